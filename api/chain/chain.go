@@ -0,0 +1,165 @@
+// Package chain wraps the Ethereum JSON-RPC calls the API makes. Everything is
+// written against the Backend interface, which both ethclient.Client and
+// go-ethereum's simulated backend satisfy, so chain code can run against a
+// local simulated chain without network access.
+package chain
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "fmt"
+    "math/big"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient"
+)
+
+// Backend is the subset of an Ethereum client the API relies on
+type Backend interface {
+    bind.ContractBackend
+    bind.DeployBackend
+    BlockNumber(ctx context.Context) (uint64, error)
+    NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+    StorageAt(ctx context.Context, account common.Address, key common.Hash, blockNumber *big.Int) ([]byte, error)
+    TransactionByHash(ctx context.Context, hash common.Hash) (*types.Transaction, bool, error)
+}
+
+// Config holds the RPC endpoint and signing key used for on-chain calls
+type Config struct {
+    RPCURL               string
+    ChainID              *big.Int
+    FreshMintAddress     common.Address
+    MinterKey            *ecdsa.PrivateKey
+    Confirmations        uint64
+    StakerAddress        common.Address
+    IndexerStartBlock    uint64
+    LevelUpAddress       common.Address
+    // StakingSource is "index" (the default) to answer staking status
+    // from indexed events, or "chain" to read NFTStaker directly
+    StakingSource        string
+    // StakingLevelInterval is how long a token must stay staked to earn its
+    // next level; NFTStaker's staking window is three hours
+    StakingLevelInterval time.Duration
+    PaymentTimeouts      PaymentTimeouts
+}
+
+// LoadConfig reads chain configuration from the environment. It returns
+// ok=false when ETH_RPC_URL is unset, so chain features can be switched off
+// in local development.
+func LoadConfig() (Config, bool, error) {
+    config := Config{
+        RPCURL:               os.Getenv("ETH_RPC_URL"),
+        Confirmations:        2,
+        StakingSource:        "index",
+        StakingLevelInterval: 3 * time.Hour,
+        PaymentTimeouts:      PaymentTimeouts{Payment: time.Hour, Transfer: 24 * time.Hour},
+    }
+    if config.RPCURL == "" {
+        return config, false, nil
+    }
+
+    chainID, ok := new(big.Int).SetString(os.Getenv("ETH_CHAIN_ID"), 10)
+    if !ok {
+        return config, false, fmt.Errorf("ETH_CHAIN_ID must be a decimal chain id")
+    }
+    config.ChainID = chainID
+
+    if address := os.Getenv("FRESHMINT_ADDRESS"); address != "" {
+        if !common.IsHexAddress(address) {
+            return config, false, fmt.Errorf("FRESHMINT_ADDRESS is not a valid address")
+        }
+        config.FreshMintAddress = common.HexToAddress(address)
+    }
+
+    if rawKey := os.Getenv("MINTER_PRIVATE_KEY"); rawKey != "" {
+        key, err := crypto.HexToECDSA(strings.TrimPrefix(rawKey, "0x"))
+        if err != nil {
+            return config, false, fmt.Errorf("MINTER_PRIVATE_KEY is invalid: %w", err)
+        }
+        config.MinterKey = key
+    }
+
+    // The key only signs mints and level-ups, so it is useless without a contract to call
+    if config.MinterKey != nil && config.FreshMintAddress == (common.Address{}) {
+        return config, false, fmt.Errorf("FRESHMINT_ADDRESS is required when MINTER_PRIVATE_KEY is set")
+    }
+
+    if address := os.Getenv("NFTSTAKER_ADDRESS"); address != "" {
+        if !common.IsHexAddress(address) {
+            return config, false, fmt.Errorf("NFTSTAKER_ADDRESS is not a valid address")
+        }
+        config.StakerAddress = common.HexToAddress(address)
+    }
+
+    if address := os.Getenv("LEVELUPNFT_ADDRESS"); address != "" {
+        if !common.IsHexAddress(address) {
+            return config, false, fmt.Errorf("LEVELUPNFT_ADDRESS is not a valid address")
+        }
+        config.LevelUpAddress = common.HexToAddress(address)
+    }
+
+    if source := os.Getenv("STAKING_STATUS_SOURCE"); source != "" {
+        if source != "index" && source != "chain" {
+            return config, false, fmt.Errorf("STAKING_STATUS_SOURCE must be index or chain")
+        }
+        config.StakingSource = source
+    }
+
+    if interval := os.Getenv("STAKING_LEVEL_INTERVAL"); interval != "" {
+        d, err := time.ParseDuration(interval)
+        if err != nil || d <= 0 {
+            return config, false, fmt.Errorf("STAKING_LEVEL_INTERVAL must be a positive duration such as 3h")
+        }
+        config.StakingLevelInterval = d
+    }
+
+    if timeout := os.Getenv("PAYMENT_TIMEOUT"); timeout != "" {
+        d, err := time.ParseDuration(timeout)
+        if err != nil || d <= 0 {
+            return config, false, fmt.Errorf("PAYMENT_TIMEOUT must be a positive duration such as 1h")
+        }
+        config.PaymentTimeouts.Payment = d
+    }
+
+    if timeout := os.Getenv("TRANSFER_TIMEOUT"); timeout != "" {
+        d, err := time.ParseDuration(timeout)
+        if err != nil || d <= 0 {
+            return config, false, fmt.Errorf("TRANSFER_TIMEOUT must be a positive duration such as 24h")
+        }
+        config.PaymentTimeouts.Transfer = d
+    }
+
+    if startBlock := os.Getenv("INDEXER_START_BLOCK"); startBlock != "" {
+        n, err := strconv.ParseUint(startBlock, 10, 64)
+        if err != nil {
+            return config, false, fmt.Errorf("INDEXER_START_BLOCK must be a number: %w", err)
+        }
+        config.IndexerStartBlock = n
+    }
+
+    if confirmations := os.Getenv("MINT_CONFIRMATIONS"); confirmations != "" {
+        n, err := strconv.ParseUint(confirmations, 10, 64)
+        if err != nil {
+            return config, false, fmt.Errorf("MINT_CONFIRMATIONS must be a number: %w", err)
+        }
+        config.Confirmations = n
+    }
+
+    return config, true, nil
+}
+
+// Dial connects to the configured JSON-RPC endpoint
+func Dial(ctx context.Context, config Config) (*ethclient.Client, error) {
+    client, err := ethclient.DialContext(ctx, config.RPCURL)
+    if err != nil {
+        return nil, fmt.Errorf("failed to dial %s: %w", config.RPCURL, err)
+    }
+    return client, nil
+}
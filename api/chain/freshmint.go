@@ -0,0 +1,137 @@
+package chain
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+)
+
+// freshMintABI covers the parts of FreshMint.sol the API calls
+const freshMintABI = `[
+    {"type":"function","name":"mintNFT","stateMutability":"nonpayable",
+     "inputs":[{"name":"recipient","type":"address"},{"name":"tokenURI","type":"string"}],
+     "outputs":[{"name":"","type":"uint256"}]},
+    {"type":"event","name":"Transfer","anonymous":false,
+     "inputs":[{"name":"from","type":"address","indexed":true},
+               {"name":"to","type":"address","indexed":true},
+               {"name":"tokenId","type":"uint256","indexed":true}]}
+]`
+
+// MintReceipt is the outcome of a mined mintNFT transaction
+type MintReceipt struct {
+    TxReceipt
+    TokenID *big.Int
+}
+
+// Minter mints FreshMint tokens. Building and sending are separate steps so
+// callers can persist the transaction hash before it is broadcast.
+type Minter interface {
+    ContractAddress() common.Address
+    // BuildMint signs a mintNFT transaction without sending it
+    BuildMint(ctx context.Context, recipient common.Address, tokenURI string) (*types.Transaction, error)
+    // Release hands back the nonce of a built transaction that will never be sent
+    Release(nonce uint64)
+    // Send broadcasts a signed transaction; rebroadcasting a known one is not an error
+    Send(ctx context.Context, tx *types.Transaction) error
+    // Dropped reports whether a transaction without a receipt can no longer be mined
+    Dropped(ctx context.Context, tx *types.Transaction) (bool, error)
+    // MintReceipt returns nil while the transaction is still pending
+    MintReceipt(ctx context.Context, txHash common.Hash) (*MintReceipt, error)
+    BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// FreshMint is a Minter backed by a deployed FreshMint contract
+type FreshMint struct {
+    address  common.Address
+    abi      abi.ABI
+    backend  Backend
+    contract *bind.BoundContract
+    signer   *Signer
+}
+
+// NewFreshMint binds the FreshMint contract at address, sending through signer
+func NewFreshMint(backend Backend, address common.Address, signer *Signer) (*FreshMint, error) {
+    parsed, err := abi.JSON(strings.NewReader(freshMintABI))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse FreshMint ABI: %w", err)
+    }
+
+    return &FreshMint{
+        address:  address,
+        abi:      parsed,
+        backend:  backend,
+        contract: bind.NewBoundContract(address, parsed, backend, backend, backend),
+        signer:   signer,
+    }, nil
+}
+
+func (f *FreshMint) ContractAddress() common.Address {
+    return f.address
+}
+
+func (f *FreshMint) BuildMint(ctx context.Context, recipient common.Address, tokenURI string) (*types.Transaction, error) {
+    opts, err := f.signer.TransactOpts(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    tx, err := f.contract.Transact(opts, "mintNFT", recipient, tokenURI)
+    if err != nil {
+        f.signer.Release(opts.Nonce.Uint64())
+        return nil, fmt.Errorf("failed to build mintNFT transaction: %w", err)
+    }
+    return tx, nil
+}
+
+func (f *FreshMint) Release(nonce uint64) {
+    f.signer.Release(nonce)
+}
+
+func (f *FreshMint) Send(ctx context.Context, tx *types.Transaction) error {
+    return f.signer.Send(ctx, tx)
+}
+
+func (f *FreshMint) Dropped(ctx context.Context, tx *types.Transaction) (bool, error) {
+    return f.signer.Dropped(ctx, tx)
+}
+
+func (f *FreshMint) MintReceipt(ctx context.Context, txHash common.Hash) (*MintReceipt, error) {
+    receipt, err := f.backend.TransactionReceipt(ctx, txHash)
+    if errors.Is(err, ethereum.NotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch receipt for %s: %w", txHash.Hex(), err)
+    }
+
+    result := &MintReceipt{TxReceipt: TxReceipt{
+        Success:     receipt.Status == types.ReceiptStatusSuccessful,
+        BlockNumber: receipt.BlockNumber.Uint64(),
+    }}
+
+    // The minted token ID is the one transferred from the zero address
+    transferID := f.abi.Events["Transfer"].ID
+    for _, log := range receipt.Logs {
+        if log.Address != f.address || len(log.Topics) != 4 || log.Topics[0] != transferID {
+            continue
+        }
+        if common.BytesToAddress(log.Topics[1].Bytes()) == (common.Address{}) {
+            result.TokenID = log.Topics[3].Big()
+            break
+        }
+    }
+
+    return result, nil
+}
+
+func (f *FreshMint) BlockNumber(ctx context.Context) (uint64, error) {
+    return f.backend.BlockNumber(ctx)
+}
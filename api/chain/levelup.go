@@ -0,0 +1,130 @@
+package chain
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+)
+
+// levelUpNFTABI covers the parts of LevelUpNFT.sol the API calls
+const levelUpNFTABI = `[
+    {"type":"function","name":"getTokenLevel","stateMutability":"view",
+     "inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+    {"type":"function","name":"incrementTokenLevel","stateMutability":"nonpayable",
+     "inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[]}
+]`
+
+// TxReceipt is the outcome of a mined transaction
+type TxReceipt struct {
+    Success     bool
+    BlockNumber uint64
+}
+
+// Leveler raises token levels on a LevelUpNFT contract. As with Minter,
+// building and sending are separate so the transaction can be stored first.
+type Leveler interface {
+    ContractAddress() common.Address
+    // TokenLevel reads a token's current on-chain level
+    TokenLevel(ctx context.Context, tokenID *big.Int) (uint64, error)
+    // BuildIncrement signs an incrementTokenLevel transaction without sending it
+    BuildIncrement(ctx context.Context, tokenID *big.Int) (*types.Transaction, error)
+    // Release hands back the nonce of a built transaction that will never be sent
+    Release(nonce uint64)
+    // Send broadcasts a signed transaction; rebroadcasting a known one is not an error
+    Send(ctx context.Context, tx *types.Transaction) error
+    // Dropped reports whether a transaction without a receipt can no longer be mined
+    Dropped(ctx context.Context, tx *types.Transaction) (bool, error)
+    // Receipt returns nil while the transaction is still pending
+    Receipt(ctx context.Context, txHash common.Hash) (*TxReceipt, error)
+    BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// LevelUpNFT is a Leveler backed by a deployed LevelUpNFT contract. The
+// contract only lets the owner or an approved operator increment a level, so
+// the signing key must be approved for the tokens it levels.
+type LevelUpNFT struct {
+    address  common.Address
+    backend  Backend
+    contract *bind.BoundContract
+    signer   *Signer
+}
+
+// NewLevelUpNFT binds the LevelUpNFT contract at address, sending through signer
+func NewLevelUpNFT(backend Backend, address common.Address, signer *Signer) (*LevelUpNFT, error) {
+    parsed, err := abi.JSON(strings.NewReader(levelUpNFTABI))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse LevelUpNFT ABI: %w", err)
+    }
+
+    return &LevelUpNFT{
+        address:  address,
+        backend:  backend,
+        contract: bind.NewBoundContract(address, parsed, backend, backend, backend),
+        signer:   signer,
+    }, nil
+}
+
+func (l *LevelUpNFT) ContractAddress() common.Address {
+    return l.address
+}
+
+func (l *LevelUpNFT) TokenLevel(ctx context.Context, tokenID *big.Int) (uint64, error) {
+    var out []interface{}
+    if err := l.contract.Call(&bind.CallOpts{Context: ctx}, &out, "getTokenLevel", tokenID); err != nil {
+        return 0, fmt.Errorf("failed to read level of token %s: %w", tokenID, err)
+    }
+    return (*abi.ConvertType(out[0], new(*big.Int)).(**big.Int)).Uint64(), nil
+}
+
+func (l *LevelUpNFT) BuildIncrement(ctx context.Context, tokenID *big.Int) (*types.Transaction, error) {
+    opts, err := l.signer.TransactOpts(ctx)
+    if err != nil {
+        return nil, err
+    }
+
+    tx, err := l.contract.Transact(opts, "incrementTokenLevel", tokenID)
+    if err != nil {
+        l.signer.Release(opts.Nonce.Uint64())
+        return nil, fmt.Errorf("failed to build incrementTokenLevel transaction: %w", err)
+    }
+    return tx, nil
+}
+
+func (l *LevelUpNFT) Release(nonce uint64) {
+    l.signer.Release(nonce)
+}
+
+func (l *LevelUpNFT) Send(ctx context.Context, tx *types.Transaction) error {
+    return l.signer.Send(ctx, tx)
+}
+
+func (l *LevelUpNFT) Dropped(ctx context.Context, tx *types.Transaction) (bool, error) {
+    return l.signer.Dropped(ctx, tx)
+}
+
+func (l *LevelUpNFT) Receipt(ctx context.Context, txHash common.Hash) (*TxReceipt, error) {
+    receipt, err := l.backend.TransactionReceipt(ctx, txHash)
+    if errors.Is(err, ethereum.NotFound) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch receipt for %s: %w", txHash.Hex(), err)
+    }
+
+    return &TxReceipt{
+        Success:     receipt.Status == types.ReceiptStatusSuccessful,
+        BlockNumber: receipt.BlockNumber.Uint64(),
+    }, nil
+}
+
+func (l *LevelUpNFT) BlockNumber(ctx context.Context) (uint64, error) {
+    return l.backend.BlockNumber(ctx)
+}
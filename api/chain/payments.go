@@ -0,0 +1,203 @@
+package chain
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "math/big"
+    "time"
+
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+    // ErrPaymentPending means the transaction is unknown, unmined or not yet
+    // confirmed deeply enough. The caller should check again later.
+    ErrPaymentPending = errors.New("payment not yet confirmed")
+    // ErrPaymentUnmined is the ErrPaymentPending of a transaction the node
+    // does not know or has not mined, as opposed to one still confirming
+    ErrPaymentUnmined = fmt.Errorf("%w: transaction is unknown or not yet mined", ErrPaymentPending)
+    // ErrPaymentInvalid means the transaction can never satisfy the payment
+    ErrPaymentInvalid = errors.New("payment transaction does not match the order")
+    // ErrTransferNotFound means a mined transaction holds no matching token transfer
+    ErrTransferNotFound = errors.New("token transfer not found in transaction")
+)
+
+// NativeCurrency is the only currency NativePayments can settle
+const NativeCurrency = "ETH"
+
+// PaymentTimeouts bound how long a pending purchase or rental waits on chain.
+// Payment is how long a submitted payment may stay unknown or unmined;
+// Transfer is how long after the payment was submitted the seller has to
+// move the token. Once either passes the order fails and is relisted.
+type PaymentTimeouts struct {
+    Payment  time.Duration
+    Transfer time.Duration
+}
+
+// transferEventID is the topic of ERC-721 Transfer(address,address,uint256)
+var transferEventID = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+
+// Payment describes the transfer a purchase expects to find on chain
+type Payment struct {
+    TxHash common.Hash
+    From   common.Address
+    To     common.Address
+    Amount *big.Int // in wei
+    // NotBefore rejects transactions mined before it, such as an old
+    // transfer reused for a new order; zero skips the check
+    NotBefore time.Time
+}
+
+// TokenTransfer describes the ERC-721 transfer a sale expects to find on chain
+type TokenTransfer struct {
+    TxHash    common.Hash
+    Contract  common.Address
+    From      common.Address
+    To        common.Address
+    TokenID   *big.Int
+    NotBefore time.Time
+}
+
+// PaymentReceipt is the on-chain evidence for a verified payment
+type PaymentReceipt struct {
+    TxHash      common.Hash
+    BlockNumber uint64
+    Amount      *big.Int
+}
+
+// PaymentVerifier checks a purchase's payment transaction. Implementations
+// return ErrPaymentPending, ErrPaymentUnmined or ErrPaymentInvalid (possibly
+// wrapped) when the payment does not verify.
+type PaymentVerifier interface {
+    VerifyPayment(ctx context.Context, payment Payment) (*PaymentReceipt, error)
+    // VerifyTransfer checks that a confirmed transaction moved the token;
+    // a mined transaction without the transfer returns ErrTransferNotFound
+    VerifyTransfer(ctx context.Context, transfer TokenTransfer) (*PaymentReceipt, error)
+}
+
+// NativePayments verifies plain ETH transfers from the buyer to the seller
+type NativePayments struct {
+    backend       Backend
+    signer        types.Signer
+    confirmations uint64
+}
+
+func NewNativePayments(backend Backend, chainID *big.Int, confirmations uint64) *NativePayments {
+    return &NativePayments{
+        backend:       backend,
+        signer:        types.LatestSignerForChainID(chainID),
+        confirmations: confirmations,
+    }
+}
+
+func (p *NativePayments) VerifyPayment(ctx context.Context, payment Payment) (*PaymentReceipt, error) {
+    tx, isPending, err := p.backend.TransactionByHash(ctx, payment.TxHash)
+    if errors.Is(err, ethereum.NotFound) {
+        return nil, ErrPaymentUnmined
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch transaction %s: %w", payment.TxHash.Hex(), err)
+    }
+
+    sender, err := types.Sender(p.signer, tx)
+    if err != nil {
+        return nil, fmt.Errorf("%w: cannot recover sender: %v", ErrPaymentInvalid, err)
+    }
+    if sender != payment.From {
+        return nil, fmt.Errorf("%w: sent from %s, expected %s", ErrPaymentInvalid, sender.Hex(), payment.From.Hex())
+    }
+    if tx.To() == nil || *tx.To() != payment.To {
+        return nil, fmt.Errorf("%w: not sent to %s", ErrPaymentInvalid, payment.To.Hex())
+    }
+    if tx.Value().Cmp(payment.Amount) < 0 {
+        return nil, fmt.Errorf("%w: paid %s wei, expected %s", ErrPaymentInvalid, tx.Value(), payment.Amount)
+    }
+    if isPending {
+        return nil, ErrPaymentUnmined
+    }
+
+    receipt, err := p.confirmedReceipt(ctx, payment.TxHash, payment.NotBefore)
+    if err != nil {
+        return nil, err
+    }
+
+    return &PaymentReceipt{
+        TxHash:      payment.TxHash,
+        BlockNumber: receipt.BlockNumber.Uint64(),
+        Amount:      tx.Value(),
+    }, nil
+}
+
+func (p *NativePayments) VerifyTransfer(ctx context.Context, transfer TokenTransfer) (*PaymentReceipt, error) {
+    receipt, err := p.confirmedReceipt(ctx, transfer.TxHash, transfer.NotBefore)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, log := range receipt.Logs {
+        if log.Address != transfer.Contract || len(log.Topics) != 4 || log.Topics[0] != transferEventID {
+            continue
+        }
+        if common.BytesToAddress(log.Topics[1].Bytes()) == transfer.From &&
+            common.BytesToAddress(log.Topics[2].Bytes()) == transfer.To &&
+            log.Topics[3].Big().Cmp(transfer.TokenID) == 0 {
+            return &PaymentReceipt{TxHash: transfer.TxHash, BlockNumber: receipt.BlockNumber.Uint64()}, nil
+        }
+    }
+
+    return nil, fmt.Errorf("%w: token %s was not sent from %s to %s", ErrTransferNotFound, transfer.TokenID, transfer.From.Hex(), transfer.To.Hex())
+}
+
+// confirmedReceipt returns the receipt of a successful transaction with
+// enough confirmations that was mined no earlier than notBefore
+func (p *NativePayments) confirmedReceipt(ctx context.Context, txHash common.Hash, notBefore time.Time) (*types.Receipt, error) {
+    receipt, err := p.backend.TransactionReceipt(ctx, txHash)
+    if errors.Is(err, ethereum.NotFound) {
+        return nil, ErrPaymentUnmined
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch receipt for %s: %w", txHash.Hex(), err)
+    }
+    if receipt.Status != types.ReceiptStatusSuccessful {
+        return nil, fmt.Errorf("%w: transaction reverted", ErrPaymentInvalid)
+    }
+
+    head, err := p.backend.BlockNumber(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch block number: %w", err)
+    }
+    block := receipt.BlockNumber.Uint64()
+    if head < block || head-block+1 < p.confirmations {
+        return nil, ErrPaymentPending
+    }
+
+    if !notBefore.IsZero() {
+        header, err := p.backend.HeaderByNumber(ctx, receipt.BlockNumber)
+        if err != nil {
+            return nil, fmt.Errorf("failed to fetch block %d: %w", block, err)
+        }
+        if minedAt := time.Unix(int64(header.Time), 0); minedAt.Before(notBefore) {
+            return nil, fmt.Errorf("%w: mined at %s, before the order was placed", ErrPaymentInvalid, minedAt.UTC().Format(time.RFC3339))
+        }
+    }
+
+    return receipt, nil
+}
+
+// EtherToWei converts a decimal ether amount such as "0.25" to wei
+func EtherToWei(amount string) (*big.Int, error) {
+    value, ok := new(big.Rat).SetString(amount)
+    if !ok || value.Sign() < 0 {
+        return nil, fmt.Errorf("invalid ether amount %q", amount)
+    }
+
+    wei := value.Mul(value, new(big.Rat).SetInt(big.NewInt(1e18)))
+    if !wei.IsInt() {
+        return nil, fmt.Errorf("ether amount %q has more than 18 decimals", amount)
+    }
+    return wei.Num(), nil
+}
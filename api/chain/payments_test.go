@@ -0,0 +1,92 @@
+package chain
+
+import (
+    "context"
+    "errors"
+    "math/big"
+    "testing"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient/simulated"
+    "github.com/ethereum/go-ethereum/params"
+)
+
+// mockMintCode is runtime code that emits Transfer(0, calldata[4:36], n) for
+// the nth call
+var mockMintCode = common.FromHex("60005460010180600055806004356000" +
+    "7f" + "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" +
+    "60006000a460005260206000f3")
+
+func TestVerifyTransfer(t *testing.T) {
+    ctx := context.Background()
+    key, err := crypto.GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    from := crypto.PubkeyToAddress(key.PublicKey)
+    backend := simulated.NewBackend(types.GenesisAlloc{from: {Balance: big.NewInt(params.Ether)}})
+    defer backend.Close()
+    client := backend.Client()
+
+    chainID, err := client.ChainID(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    signer := types.LatestSignerForChainID(chainID)
+    gasPrice, err := client.SuggestGasPrice(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    send := func(nonce uint64, to *common.Address, data []byte) common.Hash {
+        t.Helper()
+        tx := types.NewTx(&types.LegacyTx{Nonce: nonce, To: to, Gas: 200_000, GasPrice: gasPrice, Data: data})
+        signed, err := types.SignTx(tx, signer, key)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := client.SendTransaction(ctx, signed); err != nil {
+            t.Fatal(err)
+        }
+        backend.Commit()
+        return signed.Hash()
+    }
+
+    initCode := append([]byte{0x60, byte(len(mockMintCode)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, mockMintCode...)
+    deployHash := send(0, nil, initCode)
+    receipt, err := client.TransactionReceipt(ctx, deployHash)
+    if err != nil {
+        t.Fatal(err)
+    }
+    contract := receipt.ContractAddress
+
+    buyer := common.HexToAddress("0xb0b")
+    mintHash := send(1, &contract, append(common.FromHex("0x00000000"), common.LeftPadBytes(buyer.Bytes(), 32)...))
+
+    payments := NewNativePayments(client, chainID, 1)
+    transfer := TokenTransfer{TxHash: mintHash, Contract: contract, To: buyer, TokenID: big.NewInt(1)}
+    if _, err := payments.VerifyTransfer(ctx, transfer); err != nil {
+        t.Fatalf("transfer not verified: %v", err)
+    }
+
+    wrongToken := transfer
+    wrongToken.TokenID = big.NewInt(2)
+    if _, err := payments.VerifyTransfer(ctx, wrongToken); !errors.Is(err, ErrTransferNotFound) {
+        t.Fatalf("wrong token: err = %v, want ErrTransferNotFound", err)
+    }
+
+    wrongSender := transfer
+    wrongSender.From = from
+    if _, err := payments.VerifyTransfer(ctx, wrongSender); !errors.Is(err, ErrTransferNotFound) {
+        t.Fatalf("wrong sender: err = %v, want ErrTransferNotFound", err)
+    }
+
+    // A transfer mined before the order existed cannot settle it
+    stale := transfer
+    stale.NotBefore = time.Now().Add(time.Hour)
+    if _, err := payments.VerifyTransfer(ctx, stale); !errors.Is(err, ErrPaymentInvalid) {
+        t.Fatalf("stale transfer: err = %v, want ErrPaymentInvalid", err)
+    }
+}
@@ -0,0 +1,126 @@
+package chain
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+    "sync"
+
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+)
+
+// Signer signs and sends transactions for one key on behalf of every contract
+// binding that uses it. Nonces come from a single counter, so the mint and
+// level-up workers never build two transactions with the same nonce.
+type Signer struct {
+    backend Backend
+    opts    *bind.TransactOpts
+
+    mu     sync.Mutex
+    next   uint64
+    synced bool
+}
+
+// NewSigner creates a signer for key on the chain chainID
+func NewSigner(backend Backend, key *ecdsa.PrivateKey, chainID *big.Int) (*Signer, error) {
+    opts, err := bind.NewKeyedTransactorWithChainID(key, chainID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create transactor: %w", err)
+    }
+    return &Signer{backend: backend, opts: opts}, nil
+}
+
+// Address is the account the signer sends from
+func (s *Signer) Address() common.Address {
+    return s.opts.From
+}
+
+// TransactOpts returns options that sign a transaction with the next nonce
+// without sending it
+func (s *Signer) TransactOpts(ctx context.Context) (*bind.TransactOpts, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    // The node's pending nonce wins when it is ahead, e.g. after another
+    // process sent from the same account
+    pending, err := s.backend.PendingNonceAt(ctx, s.opts.From)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch pending nonce: %w", err)
+    }
+    if !s.synced || pending > s.next {
+        s.next = pending
+        s.synced = true
+    }
+
+    opts := *s.opts
+    opts.Context = ctx
+    opts.NoSend = true
+    opts.Nonce = new(big.Int).SetUint64(s.next)
+    s.next++
+    return &opts, nil
+}
+
+// Release returns the nonce of a transaction that will never reach the chain,
+// which would otherwise leave a gap no later nonce can pass. The latest nonce
+// is simply handed out again; for an older one the counter resyncs with the
+// node's pending nonce.
+func (s *Signer) Release(nonce uint64) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if s.synced && nonce+1 == s.next {
+        s.next--
+        return
+    }
+    s.synced = false
+}
+
+// Send broadcasts a signed transaction; rebroadcasting a known one is not an
+// error. A failed send keeps its nonce: callers store a transaction before
+// sending it, so it is rebroadcast later and only handed back by Dropped once
+// it can no longer be mined.
+func (s *Signer) Send(ctx context.Context, tx *types.Transaction) error {
+    err := s.backend.SendTransaction(ctx, tx)
+    if err != nil && !strings.Contains(err.Error(), "already known") {
+        return fmt.Errorf("failed to send transaction %s: %w", tx.Hash().Hex(), err)
+    }
+    return nil
+}
+
+// Dropped reports whether a sent transaction that has no receipt can no longer
+// be mined: another transaction has used its nonce, or the node has forgotten
+// it. A dropped transaction can be rebuilt without risking a second execution,
+// since the rebuilt one takes the same nonce or the old one is already void.
+func (s *Signer) Dropped(ctx context.Context, tx *types.Transaction) (bool, error) {
+    mined, err := s.backend.NonceAt(ctx, s.opts.From, nil)
+    if err != nil {
+        return false, fmt.Errorf("failed to fetch nonce: %w", err)
+    }
+    if mined > tx.Nonce() {
+        // The nonce may have gone to this very transaction since its receipt
+        // was last looked up
+        _, err := s.backend.TransactionReceipt(ctx, tx.Hash())
+        if errors.Is(err, ethereum.NotFound) {
+            return true, nil
+        }
+        if err != nil {
+            return false, fmt.Errorf("failed to fetch receipt for %s: %w", tx.Hash().Hex(), err)
+        }
+        return false, nil
+    }
+
+    _, _, err = s.backend.TransactionByHash(ctx, tx.Hash())
+    if errors.Is(err, ethereum.NotFound) {
+        s.Release(tx.Nonce())
+        return true, nil
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to look up transaction %s: %w", tx.Hash().Hex(), err)
+    }
+    return false, nil
+}
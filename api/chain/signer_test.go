@@ -0,0 +1,118 @@
+package chain
+
+import (
+    "context"
+    "errors"
+    "math/big"
+    "testing"
+
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient/simulated"
+    "github.com/ethereum/go-ethereum/params"
+)
+
+func TestSignerHandsOutDistinctNonces(t *testing.T) {
+    ctx := context.Background()
+    key, err := crypto.GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    from := crypto.PubkeyToAddress(key.PublicKey)
+    backend := simulated.NewBackend(types.GenesisAlloc{from: {Balance: big.NewInt(params.Ether)}})
+    defer backend.Close()
+    client := backend.Client()
+
+    chainID, err := client.ChainID(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    signer, err := NewSigner(client, key, chainID)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // Nothing is sent yet, so the node's pending nonce stays 0 throughout
+    nonces := map[uint64]bool{}
+    for i := 0; i < 3; i++ {
+        opts, err := signer.TransactOpts(ctx)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if nonces[opts.Nonce.Uint64()] {
+            t.Fatalf("nonce %d handed out twice", opts.Nonce.Uint64())
+        }
+        nonces[opts.Nonce.Uint64()] = true
+    }
+
+    // Releasing the latest nonce hands it out again
+    signer.Release(2)
+    opts, err := signer.TransactOpts(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if opts.Nonce.Uint64() != 2 {
+        t.Fatalf("nonce after release = %d, want 2", opts.Nonce.Uint64())
+    }
+
+    // Releasing an older one resyncs with the node
+    signer.Release(0)
+    opts, err = signer.TransactOpts(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if opts.Nonce.Uint64() != 0 {
+        t.Fatalf("nonce after resync = %d, want 0", opts.Nonce.Uint64())
+    }
+}
+
+// unreachableBackend fails every broadcast
+type unreachableBackend struct {
+    simulated.Client
+}
+
+func (b unreachableBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+    return errors.New("connection refused")
+}
+
+func TestSignerSendKeepsNonceOnFailure(t *testing.T) {
+    ctx := context.Background()
+    key, err := crypto.GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    from := crypto.PubkeyToAddress(key.PublicKey)
+    backend := simulated.NewBackend(types.GenesisAlloc{from: {Balance: big.NewInt(params.Ether)}})
+    defer backend.Close()
+    client := unreachableBackend{backend.Client()}
+
+    chainID, err := client.ChainID(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    signer, err := NewSigner(client, key, chainID)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    opts, err := signer.TransactOpts(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tx, err := opts.Signer(from, types.NewTransaction(opts.Nonce.Uint64(), from, big.NewInt(1), 21_000, big.NewInt(params.GWei), nil))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := signer.Send(ctx, tx); err == nil {
+        t.Fatal("expected the send to fail")
+    }
+
+    // The stored transaction may still be rebroadcast, so its nonce is not reused
+    opts, err = signer.TransactOpts(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if opts.Nonce.Uint64() != tx.Nonce()+1 {
+        t.Fatalf("nonce after a failed send = %d, want %d", opts.Nonce.Uint64(), tx.Nonce()+1)
+    }
+}
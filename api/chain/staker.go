@@ -0,0 +1,342 @@
+package chain
+
+import (
+    "context"
+    "fmt"
+    "math/big"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/ethereum/go-ethereum"
+    "github.com/ethereum/go-ethereum/accounts/abi"
+    "github.com/ethereum/go-ethereum/accounts/abi/bind"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+)
+
+// nftStakerABI covers the parts of NFTStaker.sol the indexer and staking
+// status reads use
+const nftStakerABI = `[
+    {"type":"function","name":"nftContract","stateMutability":"view",
+     "inputs":[],"outputs":[{"name":"","type":"address"}]},
+    {"type":"function","name":"deadline","stateMutability":"view",
+     "inputs":[],"outputs":[{"name":"","type":"uint256"}]},
+    {"type":"function","name":"completed","stateMutability":"view",
+     "inputs":[],"outputs":[{"name":"","type":"bool"}]},
+    {"type":"function","name":"stakedTokens","stateMutability":"view",
+     "inputs":[{"name":"","type":"address"},{"name":"","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+    {"type":"event","name":"NFTStaked","anonymous":false,
+     "inputs":[{"name":"staker","type":"address","indexed":true},
+               {"name":"tokenId","type":"uint256","indexed":false}]},
+    {"type":"event","name":"NFTUnstaked","anonymous":false,
+     "inputs":[{"name":"staker","type":"address","indexed":true},
+               {"name":"tokenId","type":"uint256","indexed":false}]},
+    {"type":"event","name":"LevelUp","anonymous":false,
+     "inputs":[{"name":"staker","type":"address","indexed":true},
+               {"name":"tokenId","type":"uint256","indexed":false},
+               {"name":"newLevel","type":"uint256","indexed":false}]}
+]`
+
+// Staking event kinds, as stored by the indexer
+const (
+    EventStaked   = "staked"
+    EventUnstaked = "unstaked"
+    EventLevelUp  = "level_up"
+)
+
+var stakerEventKinds = map[string]string{
+    "NFTStaked":   EventStaked,
+    "NFTUnstaked": EventUnstaked,
+    "LevelUp":     EventLevelUp,
+}
+
+// StakingEvent is a decoded NFTStaker event
+type StakingEvent struct {
+    Kind        string
+    Staker      common.Address
+    TokenID     *big.Int
+    NewLevel    uint64 // only set for EventLevelUp
+    BlockNumber uint64
+    BlockHash   common.Hash
+    TxHash      common.Hash
+    LogIndex    uint
+}
+
+// StakingEventSource is what the staking indexer reads from. NFTStaker
+// implements it against a Backend, including go-ethereum's simulated one.
+type StakingEventSource interface {
+    StakerAddress() common.Address
+    // TokenContract is the LevelUpNFT contract whose tokens are staked
+    TokenContract(ctx context.Context) (common.Address, error)
+    BlockNumber(ctx context.Context) (uint64, error)
+    // BlockHeader returns the canonical hash and timestamp of a block
+    BlockHeader(ctx context.Context, number uint64) (common.Hash, uint64, error)
+    // StakingEvents returns the decoded events in the inclusive block range
+    StakingEvents(ctx context.Context, from, to uint64) ([]StakingEvent, error)
+}
+
+// maxStakedTokens bounds how many stakedTokens entries are read for one wallet
+const maxStakedTokens = 256
+
+// stakedTokensSlot is the storage slot of NFTStaker.stakedTokens: its second
+// state variable, after nftContract (ERC721Holder declares none)
+const stakedTokensSlot = 1
+
+// StakingSchedule is when NFTStaker allows its one level-up round
+type StakingSchedule struct {
+    // Deadline is when staking closes and executeLevelUp becomes callable
+    Deadline time.Time
+    // Completed is set once a level-up has run; the contract is then frozen
+    Completed bool
+}
+
+// StakingReader reads live staking state from NFTStaker, for callers that
+// cannot wait for the indexer to catch up
+type StakingReader interface {
+    StakerAddress() common.Address
+    TokenContract(ctx context.Context) (common.Address, error)
+    // StakedTokens returns the token IDs a wallet currently has staked
+    StakedTokens(ctx context.Context, wallet common.Address) ([]*big.Int, error)
+    Schedule(ctx context.Context) (*StakingSchedule, error)
+}
+
+// NFTStaker reads events from a deployed NFTStaker contract
+type NFTStaker struct {
+    address  common.Address
+    abi      abi.ABI
+    backend  Backend
+    contract *bind.BoundContract
+}
+
+// NewNFTStaker binds the NFTStaker contract at address
+func NewNFTStaker(backend Backend, address common.Address) (*NFTStaker, error) {
+    parsed, err := abi.JSON(strings.NewReader(nftStakerABI))
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse NFTStaker ABI: %w", err)
+    }
+
+    return &NFTStaker{
+        address:  address,
+        abi:      parsed,
+        backend:  backend,
+        contract: bind.NewBoundContract(address, parsed, backend, backend, backend),
+    }, nil
+}
+
+func (s *NFTStaker) StakerAddress() common.Address {
+    return s.address
+}
+
+func (s *NFTStaker) TokenContract(ctx context.Context) (common.Address, error) {
+    var out []interface{}
+    if err := s.contract.Call(&bind.CallOpts{Context: ctx}, &out, "nftContract"); err != nil {
+        return common.Address{}, fmt.Errorf("failed to read nftContract: %w", err)
+    }
+    return *abi.ConvertType(out[0], new(common.Address)).(*common.Address), nil
+}
+
+func (s *NFTStaker) BlockNumber(ctx context.Context) (uint64, error) {
+    return s.backend.BlockNumber(ctx)
+}
+
+func (s *NFTStaker) BlockHeader(ctx context.Context, number uint64) (common.Hash, uint64, error) {
+    header, err := s.backend.HeaderByNumber(ctx, new(big.Int).SetUint64(number))
+    if err != nil {
+        return common.Hash{}, 0, fmt.Errorf("failed to fetch header %d: %w", number, err)
+    }
+    return header.Hash(), header.Time, nil
+}
+
+func (s *NFTStaker) StakingEvents(ctx context.Context, from, to uint64) ([]StakingEvent, error) {
+    topics := make([]common.Hash, 0, len(stakerEventKinds))
+    for name := range stakerEventKinds {
+        topics = append(topics, s.abi.Events[name].ID)
+    }
+
+    logs, err := s.backend.FilterLogs(ctx, ethereum.FilterQuery{
+        FromBlock: new(big.Int).SetUint64(from),
+        ToBlock:   new(big.Int).SetUint64(to),
+        Addresses: []common.Address{s.address},
+        Topics:    [][]common.Hash{topics},
+    })
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch logs %d-%d: %w", from, to, err)
+    }
+
+    events := make([]StakingEvent, 0, len(logs))
+    for _, log := range logs {
+        event, err := s.decode(log)
+        if err != nil {
+            return nil, err
+        }
+        events = append(events, event)
+    }
+    return events, nil
+}
+
+// decode turns a raw NFTStaker log into a StakingEvent
+func (s *NFTStaker) decode(log types.Log) (StakingEvent, error) {
+    if len(log.Topics) != 2 {
+        return StakingEvent{}, fmt.Errorf("unexpected topic count in log %s:%d", log.TxHash.Hex(), log.Index)
+    }
+
+    event, err := s.abi.EventByID(log.Topics[0])
+    if err != nil {
+        return StakingEvent{}, fmt.Errorf("unknown event in log %s:%d: %w", log.TxHash.Hex(), log.Index, err)
+    }
+
+    values, err := event.Inputs.NonIndexed().Unpack(log.Data)
+    if err != nil {
+        return StakingEvent{}, fmt.Errorf("failed to decode %s in log %s:%d: %w", event.Name, log.TxHash.Hex(), log.Index, err)
+    }
+
+    decoded := StakingEvent{
+        Kind:        stakerEventKinds[event.Name],
+        Staker:      common.BytesToAddress(log.Topics[1].Bytes()),
+        TokenID:     values[0].(*big.Int),
+        BlockNumber: log.BlockNumber,
+        BlockHash:   log.BlockHash,
+        TxHash:      log.TxHash,
+        LogIndex:    log.Index,
+    }
+    if decoded.Kind == EventLevelUp {
+        decoded.NewLevel = values[1].(*big.Int).Uint64()
+    }
+
+    return decoded, nil
+}
+
+func (s *NFTStaker) StakedTokens(ctx context.Context, wallet common.Address) ([]*big.Int, error) {
+    // Everything is read at one block so the length and entries agree
+    block, err := s.backend.BlockNumber(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch block number: %w", err)
+    }
+    blockNumber := new(big.Int).SetUint64(block)
+
+    // The public getter for stakedTokens takes an index and has no length, so
+    // the length is read from the array's own slot, keccak256(wallet . slot)
+    lengthSlot := crypto.Keccak256Hash(common.LeftPadBytes(wallet.Bytes(), 32), common.LeftPadBytes(big.NewInt(stakedTokensSlot).Bytes(), 32))
+    raw, err := s.backend.StorageAt(ctx, s.address, lengthSlot, blockNumber)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read stakedTokens length: %w", err)
+    }
+    length := new(big.Int).SetBytes(raw)
+    if !length.IsInt64() || length.Int64() > maxStakedTokens {
+        return nil, fmt.Errorf("wallet %s has %s staked tokens, more than the %d that are read", wallet.Hex(), length, maxStakedTokens)
+    }
+
+    tokenIDs := make([]*big.Int, 0, length.Int64())
+    for i := int64(0); i < length.Int64(); i++ {
+        var out []interface{}
+        err := s.contract.Call(&bind.CallOpts{Context: ctx, BlockNumber: blockNumber}, &out, "stakedTokens", wallet, big.NewInt(i))
+        if err != nil {
+            return nil, fmt.Errorf("failed to read stakedTokens: %w", err)
+        }
+        tokenIDs = append(tokenIDs, *abi.ConvertType(out[0], new(*big.Int)).(**big.Int))
+    }
+    return tokenIDs, nil
+}
+
+func (s *NFTStaker) Schedule(ctx context.Context) (*StakingSchedule, error) {
+    var out []interface{}
+    if err := s.contract.Call(&bind.CallOpts{Context: ctx}, &out, "deadline"); err != nil {
+        return nil, fmt.Errorf("failed to read deadline: %w", err)
+    }
+    deadline := *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+
+    out = nil
+    if err := s.contract.Call(&bind.CallOpts{Context: ctx}, &out, "completed"); err != nil {
+        return nil, fmt.Errorf("failed to read completed: %w", err)
+    }
+
+    return &StakingSchedule{
+        Deadline:  time.Unix(deadline.Int64(), 0).UTC(),
+        Completed: *abi.ConvertType(out[0], new(bool)).(*bool),
+    }, nil
+}
+
+// CachedStakingReader answers repeated staking reads from memory for ttl, so
+// polling clients do not turn into a stream of RPC calls. The token contract
+// never changes and is cached for good.
+type CachedStakingReader struct {
+    reader StakingReader
+    ttl    time.Duration
+
+    mu            sync.Mutex
+    tokenContract *common.Address
+    schedule      *StakingSchedule
+    scheduleAt    time.Time
+    staked        map[common.Address]cachedStake
+}
+
+type cachedStake struct {
+    tokenIDs []*big.Int
+    readAt   time.Time
+}
+
+// NewCachedStakingReader caches reader's results for ttl
+func NewCachedStakingReader(reader StakingReader, ttl time.Duration) *CachedStakingReader {
+    return &CachedStakingReader{reader: reader, ttl: ttl, staked: map[common.Address]cachedStake{}}
+}
+
+func (r *CachedStakingReader) StakerAddress() common.Address {
+    return r.reader.StakerAddress()
+}
+
+func (r *CachedStakingReader) TokenContract(ctx context.Context) (common.Address, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.tokenContract != nil {
+        return *r.tokenContract, nil
+    }
+
+    tokenContract, err := r.reader.TokenContract(ctx)
+    if err != nil {
+        return common.Address{}, err
+    }
+    r.tokenContract = &tokenContract
+    return tokenContract, nil
+}
+
+func (r *CachedStakingReader) StakedTokens(ctx context.Context, wallet common.Address) ([]*big.Int, error) {
+    r.mu.Lock()
+    cached, ok := r.staked[wallet]
+    r.mu.Unlock()
+    if ok && time.Since(cached.readAt) < r.ttl {
+        return cached.tokenIDs, nil
+    }
+
+    tokenIDs, err := r.reader.StakedTokens(ctx, wallet)
+    if err != nil {
+        return nil, err
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    // Drop stale entries so the cache only holds recently polled wallets
+    for address, entry := range r.staked {
+        if time.Since(entry.readAt) >= r.ttl {
+            delete(r.staked, address)
+        }
+    }
+    r.staked[wallet] = cachedStake{tokenIDs: tokenIDs, readAt: time.Now()}
+    return tokenIDs, nil
+}
+
+func (r *CachedStakingReader) Schedule(ctx context.Context) (*StakingSchedule, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.schedule != nil && time.Since(r.scheduleAt) < r.ttl {
+        return r.schedule, nil
+    }
+
+    schedule, err := r.reader.Schedule(ctx)
+    if err != nil {
+        return nil, err
+    }
+    r.schedule, r.scheduleAt = schedule, time.Now()
+    return schedule, nil
+}
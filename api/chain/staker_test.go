@@ -0,0 +1,135 @@
+package chain
+
+import (
+    "context"
+    "math/big"
+    "testing"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient/simulated"
+)
+
+// mockStakedTokensCode is runtime code answering stakedTokens(address, uint256)
+// from the storage layout solc gives NFTStaker's stakedTokens mapping
+var mockStakedTokensCode = common.FromHex("600435600052" + "6001602052" + "6040600020" + "600052" +
+    "6020600020" + "60243501" + "54" + "600052" + "60206000f3")
+
+// stakedTokensStorage lays out stakedTokens[wallet] = tokenIDs in storage
+func stakedTokensStorage(wallet common.Address, tokenIDs ...int64) map[common.Hash]common.Hash {
+    lengthSlot := crypto.Keccak256Hash(common.LeftPadBytes(wallet.Bytes(), 32), common.LeftPadBytes(big.NewInt(stakedTokensSlot).Bytes(), 32))
+    storage := map[common.Hash]common.Hash{lengthSlot: common.BigToHash(big.NewInt(int64(len(tokenIDs))))}
+
+    first := crypto.Keccak256Hash(lengthSlot.Bytes()).Big()
+    for i, tokenID := range tokenIDs {
+        slot := new(big.Int).Add(first, big.NewInt(int64(i)))
+        storage[common.BigToHash(slot)] = common.BigToHash(big.NewInt(tokenID))
+    }
+    return storage
+}
+
+func TestStakedTokensReadsArrayLength(t *testing.T) {
+    ctx := context.Background()
+    staker := common.HexToAddress("0x5a4e")
+    alice, bob := common.HexToAddress("0xa11ce"), common.HexToAddress("0xb0b")
+    backend := simulated.NewBackend(types.GenesisAlloc{
+        staker: {Code: mockStakedTokensCode, Storage: stakedTokensStorage(alice, 7, 3, 12), Balance: big.NewInt(0)},
+    })
+    defer backend.Close()
+
+    reader, err := NewNFTStaker(backend.Client(), staker)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tokenIDs, err := reader.StakedTokens(ctx, alice)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(tokenIDs) != 3 || tokenIDs[0].Int64() != 7 || tokenIDs[1].Int64() != 3 || tokenIDs[2].Int64() != 12 {
+        t.Fatalf("staked tokens = %v, want [7 3 12]", tokenIDs)
+    }
+
+    tokenIDs, err = reader.StakedTokens(ctx, bob)
+    if err != nil || len(tokenIDs) != 0 {
+        t.Fatalf("staked tokens for an empty wallet = %v, %v", tokenIDs, err)
+    }
+}
+
+func TestStakedTokensRejectsOversizedArray(t *testing.T) {
+    staker := common.HexToAddress("0x5a4e")
+    alice := common.HexToAddress("0xa11ce")
+    storage := stakedTokensStorage(alice)
+    for slot := range storage {
+        storage[slot] = common.BigToHash(big.NewInt(maxStakedTokens + 1))
+    }
+    backend := simulated.NewBackend(types.GenesisAlloc{staker: {Code: mockStakedTokensCode, Storage: storage, Balance: big.NewInt(0)}})
+    defer backend.Close()
+
+    reader, err := NewNFTStaker(backend.Client(), staker)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := reader.StakedTokens(context.Background(), alice); err == nil {
+        t.Fatal("expected an error for more staked tokens than are read")
+    }
+}
+
+// countingStakingReader counts the reads that reach it
+type countingStakingReader struct {
+    staked, schedules, tokenContracts int
+}
+
+func (r *countingStakingReader) StakerAddress() common.Address {
+    return common.HexToAddress("0x5a4e")
+}
+
+func (r *countingStakingReader) TokenContract(ctx context.Context) (common.Address, error) {
+    r.tokenContracts++
+    return common.HexToAddress("0x70ce"), nil
+}
+
+func (r *countingStakingReader) StakedTokens(ctx context.Context, wallet common.Address) ([]*big.Int, error) {
+    r.staked++
+    return []*big.Int{big.NewInt(1)}, nil
+}
+
+func (r *countingStakingReader) Schedule(ctx context.Context) (*StakingSchedule, error) {
+    r.schedules++
+    return &StakingSchedule{Deadline: time.Unix(1_700_000_000, 0)}, nil
+}
+
+func TestCachedStakingReader(t *testing.T) {
+    ctx := context.Background()
+    alice, bob := common.HexToAddress("0xa11ce"), common.HexToAddress("0xb0b")
+    inner := &countingStakingReader{}
+    reader := NewCachedStakingReader(inner, time.Hour)
+
+    for i := 0; i < 3; i++ {
+        if _, err := reader.StakedTokens(ctx, alice); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := reader.Schedule(ctx); err != nil {
+            t.Fatal(err)
+        }
+        if _, err := reader.TokenContract(ctx); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if _, err := reader.StakedTokens(ctx, bob); err != nil {
+        t.Fatal(err)
+    }
+    if inner.staked != 2 || inner.schedules != 1 || inner.tokenContracts != 1 {
+        t.Fatalf("reads reaching the chain: staked %d, schedule %d, token contract %d", inner.staked, inner.schedules, inner.tokenContracts)
+    }
+
+    // Once the ttl passes the chain is read again
+    expiring := NewCachedStakingReader(inner, 0)
+    expiring.StakedTokens(ctx, alice)
+    expiring.StakedTokens(ctx, alice)
+    if inner.staked != 4 {
+        t.Fatalf("expired entries were served from cache: %d reads", inner.staked)
+    }
+}
@@ -0,0 +1,74 @@
+// Command bootstrapadmin creates the first admin account.
+//
+//     go run ./cmd/bootstrapadmin -username alice -email alice@example.com
+//
+// The password is read from -password or BOOTSTRAP_ADMIN_PASSWORD. An existing
+// account is promoted instead of created. The command refuses to run once any
+// admin exists; further admins are granted through /api/admin/roles/grant.
+//
+// Admin and creator accounts that were self-assigned at signup through the old
+// password pattern are demoted to plain users, once, the first time the schema
+// is initialized. After upgrading a deployment whose admins all came from that
+// pattern this command can be rerun to restore one.
+package main
+
+import (
+    "errors"
+    "flag"
+    "log"
+    "os"
+
+    "github.com/joho/godotenv"
+    "shellhacks/api/database/accountdatabase"
+)
+
+func main() {
+    username := flag.String("username", "", "username of the first admin")
+    email := flag.String("email", "", "email for the account, required when it does not exist yet")
+    password := flag.String("password", os.Getenv("BOOTSTRAP_ADMIN_PASSWORD"), "password for the account, required when it does not exist yet")
+    flag.Parse()
+
+    if *username == "" {
+        log.Fatal("-username is required")
+    }
+
+    if err := godotenv.Load(); err != nil {
+        log.Fatalf("Error loading .env file: %v\n", err)
+    }
+
+    accountDB, err := accountdatabase.NewAccountDatabase(os.Getenv("ACCOUNT_DB_URL"))
+    if err != nil {
+        log.Fatalf("Unable to connect to account database: %v\n", err)
+    }
+    defer accountDB.Pool.Close()
+
+    admins, err := accountDB.CountAccountsWithRole(accountdatabase.RoleAdmin)
+    if err != nil {
+        log.Fatalf("Unable to check for existing admins: %v\n", err)
+    }
+    if admins > 0 {
+        log.Fatal("An admin already exists; grant further admins through the role-management API")
+    }
+
+    _, err = accountDB.GetUserByUsername(*username)
+    if err != nil && !errors.Is(err, accountdatabase.ErrUserNotFound) {
+        log.Fatalf("Unable to look up account: %v\n", err)
+    }
+    if err != nil {
+        if *email == "" || *password == "" {
+            log.Fatal("-email and -password are required to create a new account")
+        }
+        if err := accountDB.CreateUser(*username, *password, *email); err != nil {
+            log.Fatalf("Unable to create account: %v\n", err)
+        }
+        if err := accountDB.VerifyUserEmail(*username); err != nil {
+            log.Fatalf("Unable to verify account email: %v\n", err)
+        }
+    }
+
+    if _, err := accountDB.GrantRole(*username, accountdatabase.RoleAdmin, "bootstrap", "initial admin created from the CLI"); err != nil {
+        log.Fatalf("Unable to grant admin role: %v\n", err)
+    }
+
+    log.Printf("%s is now an admin\n", *username)
+}
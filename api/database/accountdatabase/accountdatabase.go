@@ -2,8 +2,10 @@ package accountdatabase
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -13,18 +15,13 @@ type AccountDatabase struct {
     Pool *pgxpool.Pool
 }
 
-// KYCRequest represents a KYC request structure
-type KYCRequest struct {
-    KycID        int       `json:"kyc_id"`
-    Username     string    `json:"username"`
-    FullLegalName string   `json:"full_legal_name"`
-    Address      string    `json:"address"`
-    Country      string    `json:"country"`
-    Email        string    `json:"email"`
-    PhoneNumber  string    `json:"phone_number"`
-    DateOfBirth  string    `json:"date_of_birth"`
-    CreatedAt    time.Time `json:"created_at"`
-}
+// Account types stored in accountsettings.account_type
+const (
+    RoleUser     = "user"
+    RoleCreator  = "creator"
+    RoleReviewer = "reviewer"
+    RoleAdmin    = "admin"
+)
 
 // ReleaseRequest represents a release request
 type ReleaseRequest struct {
@@ -34,6 +31,11 @@ type ReleaseRequest struct {
     ReleaseDate    time.Time
     EstimatedCount string
     ReleaseNotes   string
+    Status         string
+    // MediaThumbnail and MediaWeb reference the resized copies of image
+    // media; they are empty for video
+    MediaThumbnail string
+    MediaWeb       string
     CreatedAt      time.Time
 }
 
@@ -106,6 +108,44 @@ func InitializeAccountDatabase(pool *pgxpool.Pool) error {
         );
 
         `,
+        // kyc_pending rows are kept after a decision so the review history survives
+        `
+        ALTER TABLE kyc_pending
+            ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'submitted',
+            ADD COLUMN IF NOT EXISTS reviewed_by TEXT,
+            ADD COLUMN IF NOT EXISTS decided_at TIMESTAMP,
+            ADD COLUMN IF NOT EXISTS decline_reason TEXT,
+            ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW();
+        `,
+        `CREATE INDEX IF NOT EXISTS kyc_pending_username_idx ON kyc_pending (username);`,
+        `
+        CREATE TABLE IF NOT EXISTS kyc_events (
+            event_id SERIAL PRIMARY KEY,
+            kyc_id INT NOT NULL,
+            username TEXT NOT NULL,
+            from_status TEXT,
+            to_status TEXT NOT NULL,
+            actor TEXT NOT NULL,
+            reason TEXT,
+            created_at TIMESTAMP DEFAULT NOW()
+        );
+        `,
+        // Every signed link a reviewer was issued for a KYC document
+        `
+        CREATE TABLE IF NOT EXISTS kyc_document_access (
+            access_id SERIAL PRIMARY KEY,
+            kyc_id INT NOT NULL,
+            username TEXT NOT NULL,
+            document TEXT NOT NULL,
+            reviewer TEXT NOT NULL,
+            ip_address TEXT,
+            user_agent TEXT,
+            expires_at TIMESTAMP NOT NULL,
+            created_at TIMESTAMP DEFAULT NOW()
+        );
+        `,
+        `CREATE INDEX IF NOT EXISTS kyc_document_access_kyc_idx ON kyc_document_access (kyc_id);`,
+        `CREATE INDEX IF NOT EXISTS kyc_document_access_username_idx ON kyc_document_access (username);`,
         `
         CREATE TABLE IF NOT EXISTS creator_applications (
             application_id SERIAL PRIMARY KEY,
@@ -119,6 +159,33 @@ func InitializeAccountDatabase(pool *pgxpool.Pool) error {
         );
         `,
         `
+        ALTER TABLE creator_applications
+            ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending',
+            ADD COLUMN IF NOT EXISTS reviewed_by TEXT,
+            ADD COLUMN IF NOT EXISTS review_notes TEXT,
+            ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP;
+        `,
+        // Before the index below existed a user could open several
+        // applications; the newest stays open and the rest are superseded
+        `
+        UPDATE creator_applications c
+        SET status = 'superseded', reviewed_by = 'system',
+            review_notes = 'Superseded by a newer application', reviewed_at = NOW()
+        WHERE status IN ('pending', 'info_requested')
+          AND EXISTS (
+              SELECT 1 FROM creator_applications n
+              WHERE n.username = c.username
+                AND n.status IN ('pending', 'info_requested')
+                AND n.application_id > c.application_id
+          );
+        `,
+        // At most one open application per user
+        `
+        CREATE UNIQUE INDEX IF NOT EXISTS creator_applications_open_idx
+            ON creator_applications (username)
+            WHERE status IN ('pending', 'info_requested');
+        `,
+        `
         CREATE TABLE IF NOT EXISTS release_requests (
             release_id SERIAL PRIMARY KEY,
             username TEXT NOT NULL,
@@ -130,6 +197,31 @@ func InitializeAccountDatabase(pool *pgxpool.Pool) error {
             created_at TIMESTAMP DEFAULT NOW()
         );
         `,
+        // Approved requests are kept (not deleted) so a retried approval is a no-op
+        `
+        ALTER TABLE release_requests
+            ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'pending',
+            ADD COLUMN IF NOT EXISTS reviewed_by TEXT,
+            ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP;
+        `,
+        `
+        ALTER TABLE release_requests
+            ADD COLUMN IF NOT EXISTS media_thumbnail TEXT,
+            ADD COLUMN IF NOT EXISTS media_web TEXT;
+        `,
+        // Approvals waiting to be delivered to the NFT database's queued_mints
+        `
+        CREATE TABLE IF NOT EXISTS mint_outbox (
+            outbox_id SERIAL PRIMARY KEY,
+            release_id INT NOT NULL UNIQUE,
+            release_name TEXT NOT NULL,
+            owner_username TEXT NOT NULL,
+            attempts INT NOT NULL DEFAULT 0,
+            last_error TEXT,
+            created_at TIMESTAMP DEFAULT NOW(),
+            delivered_at TIMESTAMP
+        );
+        `,
         `
         CREATE TABLE IF NOT EXISTS transaction_history (
             transaction_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -141,6 +233,54 @@ func InitializeAccountDatabase(pool *pgxpool.Pool) error {
             status TEXT DEFAULT 'Pending...'
         );
         `,
+        // Marketplace settlements write one row per side of a trade, keyed by order
+        `
+        ALTER TABLE transaction_history
+            ADD COLUMN IF NOT EXISTS order_id INT,
+            ADD COLUMN IF NOT EXISTS tx_hash TEXT,
+            ADD COLUMN IF NOT EXISTS created_at TIMESTAMP DEFAULT NOW();
+        `,
+        `
+        CREATE UNIQUE INDEX IF NOT EXISTS transaction_history_order_side_idx
+            ON transaction_history (order_id, transaction_type) WHERE order_id IS NOT NULL;
+        `,
+        // Ledger statuses are lowercase and move through transaction_status_changes
+        `
+        ALTER TABLE transaction_history
+            ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT NOW(),
+            ALTER COLUMN status SET DEFAULT 'pending';
+        `,
+        `
+        UPDATE transaction_history SET status = CASE status
+            WHEN 'Pending...' THEN 'pending'
+            WHEN 'Completed' THEN 'confirmed'
+            WHEN 'Failed' THEN 'failed'
+            ELSE status END
+        WHERE status IN ('Pending...', 'Completed', 'Failed');
+        `,
+        `
+        CREATE INDEX IF NOT EXISTS transaction_history_client_idx
+            ON transaction_history (client_id, created_at DESC);
+        `,
+        `
+        CREATE TABLE IF NOT EXISTS transaction_status_changes (
+            change_id SERIAL PRIMARY KEY,
+            transaction_id UUID NOT NULL REFERENCES transaction_history(transaction_id),
+            from_status TEXT,
+            to_status TEXT NOT NULL,
+            changed_by TEXT NOT NULL,
+            reason TEXT,
+            changed_at TIMESTAMP DEFAULT NOW()
+        );
+        `,
+        // Rentals write one row per party and entry type, keyed by agreement
+        `
+        ALTER TABLE transaction_history ADD COLUMN IF NOT EXISTS rental_id INT;
+        `,
+        `
+        CREATE UNIQUE INDEX IF NOT EXISTS transaction_history_rental_side_idx
+            ON transaction_history (rental_id, client_id, transaction_type) WHERE rental_id IS NOT NULL;
+        `,
         `
         CREATE TABLE IF NOT EXISTS password_reset_tokens (
             token_id SERIAL PRIMARY KEY,
@@ -150,7 +290,106 @@ func InitializeAccountDatabase(pool *pgxpool.Pool) error {
             expires_at TIMESTAMP NOT NULL
         );
         `,
-        
+        `
+        CREATE TABLE IF NOT EXISTS sessions (
+            session_id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+            family_id UUID NOT NULL,
+            username TEXT NOT NULL,
+            token_hash TEXT NOT NULL UNIQUE,
+            user_agent TEXT,
+            ip_address TEXT,
+            created_at TIMESTAMP DEFAULT NOW(),
+            expires_at TIMESTAMP NOT NULL,
+            rotated_at TIMESTAMP,
+            revoked_at TIMESTAMP
+        );
+        `,
+        `CREATE INDEX IF NOT EXISTS sessions_family_id_idx ON sessions (family_id);`,
+        `CREATE INDEX IF NOT EXISTS sessions_username_idx ON sessions (username);`,
+        // Wallets are linked only after a signed Sign-In with Ethereum message
+        // proves control. accountsettings.wallet_id mirrors the primary wallet.
+        `
+        CREATE TABLE IF NOT EXISTS wallet_nonces (
+            nonce TEXT PRIMARY KEY,
+            username TEXT NOT NULL,
+            address TEXT NOT NULL,
+            message TEXT NOT NULL,
+            created_at TIMESTAMP DEFAULT NOW(),
+            expires_at TIMESTAMP NOT NULL,
+            used_at TIMESTAMP
+        );
+        `,
+        `
+        CREATE TABLE IF NOT EXISTS account_wallets (
+            wallet_id SERIAL PRIMARY KEY,
+            username TEXT NOT NULL,
+            address TEXT NOT NULL UNIQUE,
+            is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+            verified_at TIMESTAMP NOT NULL DEFAULT NOW(),
+            created_at TIMESTAMP DEFAULT NOW()
+        );
+        `,
+        `
+        CREATE UNIQUE INDEX IF NOT EXISTS account_wallets_primary_idx
+            ON account_wallets (username) WHERE is_primary;
+        `,
+        // wallet_id used to be set without any proof of control; keep it only
+        // where it names a wallet the account has since verified
+        `
+        UPDATE accountsettings a SET wallet_id = NULL
+        WHERE wallet_id IS NOT NULL
+          AND NOT EXISTS (
+              SELECT 1 FROM account_wallets w
+              WHERE w.username = a.username AND w.address = LOWER(a.wallet_id)
+          );
+        `,
+        `
+        CREATE TABLE IF NOT EXISTS role_changes (
+            change_id SERIAL PRIMARY KEY,
+            username TEXT NOT NULL,
+            old_role TEXT NOT NULL,
+            new_role TEXT NOT NULL,
+            changed_by TEXT NOT NULL,
+            reason TEXT,
+            changed_at TIMESTAMP DEFAULT NOW()
+        );
+        `,
+        `
+        CREATE TABLE IF NOT EXISTS schema_migrations (
+            name TEXT PRIMARY KEY,
+            applied_at TIMESTAMP DEFAULT NOW()
+        );
+        `,
+        // Signups used to self-assign admin or creator with an x$…x$ or c$…c$
+        // password. Every legitimate grant since goes through role_changes, so
+        // an elevated account without an audit row granting its role is demoted
+        // and the demotion recorded; rerun bootstrapadmin if no admin remains.
+        // It runs once, the first time its marker row is inserted.
+        `
+        WITH marker AS (
+            INSERT INTO schema_migrations (name) VALUES ('demote_legacy_password_roles')
+            ON CONFLICT (name) DO NOTHING
+            RETURNING name
+        ), legacy AS (
+            SELECT a.username, a.account_type
+            FROM accountsettings a
+            WHERE EXISTS (SELECT 1 FROM marker)
+              AND a.account_type IN ('admin', 'creator')
+              AND NOT EXISTS (
+                  SELECT 1 FROM role_changes r
+                  WHERE r.username = a.username AND r.new_role = a.account_type
+              )
+            FOR UPDATE OF a
+        ), demoted AS (
+            UPDATE accountsettings a SET account_type = 'user'
+            FROM legacy
+            WHERE a.username = legacy.username
+            RETURNING a.username, legacy.account_type AS old_role
+        )
+        INSERT INTO role_changes (username, old_role, new_role, changed_by, reason)
+        SELECT username, old_role, 'user', 'migration', 'role was self-assigned through the legacy password pattern'
+        FROM demoted;
+        `,
     }
 
     for _, q := range queries {
@@ -166,24 +405,17 @@ func (db *AccountDatabase) CreateUser(username, password, email string) error {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
-    // Determine account type based on password pattern
-    accountType := "user"  // Default to user
-    if len(password) > 2 && password[:2] == "x$" && password[len(password)-2:] == "x$" {
-        accountType = "admin"
-    } else if len(password) > 2 && password[:2] == "c$" && password[len(password)-2:] == "c$" {
-        accountType = "creator"
-    }
-
     hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
     if err != nil {
         return fmt.Errorf("failed to hash password: %w", err)
     }
 
+    // Every signup starts as a plain user; elevated roles are granted through the role-management API
     query := `
         INSERT INTO accountsettings (username, password, email, account_type)
         VALUES ($1, $2, $3, $4)
     `
-    _, err = db.Pool.Exec(ctx, query, username, string(hashedPassword), email, accountType)
+    _, err = db.Pool.Exec(ctx, query, username, string(hashedPassword), email, RoleUser)
     if err != nil {
         return fmt.Errorf("failed to create user: %w", err)
     }
@@ -198,10 +430,13 @@ func (db *AccountDatabase) GetUserByUsername(username string) (*User, error) {
 
     var user User
     err := db.Pool.QueryRow(ctx, `
-        SELECT account_id, username, email, password, email_verified, account_type
+        SELECT account_id, username, email, password, email_verified, account_type, wallet_id
         FROM accountsettings
         WHERE username = $1
-    `, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.AccountType)
+    `, username).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.EmailVerified, &user.AccountType, &user.WalletID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrUserNotFound
+    }
     if err != nil {
         return nil, fmt.Errorf("failed to get user by username: %w", err)
     }
@@ -247,11 +482,21 @@ func (db *AccountDatabase) VerifyUserEmail(username string) error {
     return nil
 }
 
-// UpdateAccount updates account details in the accountsettings table
+// ErrUsernameChange is returned when an account update asks for a new username
+var ErrUsernameChange = errors.New("usernames cannot be changed")
+
+// UpdateAccount updates account details in the accountsettings table. Empty
+// fields are left as they are. The username keys the account's sessions,
+// wallets, roles and ledger, so it cannot be changed; newUsername is only
+// accepted when it is empty or the current username.
 func (db *AccountDatabase) UpdateAccount(username, newUsername, newEmail, newPassword string) error {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
+    if newUsername != "" && newUsername != username {
+        return ErrUsernameChange
+    }
+
     var hashedPassword string
     if newPassword != "" {
         hp, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
@@ -263,11 +508,10 @@ func (db *AccountDatabase) UpdateAccount(username, newUsername, newEmail, newPas
 
     _, err := db.Pool.Exec(ctx, `
         UPDATE accountsettings
-        SET username = COALESCE($1, username),
-            email = COALESCE($2, email),
-            password = COALESCE(NULLIF($3, ''), password)
-        WHERE username = $4
-    `, newUsername, newEmail, hashedPassword, username)
+        SET email = COALESCE(NULLIF($1, ''), email),
+            password = COALESCE(NULLIF($2, ''), password)
+        WHERE username = $3
+    `, newEmail, hashedPassword, username)
 
     if err != nil {
         return fmt.Errorf("failed to update account: %w", err)
@@ -277,64 +521,17 @@ func (db *AccountDatabase) UpdateAccount(username, newUsername, newEmail, newPas
 }
 
 
-// AddTransaction adds a new transaction to the transaction_history table
-func (db *AccountDatabase) AddTransaction(clientID, transactionType, itemsSent, itemsReceived, notes string) error {
+// AddReleaseRequest inserts a new release request into the database.
+// mediaThumbnail and mediaWeb may be empty when the media has no resized copies.
+func (db *AccountDatabase) AddReleaseRequest(username, releaseTitle, releaseDate string, estimatedCount string, releaseNotes string, media []byte, mediaThumbnail, mediaWeb string) error {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
     query := `
-        INSERT INTO transaction_history (client_id, transaction_type, items_sent, items_received, notes, status)
-        VALUES ($1, $2, $3, $4, $5, 'Pending...')
+        INSERT INTO release_requests (username, release_title, release_date, estimated_count, release_notes, media, media_thumbnail, media_web)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''))
     `
-    _, err := db.Pool.Exec(ctx, query, clientID, transactionType, itemsSent, itemsReceived, notes)
-    if err != nil {
-        return fmt.Errorf("failed to add transaction: %w", err)
-    }
-
-    return nil
-}
-
-// AddCreatorApplication inserts a new creator application into the creator_applications table
-func (db *AccountDatabase) AddCreatorApplication(username, creatorName, website, socialMedia1, socialMedia2, reason string) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    query := `
-        INSERT INTO creator_applications (username, creator_name, website, social_media_1, social_media_2, reason)
-        VALUES ($1, $2, $3, $4, $5, $6)
-    `
-    _, err := db.Pool.Exec(ctx, query, username, creatorName, website, socialMedia1, socialMedia2, reason)
-    if err != nil {
-        return fmt.Errorf("failed to add creator application: %w", err)
-    }
-
-    return nil
-}
-
-// Add or Update the Wallet ID for a User
-func (db *AccountDatabase) UpdateWalletID(username, walletID string) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    query := `UPDATE accountsettings SET wallet_id = $1 WHERE username = $2`
-    _, err := db.Pool.Exec(ctx, query, walletID, username)
-    if err != nil {
-        return fmt.Errorf("failed to update wallet ID: %w", err)
-    }
-
-    return nil
-}
-
-// AddReleaseRequest inserts a new release request into the database
-func (db *AccountDatabase) AddReleaseRequest(username, releaseTitle, releaseDate string, estimatedCount string, releaseNotes string, media []byte) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    query := `
-        INSERT INTO release_requests (username, release_title, release_date, estimated_count, release_notes, media)
-        VALUES ($1, $2, $3, $4, $5, $6)
-    `
-    _, err := db.Pool.Exec(ctx, query, username, releaseTitle, releaseDate, estimatedCount, releaseNotes, media)
+    _, err := db.Pool.Exec(ctx, query, username, releaseTitle, releaseDate, estimatedCount, releaseNotes, media, mediaThumbnail, mediaWeb)
     if err != nil {
         return fmt.Errorf("failed to add release request: %w", err)
     }
@@ -347,8 +544,11 @@ func (db *AccountDatabase) GetReleaseRequests() ([]ReleaseRequest, error) {
     defer cancel()
 
     rows, err := db.Pool.Query(ctx, `
-        SELECT release_id, username, release_title, release_date, estimated_count, release_notes, created_at
+        SELECT release_id, username, release_title, release_date, estimated_count, release_notes, status,
+               COALESCE(media_thumbnail, ''), COALESCE(media_web, ''), created_at
         FROM release_requests
+        WHERE status = 'pending'
+        ORDER BY created_at ASC
     `)
     if err != nil {
         return nil, fmt.Errorf("failed to retrieve release requests: %w", err)
@@ -358,7 +558,7 @@ func (db *AccountDatabase) GetReleaseRequests() ([]ReleaseRequest, error) {
     var releaseRequests []ReleaseRequest
     for rows.Next() {
         var request ReleaseRequest
-        if err := rows.Scan(&request.ReleaseID, &request.Username, &request.ReleaseTitle, &request.ReleaseDate, &request.EstimatedCount, &request.ReleaseNotes, &request.CreatedAt); err != nil {
+        if err := rows.Scan(&request.ReleaseID, &request.Username, &request.ReleaseTitle, &request.ReleaseDate, &request.EstimatedCount, &request.ReleaseNotes, &request.Status, &request.MediaThumbnail, &request.MediaWeb, &request.CreatedAt); err != nil {
             return nil, fmt.Errorf("failed to scan release request: %w", err)
         }
         releaseRequests = append(releaseRequests, request)
@@ -386,10 +586,14 @@ func (db *AccountDatabase) GetReleaseRequestByID(releaseID int) (*ReleaseRequest
 
     var request ReleaseRequest
     err := db.Pool.QueryRow(ctx, `
-        SELECT release_id, username, release_title, release_date, estimated_count, release_notes, created_at
+        SELECT release_id, username, release_title, release_date, estimated_count, release_notes, status,
+               COALESCE(media_thumbnail, ''), COALESCE(media_web, ''), created_at
         FROM release_requests
         WHERE release_id = $1
-    `, releaseID).Scan(&request.ReleaseID, &request.Username, &request.ReleaseTitle, &request.ReleaseDate, &request.EstimatedCount, &request.ReleaseNotes, &request.CreatedAt)
+    `, releaseID).Scan(&request.ReleaseID, &request.Username, &request.ReleaseTitle, &request.ReleaseDate, &request.EstimatedCount, &request.ReleaseNotes, &request.Status, &request.MediaThumbnail, &request.MediaWeb, &request.CreatedAt)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil // Release request not found
+    }
     if err != nil {
         return nil, fmt.Errorf("failed to get release request by id: %w", err)
     }
@@ -397,6 +601,80 @@ func (db *AccountDatabase) GetReleaseRequestByID(releaseID int) (*ReleaseRequest
     return &request, nil
 }
 
+// GetReleaseMedia returns the stored media reference for a release request
+func (db *AccountDatabase) GetReleaseMedia(releaseID int) (string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var media []byte
+    err := db.Pool.QueryRow(ctx, `SELECT media FROM release_requests WHERE release_id = $1`, releaseID).Scan(&media)
+    if err != nil {
+        return "", fmt.Errorf("failed to get release media: %w", err)
+    }
+
+    return string(media), nil
+}
+
+// ReleaseVariants are the stored references of a release's resized images
+type ReleaseVariants struct {
+    Thumbnail string
+    Web       string
+}
+
+// GetReleaseVariants returns the image variants of those of releaseIDs that
+// are approved and have them
+func (db *AccountDatabase) GetReleaseVariants(releaseIDs []int) (map[int]ReleaseVariants, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT release_id, COALESCE(media_thumbnail, ''), COALESCE(media_web, '')
+        FROM release_requests
+        WHERE release_id = ANY($1) AND status = $2 AND (media_thumbnail IS NOT NULL OR media_web IS NOT NULL)
+    `, releaseIDs, ReleaseApproved)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve release variants: %w", err)
+    }
+    defer rows.Close()
+
+    variants := map[int]ReleaseVariants{}
+    for rows.Next() {
+        var releaseID int
+        var release ReleaseVariants
+        if err := rows.Scan(&releaseID, &release.Thumbnail, &release.Web); err != nil {
+            return nil, fmt.Errorf("failed to scan release variants: %w", err)
+        }
+        variants[releaseID] = release
+    }
+
+    return variants, rows.Err()
+}
+
+// GetApprovedReleaseIDs lists the releases a creator has had approved
+func (db *AccountDatabase) GetApprovedReleaseIDs(username string) ([]int, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT release_id FROM release_requests WHERE username = $1 AND status = $2 ORDER BY release_id
+    `, username, ReleaseApproved)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve approved releases: %w", err)
+    }
+    defer rows.Close()
+
+    var releaseIDs []int
+    for rows.Next() {
+        var releaseID int
+        if err := rows.Scan(&releaseID); err != nil {
+            return nil, fmt.Errorf("failed to scan release id: %w", err)
+        }
+        releaseIDs = append(releaseIDs, releaseID)
+    }
+
+    return releaseIDs, rows.Err()
+}
+
 func (db *AccountDatabase) GetUserByEmail(email string) (*User, error) {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
@@ -516,105 +794,3 @@ func (db *AccountDatabase) MarkPasswordResetTokenAsUsed(tokenString string) erro
 
     return nil
 }
-
-// ApproveKYCRequest approves a KYC request and updates the accountsettings table
-func (db *AccountDatabase) ApproveKYCRequest(kycID int) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    var username, fullLegalName, address, country, email, phoneNumber, dateOfBirth string
-    var document, faceImage []byte
-
-    // Retrieve KYC request details from kyc_pending
-    err := db.Pool.QueryRow(ctx, `
-        SELECT username, full_legal_name, address, country, email, phone_number, date_of_birth, document, face_image
-        FROM kyc_pending
-        WHERE kyc_id = $1
-    `, kycID).Scan(&username, &fullLegalName, &address, &country, &email, &phoneNumber, &dateOfBirth, &document, &faceImage)
-
-    if err != nil {
-        return fmt.Errorf("failed to retrieve KYC request: %w", err)
-    }
-
-    // Update accountsettings with KYC details and set kyc_verified to true
-    _, err = db.Pool.Exec(ctx, `
-        UPDATE accountsettings
-        SET full_legal_name = $1,
-            address = $2,
-            country = $3,
-            phone_number = $4,
-            date_of_birth = $5,
-            document = $6,
-            face_image = $7,
-            kyc_verified = TRUE
-        WHERE username = $8 AND email = $9
-    `, fullLegalName, address, country, phoneNumber, dateOfBirth, document, faceImage, username, email)
-
-    if err != nil {
-        return fmt.Errorf("failed to update account settings with KYC details: %w", err)
-    }
-
-    // Delete the approved KYC request from kyc_pending
-    _, err = db.Pool.Exec(ctx, `DELETE FROM kyc_pending WHERE kyc_id = $1`, kycID)
-    if err != nil {
-        return fmt.Errorf("failed to delete KYC request: %w", err)
-    }
-
-    return nil
-}
-
-// DeclineKYCRequest declines a KYC request and deletes it from kyc_pending
-func (db *AccountDatabase) DeclineKYCRequest(kycID int) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    // Delete the KYC request
-    _, err := db.Pool.Exec(ctx, `DELETE FROM kyc_pending WHERE kyc_id = $1`, kycID)
-    if err != nil {
-        return fmt.Errorf("failed to delete KYC request: %w", err)
-    }
-
-    return nil
-}
-
-func (db *AccountDatabase) AddKYCRequest(username, fullLegalName, address, country, email, phoneNumber, dateOfBirth string, document, faceImage []byte) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    query := `
-        INSERT INTO kyc_pending (username, full_legal_name, address, country, email, phone_number, date_of_birth, document, face_image, created_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
-    `
-    _, err := db.Pool.Exec(ctx, query, username, fullLegalName, address, country, email, phoneNumber, dateOfBirth, document, faceImage)
-    if err != nil {
-        return fmt.Errorf("failed to add KYC request: %w", err)
-    }
-
-    return nil
-}
-
-// GetAllPendingKYCRequests fetches all pending KYC requests
-func (db *AccountDatabase) GetAllPendingKYCRequests() ([]KYCRequest, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
-
-    rows, err := db.Pool.Query(ctx, `
-        SELECT kyc_id, username, full_legal_name, address, country, email, phone_number, date_of_birth, created_at
-        FROM kyc_pending
-    `)
-    if err != nil {
-        return nil, fmt.Errorf("failed to retrieve KYC requests: %w", err)
-    }
-    defer rows.Close()
-
-    var kycRequests []KYCRequest
-    for rows.Next() {
-        var request KYCRequest
-        if err := rows.Scan(&request.KycID, &request.Username, &request.FullLegalName, &request.Address, &request.Country, &request.Email, &request.PhoneNumber, &request.DateOfBirth, &request.CreatedAt); err != nil {
-            return nil, fmt.Errorf("failed to scan KYC request: %w", err)
-        }
-        kycRequests = append(kycRequests, request)
-    }
-
-    return kycRequests, nil
-}
\ No newline at end of file
@@ -0,0 +1,235 @@
+package accountdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// Creator application statuses
+const (
+    ApplicationPending       = "pending"
+    ApplicationInfoRequested = "info_requested"
+    ApplicationApproved      = "approved"
+    ApplicationRejected      = "rejected"
+    // ApplicationSuperseded closes an older open application replaced by a newer one
+    ApplicationSuperseded    = "superseded"
+)
+
+var (
+    ErrApplicationNotFound = errors.New("creator application not found")
+    ErrApplicationOpen     = errors.New("user already has an open creator application")
+    ErrApplicationClosed   = errors.New("creator application has already been decided")
+    ErrAlreadyCreator      = errors.New("user is already a creator")
+)
+
+// CreatorApplication represents a row in creator_applications
+type CreatorApplication struct {
+    ApplicationID   int        `json:"application_id"`
+    Username        string     `json:"username"`
+    Email           string     `json:"-"`
+    CreatorName     string     `json:"creator_name"`
+    Website         string     `json:"website"`
+    SocialMedia1    string     `json:"social_media_1"`
+    SocialMedia2    string     `json:"social_media_2"`
+    Reason          string     `json:"reason"`
+    Status          string     `json:"status"`
+    ReviewedBy      *string    `json:"reviewed_by"`
+    ReviewNotes     *string    `json:"review_notes"`
+    ApplicationDate time.Time  `json:"application_date"`
+    ReviewedAt      *time.Time `json:"reviewed_at"`
+}
+
+// CreatorApplicationFilter narrows the review queue. Empty fields match everything.
+type CreatorApplicationFilter struct {
+    Status   string
+    Username string
+    Limit    int
+    Offset   int
+}
+
+const creatorApplicationColumns = `
+    a.application_id, a.username, COALESCE(s.email, ''), a.creator_name, a.website,
+    COALESCE(a.social_media_1, ''), COALESCE(a.social_media_2, ''), a.reason, a.status,
+    a.reviewed_by, a.review_notes, a.application_date, a.reviewed_at
+`
+
+func scanCreatorApplication(row pgx.Row) (*CreatorApplication, error) {
+    var app CreatorApplication
+    err := row.Scan(&app.ApplicationID, &app.Username, &app.Email, &app.CreatorName, &app.Website,
+        &app.SocialMedia1, &app.SocialMedia2, &app.Reason, &app.Status,
+        &app.ReviewedBy, &app.ReviewNotes, &app.ApplicationDate, &app.ReviewedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &app, nil
+}
+
+// AddCreatorApplication submits a creator application. If the user was asked
+// for more information, their open application is updated and goes back to
+// pending instead of a new one being created.
+func (db *AccountDatabase) AddCreatorApplication(username, creatorName, website, socialMedia1, socialMedia2, reason string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var accountType string
+    err := db.Pool.QueryRow(ctx, `SELECT COALESCE(account_type, '') FROM accountsettings WHERE username = $1`, username).Scan(&accountType)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return ErrUserNotFound
+    }
+    if err != nil {
+        return fmt.Errorf("failed to look up account: %w", err)
+    }
+    if accountType == RoleCreator || accountType == RoleAdmin {
+        return ErrAlreadyCreator
+    }
+
+    tag, err := db.Pool.Exec(ctx, `
+        UPDATE creator_applications
+        SET creator_name = $2, website = $3, social_media_1 = $4, social_media_2 = $5, reason = $6, status = $7
+        WHERE username = $1 AND status = $8
+    `, username, creatorName, website, socialMedia1, socialMedia2, reason, ApplicationPending, ApplicationInfoRequested)
+    if err != nil {
+        return fmt.Errorf("failed to resubmit creator application: %w", err)
+    }
+    if tag.RowsAffected() > 0 {
+        return nil
+    }
+
+    query := `
+        INSERT INTO creator_applications (username, creator_name, website, social_media_1, social_media_2, reason)
+        VALUES ($1, $2, $3, $4, $5, $6)
+    `
+    _, err = db.Pool.Exec(ctx, query, username, creatorName, website, socialMedia1, socialMedia2, reason)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return ErrApplicationOpen
+        }
+        return fmt.Errorf("failed to add creator application: %w", err)
+    }
+
+    return nil
+}
+
+// GetCreatorApplications lists applications for the review queue, oldest first
+func (db *AccountDatabase) GetCreatorApplications(filter CreatorApplicationFilter) ([]CreatorApplication, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    if filter.Limit <= 0 || filter.Limit > 100 {
+        filter.Limit = 50
+    }
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+creatorApplicationColumns+`
+        FROM creator_applications a
+        LEFT JOIN accountsettings s ON s.username = a.username
+        WHERE ($1 = '' OR a.status = $1) AND ($2 = '' OR a.username = $2)
+        ORDER BY a.application_date ASC, a.application_id ASC
+        LIMIT $3 OFFSET $4
+    `, filter.Status, filter.Username, filter.Limit, filter.Offset)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve creator applications: %w", err)
+    }
+    defer rows.Close()
+
+    applications := []CreatorApplication{}
+    for rows.Next() {
+        app, err := scanCreatorApplication(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan creator application: %w", err)
+        }
+        applications = append(applications, *app)
+    }
+
+    return applications, rows.Err()
+}
+
+// GetLatestCreatorApplication returns the user's most recent application, or nil if they never applied
+func (db *AccountDatabase) GetLatestCreatorApplication(username string) (*CreatorApplication, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    app, err := scanCreatorApplication(db.Pool.QueryRow(ctx, `
+        SELECT `+creatorApplicationColumns+`
+        FROM creator_applications a
+        LEFT JOIN accountsettings s ON s.username = a.username
+        WHERE a.username = $1
+        ORDER BY a.application_date DESC, a.application_id DESC
+        LIMIT 1
+    `, username))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get creator application: %w", err)
+    }
+
+    return app, nil
+}
+
+// DecideCreatorApplication records a reviewer's decision on an open application.
+// Approval promotes a plain user to creator in the same transaction.
+func (db *AccountDatabase) DecideCreatorApplication(applicationID int, status, reviewer, notes string) (*CreatorApplication, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var username, currentStatus string
+    err = tx.QueryRow(ctx, `
+        SELECT username, status FROM creator_applications WHERE application_id = $1 FOR UPDATE
+    `, applicationID).Scan(&username, &currentStatus)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrApplicationNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up creator application: %w", err)
+    }
+
+    if currentStatus != ApplicationPending && currentStatus != ApplicationInfoRequested {
+        return nil, ErrApplicationClosed
+    }
+
+    _, err = tx.Exec(ctx, `
+        UPDATE creator_applications
+        SET status = $2, reviewed_by = $3, review_notes = NULLIF($4, ''), reviewed_at = NOW()
+        WHERE application_id = $1
+    `, applicationID, status, reviewer, notes)
+    if err != nil {
+        return nil, fmt.Errorf("failed to update creator application: %w", err)
+    }
+
+    if status == ApplicationApproved {
+        // Only plain users are promoted; reviewers and admins keep their existing role
+        _, err := changeRoleTx(ctx, tx, username, RoleUser, RoleCreator, reviewer, fmt.Sprintf("creator application %d approved", applicationID))
+        if err != nil && !errors.Is(err, ErrRoleNotHeld) {
+            return nil, err
+        }
+    }
+
+    app, err := scanCreatorApplication(tx.QueryRow(ctx, `
+        SELECT `+creatorApplicationColumns+`
+        FROM creator_applications a
+        LEFT JOIN accountsettings s ON s.username = a.username
+        WHERE a.application_id = $1
+    `, applicationID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to reload creator application: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit creator application decision: %w", err)
+    }
+
+    return app, nil
+}
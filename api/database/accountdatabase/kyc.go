@@ -0,0 +1,429 @@
+package accountdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// KYC request statuses. A request only ever moves forward through these;
+// resubmitting after resubmission_requested creates a new request.
+const (
+    KYCSubmitted             = "submitted"
+    KYCUnderReview           = "under_review"
+    KYCApproved              = "approved"
+    KYCDeclined              = "declined"
+    KYCResubmissionRequested = "resubmission_requested"
+)
+
+// Files a KYC request carries
+const (
+    KYCDocumentFile  = "document"
+    KYCFaceImageFile = "face_image"
+)
+
+var (
+    ErrKYCNotFound          = errors.New("KYC request not found")
+    ErrKYCInvalidTransition = errors.New("KYC request cannot move to that status")
+    ErrKYCAlreadyOpen       = errors.New("user already has a KYC request in review")
+    ErrKYCAccountMissing    = errors.New("the account of the KYC request no longer exists")
+)
+
+// kycTransitions lists the statuses a request may move to from each status
+var kycTransitions = map[string][]string{
+    KYCSubmitted:   {KYCUnderReview, KYCApproved, KYCDeclined, KYCResubmissionRequested},
+    KYCUnderReview: {KYCApproved, KYCDeclined, KYCResubmissionRequested},
+}
+
+// KYCRequest represents a KYC request structure
+type KYCRequest struct {
+    KycID         int        `json:"kyc_id"`
+    Username      string     `json:"username"`
+    FullLegalName string     `json:"full_legal_name"`
+    Address       string     `json:"address"`
+    Country       string     `json:"country"`
+    Email         string     `json:"email"`
+    PhoneNumber   string     `json:"phone_number"`
+    DateOfBirth   string     `json:"date_of_birth"`
+    Status        string     `json:"status"`
+    ReviewedBy    *string    `json:"reviewed_by"`
+    DecidedAt     *time.Time `json:"decided_at"`
+    DeclineReason *string    `json:"decline_reason"`
+    CreatedAt     time.Time  `json:"created_at"`
+}
+
+// KYCEvent is one status change in a KYC request's history
+type KYCEvent struct {
+    EventID    int       `json:"event_id"`
+    KycID      int       `json:"kyc_id"`
+    FromStatus *string   `json:"from_status"`
+    ToStatus   string    `json:"to_status"`
+    Actor      string    `json:"actor"`
+    Reason     *string   `json:"reason"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// KYCDocumentAccess records a reviewer being issued a link to a KYC file
+type KYCDocumentAccess struct {
+    AccessID  int       `json:"access_id"`
+    KycID     int       `json:"kyc_id"`
+    Document  string    `json:"document"`
+    Reviewer  string    `json:"reviewer"`
+    IPAddress *string   `json:"ip_address"`
+    UserAgent *string   `json:"user_agent"`
+    ExpiresAt time.Time `json:"expires_at"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// KYCHistory is everything recorded about a user's identity verification
+type KYCHistory struct {
+    Username string              `json:"username"`
+    Requests []KYCRequest        `json:"requests"`
+    Events   []KYCEvent          `json:"events"`
+    Accesses []KYCDocumentAccess `json:"accesses"`
+}
+
+const kycRequestColumns = `
+    kyc_id, username, full_legal_name, address, country, email, phone_number, date_of_birth,
+    status, reviewed_by, decided_at, decline_reason, created_at
+`
+
+func scanKYCRequest(row pgx.Row) (*KYCRequest, error) {
+    var request KYCRequest
+    err := row.Scan(&request.KycID, &request.Username, &request.FullLegalName, &request.Address, &request.Country,
+        &request.Email, &request.PhoneNumber, &request.DateOfBirth,
+        &request.Status, &request.ReviewedBy, &request.DecidedAt, &request.DeclineReason, &request.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &request, nil
+}
+
+func (db *AccountDatabase) AddKYCRequest(username, fullLegalName, address, country, email, phoneNumber, dateOfBirth string, document, faceImage []byte) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // Serialize submissions per user so two uploads cannot both open a request
+    if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('kyc:' || $1))`, username); err != nil {
+        return fmt.Errorf("failed to lock KYC submissions: %w", err)
+    }
+
+    var open bool
+    err = tx.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM kyc_pending WHERE username = $1 AND status IN ($2, $3))
+    `, username, KYCSubmitted, KYCUnderReview).Scan(&open)
+    if err != nil {
+        return fmt.Errorf("failed to check open KYC requests: %w", err)
+    }
+    if open {
+        return ErrKYCAlreadyOpen
+    }
+
+    var kycID int
+    err = tx.QueryRow(ctx, `
+        INSERT INTO kyc_pending (username, full_legal_name, address, country, email, phone_number, date_of_birth, document, face_image, status, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NOW())
+        RETURNING kyc_id
+    `, username, fullLegalName, address, country, email, phoneNumber, dateOfBirth, document, faceImage, KYCSubmitted).Scan(&kycID)
+    if err != nil {
+        return fmt.Errorf("failed to add KYC request: %w", err)
+    }
+
+    if err := recordKYCEvent(ctx, tx, kycID, username, nil, KYCSubmitted, username, ""); err != nil {
+        return err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return fmt.Errorf("failed to commit KYC request: %w", err)
+    }
+
+    return nil
+}
+
+// GetAllPendingKYCRequests fetches all KYC requests still awaiting a decision
+func (db *AccountDatabase) GetAllPendingKYCRequests() ([]KYCRequest, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+kycRequestColumns+`
+        FROM kyc_pending
+        WHERE status IN ($1, $2)
+        ORDER BY created_at ASC
+    `, KYCSubmitted, KYCUnderReview)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC requests: %w", err)
+    }
+    defer rows.Close()
+
+    kycRequests := []KYCRequest{}
+    for rows.Next() {
+        request, err := scanKYCRequest(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan KYC request: %w", err)
+        }
+        kycRequests = append(kycRequests, *request)
+    }
+
+    return kycRequests, rows.Err()
+}
+
+// GetKYCHistory returns every KYC request a user has made and every status change on them
+func (db *AccountDatabase) GetKYCHistory(username string) (*KYCHistory, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    history := KYCHistory{Username: username, Requests: []KYCRequest{}, Events: []KYCEvent{}, Accesses: []KYCDocumentAccess{}}
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+kycRequestColumns+`
+        FROM kyc_pending
+        WHERE username = $1
+        ORDER BY created_at ASC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC requests: %w", err)
+    }
+    for rows.Next() {
+        request, err := scanKYCRequest(rows)
+        if err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan KYC request: %w", err)
+        }
+        history.Requests = append(history.Requests, *request)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC requests: %w", err)
+    }
+
+    rows, err = db.Pool.Query(ctx, `
+        SELECT event_id, kyc_id, from_status, to_status, actor, reason, created_at
+        FROM kyc_events
+        WHERE username = $1
+        ORDER BY created_at ASC, event_id ASC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC events: %w", err)
+    }
+    for rows.Next() {
+        var event KYCEvent
+        if err := rows.Scan(&event.EventID, &event.KycID, &event.FromStatus, &event.ToStatus, &event.Actor, &event.Reason, &event.CreatedAt); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan KYC event: %w", err)
+        }
+        history.Events = append(history.Events, event)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC events: %w", err)
+    }
+
+    rows, err = db.Pool.Query(ctx, `
+        SELECT access_id, kyc_id, document, reviewer, ip_address, user_agent, expires_at, created_at
+        FROM kyc_document_access
+        WHERE username = $1
+        ORDER BY created_at ASC, access_id ASC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC document access: %w", err)
+    }
+    defer rows.Close()
+    for rows.Next() {
+        var access KYCDocumentAccess
+        if err := rows.Scan(&access.AccessID, &access.KycID, &access.Document, &access.Reviewer, &access.IPAddress,
+            &access.UserAgent, &access.ExpiresAt, &access.CreatedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan KYC document access: %w", err)
+        }
+        history.Accesses = append(history.Accesses, access)
+    }
+
+    return &history, rows.Err()
+}
+
+// OpenKYCDocument returns the storage reference of one of a KYC request's
+// files, recording the reviewer's access first. document is KYCDocumentFile
+// or KYCFaceImageFile; expiresAt is when the link the reviewer gets expires.
+func (db *AccountDatabase) OpenKYCDocument(kycID int, document, reviewer, ipAddress, userAgent string, expiresAt time.Time) (string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    column := "document"
+    if document == KYCFaceImageFile {
+        column = "face_image"
+    }
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return "", fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var username string
+    var reference []byte
+    err = tx.QueryRow(ctx, `SELECT username, `+column+` FROM kyc_pending WHERE kyc_id = $1`, kycID).Scan(&username, &reference)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return "", ErrKYCNotFound
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to retrieve KYC document: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `
+        INSERT INTO kyc_document_access (kyc_id, username, document, reviewer, ip_address, user_agent, expires_at)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+    `, kycID, username, column, reviewer, ipAddress, userAgent, expiresAt.UTC())
+    if err != nil {
+        return "", fmt.Errorf("failed to record KYC document access: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return "", fmt.Errorf("failed to commit KYC document access: %w", err)
+    }
+
+    return string(reference), nil
+}
+
+// StartKYCReview marks a request as claimed by a reviewer
+func (db *AccountDatabase) StartKYCReview(kycID int, reviewer string) (*KYCRequest, error) {
+    return db.transitionKYC(kycID, KYCUnderReview, reviewer, "", nil)
+}
+
+// ApproveKYCRequest approves a KYC request and copies the verified details
+// onto the account. The account is matched by username alone, since the user
+// may have changed their email since submitting; if it is gone the approval
+// rolls back with ErrKYCAccountMissing.
+func (db *AccountDatabase) ApproveKYCRequest(kycID int, reviewer string) (*KYCRequest, error) {
+    return db.transitionKYC(kycID, KYCApproved, reviewer, "", func(ctx context.Context, tx pgx.Tx) error {
+        result, err := tx.Exec(ctx, `
+            UPDATE accountsettings a
+            SET full_legal_name = k.full_legal_name,
+                address = k.address,
+                country = k.country,
+                phone_number = k.phone_number,
+                date_of_birth = k.date_of_birth,
+                document = k.document,
+                face_image = k.face_image,
+                kyc_verified = TRUE
+            FROM kyc_pending k
+            WHERE k.kyc_id = $1 AND a.username = k.username
+        `, kycID)
+        if err != nil {
+            return fmt.Errorf("failed to update account settings with KYC details: %w", err)
+        }
+        if result.RowsAffected() != 1 {
+            return ErrKYCAccountMissing
+        }
+        return nil
+    })
+}
+
+// DeclineKYCRequest declines a KYC request, keeping it for the audit trail
+func (db *AccountDatabase) DeclineKYCRequest(kycID int, reviewer, reason string) (*KYCRequest, error) {
+    return db.transitionKYC(kycID, KYCDeclined, reviewer, reason, nil)
+}
+
+// RequestKYCResubmission closes a KYC request and asks the user to submit a new one
+func (db *AccountDatabase) RequestKYCResubmission(kycID int, reviewer, reason string) (*KYCRequest, error) {
+    return db.transitionKYC(kycID, KYCResubmissionRequested, reviewer, reason, nil)
+}
+
+// transitionKYC moves a request to status, records the event, and runs apply
+// in the same transaction so side effects commit together with the decision
+func (db *AccountDatabase) transitionKYC(kycID int, status, reviewer, reason string, apply func(ctx context.Context, tx pgx.Tx) error) (*KYCRequest, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var username, current string
+    err = tx.QueryRow(ctx, `SELECT username, status FROM kyc_pending WHERE kyc_id = $1 FOR UPDATE`, kycID).Scan(&username, &current)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrKYCNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve KYC request: %w", err)
+    }
+
+    // Repeating a decision that already happened is a no-op, so retried
+    // approvals never re-apply their side effects
+    if current == status {
+        request, err := scanKYCRequest(tx.QueryRow(ctx, `SELECT `+kycRequestColumns+` FROM kyc_pending WHERE kyc_id = $1`, kycID))
+        if err != nil {
+            return nil, fmt.Errorf("failed to reload KYC request: %w", err)
+        }
+        return request, nil
+    }
+
+    if !kycTransitionAllowed(current, status) {
+        return nil, ErrKYCInvalidTransition
+    }
+
+    decided := status != KYCUnderReview
+    _, err = tx.Exec(ctx, `
+        UPDATE kyc_pending
+        SET status = $2,
+            reviewed_by = $3,
+            decline_reason = NULLIF($4, ''),
+            decided_at = CASE WHEN $5 THEN NOW() ELSE decided_at END,
+            updated_at = NOW()
+        WHERE kyc_id = $1
+    `, kycID, status, reviewer, reason, decided)
+    if err != nil {
+        return nil, fmt.Errorf("failed to update KYC request: %w", err)
+    }
+
+    if apply != nil {
+        if err := apply(ctx, tx); err != nil {
+            return nil, err
+        }
+    }
+
+    if err := recordKYCEvent(ctx, tx, kycID, username, &current, status, reviewer, reason); err != nil {
+        return nil, err
+    }
+
+    request, err := scanKYCRequest(tx.QueryRow(ctx, `SELECT `+kycRequestColumns+` FROM kyc_pending WHERE kyc_id = $1`, kycID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to reload KYC request: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit KYC decision: %w", err)
+    }
+
+    return request, nil
+}
+
+func kycTransitionAllowed(from, to string) bool {
+    for _, allowed := range kycTransitions[from] {
+        if allowed == to {
+            return true
+        }
+    }
+    return false
+}
+
+func recordKYCEvent(ctx context.Context, tx pgx.Tx, kycID int, username string, fromStatus *string, toStatus, actor, reason string) error {
+    _, err := tx.Exec(ctx, `
+        INSERT INTO kyc_events (kyc_id, username, from_status, to_status, actor, reason)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+    `, kycID, username, fromStatus, toStatus, actor, reason)
+    if err != nil {
+        return fmt.Errorf("failed to record KYC event: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,432 @@
+package accountdatabase
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/big"
+    "regexp"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// Ledger entry types
+const (
+    TransactionPurchase         = "purchase"
+    TransactionSale             = "sale"
+    TransactionTransfer         = "transfer"
+    TransactionRentPayment      = "rent_payment"
+    TransactionRentIncome       = "rent_income"
+    TransactionCollateralRefund = "collateral_refund"
+)
+
+// Ledger entry statuses
+const (
+    TransactionPending   = "pending"
+    TransactionConfirmed = "confirmed"
+    TransactionFailed    = "failed"
+    TransactionReversed  = "reversed"
+)
+
+// Ledger item kinds
+const (
+    ItemToken    = "token"
+    ItemCurrency = "currency"
+)
+
+// transactionTransitions lists the statuses each status may move to
+var transactionTransitions = map[string][]string{
+    TransactionPending:   {TransactionConfirmed, TransactionFailed},
+    TransactionConfirmed: {TransactionReversed},
+}
+
+var (
+    ErrTransactionNotFound      = errors.New("transaction not found")
+    ErrInvalidTransactionStatus = errors.New("invalid transaction status transition")
+    ErrInvalidLedgerItem        = errors.New("invalid ledger item")
+    ErrLedgerSidesMismatch      = errors.New("settlement ledger entries are partly recorded")
+)
+
+var (
+    addressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+    txHashPattern  = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+)
+
+// LedgerItem is one thing that changed hands in a transaction: either a
+// quantity of a token or an amount of a currency
+type LedgerItem struct {
+    Kind            string `json:"kind"`
+    ContractAddress string `json:"contract_address,omitempty"`
+    TokenID         string `json:"token_id,omitempty"`
+    Quantity        int    `json:"quantity,omitempty"`
+    Currency        string `json:"currency,omitempty"`
+    Amount          string `json:"amount,omitempty"` // decimal string, e.g. "0.25"
+}
+
+// Validate checks the fields required by the item's kind
+func (item LedgerItem) Validate() error {
+    switch item.Kind {
+    case ItemToken:
+        if !addressPattern.MatchString(item.ContractAddress) {
+            return fmt.Errorf("%w: token items need a contract_address", ErrInvalidLedgerItem)
+        }
+        if _, ok := new(big.Int).SetString(item.TokenID, 10); !ok {
+            return fmt.Errorf("%w: token_id must be a decimal integer", ErrInvalidLedgerItem)
+        }
+        if item.Quantity < 1 {
+            return fmt.Errorf("%w: quantity must be at least 1", ErrInvalidLedgerItem)
+        }
+    case ItemCurrency:
+        if item.Currency == "" {
+            return fmt.Errorf("%w: currency items need a currency", ErrInvalidLedgerItem)
+        }
+        amount, ok := new(big.Rat).SetString(item.Amount)
+        if !ok || amount.Sign() <= 0 {
+            return fmt.Errorf("%w: amount must be a positive decimal", ErrInvalidLedgerItem)
+        }
+    default:
+        return fmt.Errorf("%w: kind must be %q or %q", ErrInvalidLedgerItem, ItemToken, ItemCurrency)
+    }
+    return nil
+}
+
+// TokenItem describes a single token
+func TokenItem(contractAddress, tokenID string) LedgerItem {
+    return LedgerItem{Kind: ItemToken, ContractAddress: strings.ToLower(contractAddress), TokenID: tokenID, Quantity: 1}
+}
+
+// CurrencyItem describes an amount of currency
+func CurrencyItem(currency, amount string) LedgerItem {
+    return LedgerItem{Kind: ItemCurrency, Currency: strings.ToUpper(currency), Amount: amount}
+}
+
+// LedgerEntry is a row of a user's transaction_history
+type LedgerEntry struct {
+    TransactionID   string       `json:"transaction_id"`
+    Username        string       `json:"username"`
+    TransactionType string       `json:"transaction_type"`
+    ItemsSent       []LedgerItem `json:"items_sent"`
+    ItemsReceived   []LedgerItem `json:"items_received"`
+    Notes           string       `json:"notes"`
+    Status          string       `json:"status"`
+    TxHash          *string      `json:"tx_hash"`
+    OrderID         *int         `json:"order_id"`
+    RentalID        *int         `json:"rental_id"`
+    CreatedAt       time.Time    `json:"created_at"`
+    UpdatedAt       time.Time    `json:"updated_at"`
+}
+
+// LedgerStatusChange is one status transition of a ledger entry
+type LedgerStatusChange struct {
+    FromStatus *string   `json:"from_status"`
+    ToStatus   string    `json:"to_status"`
+    ChangedBy  string    `json:"changed_by"`
+    Reason     string    `json:"reason"`
+    ChangedAt  time.Time `json:"changed_at"`
+}
+
+// NewLedgerEntry holds the fields of an entry being recorded
+type NewLedgerEntry struct {
+    Username        string
+    TransactionType string
+    ItemsSent       []LedgerItem
+    ItemsReceived   []LedgerItem
+    Notes           string
+    Status          string
+    TxHash          string
+    OrderID         *int
+    RentalID        *int
+}
+
+// Validate checks the entry's type, status, tx hash and items
+func (entry NewLedgerEntry) Validate() error {
+    switch entry.TransactionType {
+    case TransactionPurchase, TransactionSale, TransactionTransfer,
+        TransactionRentPayment, TransactionRentIncome, TransactionCollateralRefund:
+    default:
+        return fmt.Errorf("unknown transaction type %q", entry.TransactionType)
+    }
+    switch entry.Status {
+    case TransactionPending, TransactionConfirmed, TransactionFailed:
+    default:
+        return fmt.Errorf("transactions cannot be recorded as %q", entry.Status)
+    }
+    if entry.TxHash != "" && !txHashPattern.MatchString(entry.TxHash) {
+        return fmt.Errorf("tx_hash must be a 0x-prefixed transaction hash")
+    }
+    if len(entry.ItemsSent) == 0 && len(entry.ItemsReceived) == 0 {
+        return fmt.Errorf("%w: a transaction needs at least one item", ErrInvalidLedgerItem)
+    }
+    for _, item := range append(append([]LedgerItem{}, entry.ItemsSent...), entry.ItemsReceived...) {
+        if err := item.Validate(); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+const ledgerColumns = `
+    transaction_id::text, client_id, transaction_type, items_sent, items_received, COALESCE(notes, ''),
+    status, tx_hash, order_id, rental_id, COALESCE(created_at, NOW()), COALESCE(updated_at, created_at, NOW())
+`
+
+func scanLedgerEntry(row pgx.Row) (*LedgerEntry, error) {
+    var entry LedgerEntry
+    var sent, received []byte
+    err := row.Scan(&entry.TransactionID, &entry.Username, &entry.TransactionType, &sent, &received, &entry.Notes,
+        &entry.Status, &entry.TxHash, &entry.OrderID, &entry.RentalID, &entry.CreatedAt, &entry.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+
+    entry.ItemsSent = decodeLedgerItems(sent)
+    entry.ItemsReceived = decodeLedgerItems(received)
+    return &entry, nil
+}
+
+// decodeLedgerItems decodes an items column. Rows written before items were
+// typed may hold arbitrary JSON; those read back as no items.
+func decodeLedgerItems(raw []byte) []LedgerItem {
+    items := []LedgerItem{}
+    if len(raw) > 0 {
+        if err := json.Unmarshal(raw, &items); err != nil {
+            return []LedgerItem{}
+        }
+    }
+    return items
+}
+
+// recordLedgerEntryTx inserts an entry and its first status change. When the
+// entry is keyed to an order or rental and that side is already recorded it
+// returns nil, nil. Unkeyed entries have no idempotency key, so they are
+// always inserted.
+func recordLedgerEntryTx(ctx context.Context, tx pgx.Tx, entry NewLedgerEntry, changedBy string) (*LedgerEntry, error) {
+    if err := entry.Validate(); err != nil {
+        return nil, err
+    }
+
+    sent, err := json.Marshal(entry.ItemsSent)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode items sent: %w", err)
+    }
+    received, err := json.Marshal(entry.ItemsReceived)
+    if err != nil {
+        return nil, fmt.Errorf("failed to encode items received: %w", err)
+    }
+
+    // Only the side's own key may absorb a repeat; any other unique
+    // violation is an error
+    onConflict := ""
+    switch {
+    case entry.OrderID != nil:
+        onConflict = `ON CONFLICT (order_id, transaction_type) WHERE order_id IS NOT NULL DO NOTHING`
+    case entry.RentalID != nil:
+        onConflict = `ON CONFLICT (rental_id, client_id, transaction_type) WHERE rental_id IS NOT NULL DO NOTHING`
+    }
+
+    recorded, err := scanLedgerEntry(tx.QueryRow(ctx, `
+        INSERT INTO transaction_history (client_id, transaction_type, items_sent, items_received, notes, status, tx_hash, order_id, rental_id)
+        VALUES ($1, $2, $3, $4, $5, $6, NULLIF(LOWER($7), ''), $8, $9)
+        `+onConflict+`
+        RETURNING `+ledgerColumns,
+        entry.Username, entry.TransactionType, string(sent), string(received), entry.Notes, entry.Status, entry.TxHash, entry.OrderID, entry.RentalID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to record transaction: %w", err)
+    }
+
+    if _, err := tx.Exec(ctx, `
+        INSERT INTO transaction_status_changes (transaction_id, from_status, to_status, changed_by, reason)
+        VALUES ($1, NULL, $2, $3, $4)
+    `, recorded.TransactionID, recorded.Status, changedBy, entry.Notes); err != nil {
+        return nil, fmt.Errorf("failed to record transaction status: %w", err)
+    }
+
+    return recorded, nil
+}
+
+// recordLedgerSidesTx records every side of one settlement. The sides are
+// always written together, so either all of them are new or all of them were
+// recorded by an earlier attempt; a mix means the ledger already disagrees
+// with itself and nothing is written.
+func recordLedgerSidesTx(ctx context.Context, tx pgx.Tx, entries []NewLedgerEntry, changedBy string) error {
+    recorded := 0
+    for _, entry := range entries {
+        side, err := recordLedgerEntryTx(ctx, tx, entry, changedBy)
+        if err != nil {
+            return fmt.Errorf("failed to record %s: %w", entry.TransactionType, err)
+        }
+        if side != nil {
+            recorded++
+        }
+    }
+
+    if recorded != 0 && recorded != len(entries) {
+        return fmt.Errorf("%w: only %d of %d sides were new", ErrLedgerSidesMismatch, recorded, len(entries))
+    }
+    return nil
+}
+
+// RecordTransaction validates and records a ledger entry
+func (db *AccountDatabase) RecordTransaction(entry NewLedgerEntry) (*LedgerEntry, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    recorded, err := recordLedgerEntryTx(ctx, tx, entry, entry.Username)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+
+    return recorded, nil
+}
+
+// TransitionTransaction moves a ledger entry to a new status. Only the moves
+// in transactionTransitions are allowed; repeating the current status is a
+// no-op.
+func (db *AccountDatabase) TransitionTransaction(transactionID, toStatus, changedBy, reason string) (*LedgerEntry, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    entry, err := scanLedgerEntry(tx.QueryRow(ctx, `
+        SELECT `+ledgerColumns+` FROM transaction_history WHERE transaction_id::text = $1 FOR UPDATE
+    `, transactionID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrTransactionNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch transaction: %w", err)
+    }
+
+    if entry.Status == toStatus {
+        return entry, tx.Commit(ctx)
+    }
+
+    allowed := false
+    for _, next := range transactionTransitions[entry.Status] {
+        allowed = allowed || next == toStatus
+    }
+    if !allowed {
+        return nil, fmt.Errorf("%w: %s to %s", ErrInvalidTransactionStatus, entry.Status, toStatus)
+    }
+
+    updated, err := scanLedgerEntry(tx.QueryRow(ctx, `
+        UPDATE transaction_history SET status = $2, updated_at = NOW()
+        WHERE transaction_id = $1::uuid
+        RETURNING `+ledgerColumns, transactionID, toStatus))
+    if err != nil {
+        return nil, fmt.Errorf("failed to update transaction: %w", err)
+    }
+
+    if _, err := tx.Exec(ctx, `
+        INSERT INTO transaction_status_changes (transaction_id, from_status, to_status, changed_by, reason)
+        VALUES ($1, $2, $3, $4, $5)
+    `, transactionID, entry.Status, toStatus, changedBy, reason); err != nil {
+        return nil, fmt.Errorf("failed to record transaction status: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit transaction: %w", err)
+    }
+
+    return updated, nil
+}
+
+// LedgerFilter narrows a user's transaction history. Empty fields match everything.
+type LedgerFilter struct {
+    Username string
+    Status   string
+    Limit    int
+    Offset   int
+}
+
+// GetTransactions returns a page of a user's ledger, newest first, with the
+// total number of matching entries
+func (db *AccountDatabase) GetTransactions(filter LedgerFilter) ([]LedgerEntry, int, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    if filter.Limit <= 0 || filter.Limit > 100 {
+        filter.Limit = 25
+    }
+
+    var total int
+    err := db.Pool.QueryRow(ctx, `
+        SELECT COUNT(*) FROM transaction_history
+        WHERE client_id = $1 AND ($2 = '' OR status = $2)
+    `, filter.Username, filter.Status).Scan(&total)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to count transactions: %w", err)
+    }
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+ledgerColumns+`
+        FROM transaction_history
+        WHERE client_id = $1 AND ($2 = '' OR status = $2)
+        ORDER BY created_at DESC NULLS LAST, transaction_id
+        LIMIT $3 OFFSET $4
+    `, filter.Username, filter.Status, filter.Limit, filter.Offset)
+    if err != nil {
+        return nil, 0, fmt.Errorf("failed to fetch transactions: %w", err)
+    }
+    defer rows.Close()
+
+    entries := []LedgerEntry{}
+    for rows.Next() {
+        entry, err := scanLedgerEntry(rows)
+        if err != nil {
+            return nil, 0, fmt.Errorf("failed to scan transaction: %w", err)
+        }
+        entries = append(entries, *entry)
+    }
+
+    return entries, total, rows.Err()
+}
+
+// GetTransactionStatusHistory returns a ledger entry's status changes, oldest first
+func (db *AccountDatabase) GetTransactionStatusHistory(transactionID string) ([]LedgerStatusChange, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT from_status, to_status, changed_by, COALESCE(reason, ''), changed_at
+        FROM transaction_status_changes
+        WHERE transaction_id::text = $1
+        ORDER BY changed_at, change_id
+    `, transactionID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch transaction status history: %w", err)
+    }
+    defer rows.Close()
+
+    changes := []LedgerStatusChange{}
+    for rows.Next() {
+        var change LedgerStatusChange
+        if err := rows.Scan(&change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.Reason, &change.ChangedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan transaction status change: %w", err)
+        }
+        changes = append(changes, change)
+    }
+
+    return changes, rows.Err()
+}
@@ -0,0 +1,140 @@
+package accountdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// Release request statuses
+const (
+    ReleasePending  = "pending"
+    ReleaseApproved = "approved"
+)
+
+var ErrReleaseNotFound = errors.New("release request not found")
+
+// MintOutboxEntry is an approved release waiting to be queued for minting in
+// the NFT database. The account and NFT databases are separate pools, so the
+// approval and the queued mint cannot share a transaction; instead the
+// approval writes this row atomically and a relay delivers it idempotently.
+type MintOutboxEntry struct {
+    OutboxID      int
+    ReleaseID     int
+    ReleaseName   string
+    OwnerUsername string
+    Attempts      int
+}
+
+// ApproveReleaseRequest marks a release approved and writes its mint outbox
+// entry in one transaction. Approving an already approved release changes
+// nothing and reports alreadyApproved, so retries never queue a second mint.
+func (db *AccountDatabase) ApproveReleaseRequest(releaseID int, reviewer string) (alreadyApproved bool, err error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return false, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var username, title, status string
+    err = tx.QueryRow(ctx, `
+        SELECT username, release_title, status FROM release_requests WHERE release_id = $1 FOR UPDATE
+    `, releaseID).Scan(&username, &title, &status)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return false, ErrReleaseNotFound
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to retrieve release request: %w", err)
+    }
+
+    if status == ReleaseApproved {
+        return true, nil
+    }
+
+    _, err = tx.Exec(ctx, `
+        UPDATE release_requests SET status = $2, reviewed_by = $3, approved_at = NOW() WHERE release_id = $1
+    `, releaseID, ReleaseApproved, reviewer)
+    if err != nil {
+        return false, fmt.Errorf("failed to approve release request: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `
+        INSERT INTO mint_outbox (release_id, release_name, owner_username)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (release_id) DO NOTHING
+    `, releaseID, title, username)
+    if err != nil {
+        return false, fmt.Errorf("failed to write mint outbox entry: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return false, fmt.Errorf("failed to commit release approval: %w", err)
+    }
+
+    return false, nil
+}
+
+// GetUndeliveredMintOutbox returns outbox entries that have not reached queued_mints yet
+func (db *AccountDatabase) GetUndeliveredMintOutbox(limit int) ([]MintOutboxEntry, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT outbox_id, release_id, release_name, owner_username, attempts
+        FROM mint_outbox
+        WHERE delivered_at IS NULL
+        ORDER BY outbox_id ASC
+        LIMIT $1
+    `, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve mint outbox: %w", err)
+    }
+    defer rows.Close()
+
+    var entries []MintOutboxEntry
+    for rows.Next() {
+        var entry MintOutboxEntry
+        if err := rows.Scan(&entry.OutboxID, &entry.ReleaseID, &entry.ReleaseName, &entry.OwnerUsername, &entry.Attempts); err != nil {
+            return nil, fmt.Errorf("failed to scan mint outbox entry: %w", err)
+        }
+        entries = append(entries, entry)
+    }
+
+    return entries, rows.Err()
+}
+
+// MarkMintOutboxDelivered records that an entry reached queued_mints
+func (db *AccountDatabase) MarkMintOutboxDelivered(outboxID int) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE mint_outbox SET delivered_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE outbox_id = $1
+    `, outboxID)
+    if err != nil {
+        return fmt.Errorf("failed to mark mint outbox entry delivered: %w", err)
+    }
+
+    return nil
+}
+
+// MarkMintOutboxFailed records a failed delivery attempt so it is retried later
+func (db *AccountDatabase) MarkMintOutboxFailed(outboxID int, deliveryErr error) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE mint_outbox SET attempts = attempts + 1, last_error = $2 WHERE outbox_id = $1
+    `, outboxID, deliveryErr.Error())
+    if err != nil {
+        return fmt.Errorf("failed to record mint outbox failure: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,102 @@
+package accountdatabase
+
+import (
+    "context"
+    "fmt"
+    "math/big"
+    "time"
+)
+
+// RentalSettlement describes a rental agreement's payment for the ledger
+type RentalSettlement struct {
+    RentalID        int
+    OwnerUsername   string
+    RenterUsername  string
+    ContractAddress string
+    TokenID         string
+    Rent            string
+    Collateral      string
+    Currency        string
+    TxHash          string
+    Status          string // TransactionConfirmed or TransactionFailed
+    Notes           string
+}
+
+// hasAmount reports whether a decimal string is a positive amount
+func hasAmount(amount string) bool {
+    value, ok := new(big.Rat).SetString(amount)
+    return ok && value.Sign() > 0
+}
+
+// RecordRentalPayment writes the renter's rent payment and the owner's rent
+// income for an agreement. The renter sends the rent and any collateral and
+// receives the use of the token. Recording the same rental again leaves the
+// existing rows untouched.
+func (db *AccountDatabase) RecordRentalPayment(settlement RentalSettlement) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    token := TokenItem(settlement.ContractAddress, settlement.TokenID)
+    payment := []LedgerItem{CurrencyItem(settlement.Currency, settlement.Rent)}
+    if hasAmount(settlement.Collateral) {
+        payment = append(payment, CurrencyItem(settlement.Currency, settlement.Collateral))
+    }
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    entries := []NewLedgerEntry{
+        {Username: settlement.RenterUsername, TransactionType: TransactionRentPayment, ItemsSent: payment, ItemsReceived: []LedgerItem{token}},
+        {Username: settlement.OwnerUsername, TransactionType: TransactionRentIncome, ItemsSent: []LedgerItem{token}, ItemsReceived: payment},
+    }
+    for i := range entries {
+        entries[i].Notes = settlement.Notes
+        entries[i].Status = settlement.Status
+        entries[i].TxHash = settlement.TxHash
+        entries[i].RentalID = &settlement.RentalID
+    }
+    if err := recordLedgerSidesTx(ctx, tx, entries, "rentals"); err != nil {
+        return err
+    }
+
+    return tx.Commit(ctx)
+}
+
+// RecordCollateralRefund writes the collateral the owner owes back to the
+// renter once a rental ends. Collateral is paid straight to the owner, so the
+// refund is recorded as pending until it is confirmed against the owner's
+// return transfer.
+func (db *AccountDatabase) RecordCollateralRefund(settlement RentalSettlement) error {
+    if !hasAmount(settlement.Collateral) {
+        return nil
+    }
+
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    collateral := []LedgerItem{CurrencyItem(settlement.Currency, settlement.Collateral)}
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    entries := []NewLedgerEntry{
+        {Username: settlement.OwnerUsername, TransactionType: TransactionCollateralRefund, ItemsSent: collateral},
+        {Username: settlement.RenterUsername, TransactionType: TransactionCollateralRefund, ItemsReceived: collateral},
+    }
+    for i := range entries {
+        entries[i].Notes = settlement.Notes
+        entries[i].Status = TransactionPending
+        entries[i].RentalID = &settlement.RentalID
+    }
+    if err := recordLedgerSidesTx(ctx, tx, entries, "rentals"); err != nil {
+        return err
+    }
+
+    return tx.Commit(ctx)
+}
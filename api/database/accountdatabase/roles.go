@@ -0,0 +1,154 @@
+package accountdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+var (
+    ErrUserNotFound = errors.New("user not found")
+    ErrInvalidRole  = errors.New("invalid role")
+    ErrRoleNotHeld  = errors.New("user does not hold that role")
+)
+
+// RoleChange is an audit record of a single account_type change
+type RoleChange struct {
+    ChangeID  int       `json:"change_id"`
+    Username  string    `json:"username"`
+    OldRole   string    `json:"old_role"`
+    NewRole   string    `json:"new_role"`
+    ChangedBy string    `json:"changed_by"`
+    Reason    string    `json:"reason"`
+    ChangedAt time.Time `json:"changed_at"`
+}
+
+// IsGrantableRole reports whether role can be granted through the role-management API
+func IsGrantableRole(role string) bool {
+    switch role {
+    case RoleAdmin, RoleCreator, RoleReviewer:
+        return true
+    }
+    return false
+}
+
+// GrantRole sets username's account_type to role and records who did it
+func (db *AccountDatabase) GrantRole(username, role, changedBy, reason string) (*RoleChange, error) {
+    if !IsGrantableRole(role) {
+        return nil, ErrInvalidRole
+    }
+    return db.changeRole(username, "", role, changedBy, reason)
+}
+
+// RevokeRole drops username back to a plain user if they currently hold role
+func (db *AccountDatabase) RevokeRole(username, role, changedBy, reason string) (*RoleChange, error) {
+    if !IsGrantableRole(role) {
+        return nil, ErrInvalidRole
+    }
+    return db.changeRole(username, role, RoleUser, changedBy, reason)
+}
+
+// changeRole updates account_type and writes the audit row in one transaction
+func (db *AccountDatabase) changeRole(username, expectedRole, newRole, changedBy, reason string) (*RoleChange, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    change, err := changeRoleTx(ctx, tx, username, expectedRole, newRole, changedBy, reason)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit role change: %w", err)
+    }
+
+    return change, nil
+}
+
+// changeRoleTx is changeRole inside a caller-owned transaction, so role
+// changes can commit atomically with whatever decision triggered them.
+// When expectedRole is set the change only applies if the user currently holds it.
+func changeRoleTx(ctx context.Context, tx pgx.Tx, username, expectedRole, newRole, changedBy, reason string) (*RoleChange, error) {
+    var oldRole string
+    err := tx.QueryRow(ctx, `
+        SELECT COALESCE(account_type, '') FROM accountsettings WHERE username = $1 FOR UPDATE
+    `, username).Scan(&oldRole)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrUserNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up account role: %w", err)
+    }
+
+    if expectedRole != "" && oldRole != expectedRole {
+        return nil, ErrRoleNotHeld
+    }
+
+    if _, err := tx.Exec(ctx, `UPDATE accountsettings SET account_type = $1 WHERE username = $2`, newRole, username); err != nil {
+        return nil, fmt.Errorf("failed to update account role: %w", err)
+    }
+
+    change := RoleChange{Username: username, OldRole: oldRole, NewRole: newRole, ChangedBy: changedBy, Reason: reason}
+    err = tx.QueryRow(ctx, `
+        INSERT INTO role_changes (username, old_role, new_role, changed_by, reason)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING change_id, changed_at
+    `, username, oldRole, newRole, changedBy, reason).Scan(&change.ChangeID, &change.ChangedAt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to record role change: %w", err)
+    }
+
+    return &change, nil
+}
+
+// GetRoleChanges returns the role audit trail, newest first. An empty
+// username returns changes for every account.
+func (db *AccountDatabase) GetRoleChanges(username string) ([]RoleChange, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT change_id, username, old_role, new_role, changed_by, COALESCE(reason, ''), changed_at
+        FROM role_changes
+        WHERE $1 = '' OR username = $1
+        ORDER BY changed_at DESC, change_id DESC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to retrieve role changes: %w", err)
+    }
+    defer rows.Close()
+
+    changes := []RoleChange{}
+    for rows.Next() {
+        var change RoleChange
+        if err := rows.Scan(&change.ChangeID, &change.Username, &change.OldRole, &change.NewRole, &change.ChangedBy, &change.Reason, &change.ChangedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan role change: %w", err)
+        }
+        changes = append(changes, change)
+    }
+
+    return changes, rows.Err()
+}
+
+// CountAccountsWithRole returns how many accounts currently hold role
+func (db *AccountDatabase) CountAccountsWithRole(role string) (int, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var count int
+    err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM accountsettings WHERE account_type = $1`, role).Scan(&count)
+    if err != nil {
+        return 0, fmt.Errorf("failed to count accounts with role: %w", err)
+    }
+
+    return count, nil
+}
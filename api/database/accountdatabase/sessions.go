@@ -0,0 +1,162 @@
+package accountdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+var (
+    ErrSessionNotFound    = errors.New("session not found")
+    ErrSessionExpired     = errors.New("session expired")
+    ErrSessionRevoked     = errors.New("session revoked")
+    ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// Session is a single refresh token. Each rotation adds a row with the same
+// FamilyID, so the family is what a user thinks of as one logged-in device.
+type Session struct {
+    SessionID string
+    FamilyID  string
+    Username  string
+    ExpiresAt time.Time
+}
+
+// CreateSession starts a new session family for username
+func (db *AccountDatabase) CreateSession(username, tokenHash, userAgent, ipAddress string, ttl time.Duration) (*Session, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    session := Session{Username: username}
+    err := db.Pool.QueryRow(ctx, `
+        INSERT INTO sessions (family_id, username, token_hash, user_agent, ip_address, expires_at)
+        VALUES (gen_random_uuid(), $1, $2, $3, $4, NOW() + make_interval(secs => $5))
+        RETURNING session_id::text, family_id::text, expires_at
+    `, username, tokenHash, userAgent, ipAddress, ttl.Seconds()).Scan(&session.SessionID, &session.FamilyID, &session.ExpiresAt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create session: %w", err)
+    }
+
+    return &session, nil
+}
+
+// RotateSession exchanges the refresh token identified by tokenHash for
+// newTokenHash within the same family. Presenting a token that was already
+// rotated means it leaked, so the whole family is revoked.
+func (db *AccountDatabase) RotateSession(tokenHash, newTokenHash string, ttl time.Duration) (*Session, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var sessionID, familyID, username string
+    var rotatedAt, revokedAt *time.Time
+    var expired bool
+    err = tx.QueryRow(ctx, `
+        SELECT session_id::text, family_id::text, username, rotated_at, revoked_at, expires_at <= NOW()
+        FROM sessions
+        WHERE token_hash = $1
+        FOR UPDATE
+    `, tokenHash).Scan(&sessionID, &familyID, &username, &rotatedAt, &revokedAt, &expired)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrSessionNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to look up session: %w", err)
+    }
+
+    if revokedAt != nil {
+        return nil, ErrSessionRevoked
+    }
+
+    if rotatedAt != nil {
+        if _, err := tx.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`, familyID); err != nil {
+            return nil, fmt.Errorf("failed to revoke session family: %w", err)
+        }
+        if err := tx.Commit(ctx); err != nil {
+            return nil, fmt.Errorf("failed to commit session revocation: %w", err)
+        }
+        return nil, ErrRefreshTokenReused
+    }
+
+    if expired {
+        return nil, ErrSessionExpired
+    }
+
+    if _, err := tx.Exec(ctx, `UPDATE sessions SET rotated_at = NOW() WHERE session_id = $1`, sessionID); err != nil {
+        return nil, fmt.Errorf("failed to rotate session: %w", err)
+    }
+
+    session := Session{FamilyID: familyID, Username: username}
+    err = tx.QueryRow(ctx, `
+        INSERT INTO sessions (family_id, username, token_hash, user_agent, ip_address, expires_at)
+        SELECT family_id, username, $2, user_agent, ip_address, NOW() + make_interval(secs => $3)
+        FROM sessions
+        WHERE session_id = $1
+        RETURNING session_id::text, expires_at
+    `, sessionID, newTokenHash, ttl.Seconds()).Scan(&session.SessionID, &session.ExpiresAt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to insert rotated session: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit session rotation: %w", err)
+    }
+
+    return &session, nil
+}
+
+// IsSessionActive reports whether the session family can still be used
+func (db *AccountDatabase) IsSessionActive(familyID string) (bool, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var active bool
+    err := db.Pool.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM sessions
+            WHERE family_id = $1 AND revoked_at IS NULL AND rotated_at IS NULL AND expires_at > NOW()
+        )
+    `, familyID).Scan(&active)
+    if err != nil {
+        return false, fmt.Errorf("failed to check session: %w", err)
+    }
+
+    return active, nil
+}
+
+// RevokeSessionFamily logs a single device out
+func (db *AccountDatabase) RevokeSessionFamily(username, familyID string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE sessions SET revoked_at = NOW()
+        WHERE family_id = $1 AND username = $2 AND revoked_at IS NULL
+    `, familyID, username)
+    if err != nil {
+        return fmt.Errorf("failed to revoke session: %w", err)
+    }
+
+    return nil
+}
+
+// RevokeAllSessions logs username out of every device
+func (db *AccountDatabase) RevokeAllSessions(username string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `UPDATE sessions SET revoked_at = NOW() WHERE username = $1 AND revoked_at IS NULL`, username)
+    if err != nil {
+        return fmt.Errorf("failed to revoke sessions: %w", err)
+    }
+
+    return nil
+}
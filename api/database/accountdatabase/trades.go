@@ -0,0 +1,56 @@
+package accountdatabase
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+// TradeSettlement is the outcome of a marketplace order, recorded once for the
+// buyer and once for the seller
+type TradeSettlement struct {
+    OrderID         int
+    BuyerUsername   string
+    SellerUsername  string
+    ContractAddress string
+    TokenID         string
+    Price           string
+    Currency        string
+    TxHash          string
+    Status          string // TransactionConfirmed or TransactionFailed
+    Notes           string
+}
+
+// RecordTradeSettlement writes the buyer's and seller's ledger entries for an
+// order. Recording the same order again leaves the existing rows untouched,
+// so settlement can be retried safely.
+func (db *AccountDatabase) RecordTradeSettlement(settlement TradeSettlement) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    token := TokenItem(settlement.ContractAddress, settlement.TokenID)
+    payment := CurrencyItem(settlement.Currency, settlement.Price)
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // The buyer sends the payment and receives the token; the seller the reverse
+    entries := []NewLedgerEntry{
+        {Username: settlement.BuyerUsername, TransactionType: TransactionPurchase, ItemsSent: []LedgerItem{payment}, ItemsReceived: []LedgerItem{token}},
+        {Username: settlement.SellerUsername, TransactionType: TransactionSale, ItemsSent: []LedgerItem{token}, ItemsReceived: []LedgerItem{payment}},
+    }
+    for i := range entries {
+        entries[i].Notes = settlement.Notes
+        entries[i].Status = settlement.Status
+        entries[i].TxHash = settlement.TxHash
+        entries[i].OrderID = &settlement.OrderID
+    }
+    if err := recordLedgerSidesTx(ctx, tx, entries, "marketplace"); err != nil {
+        return err
+    }
+
+    return tx.Commit(ctx)
+}
@@ -0,0 +1,284 @@
+package accountdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+var (
+    ErrWalletNonceInvalid = errors.New("wallet verification request is invalid or has expired")
+    ErrWalletLinked       = errors.New("wallet is already linked to another account")
+    ErrWalletNotLinked    = errors.New("wallet is not linked to this account")
+    ErrNoVerifiedWallet   = errors.New("account has no verified wallet")
+)
+
+// LinkedWallet is a wallet an account has proven control of
+type LinkedWallet struct {
+    Address    string    `json:"address"`
+    IsPrimary  bool      `json:"is_primary"`
+    VerifiedAt time.Time `json:"verified_at"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+const linkedWalletColumns = `address, is_primary, verified_at, created_at`
+
+func scanLinkedWallet(row pgx.Row) (*LinkedWallet, error) {
+    var wallet LinkedWallet
+    if err := row.Scan(&wallet.Address, &wallet.IsPrimary, &wallet.VerifiedAt, &wallet.CreatedAt); err != nil {
+        return nil, err
+    }
+    return &wallet, nil
+}
+
+// CreateWalletNonce stores the message a user has been asked to sign to prove
+// they control address. It can be used once, until ttl runs out.
+func (db *AccountDatabase) CreateWalletNonce(username, address, nonce, message string, ttl time.Duration) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        INSERT INTO wallet_nonces (nonce, username, address, message, expires_at)
+        VALUES ($1, $2, LOWER($3), $4, NOW() + make_interval(secs => $5))
+    `, nonce, username, address, message, ttl.Seconds())
+    if err != nil {
+        return fmt.Errorf("failed to store wallet nonce: %w", err)
+    }
+
+    return nil
+}
+
+// ConsumeWalletNonce marks a user's unexpired nonce used and returns the
+// address and message it was issued for. A nonce is spent even if the
+// signature that follows does not verify, so every attempt needs a new one.
+func (db *AccountDatabase) ConsumeWalletNonce(username, nonce string) (string, string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var address, message string
+    err := db.Pool.QueryRow(ctx, `
+        UPDATE wallet_nonces SET used_at = NOW()
+        WHERE nonce = $1 AND username = $2 AND used_at IS NULL AND expires_at > NOW()
+        RETURNING address, message
+    `, nonce, username).Scan(&address, &message)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return "", "", ErrWalletNonceInvalid
+    }
+    if err != nil {
+        return "", "", fmt.Errorf("failed to consume wallet nonce: %w", err)
+    }
+
+    return address, message, nil
+}
+
+// LinkWallet records a verified wallet for username. It becomes the primary
+// wallet when makePrimary is set or the account has no primary wallet yet.
+// Re-verifying a wallet the user already linked refreshes verified_at.
+func (db *AccountDatabase) LinkWallet(username, address string, makePrimary bool) (*LinkedWallet, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    address = strings.ToLower(address)
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // Lock the account so concurrent links agree on which wallet is primary
+    if _, err := tx.Exec(ctx, `SELECT 1 FROM accountsettings WHERE username = $1 FOR UPDATE`, username); err != nil {
+        return nil, fmt.Errorf("failed to lock account: %w", err)
+    }
+
+    _, err = scanLinkedWallet(tx.QueryRow(ctx, `
+        INSERT INTO account_wallets (username, address)
+        VALUES ($1, $2)
+        ON CONFLICT (address) DO UPDATE SET verified_at = NOW()
+        WHERE account_wallets.username = EXCLUDED.username
+        RETURNING `+linkedWalletColumns, username, address))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrWalletLinked
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to link wallet: %w", err)
+    }
+
+    if !makePrimary {
+        var hasPrimary bool
+        if err := tx.QueryRow(ctx, `
+            SELECT EXISTS (SELECT 1 FROM account_wallets WHERE username = $1 AND is_primary)
+        `, username).Scan(&hasPrimary); err != nil {
+            return nil, fmt.Errorf("failed to check primary wallet: %w", err)
+        }
+        makePrimary = !hasPrimary
+    }
+    if makePrimary {
+        if err := setPrimaryWalletTx(ctx, tx, username, address); err != nil {
+            return nil, err
+        }
+    }
+
+    wallet, err := scanLinkedWallet(tx.QueryRow(ctx, `
+        SELECT `+linkedWalletColumns+` FROM account_wallets WHERE address = $1
+    `, address))
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch wallet: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit wallet: %w", err)
+    }
+
+    return wallet, nil
+}
+
+// setPrimaryWalletTx makes a linked wallet the account's primary one and
+// mirrors it into accountsettings.wallet_id for profile display; payments and
+// mints read the primary wallet from account_wallets.
+// An empty address clears the primary wallet.
+func setPrimaryWalletTx(ctx context.Context, tx pgx.Tx, username, address string) error {
+    if _, err := tx.Exec(ctx, `
+        UPDATE account_wallets SET is_primary = FALSE WHERE username = $1 AND is_primary AND address <> $2
+    `, username, address); err != nil {
+        return fmt.Errorf("failed to clear primary wallet: %w", err)
+    }
+
+    if address != "" {
+        tag, err := tx.Exec(ctx, `
+            UPDATE account_wallets SET is_primary = TRUE WHERE username = $1 AND address = $2
+        `, username, address)
+        if err != nil {
+            return fmt.Errorf("failed to set primary wallet: %w", err)
+        }
+        if tag.RowsAffected() == 0 {
+            return ErrWalletNotLinked
+        }
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE accountsettings SET wallet_id = NULLIF($2, '') WHERE username = $1
+    `, username, address); err != nil {
+        return fmt.Errorf("failed to update wallet ID: %w", err)
+    }
+
+    return nil
+}
+
+// SetPrimaryWallet switches the account's primary wallet to one it has
+// already linked
+func (db *AccountDatabase) SetPrimaryWallet(username, address string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    if _, err := tx.Exec(ctx, `SELECT 1 FROM accountsettings WHERE username = $1 FOR UPDATE`, username); err != nil {
+        return fmt.Errorf("failed to lock account: %w", err)
+    }
+
+    if err := setPrimaryWalletTx(ctx, tx, username, strings.ToLower(address)); err != nil {
+        return err
+    }
+
+    return tx.Commit(ctx)
+}
+
+// UnlinkWallet removes a linked wallet. Removing the primary wallet promotes
+// the most recently verified remaining one, if any.
+func (db *AccountDatabase) UnlinkWallet(username, address string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    if _, err := tx.Exec(ctx, `SELECT 1 FROM accountsettings WHERE username = $1 FOR UPDATE`, username); err != nil {
+        return fmt.Errorf("failed to lock account: %w", err)
+    }
+
+    var wasPrimary bool
+    err = tx.QueryRow(ctx, `
+        DELETE FROM account_wallets WHERE username = $1 AND address = $2 RETURNING is_primary
+    `, username, strings.ToLower(address)).Scan(&wasPrimary)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return ErrWalletNotLinked
+    }
+    if err != nil {
+        return fmt.Errorf("failed to unlink wallet: %w", err)
+    }
+
+    if wasPrimary {
+        var next string
+        err := tx.QueryRow(ctx, `
+            SELECT address FROM account_wallets WHERE username = $1 ORDER BY verified_at DESC LIMIT 1
+        `, username).Scan(&next)
+        if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+            return fmt.Errorf("failed to fetch remaining wallets: %w", err)
+        }
+        if err := setPrimaryWalletTx(ctx, tx, username, next); err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit(ctx)
+}
+
+// GetPrimaryWallet returns the address of the account's primary verified
+// wallet. It reads account_wallets rather than accountsettings.wallet_id, so
+// only a wallet the account proved control of is ever used.
+func (db *AccountDatabase) GetPrimaryWallet(username string) (string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var address string
+    err := db.Pool.QueryRow(ctx, `
+        SELECT address FROM account_wallets WHERE username = $1 AND is_primary
+    `, username).Scan(&address)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return "", ErrNoVerifiedWallet
+    }
+    if err != nil {
+        return "", fmt.Errorf("failed to fetch primary wallet: %w", err)
+    }
+
+    return address, nil
+}
+
+// GetWallets returns the wallets linked to an account, primary first
+func (db *AccountDatabase) GetWallets(username string) ([]LinkedWallet, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+linkedWalletColumns+` FROM account_wallets
+        WHERE username = $1
+        ORDER BY is_primary DESC, verified_at DESC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch wallets: %w", err)
+    }
+    defer rows.Close()
+
+    wallets := []LinkedWallet{}
+    for rows.Next() {
+        wallet, err := scanLinkedWallet(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan wallet: %w", err)
+        }
+        wallets = append(wallets, *wallet)
+    }
+
+    return wallets, rows.Err()
+}
@@ -0,0 +1,449 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// Engagement activity types
+const (
+    ActivityEventAttendance    = "event_attendance"
+    ActivityContentInteraction = "content_interaction"
+    ActivityPurchase           = "purchase"
+)
+
+// LevelSourceEngagement marks levels earned through non-event engagement
+const LevelSourceEngagement = "engagement"
+
+var (
+    ErrActivityNotFound      = errors.New("activity not found")
+    ErrActivityInactive      = errors.New("activity is no longer active")
+    ErrActivityLimitReached  = errors.New("user has already been credited the maximum times for this activity")
+    ErrDuplicateEngagement   = errors.New("this action has already been credited")
+    ErrTokenNotEligible      = errors.New("token is not eligible for this activity")
+    ErrNotTokenOwner         = errors.New("user does not own this token")
+    ErrInvalidLevelThreshold = errors.New("level thresholds must start at level 2 and rise with each level")
+)
+
+// IsValidActivityType reports whether activityType is a known activity type
+func IsValidActivityType(activityType string) bool {
+    switch activityType {
+    case ActivityEventAttendance, ActivityContentInteraction, ActivityPurchase:
+        return true
+    }
+    return false
+}
+
+// EngagementActivity is something a creator rewards with points
+type EngagementActivity struct {
+    ActivityID      int       `json:"activity_id"`
+    CreatorUsername string    `json:"creator_username"`
+    Name            string    `json:"name"`
+    ActivityType    string    `json:"activity_type"`
+    Points          int       `json:"points"`
+    ContractAddress *string   `json:"contract_address"` // nil means any token
+    MaxPerUser      *int      `json:"max_per_user"`     // nil means unlimited
+    Active          bool      `json:"active"`
+    CreatedAt       time.Time `json:"created_at"`
+}
+
+// NewEngagementActivity holds the fields a creator supplies for an activity
+type NewEngagementActivity struct {
+    CreatorUsername string
+    Name            string
+    ActivityType    string
+    Points          int
+    ContractAddress string
+    MaxPerUser      *int
+}
+
+// EngagementCredit is a qualifying action to be recorded against a token
+type EngagementCredit struct {
+    ActivityID int
+    Username   string
+    NFTID      int
+    SourceRef  string // identifies the action so it is only credited once
+    RecordedBy string
+}
+
+// EngagementAction is a recorded engagement credit
+type EngagementAction struct {
+    ActionID   int       `json:"action_id"`
+    ActivityID int       `json:"activity_id"`
+    Username   string    `json:"username"`
+    NFTID      int       `json:"nft_id"`
+    Points     int       `json:"points"`
+    SourceRef  *string   `json:"source_ref"`
+    RecordedBy string    `json:"recorded_by"`
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// LevelThreshold is the number of points a token needs to reach a level
+type LevelThreshold struct {
+    Level          int `json:"level"`
+    PointsRequired int `json:"points_required"`
+}
+
+// EngagementProgress is a token's points and how far it is from its next level
+type EngagementProgress struct {
+    NFTID          int  `json:"nft_id"`
+    Points         int  `json:"points"`
+    Level          int  `json:"level"`
+    PendingLevel   int  `json:"pending_level"` // level once queued level-ups land
+    NextLevel      *int `json:"next_level"`
+    PointsRequired *int `json:"points_required"`
+}
+
+const activityColumns = `
+    activity_id, creator_username, name, activity_type, points, contract_address, max_per_user, active, created_at
+`
+
+func scanActivity(row pgx.Row) (*EngagementActivity, error) {
+    var activity EngagementActivity
+    err := row.Scan(&activity.ActivityID, &activity.CreatorUsername, &activity.Name, &activity.ActivityType, &activity.Points,
+        &activity.ContractAddress, &activity.MaxPerUser, &activity.Active, &activity.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &activity, nil
+}
+
+// CreateActivity stores a new active engagement activity
+func (db *NFTDatabase) CreateActivity(activity NewEngagementActivity) (*EngagementActivity, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    created, err := scanActivity(db.Pool.QueryRow(ctx, `
+        INSERT INTO engagement_activities (creator_username, name, activity_type, points, contract_address, max_per_user)
+        VALUES ($1, $2, $3, $4, NULLIF(LOWER($5), ''), $6)
+        RETURNING `+activityColumns,
+        activity.CreatorUsername, activity.Name, activity.ActivityType, activity.Points, activity.ContractAddress, activity.MaxPerUser))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create activity: %w", err)
+    }
+
+    return created, nil
+}
+
+// GetActivity fetches a single activity
+func (db *NFTDatabase) GetActivity(activityID int) (*EngagementActivity, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    activity, err := scanActivity(db.Pool.QueryRow(ctx, `SELECT `+activityColumns+` FROM engagement_activities WHERE activity_id = $1`, activityID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrActivityNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch activity: %w", err)
+    }
+
+    return activity, nil
+}
+
+// GetActivities lists activities, optionally only one creator's
+func (db *NFTDatabase) GetActivities(creatorUsername string) ([]EngagementActivity, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+activityColumns+`
+        FROM engagement_activities
+        WHERE $1 = '' OR creator_username = $1
+        ORDER BY activity_id DESC
+    `, creatorUsername)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch activities: %w", err)
+    }
+    defer rows.Close()
+
+    activities := []EngagementActivity{}
+    for rows.Next() {
+        activity, err := scanActivity(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan activity: %w", err)
+        }
+        activities = append(activities, *activity)
+    }
+
+    return activities, rows.Err()
+}
+
+// SetActivityActive turns an activity on or off
+func (db *NFTDatabase) SetActivityActive(activityID int, active bool) (*EngagementActivity, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    activity, err := scanActivity(db.Pool.QueryRow(ctx, `
+        UPDATE engagement_activities SET active = $2 WHERE activity_id = $1
+        RETURNING `+activityColumns, activityID, active))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrActivityNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to update activity: %w", err)
+    }
+
+    return activity, nil
+}
+
+// RecordEngagement credits a user's token with an activity's points and runs
+// the level rules: if the token's total crosses one or more thresholds, a
+// level-up is queued for each new level. It returns the recorded action and
+// the token's progress afterwards.
+func (db *NFTDatabase) RecordEngagement(credit EngagementCredit) (*EngagementAction, *EngagementProgress, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    action, err := recordEngagementTx(ctx, tx, credit)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    progress, err := evaluateLevelRulesTx(ctx, tx, action.NFTID, levelSourceFor(ctx, tx, action.ActivityID), fmt.Sprintf("engagement:%d", action.ActionID))
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, nil, fmt.Errorf("failed to commit engagement: %w", err)
+    }
+
+    return action, progress, nil
+}
+
+func recordEngagementTx(ctx context.Context, tx pgx.Tx, credit EngagementCredit) (*EngagementAction, error) {
+    activity, err := scanActivity(tx.QueryRow(ctx, `SELECT `+activityColumns+` FROM engagement_activities WHERE activity_id = $1 FOR SHARE`, credit.ActivityID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrActivityNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch activity: %w", err)
+    }
+    if !activity.Active {
+        return nil, ErrActivityInactive
+    }
+
+    // Lock the token so concurrent credits evaluate the rules one at a time.
+    // A rented token earns for its renter while the rental runs.
+    var contractAddress string
+    var ownerUsername *string
+    err = tx.QueryRow(ctx, `
+        SELECT contract_address, COALESCE(rented_to, owner_username) FROM nfts WHERE nft_id = $1 FOR UPDATE
+    `, credit.NFTID).Scan(&contractAddress, &ownerUsername)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if ownerUsername == nil || *ownerUsername != credit.Username {
+        return nil, ErrNotTokenOwner
+    }
+    if activity.ContractAddress != nil && *activity.ContractAddress != contractAddress {
+        return nil, ErrTokenNotEligible
+    }
+
+    if activity.MaxPerUser != nil {
+        var credited int
+        if err := tx.QueryRow(ctx, `
+            SELECT COUNT(*) FROM engagement_actions WHERE activity_id = $1 AND username = $2
+        `, activity.ActivityID, credit.Username).Scan(&credited); err != nil {
+            return nil, fmt.Errorf("failed to count engagement: %w", err)
+        }
+        if credited >= *activity.MaxPerUser {
+            return nil, ErrActivityLimitReached
+        }
+    }
+
+    action := EngagementAction{ActivityID: activity.ActivityID, Username: credit.Username, NFTID: credit.NFTID, Points: activity.Points, RecordedBy: credit.RecordedBy}
+    err = tx.QueryRow(ctx, `
+        INSERT INTO engagement_actions (activity_id, username, nft_id, points, source_ref, recorded_by)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6)
+        RETURNING action_id, source_ref, created_at
+    `, activity.ActivityID, credit.Username, credit.NFTID, activity.Points, credit.SourceRef, credit.RecordedBy).Scan(&action.ActionID, &action.SourceRef, &action.CreatedAt)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return nil, ErrDuplicateEngagement
+        }
+        return nil, fmt.Errorf("failed to record engagement: %w", err)
+    }
+
+    return &action, nil
+}
+
+// levelSourceFor maps an activity onto the level history source it produces
+func levelSourceFor(ctx context.Context, tx pgx.Tx, activityID int) string {
+    var activityType string
+    if err := tx.QueryRow(ctx, `SELECT activity_type FROM engagement_activities WHERE activity_id = $1`, activityID).Scan(&activityType); err == nil && activityType == ActivityEventAttendance {
+        return LevelSourceEventCheckIn
+    }
+    return LevelSourceEngagement
+}
+
+// evaluateLevelRulesTx compares a token's points with its level thresholds
+// and queues a level-up for every level it has newly earned. Levels already
+// reached or already queued are not queued again.
+func evaluateLevelRulesTx(ctx context.Context, tx pgx.Tx, nftID int, source, sourceRef string) (*EngagementProgress, error) {
+    progress := EngagementProgress{NFTID: nftID}
+    var contractAddress, tokenID string
+    err := tx.QueryRow(ctx, `
+        SELECT n.contract_address, n.token_id, n.level,
+            (SELECT COALESCE(SUM(points), 0) FROM engagement_actions a WHERE a.nft_id = n.nft_id),
+            GREATEST(n.level, COALESCE((
+                SELECT MAX(to_level) FROM level_up_queue q WHERE q.nft_id = n.nft_id AND q.status <> $2
+            ), 0))
+        FROM nfts n
+        WHERE n.nft_id = $1
+    `, nftID, LevelUpFailed).Scan(&contractAddress, &tokenID, &progress.Level, &progress.Points, &progress.PendingLevel)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch engagement progress: %w", err)
+    }
+
+    thresholds, err := levelThresholdsTx(ctx, tx, contractAddress)
+    if err != nil {
+        return nil, err
+    }
+
+    earned := progress.Level
+    for _, threshold := range thresholds {
+        if progress.Points >= threshold.PointsRequired && threshold.Level > earned {
+            earned = threshold.Level
+        }
+        if threshold.Level > earned && progress.NextLevel == nil {
+            level, points := threshold.Level, threshold.PointsRequired
+            progress.NextLevel, progress.PointsRequired = &level, &points
+        }
+    }
+
+    // One queue entry per level step, so on-chain increments stay one level each
+    for level := progress.PendingLevel + 1; level <= earned; level++ {
+        _, err := tx.Exec(ctx, `
+            INSERT INTO level_up_queue (nft_id, contract_address, token_id, from_level, to_level, source, source_ref)
+            VALUES ($1, $2, $3, $4, $5, $6, $7)
+            ON CONFLICT (nft_id, to_level) WHERE status <> 'failed' DO NOTHING
+        `, nftID, contractAddress, tokenID, level-1, level, source, sourceRef)
+        if err != nil {
+            return nil, fmt.Errorf("failed to queue level-up: %w", err)
+        }
+    }
+    if earned > progress.PendingLevel {
+        progress.PendingLevel = earned
+    }
+
+    return &progress, nil
+}
+
+// levelThresholdsTx returns the thresholds for a contract, falling back to the
+// default set ('' contract) when the contract has none of its own
+func levelThresholdsTx(ctx context.Context, tx pgx.Tx, contractAddress string) ([]LevelThreshold, error) {
+    rows, err := tx.Query(ctx, `
+        SELECT level, points_required
+        FROM engagement_level_thresholds
+        WHERE contract_address = CASE
+            WHEN EXISTS (SELECT 1 FROM engagement_level_thresholds WHERE contract_address = $1) THEN $1
+            ELSE '' END
+        ORDER BY level
+    `, strings.ToLower(contractAddress))
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch level thresholds: %w", err)
+    }
+    defer rows.Close()
+
+    var thresholds []LevelThreshold
+    for rows.Next() {
+        var threshold LevelThreshold
+        if err := rows.Scan(&threshold.Level, &threshold.PointsRequired); err != nil {
+            return nil, fmt.Errorf("failed to scan level threshold: %w", err)
+        }
+        thresholds = append(thresholds, threshold)
+    }
+
+    return thresholds, rows.Err()
+}
+
+// GetEngagementProgress reports a token's points and next threshold without changing anything
+func (db *NFTDatabase) GetEngagementProgress(nftID int) (*EngagementProgress, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    // Read-only: the rules run but their queue inserts are rolled back
+    defer tx.Rollback(ctx)
+
+    var exists bool
+    if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM nfts WHERE nft_id = $1)`, nftID).Scan(&exists); err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if !exists {
+        return nil, ErrNFTNotFound
+    }
+
+    return evaluateLevelRulesTx(ctx, tx, nftID, LevelSourceEngagement, "")
+}
+
+// GetLevelThresholds returns the thresholds that apply to a contract
+func (db *NFTDatabase) GetLevelThresholds(contractAddress string) ([]LevelThreshold, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    return levelThresholdsTx(ctx, tx, contractAddress)
+}
+
+// SetLevelThresholds replaces a contract's thresholds; an empty contract
+// address sets the default set. Passing no thresholds for a contract makes it
+// fall back to the defaults.
+func (db *NFTDatabase) SetLevelThresholds(contractAddress string, thresholds []LevelThreshold) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    previous := LevelThreshold{Level: 1}
+    for _, threshold := range thresholds {
+        if threshold.Level != previous.Level+1 || threshold.PointsRequired <= previous.PointsRequired {
+            return ErrInvalidLevelThreshold
+        }
+        previous = threshold
+    }
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    contractAddress = strings.ToLower(contractAddress)
+    if _, err := tx.Exec(ctx, `DELETE FROM engagement_level_thresholds WHERE contract_address = $1`, contractAddress); err != nil {
+        return fmt.Errorf("failed to clear level thresholds: %w", err)
+    }
+    for _, threshold := range thresholds {
+        if _, err := tx.Exec(ctx, `
+            INSERT INTO engagement_level_thresholds (contract_address, level, points_required) VALUES ($1, $2, $3)
+        `, contractAddress, threshold.Level, threshold.PointsRequired); err != nil {
+            return fmt.Errorf("failed to save level threshold: %w", err)
+        }
+    }
+
+    return tx.Commit(ctx)
+}
@@ -0,0 +1,320 @@
+package nftdatabase
+
+import (
+    "context"
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// eventCheckInLead is how long before an event starts check-in opens
+const eventCheckInLead = time.Hour
+
+var (
+    ErrEventNotFound       = errors.New("event not found")
+    ErrEventNotOpen        = errors.New("check-in is not open for this event")
+    ErrEventEnded          = errors.New("event has ended")
+    ErrAlreadyCheckedIn    = errors.New("user has already checked in to this event")
+    ErrNFTAlreadyCheckedIn = errors.New("this token has already been checked in to this event")
+    ErrCheckInCodeUsed     = errors.New("check-in code has already been used")
+    ErrWalletMismatch      = errors.New("token is held by a different wallet")
+)
+
+// Event is a creator event attendees check in to
+type Event struct {
+    EventID         int       `json:"event_id"`
+    CreatorUsername string    `json:"creator_username"`
+    Name            string    `json:"name"`
+    Description     *string   `json:"description"`
+    Location        *string   `json:"location"`
+    StartsAt        time.Time `json:"starts_at"`
+    EndsAt          time.Time `json:"ends_at"`
+    ActivityID      int       `json:"activity_id"`
+    CheckInSecret   []byte    `json:"-"`
+    CreatedAt       time.Time `json:"created_at"`
+}
+
+// NewEvent holds the fields a creator supplies for an event. Attendance earns
+// Points, optionally only for tokens of ContractAddress.
+type NewEvent struct {
+    CreatorUsername string
+    Name            string
+    Description     string
+    Location        string
+    StartsAt        time.Time
+    EndsAt          time.Time
+    Points          int
+    ContractAddress string
+}
+
+// EventCheckIn is a verified check-in code redeemed by a user for a token
+type EventCheckIn struct {
+    EventID       int
+    Username      string
+    WalletAddress string
+    NFTID         int
+    CodeNonce     string
+    SingleUse     bool
+}
+
+// CheckInRecord is a stored event check-in
+type CheckInRecord struct {
+    CheckInID     int       `json:"checkin_id"`
+    EventID       int       `json:"event_id"`
+    Username      string    `json:"username"`
+    WalletAddress string    `json:"wallet_address"`
+    NFTID         int       `json:"nft_id"`
+    ActionID      *int      `json:"action_id"`
+    CreatedAt     time.Time `json:"created_at"`
+}
+
+const eventColumns = `
+    event_id, creator_username, name, description, location, starts_at, ends_at, activity_id, checkin_secret, created_at
+`
+
+func scanEvent(row pgx.Row) (*Event, error) {
+    var event Event
+    err := row.Scan(&event.EventID, &event.CreatorUsername, &event.Name, &event.Description, &event.Location,
+        &event.StartsAt, &event.EndsAt, &event.ActivityID, &event.CheckInSecret, &event.CreatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &event, nil
+}
+
+// CreateEvent stores an event along with the attendance activity its
+// check-ins are credited to, and generates the event's check-in secret
+func (db *NFTDatabase) CreateEvent(event NewEvent) (*Event, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    secret := make([]byte, 32)
+    if _, err := rand.Read(secret); err != nil {
+        return nil, fmt.Errorf("failed to generate check-in secret: %w", err)
+    }
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var activityID int
+    err = tx.QueryRow(ctx, `
+        INSERT INTO engagement_activities (creator_username, name, activity_type, points, contract_address)
+        VALUES ($1, $2, $3, $4, NULLIF(LOWER($5), ''))
+        RETURNING activity_id
+    `, event.CreatorUsername, "Attended "+event.Name, ActivityEventAttendance, event.Points, event.ContractAddress).Scan(&activityID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create event activity: %w", err)
+    }
+
+    created, err := scanEvent(tx.QueryRow(ctx, `
+        INSERT INTO events (creator_username, name, description, location, starts_at, ends_at, activity_id, checkin_secret)
+        VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8)
+        RETURNING `+eventColumns,
+        event.CreatorUsername, event.Name, event.Description, event.Location, event.StartsAt.UTC(), event.EndsAt.UTC(), activityID, secret))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create event: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit event: %w", err)
+    }
+
+    return created, nil
+}
+
+// GetEvent fetches a single event
+func (db *NFTDatabase) GetEvent(eventID int) (*Event, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    event, err := scanEvent(db.Pool.QueryRow(ctx, `SELECT `+eventColumns+` FROM events WHERE event_id = $1`, eventID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrEventNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch event: %w", err)
+    }
+
+    return event, nil
+}
+
+// GetEvents lists events that have not ended, soonest first, optionally only one creator's
+func (db *NFTDatabase) GetEvents(creatorUsername string) ([]Event, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+eventColumns+`
+        FROM events
+        WHERE ends_at > CURRENT_TIMESTAMP AND ($1 = '' OR creator_username = $1)
+        ORDER BY starts_at, event_id
+    `, creatorUsername)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch events: %w", err)
+    }
+    defer rows.Close()
+
+    events := []Event{}
+    for rows.Next() {
+        event, err := scanEvent(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan event: %w", err)
+        }
+        events = append(events, *event)
+    }
+
+    return events, rows.Err()
+}
+
+// EventHasEnded reports whether an event is over, using the database clock
+// like the check-in window does
+func (db *NFTDatabase) EventHasEnded(eventID int) (bool, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var ended bool
+    err := db.Pool.QueryRow(ctx, `SELECT ends_at <= CURRENT_TIMESTAMP FROM events WHERE event_id = $1`, eventID).Scan(&ended)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return false, ErrEventNotFound
+    }
+    if err != nil {
+        return false, fmt.Errorf("failed to fetch event: %w", err)
+    }
+
+    return ended, nil
+}
+
+// CheckIn records a user's attendance with one of their tokens and credits
+// the event's attendance activity, all in one transaction. A user, a token
+// and a single-use code can each check in to an event only once.
+func (db *NFTDatabase) CheckIn(checkIn EventCheckIn) (*CheckInRecord, *EngagementProgress, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var activityID int
+    var open bool
+    err = tx.QueryRow(ctx, `
+        SELECT activity_id,
+            CURRENT_TIMESTAMP BETWEEN starts_at - make_interval(secs => $2) AND ends_at
+        FROM events
+        WHERE event_id = $1
+    `, checkIn.EventID, eventCheckInLead.Seconds()).Scan(&activityID, &open)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil, ErrEventNotFound
+    }
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to fetch event: %w", err)
+    }
+    if !open {
+        return nil, nil, ErrEventNotOpen
+    }
+
+    // A token whose holder is known on chain must be held by the caller's
+    // wallet, unless it is rented out, in which case only the renter may use it
+    var ownerAddress, rentedTo *string
+    err = tx.QueryRow(ctx, `SELECT owner_address, rented_to FROM nfts WHERE nft_id = $1 FOR UPDATE`, checkIn.NFTID).Scan(&ownerAddress, &rentedTo)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if rentedTo != nil {
+        if *rentedTo != checkIn.Username {
+            return nil, nil, ErrNotTokenOwner
+        }
+    } else if ownerAddress != nil && !strings.EqualFold(*ownerAddress, checkIn.WalletAddress) {
+        return nil, nil, ErrWalletMismatch
+    }
+
+    record := CheckInRecord{EventID: checkIn.EventID, Username: checkIn.Username, WalletAddress: strings.ToLower(checkIn.WalletAddress), NFTID: checkIn.NFTID}
+    err = tx.QueryRow(ctx, `
+        INSERT INTO event_checkins (event_id, username, wallet_address, nft_id, code_nonce, single_use)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING checkin_id, created_at
+    `, checkIn.EventID, checkIn.Username, record.WalletAddress, checkIn.NFTID, checkIn.CodeNonce, checkIn.SingleUse).Scan(&record.CheckInID, &record.CreatedAt)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            switch pgErr.ConstraintName {
+            case "event_checkins_user_key":
+                return nil, nil, ErrAlreadyCheckedIn
+            case "event_checkins_nft_key":
+                return nil, nil, ErrNFTAlreadyCheckedIn
+            default:
+                return nil, nil, ErrCheckInCodeUsed
+            }
+        }
+        return nil, nil, fmt.Errorf("failed to record check-in: %w", err)
+    }
+
+    action, err := recordEngagementTx(ctx, tx, EngagementCredit{
+        ActivityID: activityID,
+        Username:   checkIn.Username,
+        NFTID:      checkIn.NFTID,
+        SourceRef:  fmt.Sprintf("event:%d:checkin:%d", checkIn.EventID, record.CheckInID),
+        RecordedBy: checkIn.Username,
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+    record.ActionID = &action.ActionID
+
+    if _, err := tx.Exec(ctx, `UPDATE event_checkins SET action_id = $2 WHERE checkin_id = $1`, record.CheckInID, action.ActionID); err != nil {
+        return nil, nil, fmt.Errorf("failed to link check-in credit: %w", err)
+    }
+
+    progress, err := evaluateLevelRulesTx(ctx, tx, checkIn.NFTID, LevelSourceEventCheckIn, fmt.Sprintf("engagement:%d", action.ActionID))
+    if err != nil {
+        return nil, nil, err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, nil, fmt.Errorf("failed to commit check-in: %w", err)
+    }
+
+    return &record, progress, nil
+}
+
+// GetCheckIns lists an event's check-ins, oldest first
+func (db *NFTDatabase) GetCheckIns(eventID int) ([]CheckInRecord, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT checkin_id, event_id, username, wallet_address, nft_id, action_id, created_at
+        FROM event_checkins
+        WHERE event_id = $1
+        ORDER BY checkin_id
+    `, eventID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch check-ins: %w", err)
+    }
+    defer rows.Close()
+
+    checkIns := []CheckInRecord{}
+    for rows.Next() {
+        var record CheckInRecord
+        if err := rows.Scan(&record.CheckInID, &record.EventID, &record.Username, &record.WalletAddress, &record.NFTID,
+            &record.ActionID, &record.CreatedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan check-in: %w", err)
+        }
+        checkIns = append(checkIns, record)
+    }
+
+    return checkIns, rows.Err()
+}
@@ -0,0 +1,238 @@
+package nftdatabase
+
+import (
+    "context"
+    "fmt"
+    "time"
+)
+
+// Level-up queue statuses. Confirmed entries were applied by an on-chain
+// incrementTokenLevel call; recorded ones were applied off-chain only.
+const (
+    LevelUpQueued    = "queued"
+    LevelUpSubmitted = "submitted"
+    LevelUpConfirmed = "confirmed"
+    LevelUpRecorded  = "recorded"
+    LevelUpFailed    = "failed"
+)
+
+// LevelUpRequest is a row of level_up_queue: one level step earned by a token
+type LevelUpRequest struct {
+    RequestID       int       `json:"request_id"`
+    NFTID           int       `json:"nft_id"`
+    ContractAddress string    `json:"contract_address"`
+    TokenID         string    `json:"token_id"`
+    FromLevel       int       `json:"from_level"`
+    ToLevel         int       `json:"to_level"`
+    Source          string    `json:"source"`
+    SourceRef       *string   `json:"source_ref"`
+    Status          string    `json:"status"`
+    Attempts        int       `json:"attempts"`
+    TxHash          *string   `json:"tx_hash"`
+    RawTx           []byte    `json:"-"`
+    LastError       *string   `json:"last_error"`
+    CreatedAt       time.Time `json:"created_at"`
+    // PendingFor is how long ago the stored transaction was built
+    PendingFor      time.Duration `json:"-"`
+}
+
+const levelUpColumns = `
+    request_id, nft_id, contract_address, token_id, from_level, to_level, source, source_ref,
+    status, attempts, tx_hash, raw_tx, last_error, created_at
+`
+
+// ClaimLevelUps leases up to limit due level-ups to the caller, the same way
+// ClaimQueuedMints does. A token's steps are handed out in order: a step is
+// not claimed while an earlier one for the same token is still in flight.
+func (db *NFTDatabase) ClaimLevelUps(limit int, lease time.Duration) ([]LevelUpRequest, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        WITH due AS (
+            SELECT request_id
+            FROM level_up_queue q
+            WHERE status IN ($1, $2)
+              AND COALESCE(next_attempt_at, CURRENT_TIMESTAMP) <= CURRENT_TIMESTAMP
+              AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+              AND NOT EXISTS (
+                  SELECT 1 FROM level_up_queue p
+                  WHERE p.nft_id = q.nft_id AND p.to_level < q.to_level AND p.status IN ($1, $2)
+              )
+            ORDER BY request_id
+            LIMIT $3
+            FOR UPDATE SKIP LOCKED
+        )
+        UPDATE level_up_queue l
+        SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $4), updated_at = CURRENT_TIMESTAMP
+        FROM due
+        WHERE l.request_id = due.request_id
+        RETURNING l.request_id, l.nft_id, l.contract_address, l.token_id, l.from_level, l.to_level, l.source, l.source_ref,
+                  l.status, l.attempts, l.tx_hash, l.raw_tx, l.last_error, l.created_at,
+                  COALESCE(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - l.submitted_at), 0)::float8
+    `, LevelUpQueued, LevelUpSubmitted, limit, lease.Seconds())
+    if err != nil {
+        return nil, fmt.Errorf("failed to claim level-ups: %w", err)
+    }
+    defer rows.Close()
+
+    var requests []LevelUpRequest
+    for rows.Next() {
+        var request LevelUpRequest
+        var pendingSeconds float64
+        if err := rows.Scan(&request.RequestID, &request.NFTID, &request.ContractAddress, &request.TokenID, &request.FromLevel,
+            &request.ToLevel, &request.Source, &request.SourceRef, &request.Status, &request.Attempts, &request.TxHash,
+            &request.RawTx, &request.LastError, &request.CreatedAt, &pendingSeconds); err != nil {
+            return nil, fmt.Errorf("failed to scan level-up: %w", err)
+        }
+        request.PendingFor = time.Duration(pendingSeconds * float64(time.Second))
+        requests = append(requests, request)
+    }
+
+    return requests, rows.Err()
+}
+
+// RecordLevelUpSubmission stores a signed incrementTokenLevel transaction
+// before it is broadcast, so it is rebroadcast rather than rebuilt after a crash.
+// Attempts are only counted by RetryLevelUp.
+func (db *NFTDatabase) RecordLevelUpSubmission(requestID int, txHash string, rawTx []byte) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE level_up_queue
+        SET status = $2, tx_hash = $3, raw_tx = $4, submitted_at = CURRENT_TIMESTAMP, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE request_id = $1
+    `, requestID, LevelUpSubmitted, txHash, rawTx)
+    if err != nil {
+        return fmt.Errorf("failed to record level-up submission: %w", err)
+    }
+
+    return nil
+}
+
+// ScheduleLevelUpCheck releases the lease and looks at the level-up again after delay
+func (db *NFTDatabase) ScheduleLevelUpCheck(requestID int, delay time.Duration) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE level_up_queue
+        SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2), claimed_until = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE request_id = $1
+    `, requestID, delay.Seconds())
+    if err != nil {
+        return fmt.Errorf("failed to schedule level-up check: %w", err)
+    }
+
+    return nil
+}
+
+// RetryLevelUp records a failed attempt and backs off, discarding the stored
+// transaction when resetTx is set. After maxAttempts the level-up is marked
+// failed, which also frees the level to be earned again.
+func (db *NFTDatabase) RetryLevelUp(requestID int, levelErr error, delay time.Duration, resetTx bool, maxAttempts int) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE level_up_queue
+        SET attempts = attempts + 1,
+            last_error = $2,
+            status = CASE WHEN attempts + 1 >= $5 THEN $6
+                          WHEN $4 THEN $7
+                          ELSE status END,
+            tx_hash = CASE WHEN $4 THEN NULL ELSE tx_hash END,
+            raw_tx = CASE WHEN $4 THEN NULL ELSE raw_tx END,
+            submitted_at = CASE WHEN $4 THEN NULL ELSE submitted_at END,
+            next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3),
+            claimed_until = NULL,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE request_id = $1
+    `, requestID, levelErr.Error(), delay.Seconds(), resetTx, maxAttempts, LevelUpFailed, LevelUpQueued)
+    if err != nil {
+        return fmt.Errorf("failed to schedule level-up retry: %w", err)
+    }
+
+    return nil
+}
+
+// CompleteLevelUp marks a level-up confirmed (on-chain, with the block it was
+// mined in) or recorded (off-chain, blockNumber nil) and moves the token to
+// its new level. A token that already reached the level some other way, such
+// as through staking, keeps its level and only the queue entry is closed.
+func (db *NFTDatabase) CompleteLevelUp(request LevelUpRequest, blockNumber *uint64) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    status := LevelUpRecorded
+    var block *int64
+    if blockNumber != nil {
+        status = LevelUpConfirmed
+        b := int64(*blockNumber)
+        block = &b
+    }
+
+    tag, err := tx.Exec(ctx, `
+        UPDATE level_up_queue
+        SET status = $2, block_number = $3, claimed_until = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE request_id = $1 AND status IN ($4, $5)
+    `, request.RequestID, status, block, LevelUpQueued, LevelUpSubmitted)
+    if err != nil {
+        return fmt.Errorf("failed to complete level-up: %w", err)
+    }
+    if tag.RowsAffected() == 0 {
+        return nil
+    }
+
+    var level int
+    if err := tx.QueryRow(ctx, `SELECT level FROM nfts WHERE nft_id = $1 FOR UPDATE`, request.NFTID).Scan(&level); err != nil {
+        return fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if level < request.ToLevel {
+        sourceRef := fmt.Sprintf("level_up:%d", request.RequestID)
+        if request.TxHash != nil && blockNumber != nil {
+            sourceRef = *request.TxHash
+        }
+        if _, err := applyLevelChangeTx(ctx, tx, request.NFTID, request.ToLevel, request.Source, sourceRef, "", nil); err != nil {
+            return err
+        }
+    }
+
+    return tx.Commit(ctx)
+}
+
+// GetLevelUps returns a token's level-up queue entries, newest first
+func (db *NFTDatabase) GetLevelUps(nftID int) ([]LevelUpRequest, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+levelUpColumns+` FROM level_up_queue WHERE nft_id = $1 ORDER BY request_id DESC
+    `, nftID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch level-ups: %w", err)
+    }
+    defer rows.Close()
+
+    requests := []LevelUpRequest{}
+    for rows.Next() {
+        var request LevelUpRequest
+        var pendingSeconds float64
+        if err := rows.Scan(&request.RequestID, &request.NFTID, &request.ContractAddress, &request.TokenID, &request.FromLevel,
+            &request.ToLevel, &request.Source, &request.SourceRef, &request.Status, &request.Attempts, &request.TxHash,
+            &request.RawTx, &request.LastError, &request.CreatedAt, &pendingSeconds); err != nil {
+            return nil, fmt.Errorf("failed to scan level-up: %w", err)
+        }
+        request.PendingFor = time.Duration(pendingSeconds * float64(time.Second))
+        requests = append(requests, request)
+    }
+
+    return requests, rows.Err()
+}
@@ -0,0 +1,281 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// Listing statuses
+const (
+    ListingActive    = "active"
+    ListingReserved  = "reserved"
+    ListingSold      = "sold"
+    ListingCancelled = "cancelled"
+    ListingExpired   = "expired"
+)
+
+var (
+    ErrListingNotFound    = errors.New("listing not found")
+    ErrListingNotSeller   = errors.New("only the seller can modify this listing")
+    ErrListingNotActive   = errors.New("listing is no longer active")
+    ErrTokenAlreadyListed = errors.New("token already has an active listing")
+)
+
+// Listing is a marketplace listing for a single on-chain token
+type Listing struct {
+    ListingID       int        `json:"listing_id"`
+    ContractAddress string     `json:"contract_address"`
+    TokenID         string     `json:"token_id"`
+    ReleaseName     string     `json:"release_name"`
+    SellerUsername  string     `json:"seller_username"`
+    SellerAddress   string     `json:"seller_address"`
+    Price           float64    `json:"price"`
+    Currency        string     `json:"currency"`
+    ImageURL        string     `json:"image_url"`
+    Level           int        `json:"level"`
+    Status          string     `json:"status"`
+    ListedAt        time.Time  `json:"listed_at"`
+    ExpiresAt       *time.Time `json:"expires_at"`
+    UpdatedAt       time.Time  `json:"updated_at"`
+    // ReleaseID is the release the token was minted for, when it is tracked
+    ReleaseID       *int       `json:"release_id"`
+    // MediaThumbnail and MediaWeb link the release's resized images. The
+    // database does not fill them; handlers do from the release.
+    MediaThumbnail  string     `json:"media_thumbnail,omitempty"`
+    MediaWeb        string     `json:"media_web,omitempty"`
+
+    // exactPrice is the stored NUMERIC price as text, which cursors carry so
+    // paging is not thrown off by float rounding
+    exactPrice string
+}
+
+// NewListing holds the seller-supplied fields of a listing
+type NewListing struct {
+    ContractAddress string
+    TokenID         string
+    ReleaseName     string
+    SellerUsername  string
+    SellerAddress   string
+    SellerWallets   []string
+    Price           float64
+    Currency        string
+    ImageURL        string
+    ExpiresAt       *time.Time
+}
+
+const listingColumns = `
+    listing_id, COALESCE(contract_address, ''), COALESCE(token_id, ''), release_name,
+    COALESCE(seller_username, ''), seller_address, price::float8, currency, COALESCE(image_url, ''),
+    level, status, listed_at, expires_at, COALESCE(updated_at, listed_at), price::text,
+    (SELECT n.release_id FROM nfts n
+     WHERE n.contract_address = marketplace_listings.contract_address AND n.token_id = marketplace_listings.token_id)
+`
+
+func scanListing(row pgx.Row) (*Listing, error) {
+    var listing Listing
+    err := row.Scan(&listing.ListingID, &listing.ContractAddress, &listing.TokenID, &listing.ReleaseName,
+        &listing.SellerUsername, &listing.SellerAddress, &listing.Price, &listing.Currency, &listing.ImageURL,
+        &listing.Level, &listing.Status, &listing.ListedAt, &listing.ExpiresAt, &listing.UpdatedAt, &listing.exactPrice,
+        &listing.ReleaseID)
+    if err != nil {
+        return nil, err
+    }
+    return &listing, nil
+}
+
+// InsertListing inserts a new active listing into the marketplace_listings
+// table. The seller must own the token, either by account or through one of
+// their verified wallets.
+func (db *NFTDatabase) InsertListing(listing NewListing) (*Listing, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    contractAddress := strings.ToLower(listing.ContractAddress)
+    wallets := make([]string, len(listing.SellerWallets))
+    for i, wallet := range listing.SellerWallets {
+        wallets[i] = strings.ToLower(wallet)
+    }
+
+    // The level is copied onto the listing here; level changes keep it in
+    // step from then on
+    var ownerUsername, ownerAddress *string
+    var level int
+    err = tx.QueryRow(ctx, `
+        SELECT owner_username, owner_address, level FROM nfts WHERE contract_address = $1 AND token_id = $2 FOR UPDATE
+    `, contractAddress, listing.TokenID).Scan(&ownerUsername, &ownerAddress, &level)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if !ownsToken(listing.SellerUsername, wallets, ownerUsername, ownerAddress) {
+        return nil, ErrNotTokenOwner
+    }
+
+    // A token that is offered for rent or rented out cannot be sold until the
+    // offer is withdrawn
+    var offered bool
+    if err := tx.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM rental_offers WHERE contract_address = $1 AND token_id = $2 AND status IN ($3, $4)
+        )
+    `, contractAddress, listing.TokenID, RentalOfferActive, RentalOfferRented).Scan(&offered); err != nil {
+        return nil, fmt.Errorf("failed to check rental offers: %w", err)
+    }
+    if offered {
+        return nil, ErrTokenOfferedForRent
+    }
+
+    // A listing past its expiry no longer counts as active even if the expiry
+    // worker has not caught up, so it must not block relisting the token
+    if _, err := tx.Exec(ctx, `
+        UPDATE marketplace_listings SET status = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE contract_address = $1 AND token_id = $2 AND status = $4 AND expires_at <= CURRENT_TIMESTAMP
+    `, contractAddress, listing.TokenID, ListingExpired, ListingActive); err != nil {
+        return nil, fmt.Errorf("failed to expire stale listings: %w", err)
+    }
+
+    // Contract addresses are stored lowercase so lookups are case-insensitive
+    created, err := scanListing(tx.QueryRow(ctx, `
+        INSERT INTO marketplace_listings (contract_address, token_id, release_name, seller_username, seller_address, price, currency, image_url, status, expires_at, level)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+        RETURNING `+listingColumns,
+        contractAddress, listing.TokenID, listing.ReleaseName, listing.SellerUsername, listing.SellerAddress,
+        listing.Price, listing.Currency, listing.ImageURL, ListingActive, listing.ExpiresAt, level))
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return nil, ErrTokenAlreadyListed
+        }
+        return nil, fmt.Errorf("failed to insert listing: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit listing: %w", err)
+    }
+
+    return created, nil
+}
+
+// ownsToken reports whether a seller holds a token through their account or
+// one of their lowercased verified wallets
+func ownsToken(sellerUsername string, wallets []string, ownerUsername, ownerAddress *string) bool {
+    if ownerUsername != nil && *ownerUsername == sellerUsername {
+        return true
+    }
+    if ownerAddress == nil {
+        return false
+    }
+    for _, wallet := range wallets {
+        if wallet == strings.ToLower(*ownerAddress) {
+            return true
+        }
+    }
+    return false
+}
+
+// GetListing fetches a single listing regardless of status
+func (db *NFTDatabase) GetListing(listingID int) (*Listing, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    listing, err := scanListing(db.Pool.QueryRow(ctx, `SELECT `+listingColumns+` FROM marketplace_listings WHERE listing_id = $1`, listingID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrListingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch listing: %w", err)
+    }
+
+    return listing, nil
+}
+
+// UpdateListingPrice changes the price of an active listing owned by sellerUsername
+func (db *NFTDatabase) UpdateListingPrice(listingID int, sellerUsername string, price float64) (*Listing, error) {
+    return db.modifyListing(listingID, sellerUsername, `price = $2`, price)
+}
+
+// CancelListing withdraws an active listing owned by sellerUsername
+func (db *NFTDatabase) CancelListing(listingID int, sellerUsername string) (*Listing, error) {
+    return db.modifyListing(listingID, sellerUsername, `status = $2`, ListingCancelled)
+}
+
+// modifyListing applies set to a listing after checking, under a row lock,
+// that the caller is the seller and the listing is still active
+func (db *NFTDatabase) modifyListing(listingID int, sellerUsername, set string, value interface{}) (*Listing, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var seller *string
+    var status string
+    var expired bool
+    err = tx.QueryRow(ctx, `
+        SELECT seller_username, status, COALESCE(expires_at <= CURRENT_TIMESTAMP, FALSE)
+        FROM marketplace_listings
+        WHERE listing_id = $1
+        FOR UPDATE
+    `, listingID).Scan(&seller, &status, &expired)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrListingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch listing: %w", err)
+    }
+
+    if seller == nil || *seller != sellerUsername {
+        return nil, ErrListingNotSeller
+    }
+    if status != ListingActive || expired {
+        return nil, ErrListingNotActive
+    }
+
+    listing, err := scanListing(tx.QueryRow(ctx, `
+        UPDATE marketplace_listings SET `+set+`, updated_at = CURRENT_TIMESTAMP
+        WHERE listing_id = $1
+        RETURNING `+listingColumns, listingID, value))
+    if err != nil {
+        return nil, fmt.Errorf("failed to update listing: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit listing update: %w", err)
+    }
+
+    return listing, nil
+}
+
+// ExpireListings marks active listings past their expiry as expired
+func (db *NFTDatabase) ExpireListings() (int64, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tag, err := db.Pool.Exec(ctx, `
+        UPDATE marketplace_listings
+        SET status = $1, updated_at = CURRENT_TIMESTAMP
+        WHERE status = $2 AND expires_at <= CURRENT_TIMESTAMP
+    `, ListingExpired, ListingActive)
+    if err != nil {
+        return 0, fmt.Errorf("failed to expire listings: %w", err)
+    }
+
+    return tag.RowsAffected(), nil
+}
@@ -0,0 +1,234 @@
+package nftdatabase
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "regexp"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// Listing sort orders
+const (
+    SortNewest    = "newest"
+    SortPriceAsc  = "price_asc"
+    SortPriceDesc = "price_desc"
+    SortLevelAsc  = "level_asc"
+    SortLevelDesc = "level_desc"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// listingSort describes how a sort order maps onto SQL. key is the column the
+// listings are ordered by; listing_id breaks ties so cursors are stable.
+type listingSort struct {
+    key  string
+    cast string
+    desc bool
+}
+
+var listingSorts = map[string]listingSort{
+    SortNewest:    {key: "listed_at", cast: "timestamp", desc: true},
+    SortPriceAsc:  {key: "price", cast: "numeric", desc: false},
+    SortPriceDesc: {key: "price", cast: "numeric", desc: true},
+    SortLevelAsc:  {key: "level", cast: "integer", desc: false},
+    SortLevelDesc: {key: "level", cast: "integer", desc: true},
+}
+
+// IsValidListingSort reports whether sort is a supported sort order
+func IsValidListingSort(sort string) bool {
+    _, ok := listingSorts[sort]
+    return ok
+}
+
+// ListingFilter narrows the active listings query. Zero values match everything.
+type ListingFilter struct {
+    MinPrice    *float64
+    MaxPrice    *float64
+    Seller      string // seller username or wallet address
+    Release     string // case-insensitive substring of the release name
+    MinLevel    *int
+    MaxLevel    *int
+    ListedSince *time.Time
+    Sort        string
+    Cursor      string
+    Limit       int
+}
+
+// ListingPage is one page of listings plus the cursor for the next page
+type ListingPage struct {
+    Listings   []Listing `json:"listings"`
+    Total      int       `json:"total"`
+    NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// listingCursor is the opaque position handed back to clients. It records
+// the sort it was issued for so it cannot be replayed against another order.
+type listingCursor struct {
+    Sort  string `json:"s"`
+    Value string `json:"v"`
+    ID    int    `json:"id"`
+}
+
+func encodeListingCursor(sort string, listing Listing) string {
+    cursor := listingCursor{Sort: sort, ID: listing.ListingID}
+    switch listingSorts[sort].key {
+    case "listed_at":
+        cursor.Value = listing.ListedAt.Format(time.RFC3339Nano)
+    case "price":
+        cursor.Value = listing.exactPrice
+    case "level":
+        cursor.Value = strconv.Itoa(listing.Level)
+    }
+
+    raw, _ := json.Marshal(cursor)
+    return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decimalPattern matches the plain decimals price cursors are issued with
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// decodeListingCursor checks the cursor's value parses as its sort key's
+// type, so a tampered cursor is rejected here rather than failing the query
+func decodeListingCursor(encoded, sort string) (*listingCursor, error) {
+    raw, err := base64.RawURLEncoding.DecodeString(encoded)
+    if err != nil {
+        return nil, ErrInvalidCursor
+    }
+
+    var cursor listingCursor
+    if err := json.Unmarshal(raw, &cursor); err != nil || cursor.Sort != sort || cursor.ID <= 0 || cursor.ID > math.MaxInt32 {
+        return nil, ErrInvalidCursor
+    }
+
+    switch listingSorts[sort].key {
+    case "listed_at":
+        _, err = time.Parse(time.RFC3339Nano, cursor.Value)
+    case "price":
+        if !decimalPattern.MatchString(cursor.Value) {
+            err = ErrInvalidCursor
+        }
+    case "level":
+        _, err = strconv.ParseInt(cursor.Value, 10, 32)
+    }
+    if err != nil {
+        return nil, ErrInvalidCursor
+    }
+
+    return &cursor, nil
+}
+
+// likeEscaper escapes the LIKE wildcards in user input so it matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+    return likeEscaper.Replace(s)
+}
+
+// QueryListings returns a page of active, unexpired listings matching filter.
+// Total counts every match, not just the current page.
+func (db *NFTDatabase) QueryListings(filter ListingFilter) (*ListingPage, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    if filter.Sort == "" {
+        filter.Sort = SortNewest
+    }
+    sort, ok := listingSorts[filter.Sort]
+    if !ok {
+        return nil, fmt.Errorf("unknown sort %q", filter.Sort)
+    }
+    if filter.Limit <= 0 || filter.Limit > 100 {
+        filter.Limit = 24
+    }
+
+    conditions := []string{"status = $1", "(expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)"}
+    args := []interface{}{ListingActive}
+    addCondition := func(format string, values ...interface{}) {
+        placeholders := make([]interface{}, len(values))
+        for i, value := range values {
+            args = append(args, value)
+            placeholders[i] = len(args)
+        }
+        conditions = append(conditions, fmt.Sprintf(format, placeholders...))
+    }
+
+    if filter.MinPrice != nil {
+        addCondition("price >= $%d", *filter.MinPrice)
+    }
+    if filter.MaxPrice != nil {
+        addCondition("price <= $%d", *filter.MaxPrice)
+    }
+    if filter.Seller != "" {
+        addCondition("(seller_username = $%d OR LOWER(seller_address) = LOWER($%d))", filter.Seller, filter.Seller)
+    }
+    if filter.Release != "" {
+        addCondition(`release_name ILIKE '%%' || $%d || '%%' ESCAPE '\'`, escapeLike(filter.Release))
+    }
+    if filter.MinLevel != nil {
+        addCondition("level >= $%d", *filter.MinLevel)
+    }
+    if filter.MaxLevel != nil {
+        addCondition("level <= $%d", *filter.MaxLevel)
+    }
+    if filter.ListedSince != nil {
+        addCondition("listed_at >= $%d", *filter.ListedSince)
+    }
+
+    var total int
+    err := db.Pool.QueryRow(ctx, `SELECT COUNT(*) FROM marketplace_listings WHERE `+strings.Join(conditions, " AND "), args...).Scan(&total)
+    if err != nil {
+        return nil, fmt.Errorf("failed to count listings: %w", err)
+    }
+
+    direction, comparison := "ASC", ">"
+    if sort.desc {
+        direction, comparison = "DESC", "<"
+    }
+
+    if filter.Cursor != "" {
+        cursor, err := decodeListingCursor(filter.Cursor, filter.Sort)
+        if err != nil {
+            return nil, err
+        }
+        addCondition("("+sort.key+", listing_id) "+comparison+" ($%d::"+sort.cast+", $%d)", cursor.Value, cursor.ID)
+    }
+
+    // Fetch one extra row to learn whether another page follows
+    args = append(args, filter.Limit+1)
+    rows, err := db.Pool.Query(ctx, fmt.Sprintf(`
+        SELECT %s
+        FROM marketplace_listings
+        WHERE %s
+        ORDER BY %s %s, listing_id %s
+        LIMIT $%d
+    `, listingColumns, strings.Join(conditions, " AND "), sort.key, direction, direction, len(args)), args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch listings: %w", err)
+    }
+    defer rows.Close()
+
+    page := &ListingPage{Listings: []Listing{}, Total: total}
+    for rows.Next() {
+        listing, err := scanListing(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan row: %w", err)
+        }
+        page.Listings = append(page.Listings, *listing)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to fetch listings: %w", err)
+    }
+
+    if len(page.Listings) > filter.Limit {
+        page.Listings = page.Listings[:filter.Limit]
+        page.NextCursor = encodeListingCursor(filter.Sort, page.Listings[filter.Limit-1])
+    }
+
+    return page, nil
+}
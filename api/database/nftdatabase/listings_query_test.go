@@ -0,0 +1,46 @@
+package nftdatabase
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestDecodeListingCursor(t *testing.T) {
+    issued := encodeListingCursor(SortNewest, Listing{ListingID: 7, ListedAt: time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)})
+    if cursor, err := decodeListingCursor(issued, SortNewest); err != nil || cursor.ID != 7 {
+        t.Fatalf("issued cursor: %+v, %v", cursor, err)
+    }
+
+    encode := func(cursor listingCursor) string {
+        raw, _ := json.Marshal(cursor)
+        return base64.RawURLEncoding.EncodeToString(raw)
+    }
+    tests := []struct {
+        name    string
+        encoded string
+        sort    string
+        ok      bool
+    }{
+        {"price", encode(listingCursor{Sort: SortPriceAsc, Value: "0.125", ID: 3}), SortPriceAsc, true},
+        {"level", encode(listingCursor{Sort: SortLevelDesc, Value: "4", ID: 3}), SortLevelDesc, true},
+        {"not base64", "%%%", SortNewest, false},
+        {"other sort", issued, SortPriceAsc, false},
+        {"bad time", encode(listingCursor{Sort: SortNewest, Value: "yesterday", ID: 3}), SortNewest, false},
+        {"bad price", encode(listingCursor{Sort: SortPriceDesc, Value: "1e400", ID: 3}), SortPriceDesc, false},
+        {"injected price", encode(listingCursor{Sort: SortPriceAsc, Value: "1); DROP TABLE x", ID: 3}), SortPriceAsc, false},
+        {"bad level", encode(listingCursor{Sort: SortLevelAsc, Value: "99999999999", ID: 3}), SortLevelAsc, false},
+        {"bad id", encode(listingCursor{Sort: SortLevelAsc, Value: "1", ID: 1 << 40}), SortLevelAsc, false},
+    }
+    for _, tt := range tests {
+        _, err := decodeListingCursor(tt.encoded, tt.sort)
+        if tt.ok && err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+        }
+        if !tt.ok && !errors.Is(err, ErrInvalidCursor) {
+            t.Errorf("%s: err = %v, want ErrInvalidCursor", tt.name, err)
+        }
+    }
+}
@@ -63,86 +63,447 @@ func InitializeNFTDatabase(pool *pgxpool.Pool) error {
         );
     `
 
-    // Execute the table creation queries
-    queries := []string{
-        createMarketplaceListingsTable,
-        createFreshMintsTable,
-        createQueuedMintsTable,
-    }
+    // Each queued mint remembers the release it came from, so delivering the
+    // same approval twice cannot queue a second mint
+    addQueuedMintsReleaseID := `
+        ALTER TABLE queued_mints ADD COLUMN IF NOT EXISTS release_id INT;
+    `
+    createQueuedMintsReleaseIndex := `
+        CREATE UNIQUE INDEX IF NOT EXISTS queued_mints_release_id_idx
+            ON queued_mints (release_id) WHERE release_id IS NOT NULL;
+    `
 
-    for _, query := range queries {
-        if _, err := pool.Exec(ctx, query); err != nil {
-            return fmt.Errorf("failed to execute query (%s): %w", query, err)
-        }
-    }
+    // Mint worker bookkeeping: queued mints move through
+    // queued -> submitted -> confirmed (or failed) and are copied into fresh_mints
+    addQueuedMintsWorkerColumns := `
+        ALTER TABLE queued_mints
+            ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'queued',
+            ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0,
+            ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            ADD COLUMN IF NOT EXISTS claimed_until TIMESTAMP,
+            ADD COLUMN IF NOT EXISTS recipient_address TEXT,
+            ADD COLUMN IF NOT EXISTS token_uri TEXT,
+            ADD COLUMN IF NOT EXISTS tx_hash TEXT,
+            ADD COLUMN IF NOT EXISTS raw_tx BYTEA,
+            ADD COLUMN IF NOT EXISTS last_error TEXT,
+            ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+    `
+    // When the stored transaction was built, so one that never mines can be
+    // given up on. Transactions already in flight start their clock now.
+    addQueuedMintsSubmittedAt := `
+        ALTER TABLE queued_mints ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMP;
+        UPDATE queued_mints SET submitted_at = CURRENT_TIMESTAMP WHERE tx_hash IS NOT NULL AND submitted_at IS NULL;
+    `
+    addFreshMintsTokenColumns := `
+        ALTER TABLE fresh_mints
+            ADD COLUMN IF NOT EXISTS queue_id INT UNIQUE,
+            ADD COLUMN IF NOT EXISTS release_id INT,
+            ADD COLUMN IF NOT EXISTS contract_address TEXT,
+            ADD COLUMN IF NOT EXISTS token_id TEXT,
+            ADD COLUMN IF NOT EXISTS token_uri TEXT,
+            ADD COLUMN IF NOT EXISTS tx_hash TEXT,
+            ADD COLUMN IF NOT EXISTS block_number BIGINT;
+    `
 
-    return nil
-}
+    // Listings are keyed to an on-chain token and owned by a seller account.
+    // Legacy rows keep their release_name and get NULL token columns.
+    addMarketplaceListingColumns := `
+        ALTER TABLE marketplace_listings
+            ADD COLUMN IF NOT EXISTS contract_address TEXT,
+            ADD COLUMN IF NOT EXISTS token_id TEXT,
+            ADD COLUMN IF NOT EXISTS seller_username TEXT,
+            ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'ETH',
+            ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active',
+            ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP,
+            ADD COLUMN IF NOT EXISTS level INTEGER NOT NULL DEFAULT 1,
+            ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+    `
+    // Rewriting the column takes an exclusive lock, so only do it once
+    alterMarketplaceListingPrice := `
+        DO $$
+        BEGIN
+            IF EXISTS (
+                SELECT 1 FROM information_schema.columns
+                WHERE table_schema = current_schema() AND table_name = 'marketplace_listings'
+                  AND column_name = 'price' AND (data_type <> 'numeric' OR numeric_precision IS DISTINCT FROM 36 OR numeric_scale IS DISTINCT FROM 18)
+            ) THEN
+                ALTER TABLE marketplace_listings ALTER COLUMN price TYPE NUMERIC(36, 18);
+            END IF;
+        END
+        $$;
+    `
+    // A token can only be actively listed once
+    createActiveListingIndex := `
+        CREATE UNIQUE INDEX IF NOT EXISTS marketplace_listings_active_token_idx
+            ON marketplace_listings (contract_address, token_id)
+            WHERE status = 'active' AND token_id IS NOT NULL;
+    `
 
-// InsertListing inserts a new listing into the marketplace_listings table
-func (db *NFTDatabase) InsertListing(nftID, sellerAddress string, price float64, imageURL string) error {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
+    // Indexes backing the market page's sort orders
+    createListingSortIndexes := `
+        CREATE INDEX IF NOT EXISTS marketplace_listings_price_idx ON marketplace_listings (status, price, listing_id);
+        CREATE INDEX IF NOT EXISTS marketplace_listings_listed_at_idx ON marketplace_listings (status, listed_at, listing_id);
+        CREATE INDEX IF NOT EXISTS marketplace_listings_level_idx ON marketplace_listings (status, level, listing_id);
+    `
 
-    query := `
-        INSERT INTO marketplace_listings (nft_id, seller_address, price, image_url)
-        VALUES ($1, $2, $3, $4)
+    // A purchase reserves a listing and records a pending order until the
+    // buyer's payment verifies on chain
+    createMarketplaceOrdersTable := `
+        CREATE TABLE IF NOT EXISTS marketplace_orders (
+            order_id SERIAL PRIMARY KEY,
+            listing_id INTEGER NOT NULL REFERENCES marketplace_listings(listing_id),
+            contract_address TEXT NOT NULL,
+            token_id TEXT NOT NULL,
+            release_name TEXT NOT NULL,
+            buyer_username TEXT NOT NULL,
+            buyer_address TEXT NOT NULL,
+            seller_username TEXT NOT NULL,
+            seller_address TEXT NOT NULL,
+            price NUMERIC(36, 18) NOT NULL,
+            currency TEXT NOT NULL,
+            status TEXT NOT NULL DEFAULT 'pending',
+            tx_hash TEXT UNIQUE,
+            block_number BIGINT,
+            failure_reason TEXT,
+            reserved_until TIMESTAMP NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS marketplace_orders_pending_listing_idx
+            ON marketplace_orders (listing_id) WHERE status = 'pending';
+        ALTER TABLE marketplace_orders ADD COLUMN IF NOT EXISTS transfer_tx_hash TEXT;
+        CREATE UNIQUE INDEX IF NOT EXISTS marketplace_orders_transfer_tx_idx
+            ON marketplace_orders (transfer_tx_hash);
+        ALTER TABLE marketplace_orders ADD COLUMN IF NOT EXISTS payment_submitted_at TIMESTAMP;
+        UPDATE marketplace_orders SET payment_submitted_at = updated_at
+            WHERE tx_hash IS NOT NULL AND payment_submitted_at IS NULL;
     `
-    _, err := db.Pool.Exec(ctx, query, nftID, sellerAddress, price, imageURL)
-    if err != nil {
-        return fmt.Errorf("failed to insert listing: %w", err)
-    }
 
-    return nil
-}
+    // Indexer progress, one row per indexed contract
+    createChainCheckpointsTable := `
+        CREATE TABLE IF NOT EXISTS chain_checkpoints (
+            name TEXT PRIMARY KEY,
+            block_number BIGINT NOT NULL,
+            block_hash TEXT NOT NULL,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+    `
+    // NFTStaker events decoded by the staking indexer
+    createStakingEventsTable := `
+        CREATE TABLE IF NOT EXISTS staking_events (
+            event_id SERIAL PRIMARY KEY,
+            staker_contract TEXT NOT NULL,
+            token_contract TEXT NOT NULL,
+            token_id TEXT NOT NULL,
+            event_type TEXT NOT NULL,
+            staker_address TEXT NOT NULL,
+            new_level INTEGER,
+            block_number BIGINT NOT NULL,
+            block_hash TEXT NOT NULL,
+            block_time TIMESTAMP NOT NULL,
+            tx_hash TEXT NOT NULL,
+            log_index INTEGER NOT NULL,
+            UNIQUE (tx_hash, log_index)
+        );
+        CREATE INDEX IF NOT EXISTS staking_events_token_idx
+            ON staking_events (token_contract, token_id, block_number, log_index);
+        CREATE INDEX IF NOT EXISTS staking_events_staker_idx
+            ON staking_events (staker_address, block_number);
+    `
 
-// GetAllListings fetches all marketplace listings from the database
-func (db *NFTDatabase) GetAllListings() ([]map[string]interface{}, error) {
-    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-    defer cancel()
+    // Tokens the backend tracks, with their current level and owner
+    createNFTsTable := `
+        CREATE TABLE IF NOT EXISTS nfts (
+            nft_id SERIAL PRIMARY KEY,
+            contract_address TEXT NOT NULL,
+            token_id TEXT NOT NULL,
+            release_id INT,
+            release_name TEXT,
+            token_uri TEXT,
+            level INTEGER NOT NULL DEFAULT 1,
+            owner_username TEXT,
+            owner_address TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (contract_address, token_id)
+        );
+        CREATE INDEX IF NOT EXISTS nfts_owner_idx ON nfts (owner_username);
+    `
+    // Every level change and what caused it. Staking rows go away with their
+    // event if a reorg removes it.
+    createNFTLevelHistoryTable := `
+        CREATE TABLE IF NOT EXISTS nft_level_history (
+            change_id SERIAL PRIMARY KEY,
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            from_level INTEGER NOT NULL,
+            to_level INTEGER NOT NULL,
+            source TEXT NOT NULL,
+            source_ref TEXT,
+            granted_by TEXT,
+            staking_event_id INTEGER REFERENCES staking_events(event_id) ON DELETE CASCADE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS nft_level_history_nft_idx ON nft_level_history (nft_id, change_id);
+    `
 
-    rows, err := db.Pool.Query(ctx, "SELECT * FROM marketplace_listings")
-    if err != nil {
-        return nil, fmt.Errorf("failed to fetch listings: %w", err)
-    }
-    defer rows.Close()
+    // Engagement activities creators reward, the credits users earn from
+    // them, and the points a token needs for each level ('' is the default set)
+    createEngagementTables := `
+        CREATE TABLE IF NOT EXISTS engagement_activities (
+            activity_id SERIAL PRIMARY KEY,
+            creator_username TEXT NOT NULL,
+            name TEXT NOT NULL,
+            activity_type TEXT NOT NULL,
+            points INTEGER NOT NULL CHECK (points > 0),
+            contract_address TEXT,
+            max_per_user INTEGER,
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS engagement_activities_creator_idx ON engagement_activities (creator_username);
+        CREATE TABLE IF NOT EXISTS engagement_actions (
+            action_id SERIAL PRIMARY KEY,
+            activity_id INTEGER NOT NULL REFERENCES engagement_activities(activity_id),
+            username TEXT NOT NULL,
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            points INTEGER NOT NULL,
+            source_ref TEXT,
+            recorded_by TEXT NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            UNIQUE (activity_id, source_ref)
+        );
+        CREATE INDEX IF NOT EXISTS engagement_actions_nft_idx ON engagement_actions (nft_id);
+        CREATE INDEX IF NOT EXISTS engagement_actions_user_idx ON engagement_actions (activity_id, username);
+        CREATE TABLE IF NOT EXISTS engagement_level_thresholds (
+            contract_address TEXT NOT NULL DEFAULT '',
+            level INTEGER NOT NULL,
+            points_required INTEGER NOT NULL,
+            PRIMARY KEY (contract_address, level)
+        );
+        INSERT INTO engagement_level_thresholds (contract_address, level, points_required)
+        SELECT '', level, points_required
+        FROM (VALUES (2, 100), (3, 250), (4, 500), (5, 1000)) AS defaults (level, points_required)
+        WHERE NOT EXISTS (SELECT 1 FROM engagement_level_thresholds WHERE contract_address = '');
+    `
+    // Level-ups earned through engagement, applied one level at a time either
+    // by an on-chain incrementTokenLevel call or directly off-chain
+    createLevelUpQueueTable := `
+        CREATE TABLE IF NOT EXISTS level_up_queue (
+            request_id SERIAL PRIMARY KEY,
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            contract_address TEXT NOT NULL,
+            token_id TEXT NOT NULL,
+            from_level INTEGER NOT NULL,
+            to_level INTEGER NOT NULL,
+            source TEXT NOT NULL,
+            source_ref TEXT,
+            status TEXT NOT NULL DEFAULT 'queued',
+            attempts INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at TIMESTAMP,
+            claimed_until TIMESTAMP,
+            tx_hash TEXT,
+            raw_tx BYTEA,
+            block_number BIGINT,
+            last_error TEXT,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS level_up_queue_step_idx
+            ON level_up_queue (nft_id, to_level) WHERE status <> 'failed';
+        CREATE INDEX IF NOT EXISTS level_up_queue_due_idx
+            ON level_up_queue (status, next_attempt_at);
+        ALTER TABLE level_up_queue ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMP;
+        UPDATE level_up_queue SET submitted_at = CURRENT_TIMESTAMP WHERE tx_hash IS NOT NULL AND submitted_at IS NULL;
+    `
 
-    listings := []map[string]interface{}{}
+    // Creator events and the attendance check-ins that earn engagement
+    // credit. Each event signs its check-in codes with its own secret.
+    createEventTables := `
+        CREATE TABLE IF NOT EXISTS events (
+            event_id SERIAL PRIMARY KEY,
+            creator_username TEXT NOT NULL,
+            name TEXT NOT NULL,
+            description TEXT,
+            location TEXT,
+            starts_at TIMESTAMP NOT NULL,
+            ends_at TIMESTAMP NOT NULL,
+            activity_id INTEGER NOT NULL REFERENCES engagement_activities(activity_id),
+            checkin_secret BYTEA NOT NULL,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            CHECK (ends_at > starts_at)
+        );
+        CREATE INDEX IF NOT EXISTS events_starts_at_idx ON events (starts_at);
+        CREATE TABLE IF NOT EXISTS event_checkins (
+            checkin_id SERIAL PRIMARY KEY,
+            event_id INTEGER NOT NULL REFERENCES events(event_id),
+            username TEXT NOT NULL,
+            wallet_address TEXT NOT NULL,
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            code_nonce TEXT NOT NULL,
+            single_use BOOLEAN NOT NULL DEFAULT FALSE,
+            action_id INTEGER REFERENCES engagement_actions(action_id),
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            CONSTRAINT event_checkins_user_key UNIQUE (event_id, username),
+            CONSTRAINT event_checkins_nft_key UNIQUE (event_id, nft_id)
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS event_checkins_single_use_idx
+            ON event_checkins (event_id, code_nonce) WHERE single_use;
+    `
 
-    for rows.Next() {
-        var listingID int
-        var nftID, sellerAddress, imageURL string
-        var price float64
-        var listedAt time.Time
+    // Perks creators offer to holders of tokens at or above a level, claims
+    // against them, and the staff allowed to redeem a creator's perks
+    createPerkTables := `
+        CREATE TABLE IF NOT EXISTS perks (
+            perk_id SERIAL PRIMARY KEY,
+            creator_username TEXT NOT NULL,
+            title TEXT NOT NULL,
+            description TEXT,
+            min_level INTEGER NOT NULL DEFAULT 1,
+            contract_address TEXT,
+            total_supply INTEGER,
+            remaining_supply INTEGER CHECK (remaining_supply >= 0),
+            per_user_limit INTEGER NOT NULL DEFAULT 1,
+            starts_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+            ends_at TIMESTAMP,
+            active BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE INDEX IF NOT EXISTS perks_creator_idx ON perks (creator_username);
+        CREATE TABLE IF NOT EXISTS perk_claims (
+            claim_id SERIAL PRIMARY KEY,
+            perk_id INTEGER NOT NULL REFERENCES perks(perk_id),
+            username TEXT NOT NULL,
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            code_hash TEXT NOT NULL UNIQUE,
+            status TEXT NOT NULL DEFAULT 'claimed',
+            claimed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            redeemed_at TIMESTAMP,
+            redeemed_by TEXT,
+            UNIQUE (perk_id, nft_id)
+        );
+        CREATE INDEX IF NOT EXISTS perk_claims_user_idx ON perk_claims (username, perk_id);
+        CREATE TABLE IF NOT EXISTS perk_staff (
+            creator_username TEXT NOT NULL,
+            staff_username TEXT NOT NULL,
+            added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            PRIMARY KEY (creator_username, staff_username)
+        );
+    `
 
-        if err := rows.Scan(&listingID, &nftID, &sellerAddress, &price, &imageURL, &listedAt); err != nil {
-            return nil, fmt.Errorf("failed to scan row: %w", err)
-        }
+    // Rental offers owners make for their tokens and the agreements renters
+    // enter into. nfts.rented_to holds the renter while an agreement runs, so
+    // perks and engagement follow the renter rather than the owner.
+    createRentalTables := `
+        ALTER TABLE nfts ADD COLUMN IF NOT EXISTS rented_to TEXT;
+        CREATE TABLE IF NOT EXISTS rental_offers (
+            offer_id SERIAL PRIMARY KEY,
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            contract_address TEXT NOT NULL,
+            token_id TEXT NOT NULL,
+            owner_username TEXT NOT NULL,
+            owner_address TEXT NOT NULL,
+            daily_price NUMERIC(36, 18) NOT NULL CHECK (daily_price > 0),
+            currency TEXT NOT NULL DEFAULT 'ETH',
+            max_days INTEGER NOT NULL CHECK (max_days > 0),
+            collateral NUMERIC(36, 18) NOT NULL DEFAULT 0 CHECK (collateral >= 0),
+            status TEXT NOT NULL DEFAULT 'active',
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS rental_offers_open_token_idx
+            ON rental_offers (nft_id) WHERE status IN ('active', 'rented');
+        CREATE TABLE IF NOT EXISTS rental_agreements (
+            agreement_id SERIAL PRIMARY KEY,
+            offer_id INTEGER NOT NULL REFERENCES rental_offers(offer_id),
+            nft_id INTEGER NOT NULL REFERENCES nfts(nft_id),
+            contract_address TEXT NOT NULL,
+            token_id TEXT NOT NULL,
+            owner_username TEXT NOT NULL,
+            owner_address TEXT NOT NULL,
+            renter_username TEXT NOT NULL,
+            renter_address TEXT NOT NULL,
+            days INTEGER NOT NULL,
+            daily_price NUMERIC(36, 18) NOT NULL,
+            total_rent NUMERIC(36, 18) NOT NULL,
+            collateral NUMERIC(36, 18) NOT NULL,
+            currency TEXT NOT NULL,
+            status TEXT NOT NULL DEFAULT 'pending',
+            tx_hash TEXT UNIQUE,
+            block_number BIGINT,
+            failure_reason TEXT,
+            payment_due_at TIMESTAMP NOT NULL,
+            starts_at TIMESTAMP,
+            ends_at TIMESTAMP,
+            payment_recorded BOOLEAN NOT NULL DEFAULT FALSE,
+            collateral_recorded BOOLEAN NOT NULL DEFAULT FALSE,
+            created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+            updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE UNIQUE INDEX IF NOT EXISTS rental_agreements_open_offer_idx
+            ON rental_agreements (offer_id) WHERE status IN ('pending', 'active');
+        CREATE INDEX IF NOT EXISTS rental_agreements_renter_idx ON rental_agreements (renter_username);
+        CREATE INDEX IF NOT EXISTS rental_agreements_owner_idx ON rental_agreements (owner_username);
+        ALTER TABLE rental_agreements ADD COLUMN IF NOT EXISTS payment_submitted_at TIMESTAMP;
+        UPDATE rental_agreements SET payment_submitted_at = updated_at
+            WHERE tx_hash IS NOT NULL AND payment_submitted_at IS NULL;
+    `
 
-        listings = append(listings, map[string]interface{}{
-            "listing_id":     listingID,
-            "release_name":   nftID,
-            "seller_address": sellerAddress,
-            "price":          price,
-            "image_url":      imageURL,
-            "listed_at":      listedAt,
-        })
+    // Listings created without their token's level defaulted to 1
+    syncOpenListingLevels := `
+        UPDATE marketplace_listings l SET level = n.level
+        FROM nfts n
+        WHERE n.contract_address = l.contract_address AND n.token_id = l.token_id
+          AND l.status IN ('active', 'reserved') AND l.level <> n.level;
+    `
+
+    // Execute the table creation queries
+    queries := []string{
+        createMarketplaceListingsTable,
+        addMarketplaceListingColumns,
+        alterMarketplaceListingPrice,
+        createActiveListingIndex,
+        createListingSortIndexes,
+        createMarketplaceOrdersTable,
+        createChainCheckpointsTable,
+        createStakingEventsTable,
+        createNFTsTable,
+        createNFTLevelHistoryTable,
+        createEngagementTables,
+        createLevelUpQueueTable,
+        createEventTables,
+        createPerkTables,
+        createRentalTables,
+        createFreshMintsTable,
+        createQueuedMintsTable,
+        addQueuedMintsReleaseID,
+        createQueuedMintsReleaseIndex,
+        addQueuedMintsWorkerColumns,
+        addQueuedMintsSubmittedAt,
+        addFreshMintsTokenColumns,
+        syncOpenListingLevels,
     }
 
-    return listings, nil
+    for _, query := range queries {
+        if _, err := pool.Exec(ctx, query); err != nil {
+            return fmt.Errorf("failed to execute query (%s): %w", query, err)
+        }
+    }
+
+    return nil
 }
 
-func (db *NFTDatabase) QueueMint(request accountdatabase.ReleaseRequest) error {
+// QueueMint queues the mint for an approved release. It is idempotent per
+// release: delivering the same outbox entry again is a no-op.
+func (db *NFTDatabase) QueueMint(entry accountdatabase.MintOutboxEntry) error {
     ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
     defer cancel()
 
     query := `
-        INSERT INTO queued_mints (release_name, owner_address)
-        VALUES ($1, $2)
+        INSERT INTO queued_mints (release_id, release_name, owner_address)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (release_id) WHERE release_id IS NOT NULL DO NOTHING
     `
-    // Assuming nft_id is generated from the release title
-    releaseName := request.ReleaseTitle
-    _, err := db.Pool.Exec(ctx, query, releaseName, request.Username)
+    _, err := db.Pool.Exec(ctx, query, entry.ReleaseID, entry.ReleaseName, entry.OwnerUsername)
     if err != nil {
         return fmt.Errorf("failed to queue mint: %w", err)
     }
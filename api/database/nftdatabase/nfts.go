@@ -0,0 +1,314 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// Where a level change came from
+const (
+    LevelSourceStaking      = "staking"
+    LevelSourceEventCheckIn = "event_checkin"
+    LevelSourceCreatorGrant = "creator_grant"
+)
+
+var ErrNFTNotFound = errors.New("nft not found")
+
+// NFT is a token the backend tracks, with its current level and owner
+type NFT struct {
+    NFTID           int       `json:"nft_id"`
+    ContractAddress string    `json:"contract_address"`
+    TokenID         string    `json:"token_id"`
+    ReleaseID       *int      `json:"release_id"`
+    ReleaseName     *string   `json:"release_name"`
+    TokenURI        *string   `json:"token_uri"`
+    Level           int       `json:"level"`
+    OwnerUsername   *string   `json:"owner_username"`
+    OwnerAddress    *string   `json:"owner_address"`
+    RentedTo        *string   `json:"rented_to"`
+    CreatedAt       time.Time `json:"created_at"`
+    UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// LevelChange is one entry of an NFT's level history
+type LevelChange struct {
+    ChangeID  int       `json:"change_id"`
+    FromLevel int       `json:"from_level"`
+    ToLevel   int       `json:"to_level"`
+    Source    string    `json:"source"`
+    SourceRef *string   `json:"source_ref"`
+    GrantedBy *string   `json:"granted_by"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+const nftColumns = `
+    nft_id, contract_address, token_id, release_id, release_name, token_uri, level,
+    owner_username, owner_address, rented_to, created_at, updated_at
+`
+
+func scanNFT(row pgx.Row) (*NFT, error) {
+    var nft NFT
+    err := row.Scan(&nft.NFTID, &nft.ContractAddress, &nft.TokenID, &nft.ReleaseID, &nft.ReleaseName, &nft.TokenURI,
+        &nft.Level, &nft.OwnerUsername, &nft.OwnerAddress, &nft.RentedTo, &nft.CreatedAt, &nft.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &nft, nil
+}
+
+// isHexAddress reports whether s looks like a 0x-prefixed wallet address
+func isHexAddress(s string) bool {
+    if len(s) != 42 || !strings.HasPrefix(s, "0x") {
+        return false
+    }
+    for _, r := range s[2:] {
+        if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+            return false
+        }
+    }
+    return true
+}
+
+// ensureNFTTx returns the nft_id for a token, creating a bare row if the
+// backend has not seen the token before
+func ensureNFTTx(ctx context.Context, tx pgx.Tx, contractAddress, tokenID string) (int, error) {
+    var nftID int
+    err := tx.QueryRow(ctx, `
+        INSERT INTO nfts (contract_address, token_id)
+        VALUES ($1, $2)
+        ON CONFLICT (contract_address, token_id) DO UPDATE SET contract_address = EXCLUDED.contract_address
+        RETURNING nft_id
+    `, strings.ToLower(contractAddress), tokenID).Scan(&nftID)
+    if err != nil {
+        return 0, fmt.Errorf("failed to upsert nft: %w", err)
+    }
+    return nftID, nil
+}
+
+// applyLevelChangeTx moves an NFT to toLevel and records why. Listings of the
+// token pick up the new level too. Nothing is recorded if the level is unchanged.
+func applyLevelChangeTx(ctx context.Context, tx pgx.Tx, nftID, toLevel int, source, sourceRef, grantedBy string, stakingEventID *int) (*LevelChange, error) {
+    var fromLevel int
+    var contractAddress, tokenID string
+    err := tx.QueryRow(ctx, `
+        SELECT level, contract_address, token_id FROM nfts WHERE nft_id = $1 FOR UPDATE
+    `, nftID).Scan(&fromLevel, &contractAddress, &tokenID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if fromLevel == toLevel {
+        return nil, nil
+    }
+
+    change := LevelChange{FromLevel: fromLevel, ToLevel: toLevel, Source: source}
+    err = tx.QueryRow(ctx, `
+        INSERT INTO nft_level_history (nft_id, from_level, to_level, source, source_ref, granted_by, staking_event_id)
+        VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+        RETURNING change_id, source_ref, granted_by, created_at
+    `, nftID, fromLevel, toLevel, source, sourceRef, grantedBy, stakingEventID).Scan(&change.ChangeID, &change.SourceRef, &change.GrantedBy, &change.CreatedAt)
+    if err != nil {
+        return nil, fmt.Errorf("failed to record level change: %w", err)
+    }
+
+    if err := setLevelTx(ctx, tx, nftID, contractAddress, tokenID, toLevel); err != nil {
+        return nil, err
+    }
+
+    return &change, nil
+}
+
+// recomputeLevelTx resets an NFT's level from its remaining history, after
+// history rows have been removed by a reorg
+func recomputeLevelTx(ctx context.Context, tx pgx.Tx, contractAddress, tokenID string) error {
+    var nftID, level int
+    err := tx.QueryRow(ctx, `
+        SELECT n.nft_id, COALESCE((
+            SELECT h.to_level FROM nft_level_history h
+            WHERE h.nft_id = n.nft_id
+            ORDER BY h.change_id DESC
+            LIMIT 1
+        ), 1)
+        FROM nfts n
+        WHERE n.contract_address = $1 AND n.token_id = $2
+        FOR UPDATE OF n
+    `, strings.ToLower(contractAddress), tokenID).Scan(&nftID, &level)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to recompute nft level: %w", err)
+    }
+
+    return setLevelTx(ctx, tx, nftID, contractAddress, tokenID, level)
+}
+
+func setLevelTx(ctx context.Context, tx pgx.Tx, nftID int, contractAddress, tokenID string, level int) error {
+    if _, err := tx.Exec(ctx, `
+        UPDATE nfts SET level = $2, updated_at = CURRENT_TIMESTAMP WHERE nft_id = $1
+    `, nftID, level); err != nil {
+        return fmt.Errorf("failed to update nft level: %w", err)
+    }
+    if _, err := tx.Exec(ctx, `
+        UPDATE marketplace_listings SET level = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE contract_address = $1 AND token_id = $2
+    `, strings.ToLower(contractAddress), tokenID, level); err != nil {
+        return fmt.Errorf("failed to update listing level: %w", err)
+    }
+    return nil
+}
+
+// RecordLevelChange sets a token's level, recording the source (and, for
+// grants, who granted it) in its level history
+func (db *NFTDatabase) RecordLevelChange(contractAddress, tokenID string, toLevel int, source, sourceRef, grantedBy string) (*LevelChange, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    nftID, err := ensureNFTTx(ctx, tx, contractAddress, tokenID)
+    if err != nil {
+        return nil, err
+    }
+
+    change, err := applyLevelChangeTx(ctx, tx, nftID, toLevel, source, sourceRef, grantedBy, nil)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit level change: %w", err)
+    }
+
+    return change, nil
+}
+
+// setNFTOwnerTx records a token's new owner, creating its row if needed
+func setNFTOwnerTx(ctx context.Context, tx pgx.Tx, contractAddress, tokenID, ownerUsername, ownerAddress string) error {
+    nftID, err := ensureNFTTx(ctx, tx, contractAddress, tokenID)
+    if err != nil {
+        return err
+    }
+
+    _, err = tx.Exec(ctx, `
+        UPDATE nfts
+        SET owner_username = NULLIF($2, ''), owner_address = NULLIF(LOWER($3), ''), updated_at = CURRENT_TIMESTAMP
+        WHERE nft_id = $1
+    `, nftID, ownerUsername, ownerAddress)
+    if err != nil {
+        return fmt.Errorf("failed to update nft owner: %w", err)
+    }
+    return nil
+}
+
+// GetNFT fetches a tracked NFT by its nft_id
+func (db *NFTDatabase) GetNFT(nftID int) (*NFT, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    nft, err := scanNFT(db.Pool.QueryRow(ctx, `SELECT `+nftColumns+` FROM nfts WHERE nft_id = $1`, nftID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+
+    return nft, nil
+}
+
+// GetNFTByToken fetches a tracked NFT by contract and token ID
+func (db *NFTDatabase) GetNFTByToken(contractAddress, tokenID string) (*NFT, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    nft, err := scanNFT(db.Pool.QueryRow(ctx, `
+        SELECT `+nftColumns+` FROM nfts WHERE contract_address = $1 AND token_id = $2
+    `, strings.ToLower(contractAddress), tokenID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+
+    return nft, nil
+}
+
+// GetNFTByMintQueueID fetches the NFT a queued mint produced. It returns
+// ErrNFTNotFound until the mint is confirmed.
+func (db *NFTDatabase) GetNFTByMintQueueID(queueID int) (*NFT, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    nft, err := scanNFT(db.Pool.QueryRow(ctx, `
+        SELECT `+nftColumns+` FROM nfts
+        WHERE (contract_address, token_id) = (
+            SELECT LOWER(contract_address), token_id FROM fresh_mints WHERE queue_id = $1
+        )
+    `, queueID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch minted nft: %w", err)
+    }
+
+    return nft, nil
+}
+
+// ContractHasRelease reports whether any tracked token of a contract was
+// minted for one of the given releases
+func (db *NFTDatabase) ContractHasRelease(contractAddress string, releaseIDs []int) (bool, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var found bool
+    err := db.Pool.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM nfts WHERE contract_address = $1 AND release_id = ANY($2))
+    `, strings.ToLower(contractAddress), releaseIDs).Scan(&found)
+    if err != nil {
+        return false, fmt.Errorf("failed to check contract releases: %w", err)
+    }
+
+    return found, nil
+}
+
+// GetLevelHistory returns an NFT's level changes, oldest first
+func (db *NFTDatabase) GetLevelHistory(nftID int) ([]LevelChange, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT change_id, from_level, to_level, source, source_ref, granted_by, created_at
+        FROM nft_level_history
+        WHERE nft_id = $1
+        ORDER BY change_id
+    `, nftID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch level history: %w", err)
+    }
+    defer rows.Close()
+
+    history := []LevelChange{}
+    for rows.Next() {
+        var change LevelChange
+        if err := rows.Scan(&change.ChangeID, &change.FromLevel, &change.ToLevel, &change.Source, &change.SourceRef, &change.GrantedBy, &change.CreatedAt); err != nil {
+            return nil, fmt.Errorf("failed to scan level change: %w", err)
+        }
+        history = append(history, change)
+    }
+
+    return history, rows.Err()
+}
@@ -0,0 +1,522 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// Order statuses
+const (
+    OrderPending   = "pending"
+    OrderCompleted = "completed"
+    OrderFailed    = "failed"
+    OrderExpired   = "expired"
+)
+
+var (
+    ErrOrderNotFound            = errors.New("order not found")
+    ErrOrderNotPending          = errors.New("order is no longer pending")
+    ErrOwnListing               = errors.New("sellers cannot buy their own listing")
+    ErrUnsupportedCurrency      = errors.New("priced in a currency payments cannot be settled in")
+    ErrPaymentAlreadySubmitted  = errors.New("a different payment transaction was already submitted for this order")
+    ErrTxHashUsed               = errors.New("payment transaction is already attached to another order")
+    ErrTransferAlreadySubmitted = errors.New("a different transfer transaction was already submitted for this order")
+    ErrTransferTxHashUsed       = errors.New("transfer transaction is already attached to another order")
+)
+
+// Order is a buyer's reservation of a listing and the payment that settles it
+type Order struct {
+    OrderID            int        `json:"order_id"`
+    ListingID          int        `json:"listing_id"`
+    ContractAddress    string     `json:"contract_address"`
+    TokenID            string     `json:"token_id"`
+    ReleaseName        string     `json:"release_name"`
+    BuyerUsername      string     `json:"buyer_username"`
+    BuyerAddress       string     `json:"buyer_address"`
+    SellerUsername     string     `json:"seller_username"`
+    SellerAddress      string     `json:"seller_address"`
+    Price              string     `json:"price"` // exact decimal, as stored
+    Currency           string     `json:"currency"`
+    Status             string     `json:"status"`
+    TxHash             *string    `json:"tx_hash"`
+    // PaymentSubmittedAt is when TxHash was attached; the payment and
+    // transfer timeouts run from it
+    PaymentSubmittedAt *time.Time `json:"payment_submitted_at"`
+    // TransferTxHash is the seller's token transfer, when it is not part of the payment transaction
+    TransferTxHash     *string    `json:"transfer_tx_hash"`
+    BlockNumber        *int64     `json:"block_number"`
+    FailureReason      *string    `json:"failure_reason"`
+    ReservedUntil      time.Time  `json:"reserved_until"`
+    CreatedAt          time.Time  `json:"created_at"`
+    UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+const orderColumns = `
+    order_id, listing_id, contract_address, token_id, release_name, buyer_username, buyer_address,
+    seller_username, seller_address, price::text, currency, status, tx_hash, transfer_tx_hash, block_number,
+    failure_reason, reserved_until, created_at, updated_at, payment_submitted_at
+`
+
+func scanOrder(row pgx.Row) (*Order, error) {
+    var order Order
+    err := row.Scan(&order.OrderID, &order.ListingID, &order.ContractAddress, &order.TokenID, &order.ReleaseName,
+        &order.BuyerUsername, &order.BuyerAddress, &order.SellerUsername, &order.SellerAddress, &order.Price,
+        &order.Currency, &order.Status, &order.TxHash, &order.TransferTxHash, &order.BlockNumber, &order.FailureReason,
+        &order.ReservedUntil, &order.CreatedAt, &order.UpdatedAt, &order.PaymentSubmittedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &order, nil
+}
+
+// ReserveListing takes a listing off the market for hold and records a
+// pending order for the buyer. The listing row is locked for the duration, so
+// concurrent buyers are serialized: the first to commit wins and everyone
+// else sees ErrListingNotActive. Calling it again while the buyer's own
+// reservation is open returns that order. Listings priced in anything but
+// currency, the one payments settle in, return ErrUnsupportedCurrency before
+// the buyer is told what to pay.
+func (db *NFTDatabase) ReserveListing(listingID int, buyerUsername, buyerAddress, currency string, hold time.Duration) (*Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    listing, err := scanListing(tx.QueryRow(ctx, `SELECT `+listingColumns+` FROM marketplace_listings WHERE listing_id = $1 FOR UPDATE`, listingID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrListingNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch listing: %w", err)
+    }
+
+    if listing.SellerUsername == buyerUsername {
+        return nil, ErrOwnListing
+    }
+    if listing.Currency != currency {
+        return nil, ErrUnsupportedCurrency
+    }
+    if listing.TokenID == "" {
+        // Legacy listings are not tied to a token and cannot be settled
+        return nil, ErrListingNotActive
+    }
+
+    switch listing.Status {
+    case ListingActive:
+        var expired bool
+        if err := tx.QueryRow(ctx, `
+            SELECT COALESCE(expires_at <= CURRENT_TIMESTAMP, FALSE) FROM marketplace_listings WHERE listing_id = $1
+        `, listingID).Scan(&expired); err != nil {
+            return nil, fmt.Errorf("failed to check listing expiry: %w", err)
+        }
+        if expired {
+            return nil, ErrListingNotActive
+        }
+    case ListingReserved:
+        current, err := scanOrder(tx.QueryRow(ctx, `
+            SELECT `+orderColumns+` FROM marketplace_orders WHERE listing_id = $1 AND status = $2
+        `, listingID, OrderPending))
+        if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+            return nil, fmt.Errorf("failed to fetch reservation: %w", err)
+        }
+        if current != nil && current.BuyerUsername == buyerUsername {
+            return current, tx.Commit(ctx)
+        }
+        if current != nil {
+            // A reservation only lapses if no payment was submitted against it
+            held, err := reservationHeld(ctx, tx, current.OrderID)
+            if err != nil {
+                return nil, err
+            }
+            if current.TxHash != nil || held {
+                return nil, ErrListingNotActive
+            }
+
+            if _, err := tx.Exec(ctx, `
+                UPDATE marketplace_orders SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE order_id = $1
+            `, current.OrderID, OrderExpired); err != nil {
+                return nil, fmt.Errorf("failed to expire reservation: %w", err)
+            }
+        }
+    default:
+        return nil, ErrListingNotActive
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE marketplace_listings SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE listing_id = $1
+    `, listingID, ListingReserved); err != nil {
+        return nil, fmt.Errorf("failed to reserve listing: %w", err)
+    }
+
+    order, err := scanOrder(tx.QueryRow(ctx, `
+        INSERT INTO marketplace_orders (listing_id, contract_address, token_id, release_name, buyer_username, buyer_address,
+            seller_username, seller_address, price, currency, status, reserved_until)
+        SELECT listing_id, contract_address, token_id, release_name, $2, $3,
+            seller_username, seller_address, price, currency, $4, CURRENT_TIMESTAMP + $5 * INTERVAL '1 second'
+        FROM marketplace_listings WHERE listing_id = $1
+        RETURNING `+orderColumns,
+        listingID, buyerUsername, buyerAddress, OrderPending, int64(hold/time.Second)))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create order: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit reservation: %w", err)
+    }
+
+    return order, nil
+}
+
+// reservationHeld reports whether an order's hold has not yet run out. The
+// comparison is done by the database so it uses the same clock that set it.
+func reservationHeld(ctx context.Context, tx pgx.Tx, orderID int) (bool, error) {
+    var held bool
+    err := tx.QueryRow(ctx, `SELECT reserved_until > CURRENT_TIMESTAMP FROM marketplace_orders WHERE order_id = $1`, orderID).Scan(&held)
+    if err != nil {
+        return false, fmt.Errorf("failed to check reservation: %w", err)
+    }
+    return held, nil
+}
+
+// GetOrder fetches a single order
+func (db *NFTDatabase) GetOrder(orderID int) (*Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    order, err := scanOrder(db.Pool.QueryRow(ctx, `SELECT `+orderColumns+` FROM marketplace_orders WHERE order_id = $1`, orderID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrOrderNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch order: %w", err)
+    }
+
+    return order, nil
+}
+
+// SubmitOrderPayment attaches the buyer's payment transaction to a pending
+// order. Once a payment is attached the reservation no longer lapses, so a
+// slow-to-confirm payment cannot lose the listing to another buyer; instead
+// settlement fails the order if the payment or the token transfer is not on
+// chain within its timeout of payment_submitted_at.
+func (db *NFTDatabase) SubmitOrderPayment(orderID int, buyerUsername, txHash string) (*Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    txHash = strings.ToLower(txHash)
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM marketplace_orders WHERE order_id = $1 FOR UPDATE`, orderID))
+    if errors.Is(err, pgx.ErrNoRows) || (err == nil && order.BuyerUsername != buyerUsername) {
+        return nil, ErrOrderNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch order: %w", err)
+    }
+
+    if order.TxHash != nil {
+        if *order.TxHash == txHash {
+            return order, tx.Commit(ctx)
+        }
+        return nil, ErrPaymentAlreadySubmitted
+    }
+    held, err := reservationHeld(ctx, tx, orderID)
+    if err != nil {
+        return nil, err
+    }
+    if order.Status != OrderPending || !held {
+        return nil, ErrOrderNotPending
+    }
+
+    used, err := txHashUsedByRental(ctx, tx, txHash)
+    if err != nil {
+        return nil, err
+    }
+    if used {
+        return nil, ErrTxHashUsed
+    }
+
+    order, err = scanOrder(tx.QueryRow(ctx, `
+        UPDATE marketplace_orders SET tx_hash = $2, payment_submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+        WHERE order_id = $1
+        RETURNING `+orderColumns, orderID, txHash))
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return nil, ErrTxHashUsed
+        }
+        return nil, fmt.Errorf("failed to record payment: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit payment: %w", err)
+    }
+
+    return order, nil
+}
+
+// SubmitOrderTransfer attaches the transaction that moved the token to the
+// buyer, for sales where the seller transfers it separately from the payment.
+// Either side of the order may submit it.
+func (db *NFTDatabase) SubmitOrderTransfer(orderID int, username, txHash string) (*Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    txHash = strings.ToLower(txHash)
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM marketplace_orders WHERE order_id = $1 FOR UPDATE`, orderID))
+    if errors.Is(err, pgx.ErrNoRows) || (err == nil && order.BuyerUsername != username && order.SellerUsername != username) {
+        return nil, ErrOrderNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch order: %w", err)
+    }
+
+    if order.TransferTxHash != nil {
+        if *order.TransferTxHash == txHash {
+            return order, tx.Commit(ctx)
+        }
+        return nil, ErrTransferAlreadySubmitted
+    }
+    if order.Status != OrderPending {
+        return nil, ErrOrderNotPending
+    }
+
+    order, err = scanOrder(tx.QueryRow(ctx, `
+        UPDATE marketplace_orders SET transfer_tx_hash = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE order_id = $1
+        RETURNING `+orderColumns, orderID, txHash))
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return nil, ErrTransferTxHashUsed
+        }
+        return nil, fmt.Errorf("failed to record transfer: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit transfer: %w", err)
+    }
+
+    return order, nil
+}
+
+// GetPaidPendingOrders returns pending orders with a payment awaiting verification
+func (db *NFTDatabase) GetPaidPendingOrders(limit int) ([]Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+orderColumns+`
+        FROM marketplace_orders
+        WHERE status = $1 AND tx_hash IS NOT NULL
+        ORDER BY order_id
+        LIMIT $2
+    `, OrderPending, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch pending orders: %w", err)
+    }
+    defer rows.Close()
+
+    var orders []Order
+    for rows.Next() {
+        order, err := scanOrder(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan order: %w", err)
+        }
+        orders = append(orders, *order)
+    }
+
+    return orders, rows.Err()
+}
+
+// CompleteOrder settles a verified order: the order completes, its listing is
+// marked sold and the buyer becomes the token's owner in one transaction.
+// Completing an already completed order is a no-op.
+func (db *NFTDatabase) CompleteOrder(orderID int, blockNumber uint64) (*Order, error) {
+    return db.finishOrder(orderID, OrderCompleted, ListingSold, &blockNumber, nil)
+}
+
+// FailOrder closes an order whose payment can never verify and puts the
+// listing back on the market
+func (db *NFTDatabase) FailOrder(orderID int, reason string) (*Order, error) {
+    return db.finishOrder(orderID, OrderFailed, ListingActive, nil, &reason)
+}
+
+// FailStalledOrder fails a pending order like FailOrder once its payment was
+// submitted at least timeout ago. While the timeout is still running it
+// returns nil, nil and leaves the order alone. The comparison is done by the
+// database so it uses the same clock that recorded the submission.
+func (db *NFTDatabase) FailStalledOrder(orderID int, timeout time.Duration, reason string) (*Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var stalled bool
+    err := db.Pool.QueryRow(ctx, `
+        SELECT COALESCE(payment_submitted_at + $2 * INTERVAL '1 second' <= CURRENT_TIMESTAMP, FALSE)
+        FROM marketplace_orders WHERE order_id = $1
+    `, orderID, int64(timeout/time.Second)).Scan(&stalled)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrOrderNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to check payment timeout: %w", err)
+    }
+    if !stalled {
+        return nil, nil
+    }
+
+    return db.FailOrder(orderID, reason)
+}
+
+func (db *NFTDatabase) finishOrder(orderID int, orderStatus, listingStatus string, blockNumber *uint64, reason *string) (*Order, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // Lock the listing before the order, matching ReserveListing's lock order
+    var listingID int
+    err = tx.QueryRow(ctx, `SELECT listing_id FROM marketplace_orders WHERE order_id = $1`, orderID).Scan(&listingID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrOrderNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch order: %w", err)
+    }
+    if _, err := tx.Exec(ctx, `SELECT 1 FROM marketplace_listings WHERE listing_id = $1 FOR UPDATE`, listingID); err != nil {
+        return nil, fmt.Errorf("failed to lock listing: %w", err)
+    }
+
+    order, err := scanOrder(tx.QueryRow(ctx, `SELECT `+orderColumns+` FROM marketplace_orders WHERE order_id = $1 FOR UPDATE`, orderID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch order: %w", err)
+    }
+    if order.Status == orderStatus {
+        return order, tx.Commit(ctx)
+    }
+    if order.Status != OrderPending {
+        return nil, ErrOrderNotPending
+    }
+
+    var block *int64
+    if blockNumber != nil {
+        value := int64(*blockNumber)
+        block = &value
+    }
+
+    order, err = scanOrder(tx.QueryRow(ctx, `
+        UPDATE marketplace_orders
+        SET status = $2, block_number = $3, failure_reason = $4, updated_at = CURRENT_TIMESTAMP
+        WHERE order_id = $1
+        RETURNING `+orderColumns, orderID, orderStatus, block, reason))
+    if err != nil {
+        return nil, fmt.Errorf("failed to update order: %w", err)
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE marketplace_listings SET status = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE listing_id = $1 AND status = $3
+    `, listingID, listingStatus, ListingReserved); err != nil {
+        return nil, fmt.Errorf("failed to update listing: %w", err)
+    }
+
+    if orderStatus == OrderCompleted {
+        if err := setNFTOwnerTx(ctx, tx, order.ContractAddress, order.TokenID, order.BuyerUsername, order.BuyerAddress); err != nil {
+            return nil, err
+        }
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit order: %w", err)
+    }
+
+    return order, nil
+}
+
+// ReleaseLapsedReservations expires unpaid orders past their hold and puts
+// their listings back on the market
+func (db *NFTDatabase) ReleaseLapsedReservations() (int64, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // Listings are locked first, matching ReserveListing's lock order
+    rows, err := tx.Query(ctx, `
+        SELECT l.listing_id
+        FROM marketplace_listings l
+        JOIN marketplace_orders o ON o.listing_id = l.listing_id
+        WHERE l.status = $1 AND o.status = $2 AND o.tx_hash IS NULL AND o.reserved_until <= CURRENT_TIMESTAMP
+        FOR UPDATE OF l
+    `, ListingReserved, OrderPending)
+    if err != nil {
+        return 0, fmt.Errorf("failed to fetch lapsed reservations: %w", err)
+    }
+    var listingIDs []int32
+    for rows.Next() {
+        var listingID int32
+        if err := rows.Scan(&listingID); err != nil {
+            rows.Close()
+            return 0, fmt.Errorf("failed to scan listing: %w", err)
+        }
+        listingIDs = append(listingIDs, listingID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, fmt.Errorf("failed to fetch lapsed reservations: %w", err)
+    }
+    if len(listingIDs) == 0 {
+        return 0, nil
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE marketplace_orders SET status = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE listing_id = ANY($1) AND status = $3 AND tx_hash IS NULL AND reserved_until <= CURRENT_TIMESTAMP
+    `, listingIDs, OrderExpired, OrderPending); err != nil {
+        return 0, fmt.Errorf("failed to expire orders: %w", err)
+    }
+
+    tag, err := tx.Exec(ctx, `
+        UPDATE marketplace_listings SET status = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE listing_id = ANY($1) AND status = $3
+    `, listingIDs, ListingActive, ListingReserved)
+    if err != nil {
+        return 0, fmt.Errorf("failed to release listings: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, fmt.Errorf("failed to commit released reservations: %w", err)
+    }
+
+    return tag.RowsAffected(), nil
+}
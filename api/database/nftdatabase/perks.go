@@ -0,0 +1,522 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// Perk claim statuses
+const (
+    PerkClaimed  = "claimed"
+    PerkRedeemed = "redeemed"
+)
+
+var (
+    ErrPerkNotFound         = errors.New("perk not found")
+    ErrPerkUnavailable      = errors.New("perk is not available to claim")
+    ErrPerkSoldOut          = errors.New("perk has no supply left")
+    ErrPerkLimitReached     = errors.New("user has already claimed this perk the maximum times")
+    ErrPerkAlreadyClaimed   = errors.New("this token has already claimed this perk")
+    ErrLevelTooLow          = errors.New("token level is below the perk's minimum level")
+    ErrClaimNotFound        = errors.New("redemption code not found")
+    ErrClaimAlreadyRedeemed = errors.New("redemption code has already been used")
+    ErrPerkExpired          = errors.New("perk has expired")
+    ErrNotPerkStaff         = errors.New("not authorized to redeem this creator's perks")
+)
+
+// Perk is a reward a creator offers to holders of tokens at or above MinLevel
+type Perk struct {
+    PerkID          int        `json:"perk_id"`
+    CreatorUsername string     `json:"creator_username"`
+    Title           string     `json:"title"`
+    Description     *string    `json:"description"`
+    MinLevel        int        `json:"min_level"`
+    ContractAddress *string    `json:"contract_address"` // nil means any token
+    TotalSupply     *int       `json:"total_supply"`     // nil means unlimited
+    RemainingSupply *int       `json:"remaining_supply"`
+    PerUserLimit    int        `json:"per_user_limit"`
+    StartsAt        time.Time  `json:"starts_at"`
+    EndsAt          *time.Time `json:"ends_at"`
+    Active          bool       `json:"active"`
+    CreatedAt       time.Time  `json:"created_at"`
+}
+
+// NewPerk holds the fields a creator supplies for a perk
+type NewPerk struct {
+    CreatorUsername string
+    Title           string
+    Description     string
+    MinLevel        int
+    ContractAddress string
+    TotalSupply     *int
+    PerUserLimit    int
+    StartsAt        *time.Time
+    EndsAt          *time.Time
+}
+
+// EligiblePerk is a claimable perk and the caller's tokens that qualify for it
+type EligiblePerk struct {
+    Perk
+    EligibleNFTIDs []int `json:"eligible_nft_ids"`
+}
+
+// PerkClaim is a claimed perk awaiting or past redemption
+type PerkClaim struct {
+    ClaimID    int        `json:"claim_id"`
+    PerkID     int        `json:"perk_id"`
+    PerkTitle  string     `json:"perk_title"`
+    Username   string     `json:"username"`
+    NFTID      int        `json:"nft_id"`
+    Status     string     `json:"status"`
+    ClaimedAt  time.Time  `json:"claimed_at"`
+    RedeemedAt *time.Time `json:"redeemed_at"`
+    RedeemedBy *string    `json:"redeemed_by"`
+}
+
+const perkColumns = `
+    p.perk_id, p.creator_username, p.title, p.description, p.min_level, p.contract_address, p.total_supply,
+    p.remaining_supply, p.per_user_limit, p.starts_at, p.ends_at, p.active, p.created_at
+`
+
+const perkClaimColumns = `
+    c.claim_id, c.perk_id, p.title, c.username, c.nft_id, c.status, c.claimed_at, c.redeemed_at, c.redeemed_by
+`
+
+func scanPerk(row pgx.Row, extra ...interface{}) (*Perk, error) {
+    var perk Perk
+    dest := []interface{}{&perk.PerkID, &perk.CreatorUsername, &perk.Title, &perk.Description, &perk.MinLevel, &perk.ContractAddress,
+        &perk.TotalSupply, &perk.RemainingSupply, &perk.PerUserLimit, &perk.StartsAt, &perk.EndsAt, &perk.Active, &perk.CreatedAt}
+    if err := row.Scan(append(dest, extra...)...); err != nil {
+        return nil, err
+    }
+    return &perk, nil
+}
+
+func scanPerkClaim(row pgx.Row) (*PerkClaim, error) {
+    var claim PerkClaim
+    err := row.Scan(&claim.ClaimID, &claim.PerkID, &claim.PerkTitle, &claim.Username, &claim.NFTID, &claim.Status,
+        &claim.ClaimedAt, &claim.RedeemedAt, &claim.RedeemedBy)
+    if err != nil {
+        return nil, err
+    }
+    return &claim, nil
+}
+
+// CreatePerk stores a new active perk with its full supply remaining
+func (db *NFTDatabase) CreatePerk(perk NewPerk) (*Perk, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var startsAt, endsAt *time.Time
+    if perk.StartsAt != nil {
+        t := perk.StartsAt.UTC()
+        startsAt = &t
+    }
+    if perk.EndsAt != nil {
+        t := perk.EndsAt.UTC()
+        endsAt = &t
+    }
+
+    created, err := scanPerk(db.Pool.QueryRow(ctx, `
+        INSERT INTO perks AS p (creator_username, title, description, min_level, contract_address, total_supply, remaining_supply,
+            per_user_limit, starts_at, ends_at)
+        VALUES ($1, $2, NULLIF($3, ''), $4, NULLIF(LOWER($5), ''), $6, $6, $7, COALESCE($8, CURRENT_TIMESTAMP), $9)
+        RETURNING `+perkColumns,
+        perk.CreatorUsername, perk.Title, perk.Description, perk.MinLevel, perk.ContractAddress, perk.TotalSupply,
+        perk.PerUserLimit, startsAt, endsAt))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create perk: %w", err)
+    }
+
+    return created, nil
+}
+
+// GetPerk fetches a single perk
+func (db *NFTDatabase) GetPerk(perkID int) (*Perk, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    perk, err := scanPerk(db.Pool.QueryRow(ctx, `SELECT `+perkColumns+` FROM perks p WHERE p.perk_id = $1`, perkID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrPerkNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch perk: %w", err)
+    }
+
+    return perk, nil
+}
+
+// GetPerks lists perks, optionally only one creator's. Unless includeInactive
+// is set, only perks that can currently be claimed are returned.
+func (db *NFTDatabase) GetPerks(creatorUsername string, includeInactive bool) ([]Perk, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+perkColumns+`
+        FROM perks p
+        WHERE ($1 = '' OR p.creator_username = $1)
+          AND ($2 OR (p.active AND p.starts_at <= CURRENT_TIMESTAMP AND (p.ends_at IS NULL OR p.ends_at > CURRENT_TIMESTAMP)
+                      AND (p.remaining_supply IS NULL OR p.remaining_supply > 0)))
+        ORDER BY p.perk_id DESC
+    `, creatorUsername, includeInactive)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch perks: %w", err)
+    }
+    defer rows.Close()
+
+    perks := []Perk{}
+    for rows.Next() {
+        perk, err := scanPerk(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan perk: %w", err)
+        }
+        perks = append(perks, *perk)
+    }
+
+    return perks, rows.Err()
+}
+
+// SetPerkActive turns a perk on or off
+func (db *NFTDatabase) SetPerkActive(perkID int, active bool) (*Perk, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    perk, err := scanPerk(db.Pool.QueryRow(ctx, `
+        UPDATE perks p SET active = $2 WHERE p.perk_id = $1
+        RETURNING `+perkColumns, perkID, active))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrPerkNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to update perk: %w", err)
+    }
+
+    return perk, nil
+}
+
+// GetEligiblePerks lists the claimable perks a user's tokens qualify for,
+// with the tokens that can claim each one
+func (db *NFTDatabase) GetEligiblePerks(username string) ([]EligiblePerk, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+perkColumns+`, array_agg(n.nft_id ORDER BY n.nft_id)
+        FROM perks p
+        JOIN nfts n ON COALESCE(n.rented_to, n.owner_username) = $1
+            AND n.level >= p.min_level
+            AND (p.contract_address IS NULL OR p.contract_address = n.contract_address)
+        WHERE p.active
+          AND p.starts_at <= CURRENT_TIMESTAMP
+          AND (p.ends_at IS NULL OR p.ends_at > CURRENT_TIMESTAMP)
+          AND (p.remaining_supply IS NULL OR p.remaining_supply > 0)
+          AND NOT EXISTS (SELECT 1 FROM perk_claims c WHERE c.perk_id = p.perk_id AND c.nft_id = n.nft_id)
+          AND (SELECT COUNT(*) FROM perk_claims c WHERE c.perk_id = p.perk_id AND c.username = $1) < p.per_user_limit
+        GROUP BY p.perk_id
+        ORDER BY p.perk_id DESC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch eligible perks: %w", err)
+    }
+    defer rows.Close()
+
+    perks := []EligiblePerk{}
+    for rows.Next() {
+        var eligible EligiblePerk
+        perk, err := scanPerk(rows, &eligible.EligibleNFTIDs)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan perk: %w", err)
+        }
+        eligible.Perk = *perk
+        perks = append(perks, eligible)
+    }
+
+    return perks, rows.Err()
+}
+
+// GetTokenPerks lists the currently offered perks a token of contractAddress
+// at level has unlocked, lowest level first
+func (db *NFTDatabase) GetTokenPerks(contractAddress string, level int) ([]Perk, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+perkColumns+`
+        FROM perks p
+        WHERE p.active
+          AND p.min_level <= $2
+          AND (p.contract_address IS NULL OR p.contract_address = $1)
+          AND p.starts_at <= CURRENT_TIMESTAMP
+          AND (p.ends_at IS NULL OR p.ends_at > CURRENT_TIMESTAMP)
+        ORDER BY p.min_level, p.perk_id
+    `, strings.ToLower(contractAddress), level)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch token perks: %w", err)
+    }
+    defer rows.Close()
+
+    perks := []Perk{}
+    for rows.Next() {
+        perk, err := scanPerk(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan perk: %w", err)
+        }
+        perks = append(perks, *perk)
+    }
+
+    return perks, rows.Err()
+}
+
+// ClaimPerk claims a perk for one of a user's tokens. The perk row is locked
+// for the whole check-and-decrement, so concurrent claims can never take more
+// than the remaining supply. codeHash is the hash of the redemption code
+// handed to the user.
+func (db *NFTDatabase) ClaimPerk(perkID int, username string, nftID int, codeHash string) (*PerkClaim, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var open bool
+    perk, err := scanPerk(tx.QueryRow(ctx, `
+        SELECT `+perkColumns+`, p.starts_at <= CURRENT_TIMESTAMP AND (p.ends_at IS NULL OR p.ends_at > CURRENT_TIMESTAMP)
+        FROM perks p
+        WHERE p.perk_id = $1
+        FOR UPDATE
+    `, perkID), &open)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrPerkNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch perk: %w", err)
+    }
+    if !perk.Active || !open {
+        return nil, ErrPerkUnavailable
+    }
+    if perk.RemainingSupply != nil && *perk.RemainingSupply <= 0 {
+        return nil, ErrPerkSoldOut
+    }
+
+    var level int
+    var contractAddress string
+    var ownerUsername *string
+    err = tx.QueryRow(ctx, `
+        SELECT level, contract_address, COALESCE(rented_to, owner_username) FROM nfts WHERE nft_id = $1 FOR SHARE
+    `, nftID).Scan(&level, &contractAddress, &ownerUsername)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if ownerUsername == nil || *ownerUsername != username {
+        return nil, ErrNotTokenOwner
+    }
+    if perk.ContractAddress != nil && *perk.ContractAddress != contractAddress {
+        return nil, ErrTokenNotEligible
+    }
+    if level < perk.MinLevel {
+        return nil, ErrLevelTooLow
+    }
+
+    var claimed int
+    if err := tx.QueryRow(ctx, `
+        SELECT COUNT(*) FROM perk_claims WHERE perk_id = $1 AND username = $2
+    `, perkID, username).Scan(&claimed); err != nil {
+        return nil, fmt.Errorf("failed to count perk claims: %w", err)
+    }
+    if claimed >= perk.PerUserLimit {
+        return nil, ErrPerkLimitReached
+    }
+
+    claim := PerkClaim{PerkID: perkID, PerkTitle: perk.Title, Username: username, NFTID: nftID, Status: PerkClaimed}
+    err = tx.QueryRow(ctx, `
+        INSERT INTO perk_claims (perk_id, username, nft_id, code_hash, status)
+        VALUES ($1, $2, $3, $4, $5)
+        RETURNING claim_id, claimed_at
+    `, perkID, username, nftID, codeHash, PerkClaimed).Scan(&claim.ClaimID, &claim.ClaimedAt)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "perk_claims_perk_id_nft_id_key" {
+            return nil, ErrPerkAlreadyClaimed
+        }
+        return nil, fmt.Errorf("failed to claim perk: %w", err)
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE perks SET remaining_supply = remaining_supply - 1
+        WHERE perk_id = $1 AND remaining_supply IS NOT NULL
+    `, perkID); err != nil {
+        return nil, fmt.Errorf("failed to update perk supply: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit perk claim: %w", err)
+    }
+
+    return &claim, nil
+}
+
+// GetPerkClaims lists a user's perk claims, newest first
+func (db *NFTDatabase) GetPerkClaims(username string) ([]PerkClaim, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+perkClaimColumns+`
+        FROM perk_claims c
+        JOIN perks p ON p.perk_id = c.perk_id
+        WHERE c.username = $1
+        ORDER BY c.claim_id DESC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch perk claims: %w", err)
+    }
+    defer rows.Close()
+
+    claims := []PerkClaim{}
+    for rows.Next() {
+        claim, err := scanPerkClaim(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan perk claim: %w", err)
+        }
+        claims = append(claims, *claim)
+    }
+
+    return claims, rows.Err()
+}
+
+// RedeemPerkClaim looks up a claim by its redemption code hash on behalf of
+// staffUsername, who must be the perk's creator or one of their staff. With
+// redeem set the claim is marked used; otherwise the code is only checked.
+// An already used code returns the claim along with ErrClaimAlreadyRedeemed
+// so staff can see when it was used.
+func (db *NFTDatabase) RedeemPerkClaim(codeHash, staffUsername string, redeem bool) (*PerkClaim, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var creatorUsername string
+    var isStaff, expired bool
+    row := tx.QueryRow(ctx, `
+        SELECT `+perkClaimColumns+`, p.creator_username,
+            p.creator_username = $2 OR EXISTS (
+                SELECT 1 FROM perk_staff s WHERE s.creator_username = p.creator_username AND s.staff_username = $2
+            ),
+            p.ends_at IS NOT NULL AND p.ends_at <= CURRENT_TIMESTAMP
+        FROM perk_claims c
+        JOIN perks p ON p.perk_id = c.perk_id
+        WHERE c.code_hash = $1
+        FOR UPDATE OF c
+    `, codeHash, staffUsername)
+    var claim PerkClaim
+    err = row.Scan(&claim.ClaimID, &claim.PerkID, &claim.PerkTitle, &claim.Username, &claim.NFTID, &claim.Status,
+        &claim.ClaimedAt, &claim.RedeemedAt, &claim.RedeemedBy, &creatorUsername, &isStaff, &expired)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrClaimNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch perk claim: %w", err)
+    }
+    if !isStaff {
+        // Don't reveal another creator's claims
+        return nil, ErrNotPerkStaff
+    }
+    if claim.Status == PerkRedeemed {
+        return &claim, ErrClaimAlreadyRedeemed
+    }
+    if expired {
+        return &claim, ErrPerkExpired
+    }
+    if !redeem {
+        return &claim, nil
+    }
+
+    err = tx.QueryRow(ctx, `
+        UPDATE perk_claims SET status = $2, redeemed_at = CURRENT_TIMESTAMP, redeemed_by = $3
+        WHERE claim_id = $1
+        RETURNING status, redeemed_at, redeemed_by
+    `, claim.ClaimID, PerkRedeemed, staffUsername).Scan(&claim.Status, &claim.RedeemedAt, &claim.RedeemedBy)
+    if err != nil {
+        return nil, fmt.Errorf("failed to redeem perk claim: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit redemption: %w", err)
+    }
+
+    return &claim, nil
+}
+
+// AddPerkStaff lets staffUsername redeem creatorUsername's perks
+func (db *NFTDatabase) AddPerkStaff(creatorUsername, staffUsername string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        INSERT INTO perk_staff (creator_username, staff_username) VALUES ($1, $2)
+        ON CONFLICT DO NOTHING
+    `, creatorUsername, staffUsername)
+    if err != nil {
+        return fmt.Errorf("failed to add perk staff: %w", err)
+    }
+
+    return nil
+}
+
+// RemovePerkStaff stops staffUsername redeeming creatorUsername's perks
+func (db *NFTDatabase) RemovePerkStaff(creatorUsername, staffUsername string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        DELETE FROM perk_staff WHERE creator_username = $1 AND staff_username = $2
+    `, creatorUsername, staffUsername)
+    if err != nil {
+        return fmt.Errorf("failed to remove perk staff: %w", err)
+    }
+
+    return nil
+}
+
+// GetPerkStaff lists the staff who may redeem a creator's perks
+func (db *NFTDatabase) GetPerkStaff(creatorUsername string) ([]string, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT staff_username FROM perk_staff WHERE creator_username = $1 ORDER BY staff_username
+    `, creatorUsername)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch perk staff: %w", err)
+    }
+    defer rows.Close()
+
+    staff := []string{}
+    for rows.Next() {
+        var username string
+        if err := rows.Scan(&username); err != nil {
+            return nil, fmt.Errorf("failed to scan perk staff: %w", err)
+        }
+        staff = append(staff, username)
+    }
+
+    return staff, rows.Err()
+}
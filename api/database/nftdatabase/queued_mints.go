@@ -0,0 +1,198 @@
+package nftdatabase
+
+import (
+    "context"
+    "fmt"
+    "strings"
+    "time"
+)
+
+// Queued mint statuses
+const (
+    MintQueued    = "queued"
+    MintSubmitted = "submitted"
+    MintConfirmed = "confirmed"
+    MintFailed    = "failed"
+)
+
+// QueuedMint is a row of queued_mints as seen by the mint worker.
+// OwnerAddress holds the owning account's username at queue time; the worker
+// resolves it to a wallet and records that in RecipientAddress.
+type QueuedMint struct {
+    QueueID          int
+    ReleaseID        *int
+    ReleaseName      string
+    OwnerAddress     string
+    Status           string
+    Attempts         int
+    RecipientAddress *string
+    TokenURI         *string
+    TxHash           *string
+    RawTx            []byte
+    // PendingFor is how long ago the stored transaction was built
+    PendingFor       time.Duration
+}
+
+// ClaimQueuedMints leases up to limit due mints to the caller. Rows are picked
+// with FOR UPDATE SKIP LOCKED so concurrent workers never claim the same mint,
+// and the lease lets another worker take over if this one dies mid-mint.
+func (db *NFTDatabase) ClaimQueuedMints(limit int, lease time.Duration) ([]QueuedMint, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        WITH due AS (
+            SELECT queue_id
+            FROM queued_mints
+            WHERE status IN ($1, $2)
+              AND COALESCE(next_attempt_at, CURRENT_TIMESTAMP) <= CURRENT_TIMESTAMP
+              AND (claimed_until IS NULL OR claimed_until < CURRENT_TIMESTAMP)
+            ORDER BY queue_id
+            LIMIT $3
+            FOR UPDATE SKIP LOCKED
+        )
+        UPDATE queued_mints q
+        SET claimed_until = CURRENT_TIMESTAMP + make_interval(secs => $4), updated_at = CURRENT_TIMESTAMP
+        FROM due
+        WHERE q.queue_id = due.queue_id
+        RETURNING q.queue_id, q.release_id, q.release_name, q.owner_address, q.status, q.attempts,
+                  q.recipient_address, q.token_uri, q.tx_hash, q.raw_tx,
+                  COALESCE(EXTRACT(EPOCH FROM CURRENT_TIMESTAMP - q.submitted_at), 0)::float8
+    `, MintQueued, MintSubmitted, limit, lease.Seconds())
+    if err != nil {
+        return nil, fmt.Errorf("failed to claim queued mints: %w", err)
+    }
+    defer rows.Close()
+
+    var mints []QueuedMint
+    for rows.Next() {
+        var mint QueuedMint
+        var pendingSeconds float64
+        if err := rows.Scan(&mint.QueueID, &mint.ReleaseID, &mint.ReleaseName, &mint.OwnerAddress, &mint.Status, &mint.Attempts,
+            &mint.RecipientAddress, &mint.TokenURI, &mint.TxHash, &mint.RawTx, &pendingSeconds); err != nil {
+            return nil, fmt.Errorf("failed to scan queued mint: %w", err)
+        }
+        mint.PendingFor = time.Duration(pendingSeconds * float64(time.Second))
+        mints = append(mints, mint)
+    }
+
+    return mints, rows.Err()
+}
+
+// RecordMintSubmission stores a signed transaction before it is broadcast, so
+// a crash after sending can rebroadcast the same transaction instead of minting
+// twice. Only failures count as attempts, so submitting does not.
+func (db *NFTDatabase) RecordMintSubmission(queueID int, recipient, tokenURI, txHash string, rawTx []byte) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE queued_mints
+        SET status = $2, recipient_address = $3, token_uri = $4, tx_hash = $5, raw_tx = $6,
+            submitted_at = CURRENT_TIMESTAMP, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE queue_id = $1
+    `, queueID, MintSubmitted, recipient, tokenURI, txHash, rawTx)
+    if err != nil {
+        return fmt.Errorf("failed to record mint submission: %w", err)
+    }
+
+    return nil
+}
+
+// ScheduleMintCheck releases the lease and looks at the mint again after delay
+func (db *NFTDatabase) ScheduleMintCheck(queueID int, delay time.Duration) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE queued_mints
+        SET next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $2), claimed_until = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE queue_id = $1
+    `, queueID, delay.Seconds())
+    if err != nil {
+        return fmt.Errorf("failed to schedule mint check: %w", err)
+    }
+
+    return nil
+}
+
+// RetryMint records a failed attempt and backs off. When resetTx is set the
+// stored transaction is discarded (it reverted or was dropped) and a fresh one
+// is built next time. After maxAttempts the mint is marked failed for manual follow-up.
+func (db *NFTDatabase) RetryMint(queueID int, mintErr error, delay time.Duration, resetTx bool, maxAttempts int) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE queued_mints
+        SET attempts = attempts + 1,
+            last_error = $2,
+            status = CASE WHEN attempts + 1 >= $5 THEN $6
+                          WHEN $4 THEN $7
+                          ELSE status END,
+            tx_hash = CASE WHEN $4 THEN NULL ELSE tx_hash END,
+            raw_tx = CASE WHEN $4 THEN NULL ELSE raw_tx END,
+            submitted_at = CASE WHEN $4 THEN NULL ELSE submitted_at END,
+            next_attempt_at = CURRENT_TIMESTAMP + make_interval(secs => $3),
+            claimed_until = NULL,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE queue_id = $1
+    `, queueID, mintErr.Error(), delay.Seconds(), resetTx, maxAttempts, MintFailed, MintQueued)
+    if err != nil {
+        return fmt.Errorf("failed to schedule mint retry: %w", err)
+    }
+
+    return nil
+}
+
+// CompleteMint marks a mint confirmed and records it in fresh_mints atomically
+func (db *NFTDatabase) CompleteMint(mint QueuedMint, contractAddress, tokenID string, blockNumber uint64) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    _, err = tx.Exec(ctx, `
+        INSERT INTO fresh_mints (queue_id, release_id, release_name, owner_address, contract_address, token_id, token_uri, tx_hash, block_number)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+        ON CONFLICT (queue_id) DO NOTHING
+    `, mint.QueueID, mint.ReleaseID, mint.ReleaseName, mint.RecipientAddress, contractAddress, tokenID, mint.TokenURI, mint.TxHash, int64(blockNumber))
+    if err != nil {
+        return fmt.Errorf("failed to insert fresh mint: %w", err)
+    }
+
+    // Queued mints carry the owner's username until the worker resolves a wallet
+    ownerUsername := mint.OwnerAddress
+    if isHexAddress(ownerUsername) {
+        ownerUsername = ""
+    }
+    _, err = tx.Exec(ctx, `
+        INSERT INTO nfts (contract_address, token_id, release_id, release_name, token_uri, owner_username, owner_address)
+        VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), LOWER($7))
+        ON CONFLICT (contract_address, token_id) DO UPDATE
+        SET release_id = EXCLUDED.release_id, release_name = EXCLUDED.release_name, token_uri = EXCLUDED.token_uri,
+            owner_username = EXCLUDED.owner_username, owner_address = EXCLUDED.owner_address, updated_at = CURRENT_TIMESTAMP
+    `, strings.ToLower(contractAddress), tokenID, mint.ReleaseID, mint.ReleaseName, mint.TokenURI, ownerUsername, mint.RecipientAddress)
+    if err != nil {
+        return fmt.Errorf("failed to record minted nft: %w", err)
+    }
+
+    _, err = tx.Exec(ctx, `
+        UPDATE queued_mints
+        SET status = $2, claimed_until = NULL, last_error = NULL, updated_at = CURRENT_TIMESTAMP
+        WHERE queue_id = $1
+    `, mint.QueueID, MintConfirmed)
+    if err != nil {
+        return fmt.Errorf("failed to confirm queued mint: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return fmt.Errorf("failed to commit mint confirmation: %w", err)
+    }
+
+    return nil
+}
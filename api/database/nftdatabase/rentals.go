@@ -0,0 +1,782 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgconn"
+    "github.com/jackc/pgx/v4"
+)
+
+// Rental offer statuses. A rented offer has a pending or active agreement and
+// goes back to active when that agreement ends.
+const (
+    RentalOfferActive    = "active"
+    RentalOfferRented    = "rented"
+    RentalOfferCancelled = "cancelled"
+)
+
+// Rental agreement statuses
+const (
+    RentalPending = "pending"
+    RentalActive  = "active"
+    RentalEnded   = "ended"
+    RentalFailed  = "failed"
+    RentalExpired = "expired"
+)
+
+var (
+    ErrRentalOfferNotFound    = errors.New("rental offer not found")
+    ErrRentalOfferNotActive   = errors.New("rental offer is no longer active")
+    ErrOwnRentalOffer         = errors.New("owners cannot rent their own token")
+    ErrInvalidRentalDuration  = errors.New("rental duration is outside the offer's limits")
+    ErrTokenAlreadyOffered    = errors.New("token already has an open rental offer")
+    ErrTokenRented            = errors.New("token is rented out")
+    ErrTokenListedForSale     = errors.New("token has an active marketplace listing")
+    ErrTokenOfferedForRent    = errors.New("token has an open rental offer")
+    ErrRentalNotFound         = errors.New("rental agreement not found")
+    ErrRentalNotPending       = errors.New("rental agreement is no longer pending")
+    ErrRentalPaymentSubmitted = errors.New("a different payment transaction was already submitted for this rental")
+)
+
+// RentalOffer is an owner's offer to lend a token for a daily price
+type RentalOffer struct {
+    OfferID         int       `json:"offer_id"`
+    NFTID           int       `json:"nft_id"`
+    ContractAddress string    `json:"contract_address"`
+    TokenID         string    `json:"token_id"`
+    Level           int       `json:"level"`
+    OwnerUsername   string    `json:"owner_username"`
+    OwnerAddress    string    `json:"owner_address"`
+    DailyPrice      string    `json:"daily_price"` // exact decimal, as stored
+    Currency        string    `json:"currency"`
+    MaxDays         int       `json:"max_days"`
+    Collateral      string    `json:"collateral"`
+    Status          string    `json:"status"`
+    CreatedAt       time.Time `json:"created_at"`
+    UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// NewRentalOffer is the data needed to offer a token for rent
+type NewRentalOffer struct {
+    NFTID         int
+    OwnerUsername string
+    OwnerAddress  string
+    DailyPrice    string
+    Currency      string
+    MaxDays       int
+    Collateral    string
+}
+
+// RentalAgreement is a renter's use of a token for a fixed number of days.
+// The renter pays AmountDue (rent plus collateral) to the owner in one
+// transaction; the rental starts once that payment verifies.
+type RentalAgreement struct {
+    AgreementID        int        `json:"agreement_id"`
+    OfferID            int        `json:"offer_id"`
+    NFTID              int        `json:"nft_id"`
+    ContractAddress    string     `json:"contract_address"`
+    TokenID            string     `json:"token_id"`
+    OwnerUsername      string     `json:"owner_username"`
+    OwnerAddress       string     `json:"owner_address"`
+    RenterUsername     string     `json:"renter_username"`
+    RenterAddress      string     `json:"renter_address"`
+    Days               int        `json:"days"`
+    DailyPrice         string     `json:"daily_price"`
+    TotalRent          string     `json:"total_rent"`
+    Collateral         string     `json:"collateral"`
+    AmountDue          string     `json:"amount_due"`
+    Currency           string     `json:"currency"`
+    Status             string     `json:"status"`
+    TxHash             *string    `json:"tx_hash"`
+    // PaymentSubmittedAt is when TxHash was attached; the payment timeout runs from it
+    PaymentSubmittedAt *time.Time `json:"payment_submitted_at"`
+    BlockNumber        *int64     `json:"block_number"`
+    FailureReason      *string    `json:"failure_reason"`
+    PaymentDueAt       time.Time  `json:"payment_due_at"`
+    StartsAt           *time.Time `json:"starts_at"`
+    EndsAt             *time.Time `json:"ends_at"`
+    PaymentRecorded    bool       `json:"-"`
+    CollateralRecorded bool       `json:"-"`
+    CreatedAt          time.Time  `json:"created_at"`
+    UpdatedAt          time.Time  `json:"updated_at"`
+}
+
+const rentalOfferColumns = `
+    o.offer_id, o.nft_id, o.contract_address, o.token_id, n.level, o.owner_username, o.owner_address,
+    o.daily_price::text, o.currency, o.max_days, o.collateral::text, o.status, o.created_at, o.updated_at
+`
+
+const rentalAgreementColumns = `
+    agreement_id, offer_id, nft_id, contract_address, token_id, owner_username, owner_address,
+    renter_username, renter_address, days, daily_price::text, total_rent::text, collateral::text,
+    (total_rent + collateral)::text, currency, status, tx_hash, block_number, failure_reason,
+    payment_due_at, starts_at, ends_at, payment_recorded, collateral_recorded, created_at, updated_at,
+    payment_submitted_at
+`
+
+func scanRentalOffer(row pgx.Row) (*RentalOffer, error) {
+    var offer RentalOffer
+    err := row.Scan(&offer.OfferID, &offer.NFTID, &offer.ContractAddress, &offer.TokenID, &offer.Level,
+        &offer.OwnerUsername, &offer.OwnerAddress, &offer.DailyPrice, &offer.Currency, &offer.MaxDays,
+        &offer.Collateral, &offer.Status, &offer.CreatedAt, &offer.UpdatedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &offer, nil
+}
+
+func scanRentalAgreement(row pgx.Row) (*RentalAgreement, error) {
+    var agreement RentalAgreement
+    err := row.Scan(&agreement.AgreementID, &agreement.OfferID, &agreement.NFTID, &agreement.ContractAddress,
+        &agreement.TokenID, &agreement.OwnerUsername, &agreement.OwnerAddress, &agreement.RenterUsername,
+        &agreement.RenterAddress, &agreement.Days, &agreement.DailyPrice, &agreement.TotalRent, &agreement.Collateral,
+        &agreement.AmountDue, &agreement.Currency, &agreement.Status, &agreement.TxHash, &agreement.BlockNumber,
+        &agreement.FailureReason, &agreement.PaymentDueAt, &agreement.StartsAt, &agreement.EndsAt,
+        &agreement.PaymentRecorded, &agreement.CollateralRecorded, &agreement.CreatedAt, &agreement.UpdatedAt,
+        &agreement.PaymentSubmittedAt)
+    if err != nil {
+        return nil, err
+    }
+    return &agreement, nil
+}
+
+func rentalAgreements(rows pgx.Rows) ([]RentalAgreement, error) {
+    defer rows.Close()
+
+    agreements := []RentalAgreement{}
+    for rows.Next() {
+        agreement, err := scanRentalAgreement(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan rental agreement: %w", err)
+        }
+        agreements = append(agreements, *agreement)
+    }
+
+    return agreements, rows.Err()
+}
+
+// CreateRentalOffer offers a token the user owns for rent. A token can have
+// one open offer at a time and cannot be offered while it is listed for sale.
+func (db *NFTDatabase) CreateRentalOffer(offer NewRentalOffer) (*RentalOffer, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    var contractAddress, tokenID string
+    var ownerUsername, rentedTo *string
+    err = tx.QueryRow(ctx, `
+        SELECT contract_address, token_id, owner_username, rented_to FROM nfts WHERE nft_id = $1 FOR UPDATE
+    `, offer.NFTID).Scan(&contractAddress, &tokenID, &ownerUsername, &rentedTo)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrNFTNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch nft: %w", err)
+    }
+    if ownerUsername == nil || *ownerUsername != offer.OwnerUsername {
+        return nil, ErrNotTokenOwner
+    }
+    if rentedTo != nil {
+        return nil, ErrTokenRented
+    }
+
+    var listed bool
+    if err := tx.QueryRow(ctx, `
+        SELECT EXISTS (
+            SELECT 1 FROM marketplace_listings
+            WHERE contract_address = $1 AND token_id = $2 AND status IN ($3, $4)
+              AND (status <> $3 OR expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+        )
+    `, contractAddress, tokenID, ListingActive, ListingReserved).Scan(&listed); err != nil {
+        return nil, fmt.Errorf("failed to check listings: %w", err)
+    }
+    if listed {
+        return nil, ErrTokenListedForSale
+    }
+
+    var offerID int
+    err = tx.QueryRow(ctx, `
+        INSERT INTO rental_offers (nft_id, contract_address, token_id, owner_username, owner_address, daily_price, currency, max_days, collateral, status)
+        VALUES ($1, $2, $3, $4, LOWER($5), $6, $7, $8, $9, $10)
+        RETURNING offer_id
+    `, offer.NFTID, contractAddress, tokenID, offer.OwnerUsername, offer.OwnerAddress, offer.DailyPrice, offer.Currency,
+        offer.MaxDays, offer.Collateral, RentalOfferActive).Scan(&offerID)
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return nil, ErrTokenAlreadyOffered
+        }
+        return nil, fmt.Errorf("failed to create rental offer: %w", err)
+    }
+
+    created, err := scanRentalOffer(tx.QueryRow(ctx, `
+        SELECT `+rentalOfferColumns+` FROM rental_offers o JOIN nfts n ON n.nft_id = o.nft_id WHERE o.offer_id = $1
+    `, offerID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental offer: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit rental offer: %w", err)
+    }
+
+    return created, nil
+}
+
+// GetRentalOffer fetches a single rental offer
+func (db *NFTDatabase) GetRentalOffer(offerID int) (*RentalOffer, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    offer, err := scanRentalOffer(db.Pool.QueryRow(ctx, `
+        SELECT `+rentalOfferColumns+` FROM rental_offers o JOIN nfts n ON n.nft_id = o.nft_id WHERE o.offer_id = $1
+    `, offerID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrRentalOfferNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental offer: %w", err)
+    }
+
+    return offer, nil
+}
+
+// GetRentalOffers returns the offers open for renting, optionally limited to
+// one contract and a minimum level, highest level first
+func (db *NFTDatabase) GetRentalOffers(contractAddress string, minLevel int) ([]RentalOffer, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+rentalOfferColumns+`
+        FROM rental_offers o
+        JOIN nfts n ON n.nft_id = o.nft_id
+        WHERE o.status = $1
+          AND ($2 = '' OR o.contract_address = $2)
+          AND n.level >= $3
+        ORDER BY n.level DESC, o.offer_id DESC
+    `, RentalOfferActive, strings.ToLower(contractAddress), minLevel)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental offers: %w", err)
+    }
+    defer rows.Close()
+
+    offers := []RentalOffer{}
+    for rows.Next() {
+        offer, err := scanRentalOffer(rows)
+        if err != nil {
+            return nil, fmt.Errorf("failed to scan rental offer: %w", err)
+        }
+        offers = append(offers, *offer)
+    }
+
+    return offers, rows.Err()
+}
+
+// CancelRentalOffer withdraws an offer that is not currently rented
+func (db *NFTDatabase) CancelRentalOffer(offerID int, ownerUsername string) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tag, err := db.Pool.Exec(ctx, `
+        UPDATE rental_offers SET status = $3, updated_at = CURRENT_TIMESTAMP
+        WHERE offer_id = $1 AND owner_username = $2 AND status = $4
+    `, offerID, ownerUsername, RentalOfferCancelled, RentalOfferActive)
+    if err != nil {
+        return fmt.Errorf("failed to cancel rental offer: %w", err)
+    }
+    if tag.RowsAffected() == 1 {
+        return nil
+    }
+
+    offer, err := db.GetRentalOffer(offerID)
+    if err != nil {
+        return err
+    }
+    if offer.OwnerUsername != ownerUsername {
+        return ErrRentalOfferNotFound
+    }
+    return ErrRentalOfferNotActive
+}
+
+// RentToken takes an offer off the market for hold and records a pending
+// agreement for days days. The offer row is locked for the duration, so
+// concurrent renters are serialized the same way ReserveListing serializes
+// buyers. Calling it again while the renter's own agreement is still pending
+// returns that agreement. Offers priced in anything but currency, the one
+// payments settle in, return ErrUnsupportedCurrency.
+func (db *NFTDatabase) RentToken(offerID int, renterUsername, renterAddress, currency string, days int, hold time.Duration) (*RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    offer, err := scanRentalOffer(tx.QueryRow(ctx, `
+        SELECT `+rentalOfferColumns+` FROM rental_offers o JOIN nfts n ON n.nft_id = o.nft_id WHERE o.offer_id = $1 FOR UPDATE OF o
+    `, offerID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrRentalOfferNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental offer: %w", err)
+    }
+
+    if offer.OwnerUsername == renterUsername {
+        return nil, ErrOwnRentalOffer
+    }
+    if offer.Currency != currency {
+        return nil, ErrUnsupportedCurrency
+    }
+
+    switch offer.Status {
+    case RentalOfferActive:
+    case RentalOfferRented:
+        current, err := scanRentalAgreement(tx.QueryRow(ctx, `
+            SELECT `+rentalAgreementColumns+` FROM rental_agreements WHERE offer_id = $1 AND status = $2
+        `, offerID, RentalPending))
+        if errors.Is(err, pgx.ErrNoRows) {
+            return nil, ErrRentalOfferNotActive
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to fetch rental agreement: %w", err)
+        }
+        if current.RenterUsername == renterUsername {
+            return current, tx.Commit(ctx)
+        }
+
+        // A pending agreement only lapses if no payment was submitted against it
+        var due bool
+        if err := tx.QueryRow(ctx, `
+            SELECT payment_due_at <= CURRENT_TIMESTAMP FROM rental_agreements WHERE agreement_id = $1
+        `, current.AgreementID).Scan(&due); err != nil {
+            return nil, fmt.Errorf("failed to check rental agreement: %w", err)
+        }
+        if current.TxHash != nil || !due {
+            return nil, ErrRentalOfferNotActive
+        }
+        if _, err := tx.Exec(ctx, `
+            UPDATE rental_agreements SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE agreement_id = $1
+        `, current.AgreementID, RentalExpired); err != nil {
+            return nil, fmt.Errorf("failed to expire rental agreement: %w", err)
+        }
+    default:
+        return nil, ErrRentalOfferNotActive
+    }
+
+    if days < 1 || days > offer.MaxDays {
+        return nil, ErrInvalidRentalDuration
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE rental_offers SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE offer_id = $1
+    `, offerID, RentalOfferRented); err != nil {
+        return nil, fmt.Errorf("failed to reserve rental offer: %w", err)
+    }
+
+    agreement, err := scanRentalAgreement(tx.QueryRow(ctx, `
+        INSERT INTO rental_agreements (offer_id, nft_id, contract_address, token_id, owner_username, owner_address,
+            renter_username, renter_address, days, daily_price, total_rent, collateral, currency, status, payment_due_at)
+        SELECT offer_id, nft_id, contract_address, token_id, owner_username, owner_address,
+            $2, LOWER($3), $4, daily_price, daily_price * $4, collateral, currency, $5, CURRENT_TIMESTAMP + $6 * INTERVAL '1 second'
+        FROM rental_offers WHERE offer_id = $1
+        RETURNING `+rentalAgreementColumns,
+        offerID, renterUsername, renterAddress, days, RentalPending, int64(hold/time.Second)))
+    if err != nil {
+        return nil, fmt.Errorf("failed to create rental agreement: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit rental: %w", err)
+    }
+
+    return agreement, nil
+}
+
+// GetRentalAgreement fetches a single rental agreement
+func (db *NFTDatabase) GetRentalAgreement(agreementID int) (*RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    agreement, err := scanRentalAgreement(db.Pool.QueryRow(ctx, `
+        SELECT `+rentalAgreementColumns+` FROM rental_agreements WHERE agreement_id = $1
+    `, agreementID))
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrRentalNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental agreement: %w", err)
+    }
+
+    return agreement, nil
+}
+
+// GetRentals returns the agreements a user is the owner or renter on, newest first
+func (db *NFTDatabase) GetRentals(username string) ([]RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+rentalAgreementColumns+`
+        FROM rental_agreements
+        WHERE owner_username = $1 OR renter_username = $1
+        ORDER BY agreement_id DESC
+    `, username)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental agreements: %w", err)
+    }
+
+    return rentalAgreements(rows)
+}
+
+// SubmitRentalPayment attaches the renter's payment transaction to a pending
+// agreement. As with orders, an agreement with a payment attached no longer
+// lapses while the payment confirms; settlement fails it instead if the
+// payment is not mined within its timeout of payment_submitted_at.
+func (db *NFTDatabase) SubmitRentalPayment(agreementID int, renterUsername, txHash string) (*RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    txHash = strings.ToLower(txHash)
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    agreement, err := scanRentalAgreement(tx.QueryRow(ctx, `
+        SELECT `+rentalAgreementColumns+` FROM rental_agreements WHERE agreement_id = $1 FOR UPDATE
+    `, agreementID))
+    if errors.Is(err, pgx.ErrNoRows) || (err == nil && agreement.RenterUsername != renterUsername) {
+        return nil, ErrRentalNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental agreement: %w", err)
+    }
+
+    if agreement.TxHash != nil {
+        if *agreement.TxHash == txHash {
+            return agreement, tx.Commit(ctx)
+        }
+        return nil, ErrRentalPaymentSubmitted
+    }
+
+    var due bool
+    if err := tx.QueryRow(ctx, `
+        SELECT payment_due_at <= CURRENT_TIMESTAMP FROM rental_agreements WHERE agreement_id = $1
+    `, agreementID).Scan(&due); err != nil {
+        return nil, fmt.Errorf("failed to check rental agreement: %w", err)
+    }
+    if agreement.Status != RentalPending || due {
+        return nil, ErrRentalNotPending
+    }
+
+    used, err := txHashUsedByOrder(ctx, tx, txHash)
+    if err != nil {
+        return nil, err
+    }
+    if used {
+        return nil, ErrTxHashUsed
+    }
+
+    agreement, err = scanRentalAgreement(tx.QueryRow(ctx, `
+        UPDATE rental_agreements SET tx_hash = $2, payment_submitted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+        WHERE agreement_id = $1
+        RETURNING `+rentalAgreementColumns, agreementID, txHash))
+    if err != nil {
+        var pgErr *pgconn.PgError
+        if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+            return nil, ErrTxHashUsed
+        }
+        return nil, fmt.Errorf("failed to record rental payment: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit rental payment: %w", err)
+    }
+
+    return agreement, nil
+}
+
+// txHashUsedByOrder reports whether a payment transaction already settles a marketplace order
+func txHashUsedByOrder(ctx context.Context, tx pgx.Tx, txHash string) (bool, error) {
+    var used bool
+    err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM marketplace_orders WHERE tx_hash = $1)`, txHash).Scan(&used)
+    if err != nil {
+        return false, fmt.Errorf("failed to check payment transaction: %w", err)
+    }
+    return used, nil
+}
+
+// txHashUsedByRental reports whether a payment transaction already pays for a rental
+func txHashUsedByRental(ctx context.Context, tx pgx.Tx, txHash string) (bool, error) {
+    var used bool
+    err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM rental_agreements WHERE tx_hash = $1)`, txHash).Scan(&used)
+    if err != nil {
+        return false, fmt.Errorf("failed to check payment transaction: %w", err)
+    }
+    return used, nil
+}
+
+// GetPaidPendingRentals returns pending agreements with a payment awaiting verification
+func (db *NFTDatabase) GetPaidPendingRentals(limit int) ([]RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+rentalAgreementColumns+`
+        FROM rental_agreements
+        WHERE status = $1 AND tx_hash IS NOT NULL
+        ORDER BY agreement_id
+        LIMIT $2
+    `, RentalPending, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch pending rentals: %w", err)
+    }
+
+    return rentalAgreements(rows)
+}
+
+// ActivateRental starts a rental whose payment verified: the rental period
+// begins now and the renter holds the token's perks and engagement until it
+// ends. Activating an already active rental is a no-op.
+func (db *NFTDatabase) ActivateRental(agreementID int, blockNumber uint64) (*RentalAgreement, error) {
+    return db.finishRentalPayment(agreementID, RentalActive, &blockNumber, nil)
+}
+
+// FailRental closes a pending rental whose payment can never verify and puts
+// the offer back on the market
+func (db *NFTDatabase) FailRental(agreementID int, reason string) (*RentalAgreement, error) {
+    return db.finishRentalPayment(agreementID, RentalFailed, nil, &reason)
+}
+
+// FailStalledRental fails a pending agreement like FailRental once its payment
+// was submitted at least timeout ago, putting the offer back on the market.
+// While the timeout is still running it returns nil, nil.
+func (db *NFTDatabase) FailStalledRental(agreementID int, timeout time.Duration, reason string) (*RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var stalled bool
+    err := db.Pool.QueryRow(ctx, `
+        SELECT COALESCE(payment_submitted_at + $2 * INTERVAL '1 second' <= CURRENT_TIMESTAMP, FALSE)
+        FROM rental_agreements WHERE agreement_id = $1
+    `, agreementID, int64(timeout/time.Second)).Scan(&stalled)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrRentalNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to check payment timeout: %w", err)
+    }
+    if !stalled {
+        return nil, nil
+    }
+
+    return db.FailRental(agreementID, reason)
+}
+
+func (db *NFTDatabase) finishRentalPayment(agreementID int, status string, blockNumber *uint64, reason *string) (*RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // Lock the offer before the agreement, matching RentToken's lock order
+    var offerID int
+    err = tx.QueryRow(ctx, `SELECT offer_id FROM rental_agreements WHERE agreement_id = $1`, agreementID).Scan(&offerID)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, ErrRentalNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental agreement: %w", err)
+    }
+    if _, err := tx.Exec(ctx, `SELECT 1 FROM rental_offers WHERE offer_id = $1 FOR UPDATE`, offerID); err != nil {
+        return nil, fmt.Errorf("failed to lock rental offer: %w", err)
+    }
+
+    agreement, err := scanRentalAgreement(tx.QueryRow(ctx, `
+        SELECT `+rentalAgreementColumns+` FROM rental_agreements WHERE agreement_id = $1 FOR UPDATE
+    `, agreementID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch rental agreement: %w", err)
+    }
+    if agreement.Status == status {
+        return agreement, tx.Commit(ctx)
+    }
+    if agreement.Status != RentalPending {
+        return nil, ErrRentalNotPending
+    }
+
+    var block *int64
+    if blockNumber != nil {
+        value := int64(*blockNumber)
+        block = &value
+    }
+
+    agreement, err = scanRentalAgreement(tx.QueryRow(ctx, `
+        UPDATE rental_agreements
+        SET status = $2, block_number = $3, failure_reason = $4,
+            starts_at = CASE WHEN $2 = $5 THEN CURRENT_TIMESTAMP END,
+            ends_at = CASE WHEN $2 = $5 THEN CURRENT_TIMESTAMP + days * INTERVAL '1 day' END,
+            updated_at = CURRENT_TIMESTAMP
+        WHERE agreement_id = $1
+        RETURNING `+rentalAgreementColumns, agreementID, status, block, reason, RentalActive))
+    if err != nil {
+        return nil, fmt.Errorf("failed to update rental agreement: %w", err)
+    }
+
+    if status == RentalActive {
+        _, err = tx.Exec(ctx, `
+            UPDATE nfts SET rented_to = $2, updated_at = CURRENT_TIMESTAMP WHERE nft_id = $1
+        `, agreement.NFTID, agreement.RenterUsername)
+    } else {
+        _, err = tx.Exec(ctx, `
+            UPDATE rental_offers SET status = $2, updated_at = CURRENT_TIMESTAMP WHERE offer_id = $1 AND status = $3
+        `, offerID, RentalOfferActive, RentalOfferRented)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to update rented token: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit rental agreement: %w", err)
+    }
+
+    return agreement, nil
+}
+
+// ExpireRentals closes agreements whose time is up: unpaid pending agreements
+// past their payment deadline expire, and active rentals past their end date
+// end and hand the token's perks back to the owner. Either way the offer goes
+// back on the market. It returns how many agreements were expired and ended.
+func (db *NFTDatabase) ExpireRentals() (int64, int64, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    // Offers are locked first, matching RentToken's lock order
+    rows, err := tx.Query(ctx, `
+        SELECT o.offer_id
+        FROM rental_offers o
+        JOIN rental_agreements a ON a.offer_id = o.offer_id
+        WHERE o.status = $1
+          AND ((a.status = $2 AND a.tx_hash IS NULL AND a.payment_due_at <= CURRENT_TIMESTAMP)
+            OR (a.status = $3 AND a.ends_at <= CURRENT_TIMESTAMP))
+        FOR UPDATE OF o
+    `, RentalOfferRented, RentalPending, RentalActive)
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to fetch lapsed rentals: %w", err)
+    }
+    var offerIDs []int32
+    for rows.Next() {
+        var offerID int32
+        if err := rows.Scan(&offerID); err != nil {
+            rows.Close()
+            return 0, 0, fmt.Errorf("failed to scan rental offer: %w", err)
+        }
+        offerIDs = append(offerIDs, offerID)
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return 0, 0, fmt.Errorf("failed to fetch lapsed rentals: %w", err)
+    }
+    if len(offerIDs) == 0 {
+        return 0, 0, nil
+    }
+
+    expired, err := tx.Exec(ctx, `
+        UPDATE rental_agreements SET status = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE offer_id = ANY($1) AND status = $3 AND tx_hash IS NULL AND payment_due_at <= CURRENT_TIMESTAMP
+    `, offerIDs, RentalExpired, RentalPending)
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to expire rental agreements: %w", err)
+    }
+
+    ended, err := tx.Exec(ctx, `
+        WITH ended AS (
+            UPDATE rental_agreements SET status = $2, updated_at = CURRENT_TIMESTAMP
+            WHERE offer_id = ANY($1) AND status = $3 AND ends_at <= CURRENT_TIMESTAMP
+            RETURNING nft_id, renter_username
+        )
+        UPDATE nfts n SET rented_to = NULL, updated_at = CURRENT_TIMESTAMP
+        FROM ended
+        WHERE n.nft_id = ended.nft_id AND n.rented_to = ended.renter_username
+    `, offerIDs, RentalEnded, RentalActive)
+    if err != nil {
+        return 0, 0, fmt.Errorf("failed to end rentals: %w", err)
+    }
+
+    if _, err := tx.Exec(ctx, `
+        UPDATE rental_offers SET status = $2, updated_at = CURRENT_TIMESTAMP
+        WHERE offer_id = ANY($1) AND status = $3
+    `, offerIDs, RentalOfferActive, RentalOfferRented); err != nil {
+        return 0, 0, fmt.Errorf("failed to release rental offers: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return 0, 0, fmt.Errorf("failed to commit lapsed rentals: %w", err)
+    }
+
+    return expired.RowsAffected(), ended.RowsAffected(), nil
+}
+
+// GetUnrecordedRentals returns agreements with ledger entries still to write:
+// settled payments not yet recorded, and ended rentals whose collateral
+// refund is not yet recorded
+func (db *NFTDatabase) GetUnrecordedRentals(limit int) ([]RentalAgreement, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    rows, err := db.Pool.Query(ctx, `
+        SELECT `+rentalAgreementColumns+`
+        FROM rental_agreements
+        WHERE (status IN ($1, $2, $3) AND NOT payment_recorded)
+           OR (status = $2 AND NOT collateral_recorded)
+        ORDER BY agreement_id
+        LIMIT $4
+    `, RentalActive, RentalEnded, RentalFailed, limit)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch unrecorded rentals: %w", err)
+    }
+
+    return rentalAgreements(rows)
+}
+
+// MarkRentalRecorded notes which of an agreement's ledger entries have been written
+func (db *NFTDatabase) MarkRentalRecorded(agreementID int, payment, collateral bool) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    _, err := db.Pool.Exec(ctx, `
+        UPDATE rental_agreements
+        SET payment_recorded = payment_recorded OR $2, collateral_recorded = collateral_recorded OR $3, updated_at = CURRENT_TIMESTAMP
+        WHERE agreement_id = $1
+    `, agreementID, payment, collateral)
+    if err != nil {
+        return fmt.Errorf("failed to mark rental recorded: %w", err)
+    }
+
+    return nil
+}
@@ -0,0 +1,348 @@
+package nftdatabase
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strings"
+    "time"
+
+    "github.com/jackc/pgx/v4"
+)
+
+// Staking event types, matching the NFTStaker events they are decoded from
+const (
+    StakingEventStaked   = "staked"
+    StakingEventUnstaked = "unstaked"
+    StakingEventLevelUp  = "level_up"
+)
+
+// ChainCheckpoint is the last block an indexer has fully processed. The hash
+// lets the indexer notice when that block has been reorganized away.
+type ChainCheckpoint struct {
+    Name        string
+    BlockNumber uint64
+    BlockHash   string
+}
+
+// StakingEventRecord is an indexed NFTStaker event
+type StakingEventRecord struct {
+    StakerContract string
+    TokenContract  string
+    TokenID        string
+    EventType      string
+    StakerAddress  string
+    NewLevel       *int64
+    BlockNumber    uint64
+    BlockHash      string
+    BlockTime      time.Time
+    TxHash         string
+    LogIndex       uint
+}
+
+// TokenRef identifies a token on a contract
+type TokenRef struct {
+    ContractAddress string
+    TokenID         string
+}
+
+// TokenChainState is a token's level and staking status as seen on chain
+type TokenChainState struct {
+    ContractAddress string     `json:"contract_address"`
+    TokenID         string     `json:"token_id"`
+    Level           int        `json:"level"`
+    Staked          bool       `json:"staked"`
+    StakerAddress   *string    `json:"staker_address"`
+    StakedAt        *time.Time `json:"staked_at"`
+    LastEventBlock  *int64     `json:"last_event_block"`
+}
+
+// GetChainCheckpoint returns the named checkpoint, or nil if the indexer has
+// not run yet
+func (db *NFTDatabase) GetChainCheckpoint(name string) (*ChainCheckpoint, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    checkpoint := ChainCheckpoint{Name: name}
+    var blockNumber int64
+    err := db.Pool.QueryRow(ctx, `
+        SELECT block_number, block_hash FROM chain_checkpoints WHERE name = $1
+    `, name).Scan(&blockNumber, &checkpoint.BlockHash)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch checkpoint: %w", err)
+    }
+
+    checkpoint.BlockNumber = uint64(blockNumber)
+    return &checkpoint, nil
+}
+
+// SaveStakingEvents stores a processed block range's events and advances the
+// checkpoint in one transaction, so a crash never leaves the checkpoint ahead
+// of the data. LevelUp events also move the token's level. Re-saving an event
+// that is already stored is a no-op.
+func (db *NFTDatabase) SaveStakingEvents(events []StakingEventRecord, checkpoint ChainCheckpoint) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    for _, event := range events {
+        var eventID int
+        err := tx.QueryRow(ctx, `
+            INSERT INTO staking_events (staker_contract, token_contract, token_id, event_type, staker_address, new_level,
+                block_number, block_hash, block_time, tx_hash, log_index)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+            ON CONFLICT (tx_hash, log_index) DO NOTHING
+            RETURNING event_id
+        `, strings.ToLower(event.StakerContract), strings.ToLower(event.TokenContract), event.TokenID, event.EventType,
+            strings.ToLower(event.StakerAddress), event.NewLevel, int64(event.BlockNumber), event.BlockHash,
+            event.BlockTime, event.TxHash, int(event.LogIndex)).Scan(&eventID)
+        if errors.Is(err, pgx.ErrNoRows) {
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("failed to store staking event %s:%d: %w", event.TxHash, event.LogIndex, err)
+        }
+
+        if event.EventType != StakingEventLevelUp || event.NewLevel == nil {
+            continue
+        }
+        nftID, err := ensureNFTTx(ctx, tx, event.TokenContract, event.TokenID)
+        if err != nil {
+            return err
+        }
+        sourceRef := fmt.Sprintf("%s:%d", event.TxHash, event.LogIndex)
+        if _, err := applyLevelChangeTx(ctx, tx, nftID, int(*event.NewLevel), LevelSourceStaking, sourceRef, "", &eventID); err != nil {
+            return err
+        }
+    }
+
+    if err := saveCheckpointTx(ctx, tx, checkpoint); err != nil {
+        return err
+    }
+
+    return tx.Commit(ctx)
+}
+
+// LatestStakingEventBlock returns the number and hash of the highest block
+// below beforeBlock holding one of stakerContract's events, or nil if there is
+// none. The indexer uses it to find how far back a reorg reaches.
+func (db *NFTDatabase) LatestStakingEventBlock(stakerContract string, beforeBlock uint64) (*ChainCheckpoint, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    var block ChainCheckpoint
+    var blockNumber int64
+    err := db.Pool.QueryRow(ctx, `
+        SELECT block_number, block_hash FROM staking_events
+        WHERE staker_contract = $1 AND block_number < $2
+        ORDER BY block_number DESC
+        LIMIT 1
+    `, strings.ToLower(stakerContract), int64(beforeBlock)).Scan(&blockNumber, &block.BlockHash)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch latest staking event block: %w", err)
+    }
+
+    block.BlockNumber = uint64(blockNumber)
+    return &block, nil
+}
+
+// RewindStakingEvents discards everything a reorg may have invalidated:
+// stakerContract's events from fromBlock up, and the named checkpoint, which
+// moves back to checkpoint (or is removed when checkpoint is nil so indexing
+// restarts from the beginning). It returns the tokens whose state may have
+// changed, whose levels have already been recomputed.
+func (db *NFTDatabase) RewindStakingEvents(name, stakerContract string, fromBlock uint64, checkpoint *ChainCheckpoint) ([]TokenRef, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
+
+    tx, err := db.Pool.Begin(ctx)
+    if err != nil {
+        return nil, fmt.Errorf("failed to begin transaction: %w", err)
+    }
+    defer tx.Rollback(ctx)
+
+    rows, err := tx.Query(ctx, `
+        DELETE FROM staking_events
+        WHERE staker_contract = $1 AND block_number >= $2
+        RETURNING token_contract, token_id
+    `, strings.ToLower(stakerContract), int64(fromBlock))
+    if err != nil {
+        return nil, fmt.Errorf("failed to rewind staking events: %w", err)
+    }
+
+    seen := map[TokenRef]bool{}
+    var tokens []TokenRef
+    for rows.Next() {
+        var token TokenRef
+        if err := rows.Scan(&token.ContractAddress, &token.TokenID); err != nil {
+            rows.Close()
+            return nil, fmt.Errorf("failed to scan rewound event: %w", err)
+        }
+        if !seen[token] {
+            seen[token] = true
+            tokens = append(tokens, token)
+        }
+    }
+    rows.Close()
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("failed to rewind staking events: %w", err)
+    }
+
+    // Level history from the removed events went with them; roll levels back to match
+    for _, token := range tokens {
+        if err := recomputeLevelTx(ctx, tx, token.ContractAddress, token.TokenID); err != nil {
+            return nil, err
+        }
+    }
+
+    if checkpoint != nil {
+        err = saveCheckpointTx(ctx, tx, *checkpoint)
+    } else {
+        _, err = tx.Exec(ctx, `DELETE FROM chain_checkpoints WHERE name = $1`, name)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to rewind checkpoint: %w", err)
+    }
+
+    if err := tx.Commit(ctx); err != nil {
+        return nil, fmt.Errorf("failed to commit rewind: %w", err)
+    }
+
+    return tokens, nil
+}
+
+func saveCheckpointTx(ctx context.Context, tx pgx.Tx, checkpoint ChainCheckpoint) error {
+    _, err := tx.Exec(ctx, `
+        INSERT INTO chain_checkpoints (name, block_number, block_hash, updated_at)
+        VALUES ($1, $2, $3, CURRENT_TIMESTAMP)
+        ON CONFLICT (name) DO UPDATE
+        SET block_number = EXCLUDED.block_number, block_hash = EXCLUDED.block_hash, updated_at = CURRENT_TIMESTAMP
+    `, checkpoint.Name, int64(checkpoint.BlockNumber), checkpoint.BlockHash)
+    if err != nil {
+        return fmt.Errorf("failed to save checkpoint: %w", err)
+    }
+    return nil
+}
+
+// GetTokenChainState derives a token's level and staking status from its
+// indexed events. Tokens with no events are at the mint level of 1 and unstaked.
+func (db *NFTDatabase) GetTokenChainState(contractAddress, tokenID string) (*TokenChainState, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    state := &TokenChainState{ContractAddress: strings.ToLower(contractAddress), TokenID: tokenID, Level: 1}
+
+    err := db.Pool.QueryRow(ctx, `
+        SELECT new_level
+        FROM staking_events
+        WHERE token_contract = $1 AND token_id = $2 AND event_type = $3
+        ORDER BY block_number DESC, log_index DESC
+        LIMIT 1
+    `, state.ContractAddress, tokenID, StakingEventLevelUp).Scan(&state.Level)
+    if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+        return nil, fmt.Errorf("failed to fetch token level: %w", err)
+    }
+
+    var eventType, stakerAddress string
+    var blockTime time.Time
+    var blockNumber int64
+    err = db.Pool.QueryRow(ctx, `
+        SELECT event_type, staker_address, block_time, block_number
+        FROM staking_events
+        WHERE token_contract = $1 AND token_id = $2 AND event_type IN ($3, $4)
+        ORDER BY block_number DESC, log_index DESC
+        LIMIT 1
+    `, state.ContractAddress, tokenID, StakingEventStaked, StakingEventUnstaked).Scan(&eventType, &stakerAddress, &blockTime, &blockNumber)
+    if errors.Is(err, pgx.ErrNoRows) {
+        return state, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch token staking status: %w", err)
+    }
+
+    state.LastEventBlock = &blockNumber
+    if eventType == StakingEventStaked {
+        state.Staked = true
+        state.StakerAddress = &stakerAddress
+        state.StakedAt = &blockTime
+    }
+
+    return state, nil
+}
+
+// WalletStake is a token a wallet has staked, as seen in the indexed events
+type WalletStake struct {
+    StakerContract string    `json:"staker_contract"`
+    TokenContract  string    `json:"token_contract"`
+    TokenID        string    `json:"token_id"`
+    NFTID          *int      `json:"nft_id"`
+    Level          int       `json:"level"`
+    StakedAt       time.Time `json:"staked_at"`
+    // StakedSeconds adds up every period the wallet has had the token
+    // staked, including the current one
+    StakedSeconds int64 `json:"staked_seconds"`
+    // LevelUpDone is set once the staker contract has run its level-up
+    LevelUpDone bool `json:"level_up_done"`
+}
+
+// GetWalletStakes returns the tokens a wallet currently has staked according
+// to the indexed events, oldest stake first
+func (db *NFTDatabase) GetWalletStakes(wallet string) ([]WalletStake, error) {
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    // Each stake period runs from a staked event to the token's next
+    // stake/unstake event, or to now for the period still open
+    rows, err := db.Pool.Query(ctx, `
+        WITH periods AS (
+            SELECT staker_contract, token_contract, token_id, event_type, staker_address, block_time,
+                LEAD(block_time) OVER w AS ended_at,
+                ROW_NUMBER() OVER (PARTITION BY staker_contract, token_contract, token_id
+                                   ORDER BY block_number DESC, log_index DESC) AS latest
+            FROM staking_events
+            WHERE event_type IN ($2, $3)
+            WINDOW w AS (PARTITION BY staker_contract, token_contract, token_id ORDER BY block_number, log_index)
+        ),
+        stakes AS (
+            SELECT staker_contract, token_contract, token_id,
+                MAX(block_time) FILTER (WHERE latest = 1) AS staked_at,
+                SUM(EXTRACT(EPOCH FROM COALESCE(ended_at, CURRENT_TIMESTAMP AT TIME ZONE 'UTC') - block_time))::BIGINT AS staked_seconds
+            FROM periods
+            WHERE event_type = $2 AND staker_address = $1
+            GROUP BY staker_contract, token_contract, token_id
+        )
+        SELECT s.staker_contract, s.token_contract, s.token_id, n.nft_id, COALESCE(n.level, 1), s.staked_at, s.staked_seconds,
+            EXISTS (SELECT 1 FROM staking_events l WHERE l.staker_contract = s.staker_contract AND l.event_type = $4)
+        FROM stakes s
+        LEFT JOIN nfts n ON n.contract_address = s.token_contract AND n.token_id = s.token_id
+        WHERE s.staked_at IS NOT NULL
+        ORDER BY s.staked_at, s.token_id
+    `, strings.ToLower(wallet), StakingEventStaked, StakingEventUnstaked, StakingEventLevelUp)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch wallet stakes: %w", err)
+    }
+    defer rows.Close()
+
+    stakes := []WalletStake{}
+    for rows.Next() {
+        var stake WalletStake
+        if err := rows.Scan(&stake.StakerContract, &stake.TokenContract, &stake.TokenID, &stake.NFTID, &stake.Level,
+            &stake.StakedAt, &stake.StakedSeconds, &stake.LevelUpDone); err != nil {
+            return nil, fmt.Errorf("failed to scan wallet stake: %w", err)
+        }
+        stakes = append(stakes, stake)
+    }
+
+    return stakes, rows.Err()
+}
@@ -1,43 +1,15 @@
 package handlers
 
 import (
+    "errors"
     "github.com/gofiber/fiber/v2"
     "log"
     "shellhacks/api/database/accountdatabase"
-    "github.com/dgrijalva/jwt-go"
 )
 
 // Handler function to fetch user profile
 func getProfileHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
-    authHeader := c.Get("Authorization")
-    if authHeader == "" {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Missing authorization header",
-        })
-    }
-
-    tokenStr := authHeader[len("Bearer "):]
-    token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fiber.ErrUnauthorized
-        }
-        return secretKey, nil
-    })
-
-    if err != nil || !token.Valid {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token",
-        })
-    }
-
-    claims, ok := token.Claims.(jwt.MapClaims)
-    if !ok {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token claims",
-        })
-    }
-
-    username := claims["username"].(string)
+    username := currentUsername(c)
     user, err := accountDB.GetUserByUsername(username)
     if err != nil || user == nil {
         return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
@@ -55,7 +27,6 @@ func getProfileHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase)
 // Handler function to update account details
 func updateAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
     type UpdateAccountRequest struct {
-        Username    string `json:"username"`
         NewUsername string `json:"new_username"`
         NewEmail    string `json:"new_email"`
         NewPassword string `json:"new_password"`
@@ -68,7 +39,13 @@ func updateAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDataba
         })
     }
 
-    if err := accountDB.UpdateAccount(updateReq.Username, updateReq.NewUsername, updateReq.NewEmail, updateReq.NewPassword); err != nil {
+    err := accountDB.UpdateAccount(currentUsername(c), updateReq.NewUsername, updateReq.NewEmail, updateReq.NewPassword)
+    if errors.Is(err, accountdatabase.ErrUsernameChange) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": err.Error(),
+        })
+    }
+    if err != nil {
         log.Printf("Error updating account: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
             "error": "Error updating account",
@@ -80,41 +57,13 @@ func updateAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDataba
     })
 }
 
-// Handler function to update the wallet ID
+// Handler function to switch the account's wallet to one it has already verified
 func updateWalletHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
     type UpdateWalletRequest struct {
         WalletID string `json:"wallet_id"`
     }
 
-    authHeader := c.Get("Authorization")
-    if authHeader == "" {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Missing authorization header",
-        })
-    }
-
-    tokenStr := authHeader[len("Bearer "):]
-    token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fiber.ErrUnauthorized
-        }
-        return secretKey, nil
-    })
-
-    if err != nil || !token.Valid {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token",
-        })
-    }
-
-    claims, ok := token.Claims.(jwt.MapClaims)
-    if !ok {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token claims",
-        })
-    }
-
-    username := claims["username"].(string)
+    username := currentUsername(c)
 
     var walletReq UpdateWalletRequest
     if err := c.BodyParser(&walletReq); err != nil {
@@ -129,10 +78,9 @@ func updateWalletHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabas
         })
     }
 
-    if err := accountDB.UpdateWalletID(username, walletReq.WalletID); err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to update wallet ID",
-        })
+    // Only a wallet proven through /api/account/wallets/verify can be used
+    if err := accountDB.SetPrimaryWallet(username, walletReq.WalletID); err != nil {
+        return walletError(c, err)
     }
 
     return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -143,7 +91,6 @@ func updateWalletHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabas
 // Handler function to create a creator application
 func createCreatorApplicationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
     type CreatorApplicationRequest struct {
-        Username      string `json:"username"`
         CreatorName   string `json:"creator_name"`
         Website       string `json:"website"`
         SocialMedia1  string `json:"social_media_1"`
@@ -158,7 +105,18 @@ func createCreatorApplicationHandler(c *fiber.Ctx, accountDB *accountdatabase.Ac
         })
     }
 
-    if err := accountDB.AddCreatorApplication(appReq.Username, appReq.CreatorName, appReq.Website, appReq.SocialMedia1, appReq.SocialMedia2, appReq.Reason); err != nil {
+    err := accountDB.AddCreatorApplication(currentUsername(c), appReq.CreatorName, appReq.Website, appReq.SocialMedia1, appReq.SocialMedia2, appReq.Reason)
+    if errors.Is(err, accountdatabase.ErrApplicationOpen) {
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": "You already have a creator application under review",
+        })
+    }
+    if errors.Is(err, accountdatabase.ErrAlreadyCreator) {
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": "Your account is already a creator account",
+        })
+    }
+    if err != nil {
         log.Printf("Error adding creator application: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
             "error": "Error adding creator application",
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "log"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/utils"
+)
+
+// Handler function for the applicant to check their own creator application
+func getCreatorApplicationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    app, err := accountDB.GetLatestCreatorApplication(currentUsername(c))
+    if err != nil {
+        log.Printf("Error fetching creator application: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching creator application",
+        })
+    }
+
+    if app == nil {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "No creator application found",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(app)
+}
+
+// Handler function for listing the creator application review queue
+func listCreatorApplicationsHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    filter := accountdatabase.CreatorApplicationFilter{
+        Status:   c.Query("status"),
+        Username: c.Query("username"),
+        Limit:    c.QueryInt("limit", 50),
+        Offset:   c.QueryInt("offset", 0),
+    }
+
+    applications, err := accountDB.GetCreatorApplications(filter)
+    if err != nil {
+        log.Printf("Error fetching creator applications: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching creator applications",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(applications)
+}
+
+// Handler function for approving a creator application
+func approveCreatorApplicationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    return decideCreatorApplicationHandler(c, accountDB, accountdatabase.ApplicationApproved, false)
+}
+
+// Handler function for rejecting a creator application
+func rejectCreatorApplicationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    return decideCreatorApplicationHandler(c, accountDB, accountdatabase.ApplicationRejected, true)
+}
+
+// Handler function for asking an applicant for more information
+func requestCreatorInfoHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    return decideCreatorApplicationHandler(c, accountDB, accountdatabase.ApplicationInfoRequested, true)
+}
+
+func decideCreatorApplicationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, status string, notesRequired bool) error {
+    type DecisionRequest struct {
+        Notes string `json:"notes"`
+    }
+
+    applicationID, err := c.ParamsInt("id")
+    if err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid application id",
+        })
+    }
+
+    // Approvals may be sent without a body
+    var req DecisionRequest
+    if len(c.Body()) > 0 {
+        if err := c.BodyParser(&req); err != nil {
+            return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+                "error": "Invalid request format",
+            })
+        }
+    }
+
+    if notesRequired && req.Notes == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "A reason is required for this decision",
+        })
+    }
+
+    app, err := accountDB.DecideCreatorApplication(applicationID, status, currentUsername(c), req.Notes)
+    switch {
+    case errors.Is(err, accountdatabase.ErrApplicationNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Creator application not found",
+        })
+    case errors.Is(err, accountdatabase.ErrApplicationClosed):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": "Creator application has already been decided",
+        })
+    case err != nil:
+        log.Printf("Error deciding creator application: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error updating creator application",
+        })
+    }
+
+    // The decision is already committed, so a failed email is logged rather than reported
+    subject, body := creatorApplicationEmail(app)
+    if err := utils.SendEmail(app.Email, subject, body); err != nil {
+        log.Printf("Error sending creator application email to %s: %v", app.Username, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(app)
+}
+
+func creatorApplicationEmail(app *accountdatabase.CreatorApplication) (string, string) {
+    notes := ""
+    if app.ReviewNotes != nil {
+        notes = *app.ReviewNotes
+    }
+
+    switch app.Status {
+    case accountdatabase.ApplicationApproved:
+        return "Your creator application was approved", fmt.Sprintf(`Hello %s,
+
+Congratulations! Your application for %s has been approved and your account can now submit releases.`, app.Username, app.CreatorName)
+    case accountdatabase.ApplicationRejected:
+        return "Your creator application was declined", fmt.Sprintf(`Hello %s,
+
+We're sorry, your application for %s has been declined.
+
+Reason: %s`, app.Username, app.CreatorName, notes)
+    default:
+        return "More information needed for your creator application", fmt.Sprintf(`Hello %s,
+
+Our team needs more information before we can review your application for %s:
+
+%s
+
+Please resubmit your application with the requested details.`, app.Username, app.CreatorName, notes)
+    }
+}
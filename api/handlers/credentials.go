@@ -5,17 +5,20 @@ import (
     "shellhacks/api/database/accountdatabase"
     "shellhacks/api/utils"
     "golang.org/x/crypto/bcrypt"
-    "github.com/dgrijalva/jwt-go"
     "time"
     "fmt"
 	"log"
+    "errors"
 )
 
-// Secret key for JWT signing
-var secretKey = []byte("mysecretkey")
+const (
+    // Access tokens are short-lived; clients renew them with a refresh token
+    accessTokenTTL  = 15 * time.Minute
+    refreshTokenTTL = 30 * 24 * time.Hour
+)
 
 // Handler function for login
-func loginHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+func loginHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) error {
     type LoginRequest struct {
         Username string `json:"username"`
         Password string `json:"password"`
@@ -48,7 +51,102 @@ func loginHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) erro
         })
     }
 
-    token, err := generateVerificationToken(user.Username)
+    refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+    if err != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error generating token",
+        })
+    }
+
+    session, err := accountDB.CreateSession(user.Username, refreshHash, c.Get("User-Agent"), c.IP(), refreshTokenTTL)
+    if err != nil {
+        log.Printf("Error creating session: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error generating token",
+        })
+    }
+
+    return sessionTokensResponse(c, tokens, user, session, refreshToken, "Login successful")
+}
+
+// Handler function to exchange a refresh token for a new token pair
+func refreshTokenHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) error {
+    type RefreshRequest struct {
+        RefreshToken string `json:"refresh_token"`
+    }
+
+    var req RefreshRequest
+    if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    refreshToken, refreshHash, err := utils.GenerateRefreshToken()
+    if err != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error generating token",
+        })
+    }
+
+    session, err := accountDB.RotateSession(utils.HashRefreshToken(req.RefreshToken), refreshHash, refreshTokenTTL)
+    if err != nil {
+        if errors.Is(err, accountdatabase.ErrRefreshTokenReused) {
+            log.Printf("Refresh token reuse detected, session family revoked")
+        } else if !errors.Is(err, accountdatabase.ErrSessionNotFound) && !errors.Is(err, accountdatabase.ErrSessionExpired) && !errors.Is(err, accountdatabase.ErrSessionRevoked) {
+            log.Printf("Error rotating session: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error refreshing session",
+            })
+        }
+        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+            "error": "Invalid or expired refresh token",
+        })
+    }
+
+    user, err := accountDB.GetUserByUsername(session.Username)
+    if err != nil || user == nil {
+        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+            "error": "Invalid or expired refresh token",
+        })
+    }
+
+    return sessionTokensResponse(c, tokens, user, session, refreshToken, "Token refreshed")
+}
+
+// Handler function to log out the current device
+func logoutHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    sessionID, _ := c.Locals("session_id").(string)
+    if err := accountDB.RevokeSessionFamily(currentUsername(c), sessionID); err != nil {
+        log.Printf("Error revoking session: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error logging out",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "Logged out successfully",
+    })
+}
+
+// Handler function to log out every device on the account
+func logoutAllHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    if err := accountDB.RevokeAllSessions(currentUsername(c)); err != nil {
+        log.Printf("Error revoking sessions: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error logging out",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "Logged out of all devices",
+    })
+}
+
+// sessionTokensResponse issues an access token for session and returns it
+// alongside the refresh token that continues the session
+func sessionTokensResponse(c *fiber.Ctx, tokens *utils.TokenService, user *accountdatabase.User, session *accountdatabase.Session, refreshToken, message string) error {
+    token, _, err := tokens.IssueAccess(user.Username, user.AccountType, session.FamilyID, accessTokenTTL)
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
             "error": "Error generating token",
@@ -56,13 +154,15 @@ func loginHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) erro
     }
 
     return c.Status(fiber.StatusOK).JSON(fiber.Map{
-        "message": "Login successful",
-        "token":   token,
+        "message":       message,
+        "token":         token,
+        "expires_in":    int(accessTokenTTL.Seconds()),
+        "refresh_token": refreshToken,
     })
 }
 
 // Handler function to create an account
-func createAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+func createAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) error {
     type AccountRequest struct {
         Username string `json:"username"`
         Password string `json:"password"`
@@ -83,14 +183,13 @@ func createAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDataba
         })
     }
 
-    token, err := generateVerificationToken(accountReq.Username)
+    verificationLink, err := utils.GenerateVerificationLink(tokens, accountReq.Username)
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
             "error": "Error generating verification token",
         })
     }
 
-    verificationLink := "http://localhost:3000/api/verify_email?token=" + token
     emailSubject := "Verify your email address"
     emailBody := "Please verify your account by clicking the link: " + verificationLink
 
@@ -106,42 +205,27 @@ func createAccountHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDataba
 }
 
 // Handler function to verify the user's email
-func verifyEmailHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
-    tokenStr := c.Query("token")
-
-    token, parseErr := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fiber.ErrUnauthorized
-        }
-        return secretKey, nil
-    })
-
-    if parseErr != nil {
+func verifyEmailHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) error {
+    claims, err := tokens.Parse(c.Query("token"), utils.PurposeEmailVerification)
+    if err != nil {
         return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
             "error": "Invalid or expired token",
         })
     }
 
-    if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-        username := claims["username"].(string)
-        if verifyErr := accountDB.VerifyUserEmail(username); verifyErr != nil {
-            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-                "error": "Error verifying email",
-            })
-        }
-
-        return c.Status(fiber.StatusOK).JSON(fiber.Map{
-            "message": "Email verified successfully!",
+    if verifyErr := accountDB.VerifyUserEmail(claims.Username()); verifyErr != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error verifying email",
         })
     }
 
-    return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-        "error": "Invalid or expired token",
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "Email verified successfully!",
     })
 }
 
 // Handler function for forgot password
-func forgotPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+func forgotPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) error {
     type ForgotPasswordRequest struct {
         Email string `json:"email"`
     }
@@ -162,7 +246,7 @@ func forgotPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatab
 
 	log.Printf("Fetched user: %+v", user) 
 
-    token, err := generatePasswordResetToken(user.Username, accountDB)
+    token, err := generatePasswordResetToken(user.Username, accountDB, tokens)
 	log.Print("here", user.Username)
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -190,7 +274,7 @@ We received a request to reset your password. Click the link below to reset:
 }
 
 // Handler function for resetting password
-func resetPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+func resetPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) error {
     type ResetPasswordRequest struct {
         Token       string `json:"token"`
         NewPassword string `json:"new_password"`
@@ -203,32 +287,14 @@ func resetPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDataba
         })
     }
 
-    token, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fiber.ErrUnauthorized
-        }
-        return secretKey, nil
-    })
-
-    if err != nil || !token.Valid {
+    claims, err := tokens.Parse(req.Token, utils.PurposePasswordReset)
+    if err != nil {
         return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
             "error": "Invalid or expired token",
         })
     }
 
-    claims, ok := token.Claims.(jwt.MapClaims)
-    if !ok || claims["type"] != "password_reset" {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token claims",
-        })
-    }
-
-    username, ok := claims["username"].(string)
-    if !ok {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token claims",
-        })
-    }
+    username := claims.Username()
 
     valid, err := accountDB.IsPasswordResetTokenValid(req.Token, username)
     if err != nil || !valid {
@@ -249,34 +315,21 @@ func resetPasswordHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDataba
         })
     }
 
+    // A reset usually means the old password was compromised, so end every session
+    if err := accountDB.RevokeAllSessions(username); err != nil {
+        log.Printf("Error revoking sessions after password reset: %v", err)
+    }
+
     return c.Status(fiber.StatusOK).JSON(fiber.Map{
         "message": "Password has been reset successfully!",
     })
 }
 
-// Generate verification token for JWT
-func generateVerificationToken(username string) (string, error) {
-    claims := jwt.MapClaims{
-        "username": username,
-        "exp":      time.Now().Add(time.Hour * 24).Unix(),
-    }
-
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString(secretKey)
-}
-
 // Generate password reset token
-func generatePasswordResetToken(username string, accountDB *accountdatabase.AccountDatabase) (string, error) {
-    claims := jwt.MapClaims{
-        "username": username,
-        "type":     "password_reset",
-        "exp":      time.Now().Add(time.Hour * 1).Unix(),
-    }
-
+func generatePasswordResetToken(username string, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) (string, error) {
 	log.Print("updating password for:", username)
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    tokenString, err := token.SignedString(secretKey)
+    tokenString, _, err := tokens.Issue(username, "", utils.PurposePasswordReset, time.Hour*1)
     if err != nil {
         return "", fmt.Errorf("failed to sign token: %w", err)
     }
@@ -0,0 +1,346 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/middlewares"
+)
+
+// Handler function for a creator to define an activity that earns points.
+// Creators can only reward tokens of a contract holding one of their approved
+// releases, and one credit can be worth at most one level; admins may create
+// activities for any token with any value.
+func createActivityHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    type ActivityRequest struct {
+        Name            string `json:"name"`
+        ActivityType    string `json:"activity_type"`
+        Points          int    `json:"points"`
+        ContractAddress string `json:"contract_address"`
+        MaxPerUser      *int   `json:"max_per_user"`
+    }
+
+    var activityReq ActivityRequest
+    if err := c.BodyParser(&activityReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    activityReq.Name = strings.TrimSpace(activityReq.Name)
+    if activityReq.Name == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name is required"})
+    }
+    if !nftdatabase.IsValidActivityType(activityReq.ActivityType) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "activity_type must be one of event_attendance, content_interaction, purchase",
+        })
+    }
+    if activityReq.Points <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "points must be greater than zero"})
+    }
+    if activityReq.ContractAddress != "" && !contractAddressPattern.MatchString(activityReq.ContractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid contract address"})
+    }
+    if activityReq.MaxPerUser != nil && *activityReq.MaxPerUser <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_per_user must be greater than zero"})
+    }
+
+    if c.Locals("account_type") != accountdatabase.RoleAdmin {
+        if activityReq.ContractAddress == "" {
+            return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "contract_address is required"})
+        }
+
+        releaseIDs, err := accountDB.GetApprovedReleaseIDs(currentUsername(c))
+        if err != nil {
+            log.Printf("Error fetching approved releases: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error creating activity",
+            })
+        }
+        ownsContract, err := nftDB.ContractHasRelease(activityReq.ContractAddress, releaseIDs)
+        if err != nil {
+            log.Printf("Error checking contract releases: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error creating activity",
+            })
+        }
+        if !ownsContract {
+            return middlewares.Forbidden(c, "contract_address must hold one of your approved releases")
+        }
+
+        thresholds, err := nftDB.GetLevelThresholds(activityReq.ContractAddress)
+        if err != nil {
+            log.Printf("Error fetching level thresholds: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error creating activity",
+            })
+        }
+        if limit := maxActivityPoints(thresholds); limit > 0 && activityReq.Points > limit {
+            return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+                "error": fmt.Sprintf("points cannot exceed %d for this contract", limit),
+            })
+        }
+    }
+
+    activity, err := nftDB.CreateActivity(nftdatabase.NewEngagementActivity{
+        CreatorUsername: currentUsername(c),
+        Name:            activityReq.Name,
+        ActivityType:    activityReq.ActivityType,
+        Points:          activityReq.Points,
+        ContractAddress: activityReq.ContractAddress,
+        MaxPerUser:      activityReq.MaxPerUser,
+    })
+    if err != nil {
+        log.Printf("Error creating activity: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating activity",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(activity)
+}
+
+// Handler function to list the caller's activities; admins see every creator's
+func listActivitiesHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    creator := currentUsername(c)
+    if c.Locals("account_type") == accountdatabase.RoleAdmin {
+        creator = c.Query("creator")
+    }
+
+    activities, err := nftDB.GetActivities(creator)
+    if err != nil {
+        log.Printf("Error fetching activities: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching activities",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"activities": activities})
+}
+
+// Handler function to switch an activity on or off
+func setActivityActiveHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    var body struct {
+        Active *bool `json:"active"`
+    }
+    if err := c.BodyParser(&body); err != nil || body.Active == nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "active is required"})
+    }
+
+    activity, err := ownedActivity(c, nftDB)
+    if activity == nil {
+        return err
+    }
+
+    activity, err = nftDB.SetActivityActive(activity.ActivityID, *body.Active)
+    if err != nil {
+        return engagementError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(activity)
+}
+
+// Handler function for a creator to credit a user's token for an activity,
+// e.g. after they interacted with content or made a purchase. source_ref
+// identifies the action so it cannot be credited twice. Creators can only
+// credit tokens minted for their own releases.
+func creditActivityHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    type CreditRequest struct {
+        Username  string `json:"username"`
+        NFTID     int    `json:"nft_id"`
+        SourceRef string `json:"source_ref"`
+    }
+
+    var creditReq CreditRequest
+    if err := c.BodyParser(&creditReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if creditReq.Username == "" || creditReq.NFTID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "username and nft_id are required"})
+    }
+
+    activity, err := ownedActivity(c, nftDB)
+    if activity == nil {
+        return err
+    }
+
+    if c.Locals("account_type") != accountdatabase.RoleAdmin {
+        nft, err := nftDB.GetNFT(creditReq.NFTID)
+        if err != nil {
+            return engagementError(c, err)
+        }
+        releaseIDs, err := accountDB.GetApprovedReleaseIDs(currentUsername(c))
+        if err != nil {
+            log.Printf("Error fetching approved releases: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error processing engagement",
+            })
+        }
+        if nft.ReleaseID == nil || !containsInt(releaseIDs, *nft.ReleaseID) {
+            return middlewares.Forbidden(c, "Creators can only credit tokens from their own releases")
+        }
+    }
+
+    action, progress, err := nftDB.RecordEngagement(nftdatabase.EngagementCredit{
+        ActivityID: activity.ActivityID,
+        Username:   creditReq.Username,
+        NFTID:      creditReq.NFTID,
+        SourceRef:  strings.TrimSpace(creditReq.SourceRef),
+        RecordedBy: currentUsername(c),
+    })
+    if err != nil {
+        return engagementError(c, err)
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "action":   action,
+        "progress": progress,
+    })
+}
+
+// Handler function to show a token's engagement points, next level and
+// queued level-ups
+func nftEngagementHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    nft, err := nftFromParams(c, nftDB)
+    if nft == nil {
+        return err
+    }
+
+    progress, err := nftDB.GetEngagementProgress(nft.NFTID)
+    if err != nil {
+        return engagementError(c, err)
+    }
+
+    levelUps, err := nftDB.GetLevelUps(nft.NFTID)
+    if err != nil {
+        log.Printf("Error fetching level-ups: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching engagement",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "progress":  progress,
+        "level_ups": levelUps,
+    })
+}
+
+// Handler function to fetch the level thresholds that apply to a contract
+func getLevelThresholdsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    contractAddress := c.Query("contract")
+    if contractAddress != "" && !contractAddressPattern.MatchString(contractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid contract address"})
+    }
+
+    thresholds, err := nftDB.GetLevelThresholds(contractAddress)
+    if err != nil {
+        log.Printf("Error fetching level thresholds: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching level thresholds",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"thresholds": thresholds})
+}
+
+// Handler function for admins to replace a contract's level thresholds, or
+// the defaults when no contract is given
+func setLevelThresholdsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    type ThresholdsRequest struct {
+        ContractAddress string                       `json:"contract_address"`
+        Thresholds      []nftdatabase.LevelThreshold `json:"thresholds"`
+    }
+
+    var thresholdsReq ThresholdsRequest
+    if err := c.BodyParser(&thresholdsReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if thresholdsReq.ContractAddress != "" && !contractAddressPattern.MatchString(thresholdsReq.ContractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid contract address"})
+    }
+    if thresholdsReq.ContractAddress == "" && len(thresholdsReq.Thresholds) == 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "The default thresholds cannot be empty"})
+    }
+
+    if err := nftDB.SetLevelThresholds(thresholdsReq.ContractAddress, thresholdsReq.Thresholds); err != nil {
+        return engagementError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "contract_address": strings.ToLower(thresholdsReq.ContractAddress),
+        "thresholds":       thresholdsReq.Thresholds,
+    })
+}
+
+// ownedActivity loads the activity named by the :id route parameter, which
+// the caller must have created unless they are an admin. When it returns nil
+// the error response has already been written.
+func ownedActivity(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) (*nftdatabase.EngagementActivity, error) {
+    activityID, err := c.ParamsInt("id")
+    if err != nil || activityID <= 0 {
+        return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid activity ID",
+        })
+    }
+
+    activity, err := nftDB.GetActivity(activityID)
+    if err != nil {
+        return nil, engagementError(c, err)
+    }
+    if activity.CreatorUsername != currentUsername(c) && c.Locals("account_type") != accountdatabase.RoleAdmin {
+        return nil, middlewares.Forbidden(c, "Only the activity's creator can manage it")
+    }
+
+    return activity, nil
+}
+
+// maxActivityPoints is the smallest gap between consecutive level thresholds,
+// so a single credit never skips a level. It is 0 when there are no thresholds.
+func maxActivityPoints(thresholds []nftdatabase.LevelThreshold) int {
+    limit, previous := 0, 0
+    for _, threshold := range thresholds {
+        if gap := threshold.PointsRequired - previous; limit == 0 || gap < limit {
+            limit = gap
+        }
+        previous = threshold.PointsRequired
+    }
+    return limit
+}
+
+func containsInt(values []int, value int) bool {
+    for _, v := range values {
+        if v == value {
+            return true
+        }
+    }
+    return false
+}
+
+// engagementError maps engagement errors to responses
+func engagementError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, nftdatabase.ErrActivityNotFound), errors.Is(err, nftdatabase.ErrNFTNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrNotTokenOwner), errors.Is(err, nftdatabase.ErrTokenNotEligible),
+        errors.Is(err, nftdatabase.ErrInvalidLevelThreshold):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrActivityInactive), errors.Is(err, nftdatabase.ErrActivityLimitReached),
+        errors.Is(err, nftdatabase.ErrDuplicateEngagement):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    default:
+        log.Printf("Error processing engagement: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error processing engagement",
+        })
+    }
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/middlewares"
+    "shellhacks/api/utils"
+)
+
+const (
+    defaultCheckInCodeTTL = 5 * time.Minute
+    maxCheckInCodeTTL     = 24 * time.Hour
+)
+
+// Handler function for a creator to create an event attendees can check in to
+func createEventHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    type EventRequest struct {
+        Name            string    `json:"name"`
+        Description     string    `json:"description"`
+        Location        string    `json:"location"`
+        StartsAt        time.Time `json:"starts_at"`
+        EndsAt          time.Time `json:"ends_at"`
+        Points          int       `json:"points"`
+        ContractAddress string    `json:"contract_address"`
+    }
+
+    var eventReq EventRequest
+    if err := c.BodyParser(&eventReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    eventReq.Name = strings.TrimSpace(eventReq.Name)
+    if eventReq.Name == "" || eventReq.StartsAt.IsZero() || eventReq.EndsAt.IsZero() {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "name, starts_at and ends_at are required"})
+    }
+    if !eventReq.EndsAt.After(eventReq.StartsAt) || !eventReq.EndsAt.After(time.Now()) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ends_at must be after starts_at and in the future"})
+    }
+    if eventReq.Points <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "points must be greater than zero"})
+    }
+    if eventReq.ContractAddress != "" && !contractAddressPattern.MatchString(eventReq.ContractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid contract address"})
+    }
+
+    event, err := nftDB.CreateEvent(nftdatabase.NewEvent{
+        CreatorUsername: currentUsername(c),
+        Name:            eventReq.Name,
+        Description:     eventReq.Description,
+        Location:        eventReq.Location,
+        StartsAt:        eventReq.StartsAt,
+        EndsAt:          eventReq.EndsAt,
+        Points:          eventReq.Points,
+        ContractAddress: eventReq.ContractAddress,
+    })
+    if err != nil {
+        log.Printf("Error creating event: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating event",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(event)
+}
+
+// Handler function to list events that have not ended yet
+func listEventsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    events, err := nftDB.GetEvents(c.Query("creator"))
+    if err != nil {
+        log.Printf("Error fetching events: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching events",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"events": events})
+}
+
+// Handler function to fetch a single event
+func getEventHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    eventID, err := c.ParamsInt("id")
+    if err != nil || eventID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid event ID",
+        })
+    }
+
+    event, err := nftDB.GetEvent(eventID)
+    if err != nil {
+        return eventError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(event)
+}
+
+// Handler function for the event's creator to generate a signed check-in
+// code. The returned qr_payload is what the QR code encodes. Shared codes are
+// shown at the door and rotated by requesting new ones; single-use codes,
+// optionally bound to a wallet, are handed to individual attendees.
+func createCheckInCodeHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    type CodeRequest struct {
+        TTLSeconds int    `json:"ttl_seconds"`
+        SingleUse  bool   `json:"single_use"`
+        Wallet     string `json:"wallet"`
+    }
+
+    var codeReq CodeRequest
+    if len(c.Body()) > 0 {
+        if err := c.BodyParser(&codeReq); err != nil {
+            return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+                "error": "Invalid request format",
+            })
+        }
+    }
+
+    ttl := defaultCheckInCodeTTL
+    if codeReq.TTLSeconds != 0 {
+        ttl = time.Duration(codeReq.TTLSeconds) * time.Second
+    }
+    if ttl <= 0 || ttl > maxCheckInCodeTTL {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ttl_seconds must be between 1 and 86400"})
+    }
+    if codeReq.Wallet != "" && !common.IsHexAddress(codeReq.Wallet) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid wallet address"})
+    }
+
+    event, err := ownedEvent(c, nftDB)
+    if event == nil {
+        return err
+    }
+
+    ended, err := nftDB.EventHasEnded(event.EventID)
+    if err != nil {
+        return eventError(c, err)
+    }
+    if ended {
+        return eventError(c, nftdatabase.ErrEventEnded)
+    }
+
+    // Codes never outlive the event
+    expiresAt := time.Now().Add(ttl)
+    if event.EndsAt.Before(expiresAt) {
+        expiresAt = event.EndsAt
+    }
+
+    code, claims, err := utils.SignCheckInCode(event.CheckInSecret, utils.CheckInClaims{
+        EventID:   event.EventID,
+        ExpiresAt: expiresAt.Unix(),
+        SingleUse: codeReq.SingleUse,
+        Wallet:    codeReq.Wallet,
+    })
+    if err != nil {
+        log.Printf("Error signing check-in code: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating check-in code",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "event_id":   event.EventID,
+        "qr_payload": code,
+        "expires_at": claims.Expiry(),
+        "single_use": claims.SingleUse,
+        "wallet":     claims.Wallet,
+    })
+}
+
+// Handler function for an attendee to check in with a scanned code and one of
+// their tokens. The check-in is bound to the caller's linked wallet and
+// credits the event's attendance activity to the token.
+func checkInHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    type CheckInRequest struct {
+        Code  string `json:"code"`
+        NFTID int    `json:"nft_id"`
+    }
+
+    eventID, err := c.ParamsInt("id")
+    if err != nil || eventID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid event ID",
+        })
+    }
+
+    var checkInReq CheckInRequest
+    if err := c.BodyParser(&checkInReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if checkInReq.Code == "" || checkInReq.NFTID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code and nft_id are required"})
+    }
+
+    username := currentUsername(c)
+    wallet, err := accountDB.GetPrimaryWallet(username)
+    if errors.Is(err, accountdatabase.ErrNoVerifiedWallet) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Link a wallet to your account before checking in"})
+    }
+    if err != nil {
+        log.Printf("Error fetching attendee %s wallet: %v", username, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error checking in",
+        })
+    }
+
+    event, err := nftDB.GetEvent(eventID)
+    if err != nil {
+        return eventError(c, err)
+    }
+
+    claims, err := utils.ParseCheckInCode(event.CheckInSecret, event.EventID, checkInReq.Code)
+    if err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    }
+    if claims.Wallet != "" && !strings.EqualFold(claims.Wallet, wallet) {
+        return middlewares.Forbidden(c, "This check-in code was issued to a different wallet")
+    }
+
+    record, progress, err := nftDB.CheckIn(nftdatabase.EventCheckIn{
+        EventID:       event.EventID,
+        Username:      username,
+        WalletAddress: wallet,
+        NFTID:         checkInReq.NFTID,
+        CodeNonce:     claims.Nonce,
+        SingleUse:     claims.SingleUse,
+    })
+    if err != nil {
+        return eventError(c, err)
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "checkin":  record,
+        "progress": progress,
+    })
+}
+
+// Handler function for the event's creator to list its check-ins
+func listCheckInsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    event, err := ownedEvent(c, nftDB)
+    if event == nil {
+        return err
+    }
+
+    checkIns, err := nftDB.GetCheckIns(event.EventID)
+    if err != nil {
+        log.Printf("Error fetching check-ins: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching check-ins",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"checkins": checkIns})
+}
+
+// ownedEvent loads the event named by the :id route parameter, which the
+// caller must have created unless they are an admin. When it returns nil the
+// error response has already been written.
+func ownedEvent(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) (*nftdatabase.Event, error) {
+    eventID, err := c.ParamsInt("id")
+    if err != nil || eventID <= 0 {
+        return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid event ID",
+        })
+    }
+
+    event, err := nftDB.GetEvent(eventID)
+    if err != nil {
+        return nil, eventError(c, err)
+    }
+    if event.CreatorUsername != currentUsername(c) && c.Locals("account_type") != accountdatabase.RoleAdmin {
+        return nil, middlewares.Forbidden(c, "Only the event's creator can manage it")
+    }
+
+    return event, nil
+}
+
+// eventError maps event and check-in errors to responses
+func eventError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, nftdatabase.ErrEventNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrWalletMismatch):
+        return middlewares.Forbidden(c, err.Error())
+    case errors.Is(err, nftdatabase.ErrEventNotOpen), errors.Is(err, nftdatabase.ErrEventEnded),
+        errors.Is(err, nftdatabase.ErrAlreadyCheckedIn), errors.Is(err, nftdatabase.ErrNFTAlreadyCheckedIn),
+        errors.Is(err, nftdatabase.ErrCheckInCodeUsed):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    default:
+        return engagementError(c, err)
+    }
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/url"
+    "strings"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/storage"
+    "shellhacks/api/uploads"
+)
+
+// Handler function serving a file through a signed URL the API issued itself
+func signedFileHandler(c *fiber.Ctx, served storage.ServedStorage) error {
+    container := c.Params("container")
+    name, err := url.PathUnescape(c.Params("*"))
+    if err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid file name",
+        })
+    }
+
+    if err := served.VerifySignedURL(container, name, c.Query("expires"), c.Query("signature")); err != nil {
+        return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+            "error": "Link is invalid or has expired",
+        })
+    }
+
+    body, info, err := served.Get(c.Context(), container, name)
+    if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "File not found",
+        })
+    }
+    if err != nil {
+        log.Printf("Error reading stored file: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error reading file",
+        })
+    }
+
+    c.Set(fiber.HeaderContentType, info.ContentType)
+    return c.SendStream(body, int(info.Size))
+}
+
+// uploadError responds to a file rejected by the upload pipeline. what names
+// the file in the message, e.g. "Document".
+func uploadError(c *fiber.Ctx, err error, what string) error {
+    switch {
+    case errors.Is(err, uploads.ErrTooLarge):
+        return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+            "error": fmt.Sprintf("%s %v", what, err),
+        })
+    case errors.Is(err, uploads.ErrUnsupportedType):
+        return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+            "error": fmt.Sprintf("%s %v", what, err),
+        })
+    case errors.Is(err, uploads.ErrInvalidImage):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": fmt.Sprintf("%s %v", what, err),
+        })
+    }
+
+    log.Printf("Error uploading %s: %v", strings.ToLower(what), err)
+    return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+        "error": fmt.Sprintf("Failed to upload %s", strings.ToLower(what)),
+    })
+}
@@ -1,12 +1,23 @@
 package handlers
 
 import (
+    "errors"
     "github.com/gofiber/fiber/v2"
     "log"
-	"fmt"
+    "net/url"
+    "strings"
+    "time"
     "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/storage"
+    "shellhacks/api/uploads"
     "shellhacks/api/utils"
-    "github.com/dgrijalva/jwt-go"
+)
+
+// KYC files live in a private container and are only reachable through
+// short-lived signed links issued to reviewers
+const (
+    kycContainer      = storage.KYCContainer
+    kycDocumentURLTTL = 5 * time.Minute
 )
 
 // Handler function to retrieve all KYC requests for review
@@ -21,6 +32,27 @@ func reviewKYCRequestsHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDa
     return c.Status(fiber.StatusOK).JSON(kycRequests)
 }
 
+// Handler function for claiming a KYC request for review
+func startKYCReviewHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    type StartReviewRequest struct {
+        KycID int `json:"kyc_id"`
+    }
+
+    var startReq StartReviewRequest
+    if err := c.BodyParser(&startReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    request, err := accountDB.StartKYCReview(startReq.KycID, currentUsername(c))
+    if err != nil {
+        return kycDecisionError(c, err, "Error starting KYC review")
+    }
+
+    return c.Status(fiber.StatusOK).JSON(request)
+}
+
 // Handler function for approving KYC requests
 func approveKYCRequestHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
     type ApproveRequest struct {
@@ -34,11 +66,8 @@ func approveKYCRequestHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDa
         })
     }
 
-    if err := accountDB.ApproveKYCRequest(approveReq.KycID); err != nil {
-        log.Printf("Error approving KYC request: %v", err)
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error approving KYC request",
-        })
+    if _, err := accountDB.ApproveKYCRequest(approveReq.KycID, currentUsername(c)); err != nil {
+        return kycDecisionError(c, err, "Error approving KYC request")
     }
 
     return c.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -49,8 +78,8 @@ func approveKYCRequestHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDa
 // Handler function for declining KYC requests
 func declineKYCRequestHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
     type DeclineRequest struct {
-        KycID int    `json:"kyc_id"`
-        Email string `json:"email"`
+        KycID  int    `json:"kyc_id"`
+        Reason string `json:"reason"`
     }
 
     var declineReq DeclineRequest
@@ -60,16 +89,17 @@ func declineKYCRequestHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDa
         })
     }
 
-    if err := accountDB.DeclineKYCRequest(declineReq.KycID); err != nil {
-        log.Printf("Error declining KYC request: %v", err)
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error declining KYC request",
-        })
+    request, err := accountDB.DeclineKYCRequest(declineReq.KycID, currentUsername(c), declineReq.Reason)
+    if err != nil {
+        return kycDecisionError(c, err, "Error declining KYC request")
     }
 
     emailSubject := "KYC Verification Declined"
     emailBody := "We regret to inform you that your KYC verification has been declined. Please try submitting your documents again."
-    if err := utils.SendEmail(declineReq.Email, emailSubject, emailBody); err != nil {
+    if declineReq.Reason != "" {
+        emailBody += "\n\nReason: " + declineReq.Reason
+    }
+    if err := utils.SendEmail(request.Email, emailSubject, emailBody); err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
             "error": "Failed to send email notification",
         })
@@ -80,37 +110,84 @@ func declineKYCRequestHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDa
     })
 }
 
-// Handler function for KYC verification
-func kycVerificationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, uploader *utils.Uploader) error {
-    authHeader := c.Get("Authorization")
-    if authHeader == "" {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Missing authorization header",
+// Handler function for asking a user to resubmit their KYC documents
+func requestKYCResubmissionHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    type ResubmissionRequest struct {
+        KycID  int    `json:"kyc_id"`
+        Reason string `json:"reason"`
+    }
+
+    var resubmitReq ResubmissionRequest
+    if err := c.BodyParser(&resubmitReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    if resubmitReq.Reason == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "A reason is required when requesting resubmission",
+        })
+    }
+
+    request, err := accountDB.RequestKYCResubmission(resubmitReq.KycID, currentUsername(c), resubmitReq.Reason)
+    if err != nil {
+        return kycDecisionError(c, err, "Error requesting KYC resubmission")
+    }
+
+    emailSubject := "KYC Verification: Resubmission Needed"
+    emailBody := "Our reviewers need you to resubmit your KYC verification.\n\nReason: " + resubmitReq.Reason
+    if err := utils.SendEmail(request.Email, emailSubject, emailBody); err != nil {
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Failed to send email notification",
         })
     }
 
-    tokenStr := authHeader[len("Bearer "):]
-    token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fiber.ErrUnauthorized
-        }
-        return secretKey, nil
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "KYC resubmission requested successfully!",
     })
+}
 
-    if err != nil || !token.Valid {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token",
+// Handler function for a compliance view of a user's full KYC history
+func kycHistoryHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    history, err := accountDB.GetKYCHistory(c.Params("username"))
+    if err != nil {
+        log.Printf("Error fetching KYC history: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching KYC history",
         })
     }
 
-    claims, ok := token.Claims.(jwt.MapClaims)
-    if !ok {
-        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-            "error": "Invalid token claims",
+    return c.Status(fiber.StatusOK).JSON(history)
+}
+
+// kycDecisionError maps KYC state errors to responses
+func kycDecisionError(c *fiber.Ctx, err error, message string) error {
+    switch {
+    case errors.Is(err, accountdatabase.ErrKYCNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "KYC request not found",
+        })
+    case errors.Is(err, accountdatabase.ErrKYCInvalidTransition):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": "KYC request has already been decided",
+        })
+    case errors.Is(err, accountdatabase.ErrKYCAccountMissing):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": err.Error(),
         })
     }
 
-    username := claims["username"].(string)
+    log.Printf("%s: %v", message, err)
+    return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+        "error": message,
+    })
+}
+
+// Handler function for KYC verification. The request records the files'
+// object names, never a URL to them.
+func kycVerificationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, kyc storage.Storage) error {
+    username := currentUsername(c)
 
     fullLegalName := c.FormValue("full_legal_name")
     address := c.FormValue("address")
@@ -133,45 +210,94 @@ func kycVerificationHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountData
         })
     }
 
-    documentStream, err := documentFile.Open()
+    document, err := uploads.Save(c.Context(), kyc, kycContainer, username, documentFile, uploads.KYCDocument)
     if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to read document file",
-        })
+        return uploadError(c, err, "Document")
     }
-    defer documentStream.Close()
 
-    faceImageStream, err := faceImageFile.Open()
+    faceImage, err := uploads.Save(c.Context(), kyc, kycContainer, username, faceImageFile, uploads.KYCFaceImage)
     if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to read face image file",
-        })
+        return uploadError(c, err, "Face image")
     }
-    defer faceImageStream.Close()
 
-    containerName := "kyc-verification-requests"
-    documentBlobURL, err := uploader.Upload(c.Context(), containerName, username, documentStream, documentFile.Filename)
+    err = accountDB.AddKYCRequest(username, fullLegalName, address, country, email, phoneNumber, dateOfBirth, []byte(document.Original.Name), []byte(faceImage.Original.Name))
+    if errors.Is(err, accountdatabase.ErrKYCAlreadyOpen) {
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": "You already have a KYC request under review",
+        })
+    }
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": fmt.Sprintf("Failed to upload document: %v", err),
+            "error": "Error adding KYC request",
         })
     }
 
-    faceImageBlobURL, err := uploader.Upload(c.Context(), containerName, username, faceImageStream, faceImageFile.Filename)
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "message": "KYC verification request submitted successfully!",
+    })
+}
+
+// Handler function issuing a reviewer a short-lived link to a KYC file. The
+// access is logged before the link is signed, so no link exists without a
+// record of who asked for it.
+func kycDocumentURLHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, kyc storage.Storage) error {
+    type DocumentURLRequest struct {
+        KycID    int    `json:"kyc_id"`
+        Document string `json:"document"`
+    }
+
+    var docReq DocumentURLRequest
+    if err := c.BodyParser(&docReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if docReq.Document != accountdatabase.KYCDocumentFile && docReq.Document != accountdatabase.KYCFaceImageFile {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "document must be document or face_image",
+        })
+    }
+
+    expiresAt := time.Now().Add(kycDocumentURLTTL)
+    reference, err := accountDB.OpenKYCDocument(docReq.KycID, docReq.Document, currentUsername(c), c.IP(), c.Get(fiber.HeaderUserAgent), expiresAt)
     if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to upload face image",
+        return kycDecisionError(c, err, "Error opening KYC document")
+    }
+
+    name := kycObjectName(reference)
+    if name == "" {
+        log.Printf("KYC request %d has an unrecognised %s reference", docReq.KycID, docReq.Document)
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "KYC document not found",
         })
     }
 
-    err = accountDB.AddKYCRequest(username, fullLegalName, address, country, email, phoneNumber, dateOfBirth, []byte(documentBlobURL), []byte(faceImageBlobURL))
+    signedURL, err := kyc.SignedURL(c.Context(), kycContainer, name, kycDocumentURLTTL)
     if err != nil {
+        log.Printf("Error signing KYC document URL: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error adding KYC request",
+            "error": "Error opening KYC document",
         })
     }
 
-    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-        "message": "KYC verification request submitted successfully!",
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "url":        signedURL,
+        "expires_at": expiresAt,
     })
 }
+
+// kycObjectName returns the object name a KYC file reference points at.
+// Requests submitted before files were stored privately hold a full blob URL
+// instead of a name; the name is recovered from its path.
+func kycObjectName(reference string) string {
+    u, err := url.Parse(reference)
+    if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+        return reference
+    }
+
+    prefix := "/" + kycContainer + "/"
+    if i := strings.Index(u.Path, prefix); i >= 0 {
+        return u.Path[i+len(prefix):]
+    }
+    return ""
+}
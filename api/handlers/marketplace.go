@@ -1,60 +1,149 @@
 package handlers
 
 import (
-    "github.com/gofiber/fiber/v2"
+    "errors"
     "log"
-    "shellhacks/api/database/nftdatabase"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/chain"
     "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/middlewares"
 )
 
-// Handler function to fetch listings
-func getListingsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
-    listings, err := nftDB.GetAllListings()
+// Handler function to fetch a page of listings. Filters and sort come from
+// the query string; next_cursor in the response fetches the following page.
+func getListingsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, publicURL string) error {
+    filter := nftdatabase.ListingFilter{
+        Seller:  c.Query("seller"),
+        Release: c.Query("release"),
+        Sort:    c.Query("sort", nftdatabase.SortNewest),
+        Cursor:  c.Query("cursor"),
+        Limit:   c.QueryInt("limit", 24),
+    }
+
+    if !nftdatabase.IsValidListingSort(filter.Sort) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "sort must be one of newest, price_asc, price_desc, level_asc, level_desc",
+        })
+    }
+
+    var err error
+    if filter.MinPrice, err = optionalFloatQuery(c, "min_price"); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "min_price must be a number"})
+    }
+    if filter.MaxPrice, err = optionalFloatQuery(c, "max_price"); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_price must be a number"})
+    }
+    if filter.MinLevel, err = optionalIntQuery(c, "min_level"); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "min_level must be an integer"})
+    }
+    if filter.MaxLevel, err = optionalIntQuery(c, "max_level"); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_level must be an integer"})
+    }
+    if since := c.Query("listed_since"); since != "" {
+        listedSince, err := time.Parse(time.RFC3339, since)
+        if err != nil {
+            return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "listed_since must be an RFC 3339 timestamp"})
+        }
+        listedSince = listedSince.UTC()
+        filter.ListedSince = &listedSince
+    }
+
+    page, err := nftDB.QueryListings(filter)
+    if errors.Is(err, nftdatabase.ErrInvalidCursor) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    }
     if err != nil {
         log.Printf("Error fetching marketplace listings: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error":   "Error fetching marketplace listings",
-            "details": err.Error(),
+            "error": "Error fetching marketplace listings",
+        })
+    }
+    if err := attachListingMedia(accountDB, publicURL, page.Listings); err != nil {
+        log.Printf("Error fetching listing media: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching marketplace listings",
         })
     }
-    return c.Status(fiber.StatusOK).JSON(listings)
+    return c.Status(fiber.StatusOK).JSON(page)
 }
 
-// Handler function to add a transaction
-func addTransactionHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
-    type ServiceRequest struct {
-        ClientID        string `json:"client_id"`
-        TransactionType string `json:"transaction_type"`
-        ItemsSent       string `json:"items_sent"`
-        ItemsReceived   string `json:"items_received"`
-        Notes           string `json:"notes"`
+// attachListingMedia links the thumbnail and web images of each listed
+// token's release, served through the release media route
+func attachListingMedia(accountDB *accountdatabase.AccountDatabase, publicURL string, listings []nftdatabase.Listing) error {
+    var releaseIDs []int
+    for _, listing := range listings {
+        if listing.ReleaseID != nil {
+            releaseIDs = append(releaseIDs, *listing.ReleaseID)
+        }
+    }
+    if len(releaseIDs) == 0 {
+        return nil
     }
 
-    var serviceReq ServiceRequest
-    if err := c.BodyParser(&serviceReq); err != nil {
-        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-            "error": "Invalid request format",
-        })
+    variants, err := accountDB.GetReleaseVariants(releaseIDs)
+    if err != nil {
+        return err
+    }
+    for i := range listings {
+        if listings[i].ReleaseID == nil {
+            continue
+        }
+        releaseID := *listings[i].ReleaseID
+        release, ok := variants[releaseID]
+        if !ok {
+            continue
+        }
+        if release.Thumbnail != "" {
+            listings[i].MediaThumbnail = releaseMediaURL(publicURL, releaseID, mediaVariantThumbnail)
+        }
+        if release.Web != "" {
+            listings[i].MediaWeb = releaseMediaURL(publicURL, releaseID, mediaVariantWeb)
+        }
     }
+    return nil
+}
 
-    if addErr := accountDB.AddTransaction(serviceReq.ClientID, serviceReq.TransactionType, serviceReq.ItemsSent, serviceReq.ItemsReceived, serviceReq.Notes); addErr != nil {
-        log.Printf("Error adding transaction: %v", addErr)
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error adding transaction",
-        })
+// optionalFloatQuery parses a query parameter, returning nil when it is absent
+func optionalFloatQuery(c *fiber.Ctx, key string) (*float64, error) {
+    raw := c.Query(key)
+    if raw == "" {
+        return nil, nil
     }
+    value, err := strconv.ParseFloat(raw, 64)
+    if err != nil {
+        return nil, err
+    }
+    return &value, nil
+}
 
-    return c.Status(fiber.StatusOK).JSON(fiber.Map{
-        "message": "Transaction added successfully",
-    })
+// optionalIntQuery parses a query parameter, returning nil when it is absent
+func optionalIntQuery(c *fiber.Ctx, key string) (*int, error) {
+    raw := c.Query(key)
+    if raw == "" {
+        return nil, nil
+    }
+    value, err := strconv.Atoi(raw)
+    if err != nil {
+        return nil, err
+    }
+    return &value, nil
 }
 
-// Handler function to create a new listing
-func createListingHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+// Handler function to create a new listing for a token the caller holds
+func createListingHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
     type ListingRequest struct {
-        NFTID         string  `json:"nftId"`
-        SellerAddress string  `json:"sellerAddress"`
-        Price         float64 `json:"price"`
+        ContractAddress string     `json:"contract_address"`
+        TokenID         string     `json:"token_id"`
+        ReleaseName     string     `json:"release_name"`
+        Price           float64    `json:"price"`
+        Currency        string     `json:"currency"`
+        ImageURL        string     `json:"image_url"`
+        ExpiresAt       *time.Time `json:"expires_at"`
     }
 
     var listingReq ListingRequest
@@ -64,15 +153,182 @@ func createListingHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
         })
     }
 
-    err := nftDB.InsertListing(listingReq.NFTID, listingReq.SellerAddress, listingReq.Price, "")
+    if listingReq.ContractAddress == "" || listingReq.TokenID == "" || listingReq.ReleaseName == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "contract_address, token_id and release_name are required",
+        })
+    }
+    if listingReq.Price <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Price must be greater than zero",
+        })
+    }
+    if listingReq.ExpiresAt != nil && !listingReq.ExpiresAt.After(time.Now()) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "expires_at must be in the future",
+        })
+    }
+    // Purchases are settled by verifying a native transfer on chain, so
+    // listings priced in anything else could never complete
+    listingReq.Currency = strings.ToUpper(listingReq.Currency)
+    if listingReq.Currency == "" {
+        listingReq.Currency = chain.NativeCurrency
+    }
+    if listingReq.Currency != chain.NativeCurrency {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "currency must be " + chain.NativeCurrency,
+        })
+    }
+
+    // Sales settle to the seller's linked wallet, so one is required to list
+    username := currentUsername(c)
+    wallet, err := accountDB.GetPrimaryWallet(username)
+    if errors.Is(err, accountdatabase.ErrNoVerifiedWallet) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Link a wallet before creating a listing",
+        })
+    }
     if err != nil {
-        log.Printf("Error creating listing: %v", err)
+        log.Printf("Error fetching seller %s wallet: %v", username, err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
             "error": "Error creating listing",
         })
     }
 
-    return c.Status(fiber.StatusOK).JSON(fiber.Map{
-        "message": "Listing created successfully",
+    // The token may be held by the account or by any of its verified wallets
+    linked, err := accountDB.GetWallets(username)
+    if err != nil {
+        log.Printf("Error fetching seller %s wallets: %v", username, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating listing",
+        })
+    }
+    wallets := make([]string, len(linked))
+    for i, linkedWallet := range linked {
+        wallets[i] = linkedWallet.Address
+    }
+
+    listing, err := nftDB.InsertListing(nftdatabase.NewListing{
+        ContractAddress: listingReq.ContractAddress,
+        TokenID:         listingReq.TokenID,
+        ReleaseName:     listingReq.ReleaseName,
+        SellerUsername:  username,
+        SellerAddress:   wallet,
+        SellerWallets:   wallets,
+        Price:           listingReq.Price,
+        Currency:        listingReq.Currency,
+        ImageURL:        listingReq.ImageURL,
+        ExpiresAt:       listingReq.ExpiresAt,
     })
+    if errors.Is(err, nftdatabase.ErrNFTNotFound) {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": err.Error(),
+        })
+    }
+    if errors.Is(err, nftdatabase.ErrNotTokenOwner) {
+        return middlewares.Forbidden(c, err.Error())
+    }
+    if errors.Is(err, nftdatabase.ErrTokenAlreadyListed) || errors.Is(err, nftdatabase.ErrTokenOfferedForRent) {
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": err.Error(),
+        })
+    }
+    if err != nil {
+        log.Printf("Error creating listing: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating listing",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(listing)
+}
+
+// Handler function to fetch a single listing
+func getListingHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, publicURL string) error {
+    listingID, err := c.ParamsInt("id")
+    if err != nil || listingID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid listing ID",
+        })
+    }
+
+    listing, err := nftDB.GetListing(listingID)
+    if err != nil {
+        return listingError(c, err)
+    }
+
+    listings := []nftdatabase.Listing{*listing}
+    if err := attachListingMedia(accountDB, publicURL, listings); err != nil {
+        log.Printf("Error fetching listing media: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching listing",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(listings[0])
+}
+
+// Handler function for the seller to change a listing's price
+func updateListingPriceHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    listingID, err := c.ParamsInt("id")
+    if err != nil || listingID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid listing ID",
+        })
+    }
+
+    var priceReq struct {
+        Price float64 `json:"price"`
+    }
+    if err := c.BodyParser(&priceReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if priceReq.Price <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Price must be greater than zero",
+        })
+    }
+
+    listing, err := nftDB.UpdateListingPrice(listingID, currentUsername(c), priceReq.Price)
+    if err != nil {
+        return listingError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(listing)
+}
+
+// Handler function for the seller to cancel a listing
+func cancelListingHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    listingID, err := c.ParamsInt("id")
+    if err != nil || listingID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid listing ID",
+        })
+    }
+
+    listing, err := nftDB.CancelListing(listingID, currentUsername(c))
+    if err != nil {
+        return listingError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(listing)
+}
+
+// listingError maps listing errors onto HTTP responses
+func listingError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, nftdatabase.ErrListingNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrListingNotSeller):
+        return middlewares.Forbidden(c, err.Error())
+    case errors.Is(err, nftdatabase.ErrListingNotActive):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    default:
+        log.Printf("Error updating listing: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error updating listing",
+        })
+    }
 }
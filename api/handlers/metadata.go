@@ -0,0 +1,145 @@
+package handlers
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "strings"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/storage"
+    "shellhacks/api/utils"
+)
+
+// Handler function serving ERC-721 metadata for a tracked token. The JSON is
+// built from the token's current row on every request, so marketplaces that
+// refresh it see level-ups and newly unlocked perks.
+func tokenMetadataHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, publicURL string) error {
+    contractAddress, tokenID := c.Params("contract"), c.Params("tokenId")
+    if !contractAddressPattern.MatchString(contractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid contract address",
+        })
+    }
+    if _, ok := new(big.Int).SetString(tokenID, 10); !ok {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid token ID",
+        })
+    }
+
+    nft, err := nftDB.GetNFTByToken(contractAddress, tokenID)
+    if errors.Is(err, nftdatabase.ErrNFTNotFound) {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Token not found",
+        })
+    }
+    if err != nil {
+        log.Printf("Error fetching NFT: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching token metadata",
+        })
+    }
+
+    return tokenMetadataResponse(c, nftDB, accountDB, publicURL, nft)
+}
+
+// Handler function serving the metadata of the token a queued mint produced.
+// This is the URI minted tokens carry; it answers 404 until the mint is confirmed.
+func mintMetadataHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, publicURL string) error {
+    queueID, err := c.ParamsInt("queueId")
+    if err != nil || queueID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid mint ID",
+        })
+    }
+
+    nft, err := nftDB.GetNFTByMintQueueID(queueID)
+    if errors.Is(err, nftdatabase.ErrNFTNotFound) {
+        c.Set(fiber.HeaderCacheControl, "no-store")
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Token not found",
+        })
+    }
+    if err != nil {
+        log.Printf("Error fetching minted NFT: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching token metadata",
+        })
+    }
+
+    return tokenMetadataResponse(c, nftDB, accountDB, publicURL, nft)
+}
+
+// tokenMetadataResponse writes the ERC-721 metadata of nft
+func tokenMetadataResponse(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, publicURL string, nft *nftdatabase.NFT) error {
+    perks, err := nftDB.GetTokenPerks(nft.ContractAddress, nft.Level)
+    if err != nil {
+        log.Printf("Error fetching token perks: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching token metadata",
+        })
+    }
+
+    metadata := utils.TokenMetadata{
+        Name: "Token #" + nft.TokenID,
+        Attributes: []utils.TokenAttribute{
+            {TraitType: "Level", Value: nft.Level, DisplayType: "number"},
+        },
+    }
+    if nft.ReleaseName != nil {
+        metadata.Name = *nft.ReleaseName + " #" + nft.TokenID
+        metadata.Attributes = append(metadata.Attributes, utils.TokenAttribute{TraitType: "Release", Value: *nft.ReleaseName})
+    }
+
+    if nft.ReleaseID != nil {
+        release, err := accountDB.GetReleaseRequestByID(*nft.ReleaseID)
+        if err != nil {
+            log.Printf("Error fetching release request: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error fetching token metadata",
+            })
+        }
+        if release != nil {
+            metadata.Description = release.ReleaseNotes
+            metadata.Attributes = append(metadata.Attributes, utils.TokenAttribute{TraitType: "Creator", Value: release.Username})
+
+            // The web-sized copy loads faster than the original upload
+            if release.MediaWeb != "" {
+                metadata.Image = releaseImageURL(publicURL, *nft.ReleaseID, release.MediaWeb, mediaVariantWeb)
+            } else if media, err := accountDB.GetReleaseMedia(*nft.ReleaseID); err == nil && media != "" {
+                metadata.Image = releaseImageURL(publicURL, *nft.ReleaseID, media, "")
+            }
+        }
+    }
+
+    for _, perk := range perks {
+        metadata.Attributes = append(metadata.Attributes, utils.TokenAttribute{TraitType: "Perk", Value: perk.Title})
+    }
+
+    // Levels change, so caches and marketplaces should check back soon
+    c.Set(fiber.HeaderCacheControl, "public, max-age=60")
+    return c.Status(fiber.StatusOK).JSON(metadata)
+}
+
+// releaseImageURL is the public address of a release's media, or of one of
+// its image variants. Media pinned to IPFS is public by its CID; anything else
+// sits in a private container, whose unsigned URLs do not load, so it is
+// served through the API instead.
+func releaseImageURL(publicURL string, releaseID int, reference, variant string) string {
+    if storage.IsCID(reference) {
+        return storage.IPFSURI(reference)
+    }
+    return releaseMediaURL(publicURL, releaseID, variant)
+}
+
+// releaseMediaURL is the API route serving a release's media or variant
+func releaseMediaURL(publicURL string, releaseID int, variant string) string {
+    mediaURL := fmt.Sprintf("%s/api/releases/%d/media", strings.TrimSuffix(publicURL, "/"), releaseID)
+    if variant != "" {
+        mediaURL += "?variant=" + variant
+    }
+    return mediaURL
+}
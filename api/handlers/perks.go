@@ -0,0 +1,298 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/middlewares"
+    "shellhacks/api/utils"
+)
+
+// Handler function for a creator to publish a perk
+func createPerkHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    type PerkRequest struct {
+        Title           string     `json:"title"`
+        Description     string     `json:"description"`
+        MinLevel        int        `json:"min_level"`
+        ContractAddress string     `json:"contract_address"`
+        TotalSupply     *int       `json:"total_supply"`
+        PerUserLimit    int        `json:"per_user_limit"`
+        StartsAt        *time.Time `json:"starts_at"`
+        EndsAt          *time.Time `json:"ends_at"`
+    }
+
+    var perkReq PerkRequest
+    if err := c.BodyParser(&perkReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    perkReq.Title = strings.TrimSpace(perkReq.Title)
+    if perkReq.Title == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "title is required"})
+    }
+    if perkReq.MinLevel == 0 {
+        perkReq.MinLevel = 1
+    }
+    if perkReq.PerUserLimit == 0 {
+        perkReq.PerUserLimit = 1
+    }
+    if perkReq.MinLevel < 1 || perkReq.PerUserLimit < 1 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "min_level and per_user_limit must be at least 1"})
+    }
+    if perkReq.TotalSupply != nil && *perkReq.TotalSupply < 1 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "total_supply must be at least 1"})
+    }
+    if perkReq.ContractAddress != "" && !contractAddressPattern.MatchString(perkReq.ContractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid contract address"})
+    }
+    if perkReq.EndsAt != nil {
+        if !perkReq.EndsAt.After(time.Now()) || (perkReq.StartsAt != nil && !perkReq.EndsAt.After(*perkReq.StartsAt)) {
+            return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "ends_at must be in the future and after starts_at"})
+        }
+    }
+
+    perk, err := nftDB.CreatePerk(nftdatabase.NewPerk{
+        CreatorUsername: currentUsername(c),
+        Title:           perkReq.Title,
+        Description:     perkReq.Description,
+        MinLevel:        perkReq.MinLevel,
+        ContractAddress: perkReq.ContractAddress,
+        TotalSupply:     perkReq.TotalSupply,
+        PerUserLimit:    perkReq.PerUserLimit,
+        StartsAt:        perkReq.StartsAt,
+        EndsAt:          perkReq.EndsAt,
+    })
+    if err != nil {
+        log.Printf("Error creating perk: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating perk",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(perk)
+}
+
+// Handler function to list perks that can currently be claimed
+func listPerksHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    perks, err := nftDB.GetPerks(c.Query("creator"), false)
+    if err != nil {
+        log.Printf("Error fetching perks: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching perks",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"perks": perks})
+}
+
+// Handler function for a creator to list all of their perks, including
+// inactive, expired and sold-out ones
+func listCreatorPerksHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    perks, err := nftDB.GetPerks(currentUsername(c), true)
+    if err != nil {
+        log.Printf("Error fetching perks: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching perks",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"perks": perks})
+}
+
+// Handler function to list the perks the caller's tokens qualify for
+func eligiblePerksHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    perks, err := nftDB.GetEligiblePerks(currentUsername(c))
+    if err != nil {
+        log.Printf("Error fetching eligible perks: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching eligible perks",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"perks": perks})
+}
+
+// Handler function to switch a perk on or off
+func setPerkActiveHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    var body struct {
+        Active *bool `json:"active"`
+    }
+    if err := c.BodyParser(&body); err != nil || body.Active == nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "active is required"})
+    }
+
+    perkID, err := c.ParamsInt("id")
+    if err != nil || perkID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid perk ID"})
+    }
+
+    perk, err := nftDB.GetPerk(perkID)
+    if err != nil {
+        return perkError(c, err)
+    }
+    if perk.CreatorUsername != currentUsername(c) && c.Locals("account_type") != accountdatabase.RoleAdmin {
+        return middlewares.Forbidden(c, "Only the perk's creator can manage it")
+    }
+
+    perk, err = nftDB.SetPerkActive(perkID, *body.Active)
+    if err != nil {
+        return perkError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(perk)
+}
+
+// Handler function to claim a perk for one of the caller's tokens. The
+// redemption code is only ever returned here; the server keeps its hash.
+func claimPerkHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    var body struct {
+        NFTID int `json:"nft_id"`
+    }
+    if err := c.BodyParser(&body); err != nil || body.NFTID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "nft_id is required"})
+    }
+
+    perkID, err := c.ParamsInt("id")
+    if err != nil || perkID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid perk ID"})
+    }
+
+    code, codeHash, err := utils.GenerateRedemptionCode()
+    if err != nil {
+        log.Printf("Error generating redemption code: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error claiming perk",
+        })
+    }
+
+    claim, err := nftDB.ClaimPerk(perkID, currentUsername(c), body.NFTID, codeHash)
+    if err != nil {
+        return perkError(c, err)
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "claim":           claim,
+        "redemption_code": code,
+    })
+}
+
+// Handler function to list the caller's perk claims
+func listPerkClaimsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    claims, err := nftDB.GetPerkClaims(currentUsername(c))
+    if err != nil {
+        log.Printf("Error fetching perk claims: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching perk claims",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"claims": claims})
+}
+
+// Handler function for a creator or their staff to check a redemption code
+// and, with "redeem": true, mark it used
+func redeemPerkHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    var body struct {
+        Code   string `json:"code"`
+        Redeem bool   `json:"redeem"`
+    }
+    if err := c.BodyParser(&body); err != nil || strings.TrimSpace(body.Code) == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "code is required"})
+    }
+
+    claim, err := nftDB.RedeemPerkClaim(utils.HashRedemptionCode(body.Code), currentUsername(c), body.Redeem)
+    if errors.Is(err, nftdatabase.ErrClaimAlreadyRedeemed) {
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": err.Error(),
+            "claim": claim,
+        })
+    }
+    if err != nil {
+        return perkError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "valid":    true,
+        "redeemed": claim.Status == nftdatabase.PerkRedeemed,
+        "claim":    claim,
+    })
+}
+
+// Handler function for a creator to list the staff who can redeem their perks
+func listPerkStaffHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    staff, err := nftDB.GetPerkStaff(currentUsername(c))
+    if err != nil {
+        log.Printf("Error fetching perk staff: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching perk staff",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"staff": staff})
+}
+
+// Handler function for a creator to let another account redeem their perks
+func addPerkStaffHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    var body struct {
+        Username string `json:"username"`
+    }
+    if err := c.BodyParser(&body); err != nil || body.Username == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "username is required"})
+    }
+
+    user, err := accountDB.GetUserByUsername(body.Username)
+    if err != nil || user == nil {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "User not found"})
+    }
+
+    if err := nftDB.AddPerkStaff(currentUsername(c), user.Username); err != nil {
+        log.Printf("Error adding perk staff: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error adding perk staff",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Staff member added"})
+}
+
+// Handler function for a creator to remove a staff member
+func removePerkStaffHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    if err := nftDB.RemovePerkStaff(currentUsername(c), c.Params("username")); err != nil {
+        log.Printf("Error removing perk staff: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error removing perk staff",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{"message": "Staff member removed"})
+}
+
+// perkError maps perk errors to responses
+func perkError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, nftdatabase.ErrPerkNotFound), errors.Is(err, nftdatabase.ErrClaimNotFound),
+        errors.Is(err, nftdatabase.ErrNFTNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrNotPerkStaff):
+        return middlewares.Forbidden(c, err.Error())
+    case errors.Is(err, nftdatabase.ErrNotTokenOwner), errors.Is(err, nftdatabase.ErrTokenNotEligible),
+        errors.Is(err, nftdatabase.ErrLevelTooLow):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrPerkUnavailable), errors.Is(err, nftdatabase.ErrPerkSoldOut),
+        errors.Is(err, nftdatabase.ErrPerkLimitReached), errors.Is(err, nftdatabase.ErrPerkAlreadyClaimed),
+        errors.Is(err, nftdatabase.ErrClaimAlreadyRedeemed), errors.Is(err, nftdatabase.ErrPerkExpired):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    default:
+        log.Printf("Error processing perk: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error processing perk",
+        })
+    }
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "regexp"
+    "time"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/workers"
+)
+
+// purchaseHold is how long a buyer has to submit payment after reserving
+const purchaseHold = 15 * time.Minute
+
+var txHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// Handler function for a buyer to reserve a listing. The response tells the
+// buyer what to pay and where; the listing stays off the market until the
+// hold runs out or the payment settles.
+func purchaseListingHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    listingID, err := c.ParamsInt("id")
+    if err != nil || listingID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid listing ID",
+        })
+    }
+
+    username := currentUsername(c)
+    wallet, err := accountDB.GetPrimaryWallet(username)
+    if errors.Is(err, accountdatabase.ErrNoVerifiedWallet) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Link a wallet before buying",
+        })
+    }
+    if err != nil {
+        log.Printf("Error fetching buyer %s wallet: %v", username, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error reserving listing",
+        })
+    }
+
+    order, err := nftDB.ReserveListing(listingID, username, wallet, chain.NativeCurrency, purchaseHold)
+    if err != nil {
+        return orderError(c, err)
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(order)
+}
+
+// Handler function for a buyer to submit the transaction that pays for an
+// order. The payment is verified straight away; if it is still confirming the
+// order stays pending and settles in the background.
+func submitOrderPaymentHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts) error {
+    orderID, err := c.ParamsInt("id")
+    if err != nil || orderID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid order ID",
+        })
+    }
+
+    var paymentReq struct {
+        TxHash string `json:"tx_hash"`
+    }
+    if err := c.BodyParser(&paymentReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if !txHashPattern.MatchString(paymentReq.TxHash) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "tx_hash must be a 0x-prefixed transaction hash",
+        })
+    }
+
+    if payments == nil {
+        return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+            "error": "Payment verification is not configured",
+        })
+    }
+
+    order, err := nftDB.SubmitOrderPayment(orderID, currentUsername(c), paymentReq.TxHash)
+    if err != nil {
+        return orderError(c, err)
+    }
+
+    order, err = workers.SettleOrder(c.Context(), accountDB, nftDB, payments, timeouts, order)
+    if errors.Is(err, chain.ErrPaymentPending) {
+        return c.Status(fiber.StatusAccepted).JSON(order)
+    }
+    if err != nil {
+        // The payment is recorded; the settlement worker will retry
+        log.Printf("Error settling order %d: %v", orderID, err)
+        return c.Status(fiber.StatusAccepted).JSON(order)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// Handler function for the buyer or seller to attach the transaction that
+// transferred the token, when the seller sent it separately from the payment
+func submitOrderTransferHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts) error {
+    orderID, err := c.ParamsInt("id")
+    if err != nil || orderID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid order ID",
+        })
+    }
+
+    var transferReq struct {
+        TxHash string `json:"tx_hash"`
+    }
+    if err := c.BodyParser(&transferReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if !txHashPattern.MatchString(transferReq.TxHash) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "tx_hash must be a 0x-prefixed transaction hash",
+        })
+    }
+
+    order, err := nftDB.SubmitOrderTransfer(orderID, currentUsername(c), transferReq.TxHash)
+    if err != nil {
+        return orderError(c, err)
+    }
+    if payments == nil || order.TxHash == nil {
+        return c.Status(fiber.StatusAccepted).JSON(order)
+    }
+
+    order, err = workers.SettleOrder(c.Context(), accountDB, nftDB, payments, timeouts, order)
+    if err != nil {
+        if !errors.Is(err, chain.ErrPaymentPending) {
+            log.Printf("Error settling order %d: %v", orderID, err)
+        }
+        return c.Status(fiber.StatusAccepted).JSON(order)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// Handler function to fetch an order. Only its buyer and seller may see it.
+func getOrderHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    orderID, err := c.ParamsInt("id")
+    if err != nil || orderID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid order ID",
+        })
+    }
+
+    order, err := nftDB.GetOrder(orderID)
+    if err != nil {
+        return orderError(c, err)
+    }
+
+    username := currentUsername(c)
+    if order.BuyerUsername != username && order.SellerUsername != username {
+        return orderError(c, nftdatabase.ErrOrderNotFound)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(order)
+}
+
+// orderError maps purchase errors onto HTTP responses
+func orderError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, nftdatabase.ErrListingNotFound), errors.Is(err, nftdatabase.ErrOrderNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrListingNotActive),
+        errors.Is(err, nftdatabase.ErrOrderNotPending),
+        errors.Is(err, nftdatabase.ErrPaymentAlreadySubmitted),
+        errors.Is(err, nftdatabase.ErrTxHashUsed),
+        errors.Is(err, nftdatabase.ErrTransferAlreadySubmitted),
+        errors.Is(err, nftdatabase.ErrTransferTxHashUsed):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrOwnListing), errors.Is(err, nftdatabase.ErrUnsupportedCurrency):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    default:
+        log.Printf("Error processing order: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error processing order",
+        })
+    }
+}
@@ -1,15 +1,30 @@
 package handlers
 
 import (
+    "errors"
+    "log"
+
     "github.com/gofiber/fiber/v2"
     "shellhacks/api/database/accountdatabase"
     "shellhacks/api/database/nftdatabase"
-    "shellhacks/api/utils"
+    "shellhacks/api/storage"
+    "shellhacks/api/uploads"
+    "shellhacks/api/workers"
+)
+
+// releaseMediaContainer holds release media and its image variants
+const releaseMediaContainer = "release-request"
+
+// Image variants the release media route serves besides the original
+const (
+    mediaVariantThumbnail = "thumbnail"
+    mediaVariantWeb       = "web"
 )
 
-// Handler function for processing the release form submission
-func releaseFormHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, uploader *utils.Uploader) error {
-    username := c.Query("username")
+// Handler function for processing the release form submission. Image media
+// is stored with a thumbnail and a web-sized copy for marketplace display.
+func releaseFormHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, media storage.Storage) error {
+    username := currentUsername(c)
     releaseTitle := c.Query("release_title")
     releaseDate := c.Query("release_date")
     estimatedCount := c.Query("estimated_count")
@@ -28,32 +43,127 @@ func releaseFormHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase
         })
     }
 
-    mediaFileStream, err := mediaHeader.Open()
+    upload, err := uploads.Save(c.Context(), media, releaseMediaContainer, username, mediaHeader, uploads.ReleaseMedia)
+    if err != nil {
+        return uploadError(c, err, "Media")
+    }
+
+    var thumbnailRef, webRef string
+    if upload.Thumbnail != nil {
+        thumbnailRef = mediaReference(upload.Thumbnail)
+    }
+    if upload.Web != nil {
+        webRef = mediaReference(upload.Web)
+    }
+
+    err = accountDB.AddReleaseRequest(username, releaseTitle, releaseDate, estimatedCount, releaseNotes, []byte(mediaReference(upload.Original)), thumbnailRef, webRef)
     if err != nil {
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to read media file",
+            "error": "Error adding release request",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "message": "Release request submitted successfully!",
+    })
+}
+
+// Handler function serving an approved release's media, or with ?variant= one
+// of its image variants, publicly. This is the image minted tokens' metadata
+// points at, since media outside IPFS sits in a private container.
+func releaseMediaHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, media storage.Storage) error {
+    releaseID, err := c.ParamsInt("id")
+    if err != nil || releaseID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid release ID",
         })
     }
-    defer mediaFileStream.Close()
 
-    containerName := "release-request"
-    blobURL, err := uploader.Upload(c.Context(), containerName, username, mediaFileStream, mediaHeader.Filename)
+    release, err := accountDB.GetReleaseRequestByID(releaseID)
     if err != nil {
+        log.Printf("Error fetching release request: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Failed to upload media to Azure Blob Storage",
+            "error": "Error fetching release media",
+        })
+    }
+    if release == nil || release.Status != accountdatabase.ReleaseApproved {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Release not found",
+        })
+    }
+
+    var reference string
+    switch c.Query("variant") {
+    case mediaVariantThumbnail:
+        reference = release.MediaThumbnail
+    case mediaVariantWeb:
+        reference = release.MediaWeb
+    case "":
+        reference, err = accountDB.GetReleaseMedia(releaseID)
+        if err != nil {
+            log.Printf("Error fetching release media: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error fetching release media",
+            })
+        }
+    default:
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "variant must be thumbnail or web",
+        })
+    }
+    if reference == "" {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Media not found",
         })
     }
+    return sendReleaseMedia(c, media, reference)
+}
 
-    err = accountDB.AddReleaseRequest(username, releaseTitle, releaseDate, estimatedCount, releaseNotes, []byte(blobURL))
+// sendReleaseMedia streams a stored media reference, or redirects to the
+// gateway for content on IPFS
+func sendReleaseMedia(c *fiber.Ctx, media storage.Storage, reference string) error {
+    if storage.IsCID(reference) {
+        gatewayURL, err := media.SignedURL(c.Context(), releaseMediaContainer, reference, 0)
+        if err != nil {
+            log.Printf("Error resolving release media: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error fetching release media",
+            })
+        }
+        return c.Redirect(gatewayURL, fiber.StatusFound)
+    }
+
+    name, ok := storage.ObjectNameFromURL(reference, releaseMediaContainer)
+    if !ok {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Media not found",
+        })
+    }
+    body, info, err := media.Get(c.Context(), releaseMediaContainer, name)
+    if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidName) {
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "Media not found",
+        })
+    }
     if err != nil {
+        log.Printf("Error reading release media: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error adding release request",
+            "error": "Error fetching release media",
         })
     }
 
-    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-        "message": "Release request submitted successfully!",
-    })
+    c.Set(fiber.HeaderContentType, info.ContentType)
+    c.Set(fiber.HeaderCacheControl, "public, max-age=86400")
+    return c.SendStream(body, int(info.Size))
+}
+
+// mediaReference is how a stored media object is recorded: by CID on a
+// content-addressed backend, by URL anywhere else
+func mediaReference(info *storage.ObjectInfo) string {
+    if info.CID != "" {
+        return info.CID
+    }
+    return info.URL
 }
 
 // Handler function for reviewing release requests
@@ -81,33 +191,30 @@ func approveReleaseHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatab
         })
     }
 
-    releaseRequest, err := accountDB.GetReleaseRequestByID(approveReq.ReleaseID)
-    if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error retrieving release request",
-        })
-    }
-
-    if releaseRequest == nil {
+    alreadyApproved, err := accountDB.ApproveReleaseRequest(approveReq.ReleaseID, currentUsername(c))
+    if errors.Is(err, accountdatabase.ErrReleaseNotFound) {
         return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
             "error": "Release request not found",
         })
     }
-
-    err = nftDB.QueueMint(*releaseRequest)
     if err != nil {
+        log.Printf("Error approving release request: %v", err)
         return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error queuing mint",
+            "error": "Error approving release request",
         })
     }
 
-    err = accountDB.DeleteReleaseRequest(approveReq.ReleaseID)
-    if err != nil {
-        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-            "error": "Error deleting release request",
+    if alreadyApproved {
+        return c.Status(fiber.StatusOK).JSON(fiber.Map{
+            "message": "Release request was already approved",
         })
     }
 
+    // The approval is committed; if queuing fails here the background relay retries it
+    if _, err := workers.RelayMintOutbox(accountDB, nftDB); err != nil {
+        log.Printf("Error relaying mint outbox: %v", err)
+    }
+
     return c.Status(fiber.StatusOK).JSON(fiber.Map{
         "message": "Release request approved successfully!",
     })
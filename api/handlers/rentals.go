@@ -0,0 +1,287 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/workers"
+)
+
+// rentalHold is how long a renter has to submit payment after renting
+const rentalHold = 15 * time.Minute
+
+// maxRentalDays caps how long an offer may allow a token to be rented for
+const maxRentalDays = 365
+
+// Handler function to list the tokens open for renting, optionally filtered
+// by contract and minimum level
+func listRentalOffersHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    contractAddress := c.Query("contract")
+    if contractAddress != "" && !contractAddressPattern.MatchString(contractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid contract address"})
+    }
+    minLevel := c.QueryInt("min_level", 1)
+
+    offers, err := nftDB.GetRentalOffers(contractAddress, minLevel)
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(offers)
+}
+
+// Handler function to fetch a single rental offer
+func getRentalOfferHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    offerID, err := c.ParamsInt("id")
+    if err != nil || offerID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid offer ID",
+        })
+    }
+
+    offer, err := nftDB.GetRentalOffer(offerID)
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(offer)
+}
+
+// Handler function for an owner to offer a token for rent. Payments go to the
+// owner's linked wallet, so one is required.
+func createRentalOfferHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    type RentalOfferRequest struct {
+        NFTID      int     `json:"nft_id"`
+        DailyPrice float64 `json:"daily_price"`
+        Currency   string  `json:"currency"`
+        MaxDays    int     `json:"max_days"`
+        Collateral float64 `json:"collateral"`
+    }
+
+    var offerReq RentalOfferRequest
+    if err := c.BodyParser(&offerReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    if offerReq.NFTID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "nft_id is required"})
+    }
+    if offerReq.DailyPrice <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "daily_price must be greater than zero"})
+    }
+    if offerReq.Collateral < 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "collateral cannot be negative"})
+    }
+    if offerReq.MaxDays < 1 || offerReq.MaxDays > maxRentalDays {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "max_days must be between 1 and 365"})
+    }
+    // Rent is settled by verifying a native transfer on chain, as purchases are
+    offerReq.Currency = strings.ToUpper(offerReq.Currency)
+    if offerReq.Currency == "" {
+        offerReq.Currency = chain.NativeCurrency
+    }
+    if offerReq.Currency != chain.NativeCurrency {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "currency must be " + chain.NativeCurrency})
+    }
+
+    username := currentUsername(c)
+    wallet, err := accountDB.GetPrimaryWallet(username)
+    if errors.Is(err, accountdatabase.ErrNoVerifiedWallet) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Link a wallet before offering a token for rent",
+        })
+    }
+    if err != nil {
+        log.Printf("Error fetching owner %s wallet: %v", username, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error creating rental offer",
+        })
+    }
+
+    offer, err := nftDB.CreateRentalOffer(nftdatabase.NewRentalOffer{
+        NFTID:         offerReq.NFTID,
+        OwnerUsername: username,
+        OwnerAddress:  wallet,
+        DailyPrice:    strconv.FormatFloat(offerReq.DailyPrice, 'f', -1, 64),
+        Currency:      offerReq.Currency,
+        MaxDays:       offerReq.MaxDays,
+        Collateral:    strconv.FormatFloat(offerReq.Collateral, 'f', -1, 64),
+    })
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(offer)
+}
+
+// Handler function for an owner to withdraw a rental offer that is not rented
+func cancelRentalOfferHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    offerID, err := c.ParamsInt("id")
+    if err != nil || offerID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid offer ID",
+        })
+    }
+
+    if err := nftDB.CancelRentalOffer(offerID, currentUsername(c)); err != nil {
+        return rentalError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "Rental offer cancelled",
+    })
+}
+
+// Handler function for a renter to rent a token for a number of days. The
+// response tells the renter what to pay and where; the offer stays off the
+// market until the hold runs out or the rental ends.
+func rentTokenHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    offerID, err := c.ParamsInt("id")
+    if err != nil || offerID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid offer ID",
+        })
+    }
+
+    var rentReq struct {
+        Days int `json:"days"`
+    }
+    if err := c.BodyParser(&rentReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    username := currentUsername(c)
+    wallet, err := accountDB.GetPrimaryWallet(username)
+    if errors.Is(err, accountdatabase.ErrNoVerifiedWallet) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Link a wallet before renting",
+        })
+    }
+    if err != nil {
+        log.Printf("Error fetching renter %s wallet: %v", username, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error renting token",
+        })
+    }
+
+    agreement, err := nftDB.RentToken(offerID, username, wallet, chain.NativeCurrency, rentReq.Days, rentalHold)
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(agreement)
+}
+
+// Handler function for a renter to submit the transaction that pays for a
+// rental. As with purchases the payment is verified straight away and settles
+// in the background if it is still confirming.
+func submitRentalPaymentHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts) error {
+    agreementID, err := c.ParamsInt("id")
+    if err != nil || agreementID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid rental ID",
+        })
+    }
+
+    var paymentReq struct {
+        TxHash string `json:"tx_hash"`
+    }
+    if err := c.BodyParser(&paymentReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if !txHashPattern.MatchString(paymentReq.TxHash) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "tx_hash must be a 0x-prefixed transaction hash",
+        })
+    }
+
+    if payments == nil {
+        return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+            "error": "Payment verification is not configured",
+        })
+    }
+
+    agreement, err := nftDB.SubmitRentalPayment(agreementID, currentUsername(c), paymentReq.TxHash)
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    agreement, err = workers.SettleRental(c.Context(), accountDB, nftDB, payments, timeouts, agreement)
+    if errors.Is(err, chain.ErrPaymentPending) {
+        return c.Status(fiber.StatusAccepted).JSON(agreement)
+    }
+    if err != nil {
+        // The payment is recorded; the rental job will retry
+        log.Printf("Error settling rental %d: %v", agreementID, err)
+        return c.Status(fiber.StatusAccepted).JSON(agreement)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(agreement)
+}
+
+// Handler function to fetch a rental agreement. Only its owner and renter may see it.
+func getRentalAgreementHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    agreementID, err := c.ParamsInt("id")
+    if err != nil || agreementID <= 0 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid rental ID",
+        })
+    }
+
+    agreement, err := nftDB.GetRentalAgreement(agreementID)
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    username := currentUsername(c)
+    if agreement.OwnerUsername != username && agreement.RenterUsername != username {
+        return rentalError(c, nftdatabase.ErrRentalNotFound)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(agreement)
+}
+
+// Handler function to list the current user's rentals, as owner or renter
+func listAccountRentalsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    agreements, err := nftDB.GetRentals(currentUsername(c))
+    if err != nil {
+        return rentalError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(agreements)
+}
+
+// rentalError maps rental errors onto HTTP responses
+func rentalError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, nftdatabase.ErrRentalOfferNotFound), errors.Is(err, nftdatabase.ErrRentalNotFound),
+        errors.Is(err, nftdatabase.ErrNFTNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrNotTokenOwner), errors.Is(err, nftdatabase.ErrOwnRentalOffer),
+        errors.Is(err, nftdatabase.ErrInvalidRentalDuration), errors.Is(err, nftdatabase.ErrUnsupportedCurrency):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, nftdatabase.ErrRentalOfferNotActive), errors.Is(err, nftdatabase.ErrRentalNotPending),
+        errors.Is(err, nftdatabase.ErrTokenAlreadyOffered), errors.Is(err, nftdatabase.ErrTokenRented),
+        errors.Is(err, nftdatabase.ErrTokenListedForSale), errors.Is(err, nftdatabase.ErrRentalPaymentSubmitted),
+        errors.Is(err, nftdatabase.ErrTxHashUsed):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    default:
+        log.Printf("Error processing rental: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error processing rental",
+        })
+    }
+}
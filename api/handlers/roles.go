@@ -0,0 +1,78 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+)
+
+type roleChangeRequest struct {
+    Username string `json:"username"`
+    Role     string `json:"role"`
+    Reason   string `json:"reason"`
+}
+
+// Handler function for granting a role to an account
+func grantRoleHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    return changeRoleHandler(c, accountDB, accountDB.GrantRole)
+}
+
+// Handler function for revoking a role from an account
+func revokeRoleHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    return changeRoleHandler(c, accountDB, accountDB.RevokeRole)
+}
+
+func changeRoleHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, change func(username, role, changedBy, reason string) (*accountdatabase.RoleChange, error)) error {
+    var req roleChangeRequest
+    if err := c.BodyParser(&req); err != nil || req.Username == "" || req.Role == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    // Admins cannot change their own role, so the last admin can never lock everyone out
+    admin := currentUsername(c)
+    if req.Username == admin {
+        return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+            "error": "You cannot change your own role",
+        })
+    }
+
+    roleChange, err := change(req.Username, req.Role, admin, req.Reason)
+    switch {
+    case errors.Is(err, accountdatabase.ErrInvalidRole):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Role must be one of admin, creator or reviewer",
+        })
+    case errors.Is(err, accountdatabase.ErrUserNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": "User not found",
+        })
+    case errors.Is(err, accountdatabase.ErrRoleNotHeld):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+            "error": "User does not hold that role",
+        })
+    case err != nil:
+        log.Printf("Error changing role: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error changing role",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(roleChange)
+}
+
+// Handler function for listing the role change audit trail
+func roleAuditHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    changes, err := accountDB.GetRoleChanges(c.Query("username"))
+    if err != nil {
+        log.Printf("Error fetching role changes: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching role changes",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(changes)
+}
@@ -1,54 +1,244 @@
 package handlers
 
 import (
+    "time"
+
     "github.com/gofiber/fiber/v2"
+    "shellhacks/api/chain"
     "shellhacks/api/database/accountdatabase"
     "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/middlewares"
+    "shellhacks/api/storage"
     "shellhacks/api/utils"
 )
 
+// routeScope registers routes behind a shared middleware chain. The chain is
+// attached per route rather than mounted on a prefix, so public and protected
+// routes can live side by side under "/api".
+type routeScope struct {
+    router     fiber.Router
+    middleware []fiber.Handler
+}
+
+func (s routeScope) chain(handler fiber.Handler) []fiber.Handler {
+    handlers := make([]fiber.Handler, 0, len(s.middleware)+1)
+    handlers = append(handlers, s.middleware...)
+    return append(handlers, handler)
+}
+
+func (s routeScope) Get(path string, handler fiber.Handler)    { s.router.Get(path, s.chain(handler)...) }
+func (s routeScope) Post(path string, handler fiber.Handler)   { s.router.Post(path, s.chain(handler)...) }
+func (s routeScope) Put(path string, handler fiber.Handler)    { s.router.Put(path, s.chain(handler)...) }
+func (s routeScope) Delete(path string, handler fiber.Handler) { s.router.Delete(path, s.chain(handler)...) }
+
+// routeScopes groups routes by who may call them
+type routeScopes struct {
+    Public        routeScope
+    Authenticated routeScope
+    Creator       routeScope
+    Reviewer      routeScope
+    Admin         routeScope
+}
+
+func newRouteScopes(router fiber.Router, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) routeScopes {
+    jwt := middlewares.JWTMiddleware(tokens, accountDB)
+    return routeScopes{
+        Public:        routeScope{router: router},
+        Authenticated: routeScope{router: router, middleware: []fiber.Handler{jwt}},
+        Creator:       routeScope{router: router, middleware: []fiber.Handler{jwt, middlewares.RequireRole(accountDB, accountdatabase.RoleCreator, accountdatabase.RoleAdmin)}},
+        Reviewer:      routeScope{router: router, middleware: []fiber.Handler{jwt, middlewares.RequireRole(accountDB, accountdatabase.RoleReviewer, accountdatabase.RoleAdmin)}},
+        Admin:         routeScope{router: router, middleware: []fiber.Handler{jwt, middlewares.RequireRole(accountDB, accountdatabase.RoleAdmin)}},
+    }
+}
+
+// currentUsername returns the username JWTMiddleware stored for this request
+func currentUsername(c *fiber.Ctx) string {
+    username, _ := c.Locals("username").(string)
+    return username
+}
 
 // Register all account and marketplace routes
-func RegisterRoutes(app *fiber.App, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, uploader *utils.Uploader) {
+func RegisterRoutes(app *fiber.App, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, store, media, kyc storage.Storage, tokens *utils.TokenService, siwe utils.SIWEConfig, payments chain.PaymentVerifier, paymentTimeouts chain.PaymentTimeouts, staking chain.StakingReader, stakingInterval time.Duration, publicURL string) {
     // Account-related routes (from account.go, credentials.go, etc.)
-    RegisterAccountRoutes(app, accountDB, nftDB, uploader)
+    RegisterAccountRoutes(app, accountDB, nftDB, media, kyc, tokens, siwe)
     // Marketplace-related routes (from marketplace.go)
-    RegisterMarketplaceRoutes(app.Group("/api/marketplace"), nftDB, accountDB)
+    RegisterMarketplaceRoutes(app.Group("/api/marketplace"), nftDB, accountDB, tokens, payments, paymentTimeouts, publicURL)
+    // Token routes (from tokens.go)
+    RegisterTokenRoutes(app, nftDB, accountDB, tokens, staking, stakingInterval, publicURL)
+    // Engagement routes (from engagement.go)
+    RegisterEngagementRoutes(app, nftDB, accountDB, tokens)
+    // Perk routes (from perks.go)
+    RegisterPerkRoutes(app, nftDB, accountDB, tokens)
+    // Rental routes (from rentals.go)
+    RegisterRentalRoutes(app, nftDB, accountDB, tokens, payments, paymentTimeouts)
+    // File routes (from files.go)
+    RegisterFileRoutes(app, store, kyc)
+}
+
+// Register the routes serving signed URLs that point back at the API: files
+// on the local backend, and KYC files sealed with envelope encryption. Other
+// backends hand out URLs on their own service, so nothing is registered.
+func RegisterFileRoutes(app *fiber.App, store, kyc storage.Storage) {
+    if served, ok := store.(storage.ServedStorage); ok {
+        app.Get("/api/files/:container/*", func(c *fiber.Ctx) error { return signedFileHandler(c, served) })
+    }
+    if sealed, ok := kyc.(*storage.EncryptedStorage); ok {
+        app.Get("/api/kyc/files/:container/*", func(c *fiber.Ctx) error { return signedFileHandler(c, sealed) })
+    }
+}
+
+// Register routes exposing tracked NFTs and their indexed on-chain state.
+// staking is nil unless staking status is configured to be read from chain,
+// and stakingInterval is how long a stake takes to earn a level; publicURL is
+// the API origin that metadata media URLs point at.
+func RegisterTokenRoutes(app *fiber.App, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService, staking chain.StakingReader, stakingInterval time.Duration, publicURL string) {
+    scopes := newRouteScopes(app, accountDB, tokens)
+
+    scopes.Public.Get("/api/chain/tokens/:contract/:tokenId", func(c *fiber.Ctx) error { return tokenChainStateHandler(c, nftDB) })
+    scopes.Public.Get("/api/nfts/:id", func(c *fiber.Ctx) error { return getNFTHandler(c, nftDB) })
+    scopes.Public.Get("/api/nfts/:id/levels", func(c *fiber.Ctx) error { return nftLevelsHandler(c, nftDB) })
+    scopes.Creator.Post("/api/nfts/:id/levels", func(c *fiber.Ctx) error { return grantLevelHandler(c, nftDB, accountDB) })
+    // Minted tokens' URIs name their queued mint, since the token ID is not known before mining
+    scopes.Public.Get("/api/metadata/mints/:queueId", func(c *fiber.Ctx) error { return mintMetadataHandler(c, nftDB, accountDB, publicURL) })
+    scopes.Public.Get("/api/metadata/:contract/:tokenId", func(c *fiber.Ctx) error { return tokenMetadataHandler(c, nftDB, accountDB, publicURL) })
+
+    // Staking routes (from staking.go)
+    scopes.Public.Get("/api/staking/:wallet", func(c *fiber.Ctx) error { return stakingStatusHandler(c, nftDB, staking, stakingInterval) })
 }
 
-// Register marketplace routes
-func RegisterMarketplaceRoutes(router fiber.Router, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) {
-    router.Get("/listings", func(c *fiber.Ctx) error { return getListingsHandler(c, nftDB) })
-    router.Post("/listings", func(c *fiber.Ctx) error { return createListingHandler(c, nftDB) })
-    router.Post("/transaction", func(c *fiber.Ctx) error { return addTransactionHandler(c, accountDB) })
+// Register routes for engagement activities, events and the level-ups they earn
+func RegisterEngagementRoutes(app *fiber.App, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) {
+    scopes := newRouteScopes(app, accountDB, tokens)
+
+    scopes.Creator.Post("/api/engagement/activities", func(c *fiber.Ctx) error { return createActivityHandler(c, nftDB, accountDB) })
+    scopes.Creator.Get("/api/engagement/activities", func(c *fiber.Ctx) error { return listActivitiesHandler(c, nftDB) })
+    scopes.Creator.Put("/api/engagement/activities/:id/active", func(c *fiber.Ctx) error { return setActivityActiveHandler(c, nftDB) })
+    scopes.Creator.Post("/api/engagement/activities/:id/credit", func(c *fiber.Ctx) error { return creditActivityHandler(c, nftDB, accountDB) })
+    scopes.Public.Get("/api/engagement/thresholds", func(c *fiber.Ctx) error { return getLevelThresholdsHandler(c, nftDB) })
+    scopes.Admin.Put("/api/admin/engagement/thresholds", func(c *fiber.Ctx) error { return setLevelThresholdsHandler(c, nftDB) })
+    scopes.Public.Get("/api/nfts/:id/engagement", func(c *fiber.Ctx) error { return nftEngagementHandler(c, nftDB) })
+
+    // Event routes (from events.go)
+    scopes.Public.Get("/api/events", func(c *fiber.Ctx) error { return listEventsHandler(c, nftDB) })
+    scopes.Public.Get("/api/events/:id", func(c *fiber.Ctx) error { return getEventHandler(c, nftDB) })
+    scopes.Creator.Post("/api/events", func(c *fiber.Ctx) error { return createEventHandler(c, nftDB) })
+    scopes.Creator.Post("/api/events/:id/checkin_codes", func(c *fiber.Ctx) error { return createCheckInCodeHandler(c, nftDB) })
+    scopes.Creator.Get("/api/events/:id/checkins", func(c *fiber.Ctx) error { return listCheckInsHandler(c, nftDB) })
+    scopes.Authenticated.Post("/api/events/:id/checkin", func(c *fiber.Ctx) error { return checkInHandler(c, nftDB, accountDB) })
+}
+
+// Register routes for level-gated perks, their claims and redemption
+func RegisterPerkRoutes(app *fiber.App, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService) {
+    scopes := newRouteScopes(app, accountDB, tokens)
+
+    scopes.Public.Get("/api/perks", func(c *fiber.Ctx) error { return listPerksHandler(c, nftDB) })
+    scopes.Authenticated.Get("/api/perks/eligible", func(c *fiber.Ctx) error { return eligiblePerksHandler(c, nftDB) })
+    scopes.Authenticated.Post("/api/perks/:id/claim", func(c *fiber.Ctx) error { return claimPerkHandler(c, nftDB) })
+    scopes.Authenticated.Get("/api/account/perk_claims", func(c *fiber.Ctx) error { return listPerkClaimsHandler(c, nftDB) })
+    // Staff are ordinary accounts, so redemption checks authorization per perk
+    scopes.Authenticated.Post("/api/perks/redeem", func(c *fiber.Ctx) error { return redeemPerkHandler(c, nftDB) })
+
+    scopes.Creator.Post("/api/perks", func(c *fiber.Ctx) error { return createPerkHandler(c, nftDB) })
+    scopes.Creator.Get("/api/creator/perks", func(c *fiber.Ctx) error { return listCreatorPerksHandler(c, nftDB) })
+    scopes.Creator.Put("/api/perks/:id/active", func(c *fiber.Ctx) error { return setPerkActiveHandler(c, nftDB) })
+    scopes.Creator.Get("/api/creator/perk_staff", func(c *fiber.Ctx) error { return listPerkStaffHandler(c, nftDB) })
+    scopes.Creator.Post("/api/creator/perk_staff", func(c *fiber.Ctx) error { return addPerkStaffHandler(c, nftDB, accountDB) })
+    scopes.Creator.Delete("/api/creator/perk_staff/:username", func(c *fiber.Ctx) error { return removePerkStaffHandler(c, nftDB) })
+}
+
+// Register routes for renting tokens out. As with purchases, payments may be
+// nil, in which case rentals can be started but not paid for.
+func RegisterRentalRoutes(app *fiber.App, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts) {
+    scopes := newRouteScopes(app, accountDB, tokens)
+
+    scopes.Public.Get("/api/rentals/offers", func(c *fiber.Ctx) error { return listRentalOffersHandler(c, nftDB) })
+    scopes.Public.Get("/api/rentals/offers/:id", func(c *fiber.Ctx) error { return getRentalOfferHandler(c, nftDB) })
+    scopes.Authenticated.Post("/api/rentals/offers", func(c *fiber.Ctx) error { return createRentalOfferHandler(c, nftDB, accountDB) })
+    scopes.Authenticated.Post("/api/rentals/offers/:id/cancel", func(c *fiber.Ctx) error { return cancelRentalOfferHandler(c, nftDB) })
+    scopes.Authenticated.Post("/api/rentals/offers/:id/rent", func(c *fiber.Ctx) error { return rentTokenHandler(c, nftDB, accountDB) })
+    scopes.Authenticated.Get("/api/rentals/agreements/:id", func(c *fiber.Ctx) error { return getRentalAgreementHandler(c, nftDB) })
+    scopes.Authenticated.Post("/api/rentals/agreements/:id/payment", func(c *fiber.Ctx) error { return submitRentalPaymentHandler(c, nftDB, accountDB, payments, timeouts) })
+    scopes.Authenticated.Get("/api/account/rentals", func(c *fiber.Ctx) error { return listAccountRentalsHandler(c, nftDB) })
+}
+
+// Register marketplace routes. payments may be nil when no chain is configured,
+// in which case orders can be reserved but not settled; timeouts bound how long
+// a paid order waits for its payment and transfer, and publicURL is the API
+// origin listing media URLs point at.
+func RegisterMarketplaceRoutes(router fiber.Router, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase, tokens *utils.TokenService, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts, publicURL string) {
+    scopes := newRouteScopes(router, accountDB, tokens)
+
+    scopes.Public.Get("/listings", func(c *fiber.Ctx) error { return getListingsHandler(c, nftDB, accountDB, publicURL) })
+    scopes.Public.Get("/listings/:id", func(c *fiber.Ctx) error { return getListingHandler(c, nftDB, accountDB, publicURL) })
+    scopes.Authenticated.Post("/listings", func(c *fiber.Ctx) error { return createListingHandler(c, nftDB, accountDB) })
+    scopes.Authenticated.Put("/listings/:id/price", func(c *fiber.Ctx) error { return updateListingPriceHandler(c, nftDB) })
+    scopes.Authenticated.Post("/listings/:id/cancel", func(c *fiber.Ctx) error { return cancelListingHandler(c, nftDB) })
+
+    // Purchase routes (from purchase.go)
+    scopes.Authenticated.Post("/listings/:id/purchase", func(c *fiber.Ctx) error { return purchaseListingHandler(c, nftDB, accountDB) })
+    scopes.Authenticated.Get("/orders/:id", func(c *fiber.Ctx) error { return getOrderHandler(c, nftDB) })
+    scopes.Authenticated.Post("/orders/:id/payment", func(c *fiber.Ctx) error { return submitOrderPaymentHandler(c, nftDB, accountDB, payments, timeouts) })
+    scopes.Authenticated.Post("/orders/:id/transfer", func(c *fiber.Ctx) error { return submitOrderTransferHandler(c, nftDB, accountDB, payments, timeouts) })
+
+    scopes.Authenticated.Post("/transaction", func(c *fiber.Ctx) error { return addTransactionHandler(c, accountDB) })
 }
 
 
 // Register all account-related routes
-func RegisterAccountRoutes(app *fiber.App, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, uploader *utils.Uploader) {
+func RegisterAccountRoutes(app *fiber.App, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, media, kyc storage.Storage, tokens *utils.TokenService, siwe utils.SIWEConfig) {
+    scopes := newRouteScopes(app, accountDB, tokens)
+
     // Credentials routes (from credentials.go)
-    app.Post("/api/login", func(c *fiber.Ctx) error { return loginHandler(c, accountDB) })
-    app.Post("/api/signup", func(c *fiber.Ctx) error { return createAccountHandler(c, accountDB) })
-    app.Post("/api/forgot_password", func(c *fiber.Ctx) error { return forgotPasswordHandler(c, accountDB) })
-    app.Post("/api/reset_password", func(c *fiber.Ctx) error { return resetPasswordHandler(c, accountDB) })
-    app.Get("/api/verify_email", func(c *fiber.Ctx) error { return verifyEmailHandler(c, accountDB) })
+    scopes.Public.Post("/api/login", func(c *fiber.Ctx) error { return loginHandler(c, accountDB, tokens) })
+    scopes.Public.Post("/api/signup", func(c *fiber.Ctx) error { return createAccountHandler(c, accountDB, tokens) })
+    scopes.Public.Post("/api/forgot_password", func(c *fiber.Ctx) error { return forgotPasswordHandler(c, accountDB, tokens) })
+    scopes.Public.Post("/api/reset_password", func(c *fiber.Ctx) error { return resetPasswordHandler(c, accountDB, tokens) })
+    scopes.Public.Get("/api/verify_email", func(c *fiber.Ctx) error { return verifyEmailHandler(c, accountDB, tokens) })
+    scopes.Public.Post("/api/token/refresh", func(c *fiber.Ctx) error { return refreshTokenHandler(c, accountDB, tokens) })
+    scopes.Authenticated.Post("/api/logout", func(c *fiber.Ctx) error { return logoutHandler(c, accountDB) })
+    scopes.Authenticated.Post("/api/logout_all", func(c *fiber.Ctx) error { return logoutAllHandler(c, accountDB) })
 
     // Account routes (from account.go)
-    app.Get("/api/account/profile", func(c *fiber.Ctx) error { return getProfileHandler(c, accountDB) })
-    app.Put("/api/account/update", func(c *fiber.Ctx) error { return updateAccountHandler(c, accountDB) })
-    app.Put("/api/account/update_wallet", func(c *fiber.Ctx) error { return updateWalletHandler(c, accountDB) })
-    app.Post("/api/account/creator_application", func(c *fiber.Ctx) error { return createCreatorApplicationHandler(c, accountDB) })
+    scopes.Authenticated.Get("/api/account/profile", func(c *fiber.Ctx) error { return getProfileHandler(c, accountDB) })
+    scopes.Authenticated.Put("/api/account/update", func(c *fiber.Ctx) error { return updateAccountHandler(c, accountDB) })
+    scopes.Authenticated.Put("/api/account/update_wallet", func(c *fiber.Ctx) error { return updateWalletHandler(c, accountDB) })
+    // Wallet linking routes (from wallets.go)
+    scopes.Authenticated.Post("/api/account/wallets/nonce", func(c *fiber.Ctx) error { return walletNonceHandler(c, accountDB, siwe) })
+    scopes.Authenticated.Post("/api/account/wallets/verify", func(c *fiber.Ctx) error { return verifyWalletHandler(c, accountDB) })
+    scopes.Authenticated.Get("/api/account/wallets", func(c *fiber.Ctx) error { return listWalletsHandler(c, accountDB) })
+    scopes.Authenticated.Put("/api/account/wallets/:address/primary", func(c *fiber.Ctx) error { return setPrimaryWalletHandler(c, accountDB) })
+    scopes.Authenticated.Delete("/api/account/wallets/:address", func(c *fiber.Ctx) error { return unlinkWalletHandler(c, accountDB) })
+    scopes.Authenticated.Post("/api/account/creator_application", func(c *fiber.Ctx) error { return createCreatorApplicationHandler(c, accountDB) })
+    scopes.Authenticated.Get("/api/account/creator_application", func(c *fiber.Ctx) error { return getCreatorApplicationHandler(c, accountDB) })
+
+    // Transaction ledger routes (from transactions.go)
+    scopes.Authenticated.Get("/api/account/transactions", func(c *fiber.Ctx) error { return listTransactionsHandler(c, accountDB) })
+    scopes.Admin.Post("/api/admin/transactions/:id/status", func(c *fiber.Ctx) error { return updateTransactionStatusHandler(c, accountDB) })
+
+    // Creator application review routes (from creator_review.go)
+    scopes.Admin.Get("/api/admin/creator_applications", func(c *fiber.Ctx) error { return listCreatorApplicationsHandler(c, accountDB) })
+    scopes.Admin.Post("/api/admin/creator_applications/:id/approve", func(c *fiber.Ctx) error { return approveCreatorApplicationHandler(c, accountDB) })
+    scopes.Admin.Post("/api/admin/creator_applications/:id/reject", func(c *fiber.Ctx) error { return rejectCreatorApplicationHandler(c, accountDB) })
+    scopes.Admin.Post("/api/admin/creator_applications/:id/request_info", func(c *fiber.Ctx) error { return requestCreatorInfoHandler(c, accountDB) })
 
     // KYC routes (from kyc.go)
-    app.Post("/api/account/kyc_verification", func(c *fiber.Ctx) error { return kycVerificationHandler(c, accountDB, uploader) })
-    app.Get("/api/review_kyc", func(c *fiber.Ctx) error { return reviewKYCRequestsHandler(c, accountDB) })
-    app.Post("/api/approve_kyc", func(c *fiber.Ctx) error { return approveKYCRequestHandler(c, accountDB) })
-    app.Post("/api/decline_kyc", func(c *fiber.Ctx) error { return declineKYCRequestHandler(c, accountDB) })
+    scopes.Authenticated.Post("/api/account/kyc_verification", func(c *fiber.Ctx) error { return kycVerificationHandler(c, accountDB, kyc) })
+    scopes.Reviewer.Get("/api/review_kyc", func(c *fiber.Ctx) error { return reviewKYCRequestsHandler(c, accountDB) })
+    scopes.Reviewer.Post("/api/approve_kyc", func(c *fiber.Ctx) error { return approveKYCRequestHandler(c, accountDB) })
+    scopes.Reviewer.Post("/api/decline_kyc", func(c *fiber.Ctx) error { return declineKYCRequestHandler(c, accountDB) })
+    scopes.Reviewer.Post("/api/start_kyc_review", func(c *fiber.Ctx) error { return startKYCReviewHandler(c, accountDB) })
+    scopes.Reviewer.Post("/api/request_kyc_resubmission", func(c *fiber.Ctx) error { return requestKYCResubmissionHandler(c, accountDB) })
+    scopes.Reviewer.Get("/api/kyc_history/:username", func(c *fiber.Ctx) error { return kycHistoryHandler(c, accountDB) })
+    scopes.Reviewer.Post("/api/kyc_document_url", func(c *fiber.Ctx) error { return kycDocumentURLHandler(c, accountDB, kyc) })
 
     // Release routes (from release.go)
-    app.Post("/api/release_request", func(c *fiber.Ctx) error { return releaseFormHandler(c, accountDB, uploader) })
-    app.Get("/api/review_release_requests", func(c *fiber.Ctx) error { return reviewReleaseRequestsHandler(c, accountDB) })
-    app.Post("/api/approve_release", func(c *fiber.Ctx) error { return approveReleaseHandler(c, accountDB, nftDB) })
+    scopes.Creator.Post("/api/release_request", func(c *fiber.Ctx) error { return releaseFormHandler(c, accountDB, media) })
+    scopes.Public.Get("/api/releases/:id/media", func(c *fiber.Ctx) error { return releaseMediaHandler(c, accountDB, media) })
+    scopes.Admin.Get("/api/review_release_requests", func(c *fiber.Ctx) error { return reviewReleaseRequestsHandler(c, accountDB) })
+    scopes.Admin.Post("/api/approve_release", func(c *fiber.Ctx) error { return approveReleaseHandler(c, accountDB, nftDB) })
 
-	
+    // Role management routes (from roles.go)
+    scopes.Admin.Post("/api/admin/roles/grant", func(c *fiber.Ctx) error { return grantRoleHandler(c, accountDB) })
+    scopes.Admin.Post("/api/admin/roles/revoke", func(c *fiber.Ctx) error { return revokeRoleHandler(c, accountDB) })
+    scopes.Admin.Get("/api/admin/roles/audit", func(c *fiber.Ctx) error { return roleAuditHandler(c, accountDB) })
 }
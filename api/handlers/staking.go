@@ -0,0 +1,163 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// stakedTokenStatus is one staked token in a wallet's staking status. A token
+// is projected to gain one level once it has been staked for the configured
+// level interval, and never before NFTStaker's deadline when that is known.
+type stakedTokenStatus struct {
+    StakerContract string     `json:"staker_contract"`
+    TokenContract  string     `json:"token_contract"`
+    TokenID        string     `json:"token_id"`
+    NFTID          *int       `json:"nft_id"`
+    Level          int        `json:"level"`
+    StakedAt       *time.Time `json:"staked_at"`
+    StakedSeconds  int64      `json:"staked_seconds"`
+    NextLevel      *int       `json:"next_level"`
+    NextLevelAt    *time.Time `json:"next_level_at"`
+}
+
+// Handler function to fetch the tokens a wallet has staked in NFTStaker, with
+// how long they have been staked and the level they are projected to reach.
+// The indexed events answer by default; when a chain reader is configured
+// the staked set and level-up schedule are read from the contract instead.
+func stakingStatusHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, reader chain.StakingReader, levelInterval time.Duration) error {
+    wallet := c.Params("wallet")
+    if !common.IsHexAddress(wallet) || !strings.HasPrefix(wallet, "0x") {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid wallet address",
+        })
+    }
+
+    stakes, err := nftDB.GetWalletStakes(wallet)
+    if err != nil {
+        log.Printf("Error fetching stakes for %s: %v", wallet, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching staking status",
+        })
+    }
+
+    if reader == nil {
+        tokens := make([]stakedTokenStatus, 0, len(stakes))
+        for _, stake := range stakes {
+            tokens = append(tokens, stakeStatus(stake, true, !stake.LevelUpDone, nil, levelInterval))
+        }
+        return c.Status(fiber.StatusOK).JSON(fiber.Map{
+            "wallet": strings.ToLower(wallet),
+            "source": "index",
+            "tokens": tokens,
+        })
+    }
+
+    tokens, schedule, err := chainStakingStatus(c, nftDB, reader, wallet, stakes, levelInterval)
+    if err != nil {
+        log.Printf("Error reading NFTStaker for %s: %v", wallet, err)
+        return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+            "error": "Error reading staking contract",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "wallet":             strings.ToLower(wallet),
+        "source":             "chain",
+        "staker_contract":    strings.ToLower(reader.StakerAddress().Hex()),
+        "deadline":           schedule.Deadline,
+        "level_up_completed": schedule.Completed,
+        "tokens":             tokens,
+    })
+}
+
+// chainStakingStatus takes the staked set from the contract, filling in stake
+// times and durations from the indexed events where the indexer has them
+func chainStakingStatus(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, reader chain.StakingReader, wallet string, stakes []nftdatabase.WalletStake, levelInterval time.Duration) ([]stakedTokenStatus, *chain.StakingSchedule, error) {
+    schedule, err := reader.Schedule(c.Context())
+    if err != nil {
+        return nil, nil, err
+    }
+    tokenContract, err := reader.TokenContract(c.Context())
+    if err != nil {
+        return nil, nil, err
+    }
+    tokenIDs, err := reader.StakedTokens(c.Context(), common.HexToAddress(wallet))
+    if err != nil {
+        return nil, nil, err
+    }
+
+    stakerContract := strings.ToLower(reader.StakerAddress().Hex())
+    indexed := map[string]nftdatabase.WalletStake{}
+    for _, stake := range stakes {
+        if stake.StakerContract == stakerContract {
+            indexed[stake.TokenID] = stake
+        }
+    }
+
+    tokens := make([]stakedTokenStatus, 0, len(tokenIDs))
+    for _, tokenID := range tokenIDs {
+        stake, ok := indexed[tokenID.String()]
+        if !ok {
+            // Staked too recently for the indexer to have seen it yet
+            stake = nftdatabase.WalletStake{
+                StakerContract: stakerContract,
+                TokenContract:  strings.ToLower(tokenContract.Hex()),
+                TokenID:        tokenID.String(),
+                Level:          1,
+            }
+            nft, err := nftDB.GetNFTByToken(stake.TokenContract, stake.TokenID)
+            if err != nil && !errors.Is(err, nftdatabase.ErrNFTNotFound) {
+                return nil, nil, err
+            }
+            if nft != nil {
+                stake.NFTID = &nft.NFTID
+                stake.Level = nft.Level
+            }
+        }
+
+        tokens = append(tokens, stakeStatus(stake, ok, !schedule.Completed, &schedule.Deadline, levelInterval))
+    }
+
+    return tokens, schedule, nil
+}
+
+// stakeStatus projects a stake's next level. indexed is whether the stake time
+// is known, levelUpOpen whether the staker contract's level-up round is still
+// to run, and deadline when it can run, if known. The next level is due
+// levelInterval after the stake time, or at the deadline if that is later.
+func stakeStatus(stake nftdatabase.WalletStake, indexed, levelUpOpen bool, deadline *time.Time, levelInterval time.Duration) stakedTokenStatus {
+    status := stakedTokenStatus{
+        StakerContract: stake.StakerContract,
+        TokenContract:  stake.TokenContract,
+        TokenID:        stake.TokenID,
+        NFTID:          stake.NFTID,
+        Level:          stake.Level,
+        StakedSeconds:  stake.StakedSeconds,
+    }
+    if indexed {
+        status.StakedAt = &stake.StakedAt
+    }
+    if !levelUpOpen {
+        return status
+    }
+
+    next := stake.Level + 1
+    status.NextLevel = &next
+    if indexed {
+        nextAt := stake.StakedAt.Add(levelInterval)
+        if deadline != nil && deadline.After(nextAt) {
+            nextAt = *deadline
+        }
+        status.NextLevelAt = &nextAt
+    } else {
+        status.NextLevelAt = deadline
+    }
+    return status
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "math/big"
+    "regexp"
+    "strings"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+    "shellhacks/api/middlewares"
+)
+
+var contractAddressPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{40}$`)
+
+// Handler function to fetch a token's indexed level and staking status
+func tokenChainStateHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    contractAddress, tokenID := c.Params("contract"), c.Params("tokenId")
+    if !contractAddressPattern.MatchString(contractAddress) {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid contract address",
+        })
+    }
+    if _, ok := new(big.Int).SetString(tokenID, 10); !ok {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid token ID",
+        })
+    }
+
+    state, err := nftDB.GetTokenChainState(contractAddress, tokenID)
+    if err != nil {
+        log.Printf("Error fetching token chain state: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching token state",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(state)
+}
+
+// Handler function to fetch a tracked NFT with its current level, owner and
+// staking status
+func getNFTHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    nft, err := nftFromParams(c, nftDB)
+    if nft == nil {
+        return err
+    }
+
+    state, err := nftDB.GetTokenChainState(nft.ContractAddress, nft.TokenID)
+    if err != nil {
+        log.Printf("Error fetching token chain state: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching NFT",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "nft":            nft,
+        "staked":         state.Staked,
+        "staker_address": state.StakerAddress,
+        "staked_at":      state.StakedAt,
+    })
+}
+
+// Handler function to fetch an NFT's level-up history
+func nftLevelsHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) error {
+    nft, err := nftFromParams(c, nftDB)
+    if nft == nil {
+        return err
+    }
+
+    history, err := nftDB.GetLevelHistory(nft.NFTID)
+    if err != nil {
+        log.Printf("Error fetching level history: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching level history",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "nft_id":         nft.NFTID,
+        "level":          nft.Level,
+        "owner_username": nft.OwnerUsername,
+        "owner_address":  nft.OwnerAddress,
+        "history":        history,
+    })
+}
+
+// Handler function for a creator or admin to grant an NFT a level directly.
+// Creators may only grant levels on tokens of their own approved releases.
+func grantLevelHandler(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase, accountDB *accountdatabase.AccountDatabase) error {
+    nft, err := nftFromParams(c, nftDB)
+    if nft == nil {
+        return err
+    }
+
+    var grantReq struct {
+        Level  int    `json:"level"`
+        Reason string `json:"reason"`
+    }
+    if err := c.BodyParser(&grantReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if grantReq.Level < 1 {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "level must be at least 1",
+        })
+    }
+
+    username := currentUsername(c)
+    if c.Locals("account_type") != accountdatabase.RoleAdmin {
+        releaseIDs, err := accountDB.GetApprovedReleaseIDs(username)
+        if err != nil {
+            log.Printf("Error fetching approved releases: %v", err)
+            return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+                "error": "Error granting level",
+            })
+        }
+        if nft.ReleaseID == nil || !containsInt(releaseIDs, *nft.ReleaseID) {
+            return middlewares.Forbidden(c, "You can only grant levels on tokens of your approved releases")
+        }
+    }
+
+    change, err := nftDB.RecordLevelChange(nft.ContractAddress, nft.TokenID, grantReq.Level,
+        nftdatabase.LevelSourceCreatorGrant, strings.TrimSpace(grantReq.Reason), username)
+    if err != nil {
+        log.Printf("Error granting level to NFT %d: %v", nft.NFTID, err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error granting level",
+        })
+    }
+    if change == nil {
+        return c.Status(fiber.StatusOK).JSON(fiber.Map{
+            "message": "NFT is already at this level",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(change)
+}
+
+// nftFromParams loads the NFT named by the :id route parameter. When it
+// returns nil the error response has already been written.
+func nftFromParams(c *fiber.Ctx, nftDB *nftdatabase.NFTDatabase) (*nftdatabase.NFT, error) {
+    nftID, err := c.ParamsInt("id")
+    if err != nil || nftID <= 0 {
+        return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid NFT ID",
+        })
+    }
+
+    nft, err := nftDB.GetNFT(nftID)
+    if errors.Is(err, nftdatabase.ErrNFTNotFound) {
+        return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+            "error": err.Error(),
+        })
+    }
+    if err != nil {
+        log.Printf("Error fetching NFT: %v", err)
+        return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching NFT",
+        })
+    }
+
+    return nft, nil
+}
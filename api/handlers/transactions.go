@@ -0,0 +1,123 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "strings"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+)
+
+// Handler function for a user to record a transaction of their own. Entries
+// start pending; an admin confirms or fails them once they are checked.
+func addTransactionHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    type TransactionRequest struct {
+        TransactionType string                       `json:"transaction_type"`
+        ItemsSent       []accountdatabase.LedgerItem `json:"items_sent"`
+        ItemsReceived   []accountdatabase.LedgerItem `json:"items_received"`
+        Notes           string                       `json:"notes"`
+        TxHash          string                       `json:"tx_hash"`
+    }
+
+    var transactionReq TransactionRequest
+    if err := c.BodyParser(&transactionReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    entry := accountdatabase.NewLedgerEntry{
+        Username:        currentUsername(c),
+        TransactionType: transactionReq.TransactionType,
+        ItemsSent:       transactionReq.ItemsSent,
+        ItemsReceived:   transactionReq.ItemsReceived,
+        Notes:           transactionReq.Notes,
+        Status:          accountdatabase.TransactionPending,
+        TxHash:          transactionReq.TxHash,
+    }
+    if err := entry.Validate(); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": err.Error(),
+        })
+    }
+
+    recorded, err := accountDB.RecordTransaction(entry)
+    if err != nil {
+        log.Printf("Error adding transaction: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error adding transaction",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(recorded)
+}
+
+// Handler function for a user to page through their own transaction history
+func listTransactionsHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    filter := accountdatabase.LedgerFilter{
+        Username: currentUsername(c),
+        Status:   strings.ToLower(c.Query("status")),
+        Limit:    c.QueryInt("limit", 25),
+        Offset:   c.QueryInt("offset", 0),
+    }
+    if filter.Offset < 0 {
+        filter.Offset = 0
+    }
+
+    entries, total, err := accountDB.GetTransactions(filter)
+    if err != nil {
+        log.Printf("Error fetching transactions: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error fetching transactions",
+        })
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "transactions": entries,
+        "total":        total,
+        "limit":        filter.Limit,
+        "offset":       filter.Offset,
+    })
+}
+
+// Handler function for an admin to confirm, fail or reverse a transaction
+func updateTransactionStatusHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    var statusReq struct {
+        Status string `json:"status"`
+        Reason string `json:"reason"`
+    }
+    if err := c.BodyParser(&statusReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if strings.TrimSpace(statusReq.Reason) == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "A reason is required",
+        })
+    }
+
+    entry, err := accountDB.TransitionTransaction(c.Params("id"), strings.ToLower(statusReq.Status), currentUsername(c), statusReq.Reason)
+    switch {
+    case errors.Is(err, accountdatabase.ErrTransactionNotFound):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, accountdatabase.ErrInvalidTransactionStatus):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    case err != nil:
+        log.Printf("Error updating transaction status: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error updating transaction status",
+        })
+    }
+
+    history, err := accountDB.GetTransactionStatusHistory(entry.TransactionID)
+    if err != nil {
+        log.Printf("Error fetching transaction status history: %v", err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "transaction":    entry,
+        "status_history": history,
+    })
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+    "errors"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/utils"
+)
+
+// walletNonceTTL is how long a user has to sign a wallet verification message
+const walletNonceTTL = 10 * time.Minute
+
+// Handler function to start linking a wallet. The response carries an
+// EIP-4361 message for the wallet to sign with personal_sign.
+func walletNonceHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase, siwe utils.SIWEConfig) error {
+    var nonceReq struct {
+        Address string `json:"address"`
+    }
+    if err := c.BodyParser(&nonceReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+
+    address, err := utils.ParseWalletAddress(strings.TrimSpace(nonceReq.Address))
+    if err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    }
+
+    nonce, err := utils.GenerateSIWENonce()
+    if err != nil {
+        log.Printf("Error generating wallet nonce: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error starting wallet verification",
+        })
+    }
+
+    message := siwe.NewSIWEMessage(address, nonce, walletNonceTTL)
+    if err := accountDB.CreateWalletNonce(currentUsername(c), address.Hex(), nonce, message.String(), walletNonceTTL); err != nil {
+        log.Printf("Error storing wallet nonce: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error starting wallet verification",
+        })
+    }
+
+    return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+        "nonce":      nonce,
+        "address":    address.Hex(),
+        "message":    message.String(),
+        "expires_at": message.ExpirationTime,
+    })
+}
+
+// Handler function to finish linking a wallet. The signature must recover to
+// the address the nonce was issued for, over exactly the message issued.
+func verifyWalletHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    var verifyReq struct {
+        Nonce     string `json:"nonce"`
+        Signature string `json:"signature"`
+        Primary   bool   `json:"primary"`
+    }
+    if err := c.BodyParser(&verifyReq); err != nil {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "Invalid request format",
+        })
+    }
+    if verifyReq.Nonce == "" || verifyReq.Signature == "" {
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+            "error": "nonce and signature are required",
+        })
+    }
+
+    username := currentUsername(c)
+    address, message, err := accountDB.ConsumeWalletNonce(username, verifyReq.Nonce)
+    if err != nil {
+        return walletError(c, err)
+    }
+
+    signer, err := utils.RecoverPersonalSign(message, verifyReq.Signature)
+    if err != nil || !strings.EqualFold(signer.Hex(), address) {
+        return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+            "error": utils.ErrInvalidSignature.Error(),
+        })
+    }
+
+    wallet, err := accountDB.LinkWallet(username, address, verifyReq.Primary)
+    if err != nil {
+        return walletError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(wallet)
+}
+
+// Handler function to list the current user's linked wallets
+func listWalletsHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    wallets, err := accountDB.GetWallets(currentUsername(c))
+    if err != nil {
+        return walletError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(wallets)
+}
+
+// Handler function to make a linked wallet the one payments and mints use
+func setPrimaryWalletHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    if err := accountDB.SetPrimaryWallet(currentUsername(c), c.Params("address")); err != nil {
+        return walletError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "Primary wallet updated",
+    })
+}
+
+// Handler function to unlink a wallet from the current user's account
+func unlinkWalletHandler(c *fiber.Ctx, accountDB *accountdatabase.AccountDatabase) error {
+    if err := accountDB.UnlinkWallet(currentUsername(c), c.Params("address")); err != nil {
+        return walletError(c, err)
+    }
+
+    return c.Status(fiber.StatusOK).JSON(fiber.Map{
+        "message": "Wallet unlinked",
+    })
+}
+
+// walletError maps wallet linking errors onto HTTP responses
+func walletError(c *fiber.Ctx, err error) error {
+    switch {
+    case errors.Is(err, accountdatabase.ErrWalletNotLinked):
+        return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, accountdatabase.ErrWalletNonceInvalid):
+        return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+    case errors.Is(err, accountdatabase.ErrWalletLinked):
+        return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": err.Error()})
+    default:
+        log.Printf("Error processing wallet: %v", err)
+        return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+            "error": "Error processing wallet",
+        })
+    }
+}
@@ -1,22 +1,32 @@
 package main
 
 import (
+    "context"
     "log"
     "os"
+    "time"
 
+    "github.com/ethereum/go-ethereum/common"
     "github.com/gofiber/fiber/v2"
     "github.com/gofiber/fiber/v2/middleware/cors"
     "github.com/gofiber/fiber/v2/middleware/logger"
     "github.com/joho/godotenv" 
+    "shellhacks/api/chain"
     "shellhacks/api/database/accountdatabase"
     "shellhacks/api/database/nftdatabase"
     "shellhacks/api/handlers"
+    "shellhacks/api/storage"
+    "shellhacks/api/uploads"
     "shellhacks/api/utils"
+    "shellhacks/api/workers"
 )
 
 var nftDB *nftdatabase.NFTDatabase
 var accountDB *accountdatabase.AccountDatabase
-var uploader *utils.Uploader
+var store storage.Storage
+var media storage.Storage
+var kycStore storage.Storage
+var tokens *utils.TokenService
 
 func main() {
     if err := godotenv.Load(); err != nil {
@@ -25,7 +35,6 @@ func main() {
 
     nftDBURL := os.Getenv("NFT_DB_URL")
     accountDBURL := os.Getenv("ACCOUNT_DB_URL")
-    azureBlobConnectionString := os.Getenv("AZURE_BLOB_CONNECTION_STRING")
 
     var err error
     nftDB, err = nftdatabase.NewNFTDatabase(nftDBURL)
@@ -40,12 +49,134 @@ func main() {
     }
     defer accountDB.Pool.Close()
 
-    uploader, err = utils.NewUploader(azureBlobConnectionString)
+    storageConfig, err := storage.LoadConfig()
     if err != nil {
-        log.Fatalf("Unable to initialize Azure Blob Uploader: %v\n", err)
+        log.Fatalf("Unable to load storage configuration: %v\n", err)
     }
 
-    app := fiber.New()
+    store, err = storage.New(storageConfig)
+    if err != nil {
+        log.Fatalf("Unable to initialize %s storage: %v\n", storageConfig.Backend, err)
+    }
+
+    media, err = storage.NewMedia(storageConfig, store)
+    if err != nil {
+        log.Fatalf("Unable to initialize media storage: %v\n", err)
+    }
+
+    kycStore, err = storage.NewKYC(storageConfig, store)
+    if err != nil {
+        log.Fatalf("Unable to initialize KYC storage: %v\n", err)
+    }
+
+    tokenConfig, err := utils.LoadTokenConfig()
+    if err != nil {
+        log.Fatalf("Unable to load token configuration: %v\n", err)
+    }
+
+    tokens, err = utils.NewTokenService(tokenConfig)
+    if err != nil {
+        log.Fatalf("Unable to initialize token service: %v\n", err)
+    }
+
+    // The API's public origin, which token metadata and media URLs point at
+    publicURL := os.Getenv("PUBLIC_API_URL")
+    if publicURL == "" {
+        publicURL = "http://localhost:3000"
+    }
+
+    siweConfig, err := utils.LoadSIWEConfig()
+    if err != nil {
+        log.Fatalf("Unable to load wallet verification configuration: %v\n", err)
+    }
+
+    // Background jobs stop when main returns
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+
+    // Deliver release approvals to queued_mints, retrying any that failed inline
+    go workers.RunMintOutboxRelay(ctx, accountDB, nftDB, 30*time.Second)
+    go workers.RunListingExpiry(ctx, nftDB, time.Minute)
+
+    chainConfig, chainEnabled, err := chain.LoadConfig()
+    if err != nil {
+        log.Fatalf("Unable to load chain configuration: %v\n", err)
+    }
+
+    // Purchases stay unsettled until a chain is configured, and engagement
+    // level-ups are recorded off-chain until a LevelUpNFT signer is
+    var payments chain.PaymentVerifier
+    var leveler chain.Leveler
+    var stakingReader chain.StakingReader
+    if chainEnabled {
+        ethClient, err := chain.Dial(ctx, chainConfig)
+        if err != nil {
+            log.Fatalf("Unable to connect to Ethereum RPC: %v\n", err)
+        }
+        defer ethClient.Close()
+
+        nativePayments := chain.NewNativePayments(ethClient, chainConfig.ChainID, chainConfig.Confirmations)
+        payments = nativePayments
+        go workers.RunOrderSettlement(ctx, accountDB, nftDB, nativePayments, chainConfig.PaymentTimeouts, 30*time.Second)
+
+        if chainConfig.StakerAddress != (common.Address{}) {
+            staker, err := chain.NewNFTStaker(ethClient, chainConfig.StakerAddress)
+            if err != nil {
+                log.Fatalf("Unable to bind NFTStaker contract: %v\n", err)
+            }
+
+            stakingIndexer := workers.NewStakingIndexer(nftDB, staker, chainConfig.IndexerStartBlock, chainConfig.Confirmations)
+            go stakingIndexer.Run(ctx, 15*time.Second)
+
+            if chainConfig.StakingSource == "chain" {
+                stakingReader = chain.NewCachedStakingReader(staker, 15*time.Second)
+            }
+        } else {
+            log.Println("Staking indexer disabled: NFTSTAKER_ADDRESS not set")
+        }
+
+        // One signer for the minter key, so every worker sending from it shares a nonce counter
+        var minterSigner *chain.Signer
+        if chainConfig.MinterKey != nil {
+            minterSigner, err = chain.NewSigner(ethClient, chainConfig.MinterKey, chainConfig.ChainID)
+            if err != nil {
+                log.Fatalf("Unable to create minter signer: %v\n", err)
+            }
+        }
+
+        if minterSigner != nil {
+            minter, err := chain.NewFreshMint(ethClient, chainConfig.FreshMintAddress, minterSigner)
+            if err != nil {
+                log.Fatalf("Unable to bind FreshMint contract: %v\n", err)
+            }
+
+            // Tokens point at the API's metadata, so level-ups and perks show up in wallets
+            tokenURIs := workers.APIMetadataURIs{BaseURL: publicURL}
+            mintWorker := workers.NewMintWorker(accountDB, nftDB, minter, tokenURIs, chainConfig.Confirmations)
+            go mintWorker.Run(ctx, 10*time.Second)
+        } else {
+            log.Println("Mint worker disabled: MINTER_PRIVATE_KEY not set")
+        }
+
+        if minterSigner != nil && chainConfig.LevelUpAddress != (common.Address{}) {
+            levelUpNFT, err := chain.NewLevelUpNFT(ethClient, chainConfig.LevelUpAddress, minterSigner)
+            if err != nil {
+                log.Fatalf("Unable to bind LevelUpNFT contract: %v\n", err)
+            }
+            leveler = levelUpNFT
+        }
+    } else {
+        log.Println("Chain features disabled: ETH_RPC_URL not set")
+    }
+
+    levelUpWorker := workers.NewLevelUpWorker(nftDB, leveler, chainConfig.Confirmations)
+    go levelUpWorker.Run(ctx, 10*time.Second)
+
+    // Rentals expire and end without a chain; paid ones settle once payments are configured
+    go workers.RunRentalJobs(ctx, accountDB, nftDB, payments, chainConfig.PaymentTimeouts, time.Minute)
+
+    // Uploads are checked per purpose by the uploads package; this only caps the request
+    app := fiber.New(fiber.Config{BodyLimit: uploads.MaxRequestSize})
     app.Use(logger.New())
     app.Use(cors.New(cors.Config{
         AllowOrigins: "*", 
@@ -54,7 +185,7 @@ func main() {
     }))
 
     // Register all routes through routes.go
-    handlers.RegisterRoutes(app, accountDB, nftDB, uploader)
+    handlers.RegisterRoutes(app, accountDB, nftDB, store, media, kycStore, tokens, siweConfig, payments, chainConfig.PaymentTimeouts, stakingReader, chainConfig.StakingLevelInterval, publicURL)
 
     log.Fatal(app.Listen(":3000"))
 }
@@ -3,29 +3,73 @@ package middlewares
 import (
     "log"
     "github.com/gofiber/fiber/v2"
+    "shellhacks/api/database/accountdatabase"
     "shellhacks/api/utils"
     "strings"
 )
 
-func JWTMiddleware() fiber.Handler {
+// Unauthorized writes the standard 401 response used by every protected route
+func Unauthorized(c *fiber.Ctx, message string) error {
+    return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": message})
+}
+
+// Forbidden writes the standard 403 response used by every protected route
+func Forbidden(c *fiber.Ctx, message string) error {
+    return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": message})
+}
+
+// JWTMiddleware rejects requests without a valid access token
+func JWTMiddleware(tokens *utils.TokenService, accountDB *accountdatabase.AccountDatabase) fiber.Handler {
     return func(c *fiber.Ctx) error {
         authHeader := c.Get("Authorization")
-        log.Println("Authorization Header:", authHeader)
 
         if !strings.HasPrefix(authHeader, "Bearer ") {
-            return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Authorization header missing or invalid"})
+            return Unauthorized(c, "Authorization header missing or invalid")
         }
 
         tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-        claims, err := utils.ParseToken(tokenStr)
+        claims, err := tokens.Parse(tokenStr, utils.PurposeAccess)
         if err != nil {
             log.Println("Error parsing token:", err)
-            return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+            return Unauthorized(c, "Invalid token")
         }
 
-        // Store the username in the context for use in future handlers
-        c.Locals("username", claims.Username)
+        // Access tokens die with their session, even before they expire
+        active, err := accountDB.IsSessionActive(claims.SessionID)
+        if err != nil || !active {
+            return Unauthorized(c, "Session has been revoked")
+        }
+
+        // Store the username and session in the context for use in future handlers
+        c.Locals("username", claims.Username())
+        c.Locals("session_id", claims.SessionID)
 
         return c.Next()
     }
 }
+
+// RequireRole only lets a request through when the authenticated user's
+// accountsettings.account_type is one of roles. It must run after JWTMiddleware.
+func RequireRole(accountDB *accountdatabase.AccountDatabase, roles ...string) fiber.Handler {
+    return func(c *fiber.Ctx) error {
+        username, ok := c.Locals("username").(string)
+        if !ok || username == "" {
+            return Unauthorized(c, "Authentication required")
+        }
+
+        user, err := accountDB.GetUserByUsername(username)
+        if err != nil || user == nil {
+            return Unauthorized(c, "Account not found")
+        }
+
+        for _, role := range roles {
+            if user.AccountType == role {
+                // Store the role so handlers can tailor responses without another lookup
+                c.Locals("account_type", user.AccountType)
+                return c.Next()
+            }
+        }
+
+        return Forbidden(c, "You do not have permission to perform this action")
+    }
+}
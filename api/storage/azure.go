@@ -0,0 +1,132 @@
+package storage
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "time"
+
+    "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+    "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+    "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+    "github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+)
+
+// AzureStorage stores objects as blobs, one Azure container per container
+type AzureStorage struct {
+    client *azblob.Client
+}
+
+// NewAzureStorage connects with an account connection string. The string must
+// carry the account key, which SignedURL uses to sign SAS tokens.
+func NewAzureStorage(connectionString string) (*AzureStorage, error) {
+    client, err := azblob.NewClientFromConnectionString(connectionString, nil)
+    if err != nil {
+        return nil, fmt.Errorf("failed to create blob service client: %w", err)
+    }
+    return &AzureStorage{client: client}, nil
+}
+
+func (s *AzureStorage) blobClient(container, name string) *blob.Client {
+    return s.client.ServiceClient().NewContainerClient(container).NewBlobClient(name)
+}
+
+func (s *AzureStorage) Put(ctx context.Context, container, name string, body io.Reader, contentType string) (*ObjectInfo, error) {
+    if err := validateName(container, name); err != nil {
+        return nil, err
+    }
+
+    counter := &countingReader{r: body}
+    options := &azblob.UploadStreamOptions{}
+    if contentType != "" {
+        options.HTTPHeaders = &blob.HTTPHeaders{BlobContentType: &contentType}
+    }
+    resp, err := s.client.UploadStream(ctx, container, name, counter, options)
+    if err != nil {
+        return nil, fmt.Errorf("failed to upload blob: %w", err)
+    }
+
+    info := &ObjectInfo{
+        Container:   container,
+        Name:        name,
+        Size:        counter.n,
+        ContentType: contentType,
+        ModifiedAt:  time.Now().UTC(),
+        URL:         s.blobClient(container, name).URL(),
+    }
+    if resp.LastModified != nil {
+        info.ModifiedAt = *resp.LastModified
+    }
+    return info, nil
+}
+
+func (s *AzureStorage) Get(ctx context.Context, container, name string) (io.ReadCloser, *ObjectInfo, error) {
+    resp, err := s.client.DownloadStream(ctx, container, name, nil)
+    if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+        return nil, nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to download blob: %w", err)
+    }
+
+    info := s.objectInfo(container, name, resp.ContentLength, resp.ContentType, resp.LastModified)
+    return resp.Body, info, nil
+}
+
+func (s *AzureStorage) Delete(ctx context.Context, container, name string) error {
+    _, err := s.client.DeleteBlob(ctx, container, name, nil)
+    if err != nil && !bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+        return fmt.Errorf("failed to delete blob: %w", err)
+    }
+    return nil
+}
+
+// SignedURL returns a read-only SAS URL for the blob
+func (s *AzureStorage) SignedURL(ctx context.Context, container, name string, expiry time.Duration) (string, error) {
+    signed, err := s.blobClient(container, name).GetSASURL(sas.BlobPermissions{Read: true}, time.Now().Add(expiry), nil)
+    if err != nil {
+        return "", fmt.Errorf("failed to sign blob URL: %w", err)
+    }
+    return signed, nil
+}
+
+func (s *AzureStorage) Stat(ctx context.Context, container, name string) (*ObjectInfo, error) {
+    resp, err := s.blobClient(container, name).GetProperties(ctx, nil)
+    if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get blob properties: %w", err)
+    }
+    return s.objectInfo(container, name, resp.ContentLength, resp.ContentType, resp.LastModified), nil
+}
+
+func (s *AzureStorage) objectInfo(container, name string, size *int64, contentType *string, modifiedAt *time.Time) *ObjectInfo {
+    info := &ObjectInfo{Container: container, Name: name, URL: s.blobClient(container, name).URL()}
+    if size != nil {
+        info.Size = *size
+    }
+    if contentType != nil {
+        info.ContentType = *contentType
+    }
+    if modifiedAt != nil {
+        info.ModifiedAt = *modifiedAt
+    }
+    return info
+}
+
+// requirePrivate fails when container allows anonymous reads. A container that
+// does not exist yet exposes nothing; it is created private by the account default.
+func (s *AzureStorage) requirePrivate(ctx context.Context, container string) error {
+    resp, err := s.client.ServiceClient().NewContainerClient(container).GetAccessPolicy(ctx, nil)
+    if bloberror.HasCode(err, bloberror.ContainerNotFound) {
+        return nil
+    }
+    if err != nil {
+        return fmt.Errorf("failed to read access policy of container %s: %w", container, err)
+    }
+    if resp.BlobPublicAccess != nil {
+        return fmt.Errorf("container %s allows public %s access; set its access level to private", container, *resp.BlobPublicAccess)
+    }
+    return nil
+}
@@ -0,0 +1,280 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// sealedMagic starts every object EncryptedStorage writes
+const sealedMagic = "LUE1"
+
+var ErrUnknownKey = errors.New("object was sealed with an unknown key")
+
+// EncryptedStorage seals objects with envelope encryption before handing them
+// to another backend. Every object gets a fresh AES-256-GCM data key, which is
+// itself encrypted with the active key-encryption key and stored alongside the
+// ciphertext, so rotating the key-encryption key only needs the new kid added
+// and the active id switched. The inner backend only ever sees ciphertext.
+//
+// Sealed objects cannot be handed out by the inner backend's own signed URLs,
+// so SignedURL points at the API, which decrypts on the fly after
+// VerifySignedURL accepts the link.
+type EncryptedStorage struct {
+    inner       Storage
+    activeKeyID string
+    keys        map[string][]byte
+    baseURL     string
+    urlSecret   []byte
+}
+
+// NewEncryptedStorage wraps inner. keys maps key ids to 32-byte
+// key-encryption keys; activeKeyID picks the one new objects are sealed with.
+// baseURL is where the API serves decrypted objects.
+func NewEncryptedStorage(inner Storage, keys map[string][]byte, activeKeyID, baseURL string) (*EncryptedStorage, error) {
+    active, ok := keys[activeKeyID]
+    if !ok {
+        return nil, fmt.Errorf("active key id %q has no matching key", activeKeyID)
+    }
+    if len(activeKeyID) > 255 {
+        return nil, fmt.Errorf("key id %q is too long", activeKeyID)
+    }
+    for kid, key := range keys {
+        if len(key) != 32 {
+            return nil, fmt.Errorf("encryption key %q must be 32 bytes", kid)
+        }
+    }
+
+    // Signed links use a key derived from the active key rather than the key itself
+    mac := hmac.New(sha256.New, active)
+    mac.Write([]byte("signed-url"))
+
+    return &EncryptedStorage{
+        inner:       inner,
+        activeKeyID: activeKeyID,
+        keys:        keys,
+        baseURL:     strings.TrimSuffix(baseURL, "/"),
+        urlSecret:   mac.Sum(nil),
+    }, nil
+}
+
+// Put seals body and stores it. The container and name are bound into the
+// ciphertext, so a sealed object copied to another name fails to open.
+func (s *EncryptedStorage) Put(ctx context.Context, container, name string, body io.Reader, contentType string) (*ObjectInfo, error) {
+    plaintext, err := io.ReadAll(body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read object: %w", err)
+    }
+
+    dataKey := make([]byte, 32)
+    if _, err := rand.Read(dataKey); err != nil {
+        return nil, fmt.Errorf("failed to generate data key: %w", err)
+    }
+
+    wrappedKey, err := seal(s.keys[s.activeKeyID], dataKey, []byte(s.activeKeyID))
+    if err != nil {
+        return nil, fmt.Errorf("failed to wrap data key: %w", err)
+    }
+    ciphertext, err := seal(dataKey, plaintext, []byte(container+"/"+name))
+    if err != nil {
+        return nil, fmt.Errorf("failed to encrypt object: %w", err)
+    }
+
+    // magic | kid length | kid | content type length | content type |
+    // wrapped key length | wrapped key | ciphertext
+    var sealed bytes.Buffer
+    sealed.WriteString(sealedMagic)
+    sealed.WriteByte(byte(len(s.activeKeyID)))
+    sealed.WriteString(s.activeKeyID)
+    binary.Write(&sealed, binary.BigEndian, uint16(len(contentType)))
+    sealed.WriteString(contentType)
+    binary.Write(&sealed, binary.BigEndian, uint16(len(wrappedKey)))
+    sealed.Write(wrappedKey)
+    sealed.Write(ciphertext)
+
+    info, err := s.inner.Put(ctx, container, name, &sealed, "application/octet-stream")
+    if err != nil {
+        return nil, err
+    }
+    info.Size = int64(len(plaintext))
+    info.ContentType = contentType
+    return info, nil
+}
+
+// Get opens a sealed object. The whole object is decrypted in memory before
+// any of it is returned, so a tampered object never yields partial content.
+//
+// Objects uploaded before encryption was turned on are stored in the clear.
+// They are returned as they are and sealed in place, so each legacy object is
+// only ever read unencrypted once.
+func (s *EncryptedStorage) Get(ctx context.Context, container, name string) (io.ReadCloser, *ObjectInfo, error) {
+    body, info, err := s.inner.Get(ctx, container, name)
+    if err != nil {
+        return nil, nil, err
+    }
+    defer body.Close()
+
+    sealed, err := io.ReadAll(body)
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to read sealed object: %w", err)
+    }
+
+    if !bytes.HasPrefix(sealed, []byte(sealedMagic)) {
+        if _, err := s.Put(ctx, container, name, bytes.NewReader(sealed), info.ContentType); err != nil {
+            return nil, nil, fmt.Errorf("failed to seal legacy object: %w", err)
+        }
+        info.Size = int64(len(sealed))
+        return io.NopCloser(bytes.NewReader(sealed)), info, nil
+    }
+
+    plaintext, contentType, err := s.open(container, name, sealed)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    info.Size = int64(len(plaintext))
+    info.ContentType = contentType
+    return io.NopCloser(bytes.NewReader(plaintext)), info, nil
+}
+
+func (s *EncryptedStorage) Delete(ctx context.Context, container, name string) error {
+    return s.inner.Delete(ctx, container, name)
+}
+
+// SignedURL returns a link to the API's decrypting file route
+func (s *EncryptedStorage) SignedURL(ctx context.Context, container, name string, expiry time.Duration) (string, error) {
+    if err := validateName(container, name); err != nil {
+        return "", err
+    }
+
+    expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+    query := url.Values{}
+    query.Set("expires", expires)
+    query.Set("signature", s.sign(container, name, expires))
+    return s.baseURL + "/" + escapeObjectPath(container, name) + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature parameters of a URL issued
+// by SignedURL
+func (s *EncryptedStorage) VerifySignedURL(container, name, expires, signature string) error {
+    unix, err := strconv.ParseInt(expires, 10, 64)
+    if err != nil || time.Now().Unix() > unix {
+        return ErrInvalidSignature
+    }
+    if !hmac.Equal([]byte(signature), []byte(s.sign(container, name, expires))) {
+        return ErrInvalidSignature
+    }
+    return nil
+}
+
+// Stat describes the sealed object as the inner backend stores it; its size
+// includes the encryption overhead
+func (s *EncryptedStorage) Stat(ctx context.Context, container, name string) (*ObjectInfo, error) {
+    return s.inner.Stat(ctx, container, name)
+}
+
+func (s *EncryptedStorage) sign(container, name, expires string) string {
+    mac := hmac.New(sha256.New, s.urlSecret)
+    mac.Write([]byte(container + "\n" + name + "\n" + expires))
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+// open parses and decrypts a sealed object
+func (s *EncryptedStorage) open(container, name string, sealed []byte) ([]byte, string, error) {
+    r := bytes.NewReader(sealed)
+    malformed := fmt.Errorf("sealed object %s/%s is malformed", container, name)
+
+    magic := make([]byte, len(sealedMagic))
+    if _, err := io.ReadFull(r, magic); err != nil || string(magic) != sealedMagic {
+        return nil, "", malformed
+    }
+
+    kidLen, err := r.ReadByte()
+    if err != nil {
+        return nil, "", malformed
+    }
+    kid := make([]byte, kidLen)
+    if _, err := io.ReadFull(r, kid); err != nil {
+        return nil, "", malformed
+    }
+
+    var typeLen uint16
+    if err := binary.Read(r, binary.BigEndian, &typeLen); err != nil {
+        return nil, "", malformed
+    }
+    contentType := make([]byte, typeLen)
+    if _, err := io.ReadFull(r, contentType); err != nil {
+        return nil, "", malformed
+    }
+
+    var wrappedLen uint16
+    if err := binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+        return nil, "", malformed
+    }
+    wrappedKey := make([]byte, wrappedLen)
+    if _, err := io.ReadFull(r, wrappedKey); err != nil {
+        return nil, "", malformed
+    }
+
+    kek, ok := s.keys[string(kid)]
+    if !ok {
+        return nil, "", ErrUnknownKey
+    }
+    dataKey, err := unseal(kek, wrappedKey, kid)
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to unwrap data key: %w", err)
+    }
+
+    ciphertext := sealed[len(sealed)-r.Len():]
+    plaintext, err := unseal(dataKey, ciphertext, []byte(container+"/"+name))
+    if err != nil {
+        return nil, "", fmt.Errorf("failed to decrypt object: %w", err)
+    }
+    return plaintext, string(contentType), nil
+}
+
+// seal encrypts plaintext with AES-GCM, prefixing the random nonce
+func seal(key, plaintext, additionalData []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, err
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := rand.Read(nonce); err != nil {
+        return nil, err
+    }
+    return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// unseal reverses seal
+func unseal(key, sealed, additionalData []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, err
+    }
+    if len(sealed) < gcm.NonceSize() {
+        return nil, errors.New("ciphertext too short")
+    }
+    return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "io"
+    "strings"
+    "testing"
+)
+
+func newTestEncryptedStorage(t *testing.T) (*EncryptedStorage, *LocalStorage) {
+    t.Helper()
+    inner, err := NewLocalStorage(t.TempDir(), "http://localhost:3000/api/files", []byte("secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    s, err := NewEncryptedStorage(inner, map[string][]byte{"2024-10": bytes.Repeat([]byte{7}, 32)}, "2024-10", "http://localhost:3000/api/kyc/files")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s, inner
+}
+
+// readInner returns the bytes the inner backend holds for an object
+func readInner(t *testing.T, inner Storage, name string) []byte {
+    t.Helper()
+    body, _, err := inner.Get(context.Background(), KYCContainer, name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer body.Close()
+    data, err := io.ReadAll(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return data
+}
+
+func TestEncryptedStorageRoundTrip(t *testing.T) {
+    ctx := context.Background()
+    s, inner := newTestEncryptedStorage(t)
+
+    if _, err := s.Put(ctx, KYCContainer, "alice/id.pdf", strings.NewReader("%PDF passport"), "application/pdf"); err != nil {
+        t.Fatal(err)
+    }
+    if stored := readInner(t, inner, "alice/id.pdf"); !bytes.HasPrefix(stored, []byte(sealedMagic)) || bytes.Contains(stored, []byte("passport")) {
+        t.Fatalf("inner backend holds unsealed content: %q", stored)
+    }
+
+    body, info, err := s.Get(ctx, KYCContainer, "alice/id.pdf")
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, _ := io.ReadAll(body)
+    body.Close()
+    if string(data) != "%PDF passport" || info.ContentType != "application/pdf" || info.Size != int64(len(data)) {
+        t.Fatalf("got %q as %+v", data, info)
+    }
+
+    // A sealed object copied to another name does not open
+    copied := readInner(t, inner, "alice/id.pdf")
+    if _, err := inner.Put(ctx, KYCContainer, "bob/id.pdf", bytes.NewReader(copied), ""); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := s.Get(ctx, KYCContainer, "bob/id.pdf"); err == nil {
+        t.Fatal("expected a copied object to fail to open")
+    }
+}
+
+func TestEncryptedStorageSealsLegacyObjects(t *testing.T) {
+    ctx := context.Background()
+    s, inner := newTestEncryptedStorage(t)
+
+    // Uploaded before encryption was turned on
+    if _, err := inner.Put(ctx, KYCContainer, "alice/face.png", strings.NewReader("\x89PNG face"), "image/png"); err != nil {
+        t.Fatal(err)
+    }
+
+    for i := 0; i < 2; i++ {
+        body, info, err := s.Get(ctx, KYCContainer, "alice/face.png")
+        if err != nil {
+            t.Fatal(err)
+        }
+        data, _ := io.ReadAll(body)
+        body.Close()
+        if string(data) != "\x89PNG face" || info.ContentType != "image/png" {
+            t.Fatalf("read %d: got %q as %+v", i, data, info)
+        }
+
+        if stored := readInner(t, inner, "alice/face.png"); !bytes.HasPrefix(stored, []byte(sealedMagic)) {
+            t.Fatalf("read %d: legacy object was not sealed in place: %q", i, stored)
+        }
+    }
+}
@@ -0,0 +1,314 @@
+package storage
+
+import (
+    "bufio"
+    "bytes"
+    "context"
+    "encoding/base32"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math/big"
+    "mime/multipart"
+    "net/http"
+    "net/url"
+    "path"
+    "strings"
+    "time"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// IPFSStorage stores objects on an IPFS node through its HTTP RPC API (the
+// /api/v0 endpoints Kubo serves). Content is addressed by CID: Put pins the
+// object and reports its CID, and Get, Stat, Delete and SignedURL take the CID
+// as the name. Containers are ignored. Everything stored here is public, so it
+// must only be used for media meant to be published.
+type IPFSStorage struct {
+    apiURL     string
+    gatewayURL string
+    apiToken   string
+    client     *http.Client
+}
+
+// ipfsAddResult is one line of the /api/v0/add response
+type ipfsAddResult struct {
+    Name string
+    Hash string
+    Size string
+}
+
+// ipfsError is the body the RPC API returns with a failed call
+type ipfsError struct {
+    Message string
+    Code    int
+}
+
+// NewIPFSStorage talks to the RPC API at apiURL, e.g. http://127.0.0.1:5001.
+// gatewayURL is the HTTP gateway SignedURL links to. apiToken, when set, is
+// sent as a bearer token for nodes behind an authenticating proxy.
+func NewIPFSStorage(apiURL, gatewayURL, apiToken string) (*IPFSStorage, error) {
+    if u, err := url.Parse(apiURL); err != nil || u.Scheme == "" || u.Host == "" {
+        return nil, fmt.Errorf("invalid IPFS API URL %q", apiURL)
+    }
+    return &IPFSStorage{
+        apiURL:     strings.TrimSuffix(apiURL, "/"),
+        gatewayURL: strings.TrimSuffix(gatewayURL, "/"),
+        apiToken:   apiToken,
+        client:     &http.Client{Timeout: 5 * time.Minute},
+    }, nil
+}
+
+// Put adds body to the node as a CIDv1 file and pins it. The CID is first
+// computed without storing anything, and the pinned content must come back
+// under the same CID. The returned info carries the CID, and its URL is the
+// ipfs:// URI of the content.
+func (s *IPFSStorage) Put(ctx context.Context, container, name string, body io.Reader, contentType string) (*ObjectInfo, error) {
+    if err := validateName(container, name); err != nil {
+        return nil, err
+    }
+
+    // The content is sent twice, so it is buffered; uploads are bounded by
+    // the API's request size limit
+    payload, err := io.ReadAll(body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read object: %w", err)
+    }
+
+    expected, err := s.add(ctx, path.Base(name), payload, true)
+    if err != nil {
+        return nil, err
+    }
+    added, err := s.add(ctx, path.Base(name), payload, false)
+    if err != nil {
+        return nil, err
+    }
+    if added.Hash != expected.Hash {
+        return nil, fmt.Errorf("IPFS add returned CID %s, expected %s", added.Hash, expected.Hash)
+    }
+
+    return &ObjectInfo{
+        Container:   container,
+        Name:        name,
+        Size:        int64(len(payload)),
+        ContentType: contentType,
+        ModifiedAt:  time.Now().UTC(),
+        URL:         IPFSURI(added.Hash),
+        CID:         added.Hash,
+    }, nil
+}
+
+// add sends payload to /api/v0/add as a CIDv1 file. With onlyHash the node
+// only computes the CID; otherwise it stores and pins the content.
+func (s *IPFSStorage) add(ctx context.Context, filename string, payload []byte, onlyHash bool) (*ipfsAddResult, error) {
+    var form bytes.Buffer
+    writer := multipart.NewWriter(&form)
+    part, err := writer.CreateFormFile("file", filename)
+    if err != nil {
+        return nil, fmt.Errorf("failed to build IPFS add request: %w", err)
+    }
+    part.Write(payload)
+    if err := writer.Close(); err != nil {
+        return nil, fmt.Errorf("failed to build IPFS add request: %w", err)
+    }
+
+    query := url.Values{}
+    query.Set("cid-version", "1")
+    query.Set("quieter", "true")
+    if onlyHash {
+        query.Set("only-hash", "true")
+        query.Set("pin", "false")
+    } else {
+        query.Set("pin", "true")
+    }
+    resp, err := s.call(ctx, "add", query, &form, writer.FormDataContentType())
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    // The response is one JSON object per added entry; the last one is the file
+    var result ipfsAddResult
+    scanner := bufio.NewScanner(resp.Body)
+    for scanner.Scan() {
+        if line := strings.TrimSpace(scanner.Text()); line != "" {
+            if err := json.Unmarshal([]byte(line), &result); err != nil {
+                return nil, fmt.Errorf("failed to decode IPFS add response: %w", err)
+            }
+        }
+    }
+    if err := scanner.Err(); err != nil {
+        return nil, fmt.Errorf("failed to read IPFS add response: %w", err)
+    }
+    if !IsCID(result.Hash) {
+        return nil, fmt.Errorf("IPFS add returned an invalid CID %q", result.Hash)
+    }
+
+    return &result, nil
+}
+
+// Get reads the content of the CID given as name
+func (s *IPFSStorage) Get(ctx context.Context, container, cid string) (io.ReadCloser, *ObjectInfo, error) {
+    if !IsCID(cid) {
+        return nil, nil, ErrNotFound
+    }
+
+    info, err := s.Stat(ctx, container, cid)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    query := url.Values{}
+    query.Set("arg", cid)
+    resp, err := s.call(ctx, "cat", query, nil, "")
+    if err != nil {
+        return nil, nil, err
+    }
+    return resp.Body, info, nil
+}
+
+// Delete unpins the CID given as name. The node frees the content on its next
+// garbage collection, though other nodes may still hold copies.
+func (s *IPFSStorage) Delete(ctx context.Context, container, cid string) error {
+    if !IsCID(cid) {
+        return nil
+    }
+
+    query := url.Values{}
+    query.Set("arg", cid)
+    resp, err := s.call(ctx, "pin/rm", query, nil, "")
+    if err != nil {
+        if strings.Contains(err.Error(), "not pinned") {
+            return nil
+        }
+        return err
+    }
+    resp.Body.Close()
+    return nil
+}
+
+// SignedURL returns the gateway URL of the CID given as name. IPFS content is
+// public, so the link is not signed and does not expire.
+func (s *IPFSStorage) SignedURL(ctx context.Context, container, cid string, expiry time.Duration) (string, error) {
+    if !IsCID(cid) {
+        return "", ErrInvalidName
+    }
+    return s.gatewayURL + "/ipfs/" + cid, nil
+}
+
+// Stat describes the CID given as name. IPFS does not record content types.
+func (s *IPFSStorage) Stat(ctx context.Context, container, cid string) (*ObjectInfo, error) {
+    if !IsCID(cid) {
+        return nil, ErrNotFound
+    }
+
+    query := url.Values{}
+    query.Set("arg", "/ipfs/"+cid)
+    resp, err := s.call(ctx, "files/stat", query, nil, "")
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+
+    var stat struct {
+        Hash string
+        Size int64
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&stat); err != nil {
+        return nil, fmt.Errorf("failed to decode IPFS stat response: %w", err)
+    }
+
+    return &ObjectInfo{
+        Container:   container,
+        Name:        cid,
+        Size:        stat.Size,
+        ContentType: "application/octet-stream",
+        URL:         IPFSURI(cid),
+        CID:         cid,
+    }, nil
+}
+
+// call POSTs to an RPC endpoint, turning error responses into errors
+func (s *IPFSStorage) call(ctx context.Context, endpoint string, query url.Values, body io.Reader, contentType string) (*http.Response, error) {
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+"/api/v0/"+endpoint+"?"+query.Encode(), body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to build IPFS request: %w", err)
+    }
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+    if s.apiToken != "" {
+        req.Header.Set("Authorization", "Bearer "+s.apiToken)
+    }
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to call IPFS %s: %w", endpoint, err)
+    }
+    if resp.StatusCode == http.StatusOK {
+        return resp, nil
+    }
+    defer resp.Body.Close()
+
+    var rpcErr ipfsError
+    if err := json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&rpcErr); err != nil || rpcErr.Message == "" {
+        return nil, fmt.Errorf("failed to call IPFS %s: %s", endpoint, resp.Status)
+    }
+    return nil, fmt.Errorf("failed to call IPFS %s: %s", endpoint, rpcErr.Message)
+}
+
+// IsCID reports whether s is a CID in one of the two forms IPFS nodes print:
+// a base58 CIDv0 ("Qm...", a bare sha2-256 multihash) or a base32 CIDv1
+// ("b...") whose version, codec and multihash all decode
+func IsCID(s string) bool {
+    if len(s) == 46 && strings.HasPrefix(s, "Qm") {
+        hash, ok := decodeBase58(s)
+        return ok && len(hash) == 34 && hash[0] == 0x12 && hash[1] == 0x20
+    }
+
+    if len(s) < 2 || s[0] != 'b' {
+        return false
+    }
+    raw, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(s[1:]))
+    if err != nil || strings.ToLower(s[1:]) != s[1:] {
+        return false
+    }
+
+    // <version><codec><hash function><digest length><digest>, all but the
+    // digest as unsigned varints
+    var fields [4]uint64
+    for i := range fields {
+        value, n := binary.Uvarint(raw)
+        if n <= 0 {
+            return false
+        }
+        fields[i], raw = value, raw[n:]
+    }
+    return fields[0] == 1 && fields[3] > 0 && uint64(len(raw)) == fields[3]
+}
+
+// decodeBase58 decodes a base58btc string, keeping leading zero bytes
+func decodeBase58(s string) ([]byte, bool) {
+    value := new(big.Int)
+    radix := big.NewInt(58)
+    for _, c := range s {
+        digit := strings.IndexRune(base58Alphabet, c)
+        if digit < 0 {
+            return nil, false
+        }
+        value.Mul(value, radix)
+        value.Add(value, big.NewInt(int64(digit)))
+    }
+
+    zeros := 0
+    for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+        zeros++
+    }
+    return append(make([]byte, zeros), value.Bytes()...), true
+}
+
+// IPFSURI returns the ipfs:// URI of a CID
+func IPFSURI(cid string) string {
+    return "ipfs://" + cid
+}
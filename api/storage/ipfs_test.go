@@ -0,0 +1,149 @@
+package storage
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+const (
+    testCIDv0 = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+    testCIDv1 = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+    otherCID  = "bafkreie7q3iidccmpvszul7kudcvvuavuo7u6gzlbobczuk5nqk3b4akba"
+)
+
+// fakeIPFSNode serves the RPC endpoints IPFSStorage uses. pinnedCID is what
+// a storing add reports, so a node that stores content under another CID
+// than it computed can be simulated.
+type fakeIPFSNode struct {
+    pinnedCID string
+    pinned    map[string]string
+    adds      []string
+}
+
+func (n *fakeIPFSNode) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    query := r.URL.Query()
+    switch r.URL.Path {
+    case "/api/v0/add":
+        if query.Get("cid-version") != "1" {
+            http.Error(w, `{"Message":"expected cid-version=1"}`, http.StatusInternalServerError)
+            return
+        }
+        file, _, err := r.FormFile("file")
+        if err != nil {
+            http.Error(w, `{"Message":"missing file"}`, http.StatusInternalServerError)
+            return
+        }
+        content, _ := io.ReadAll(file)
+
+        if query.Get("only-hash") == "true" {
+            n.adds = append(n.adds, "only-hash")
+            fmt.Fprintf(w, `{"Name":"cover.png","Hash":"%s","Size":"%d"}`+"\n", testCIDv1, len(content))
+            return
+        }
+        if query.Get("pin") != "true" {
+            http.Error(w, `{"Message":"expected pin=true"}`, http.StatusInternalServerError)
+            return
+        }
+        n.adds = append(n.adds, "pin")
+        n.pinned[n.pinnedCID] = string(content)
+        fmt.Fprintf(w, `{"Name":"cover.png","Hash":"%s","Size":"%d"}`+"\n", n.pinnedCID, len(content))
+    case "/api/v0/files/stat":
+        content, ok := n.pinned[strings.TrimPrefix(query.Get("arg"), "/ipfs/")]
+        if !ok {
+            http.Error(w, `{"Message":"not found"}`, http.StatusInternalServerError)
+            return
+        }
+        fmt.Fprintf(w, `{"Hash":"%s","Size":%d}`, query.Get("arg"), len(content))
+    case "/api/v0/cat":
+        io.WriteString(w, n.pinned[query.Get("arg")])
+    default:
+        http.NotFound(w, r)
+    }
+}
+
+func newTestIPFS(t *testing.T, pinnedCID string) (*IPFSStorage, *fakeIPFSNode) {
+    t.Helper()
+    node := &fakeIPFSNode{pinnedCID: pinnedCID, pinned: map[string]string{}}
+    server := httptest.NewServer(node)
+    t.Cleanup(server.Close)
+
+    s, err := NewIPFSStorage(server.URL, "https://gateway.example.com/", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s, node
+}
+
+func TestIPFSPutPinsVerifiedCID(t *testing.T) {
+    ctx := context.Background()
+    s, node := newTestIPFS(t, testCIDv1)
+
+    info, err := s.Put(ctx, "release-request", "alice/cover.png", strings.NewReader("image bytes"), "image/png")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.CID != testCIDv1 || info.URL != "ipfs://"+testCIDv1 || info.Size != int64(len("image bytes")) {
+        t.Fatalf("unexpected object info: %+v", info)
+    }
+    if len(node.adds) != 2 || node.adds[0] != "only-hash" || node.adds[1] != "pin" {
+        t.Fatalf("add calls = %v, want only-hash then pin", node.adds)
+    }
+    if node.pinned[testCIDv1] != "image bytes" {
+        t.Fatalf("pinned content = %q", node.pinned[testCIDv1])
+    }
+
+    body, stat, err := s.Get(ctx, "release-request", info.CID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, _ := io.ReadAll(body)
+    body.Close()
+    if string(data) != "image bytes" || stat.Size != int64(len(data)) {
+        t.Fatalf("got %q (%d bytes)", data, stat.Size)
+    }
+
+    gatewayURL, err := s.SignedURL(ctx, "release-request", info.CID, 0)
+    if err != nil || gatewayURL != "https://gateway.example.com/ipfs/"+testCIDv1 {
+        t.Fatalf("SignedURL = %s, %v", gatewayURL, err)
+    }
+}
+
+func TestIPFSPutRejectsMismatchedCID(t *testing.T) {
+    s, _ := newTestIPFS(t, otherCID)
+
+    _, err := s.Put(context.Background(), "release-request", "alice/cover.png", strings.NewReader("image bytes"), "image/png")
+    if err == nil || !strings.Contains(err.Error(), "expected "+testCIDv1) {
+        t.Fatalf("Put = %v, want a CID mismatch error", err)
+    }
+}
+
+func TestIsCID(t *testing.T) {
+    valid := []string{testCIDv0, testCIDv1, otherCID}
+    for _, cid := range valid {
+        if !IsCID(cid) {
+            t.Errorf("IsCID(%q) = false, want true", cid)
+        }
+    }
+
+    invalid := []string{
+        "",
+        "bananas",
+        "bob/cover.png",
+        "release-request/alice/cover.png",
+        "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbd0",         // 0 is not base58
+        "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdGQm",       // wrong length
+        strings.ToUpper(testCIDv1[:1]) + testCIDv1[1:],           // not the lowercase multibase prefix
+        "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55", // truncated digest
+        "b" + strings.ToUpper(testCIDv1[1:]),                     // base32upper needs the B prefix
+    }
+    for _, cid := range invalid {
+        if IsCID(cid) {
+            t.Errorf("IsCID(%q) = true, want false", cid)
+        }
+    }
+}
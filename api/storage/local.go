@@ -0,0 +1,181 @@
+package storage
+
+import (
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "mime"
+    "net/url"
+    "os"
+    "path"
+    "path/filepath"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var ErrInvalidSignature = errors.New("invalid or expired signed URL")
+
+// LocalStorage keeps objects under a directory on disk, one subdirectory per
+// container. It has no access control of its own: objects are only served
+// through signed URLs checked by VerifySignedURL.
+type LocalStorage struct {
+    root    string
+    baseURL string
+    secret  []byte
+}
+
+// NewLocalStorage stores objects under root. baseURL is where the API serves
+// signed files; secret signs those URLs.
+func NewLocalStorage(root, baseURL string, secret []byte) (*LocalStorage, error) {
+    if err := os.MkdirAll(root, 0o750); err != nil {
+        return nil, fmt.Errorf("failed to create storage directory: %w", err)
+    }
+    return &LocalStorage{root: root, baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+func (s *LocalStorage) path(container, name string) (string, error) {
+    if err := validateName(container, name); err != nil {
+        return "", err
+    }
+    return filepath.Join(s.root, container, filepath.FromSlash(name)), nil
+}
+
+func (s *LocalStorage) Put(ctx context.Context, container, name string, body io.Reader, contentType string) (*ObjectInfo, error) {
+    target, err := s.path(container, name)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+        return nil, fmt.Errorf("failed to create object directory: %w", err)
+    }
+
+    // Write to a temporary file first so a failed upload never leaves a
+    // truncated object behind
+    tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+    if err != nil {
+        return nil, fmt.Errorf("failed to create object file: %w", err)
+    }
+    defer os.Remove(tmp.Name())
+
+    if _, err := io.Copy(tmp, body); err != nil {
+        tmp.Close()
+        return nil, fmt.Errorf("failed to write object: %w", err)
+    }
+    if err := tmp.Close(); err != nil {
+        return nil, fmt.Errorf("failed to write object: %w", err)
+    }
+    if err := os.Rename(tmp.Name(), target); err != nil {
+        return nil, fmt.Errorf("failed to store object: %w", err)
+    }
+
+    return s.Stat(ctx, container, name)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, container, name string) (io.ReadCloser, *ObjectInfo, error) {
+    target, err := s.path(container, name)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    file, err := os.Open(target)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, nil, fmt.Errorf("failed to open object: %w", err)
+    }
+
+    stat, err := file.Stat()
+    if err != nil {
+        file.Close()
+        return nil, nil, fmt.Errorf("failed to stat object: %w", err)
+    }
+    return file, s.objectInfo(container, name, stat), nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, container, name string) error {
+    target, err := s.path(container, name)
+    if err != nil {
+        return err
+    }
+    if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+        return fmt.Errorf("failed to delete object: %w", err)
+    }
+    return nil
+}
+
+// SignedURL returns a URL on the API's file route carrying an expiry and an
+// HMAC over the container, name and expiry
+func (s *LocalStorage) SignedURL(ctx context.Context, container, name string, expiry time.Duration) (string, error) {
+    if err := validateName(container, name); err != nil {
+        return "", err
+    }
+
+    expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+    query := url.Values{}
+    query.Set("expires", expires)
+    query.Set("signature", s.sign(container, name, expires))
+    return s.objectURL(container, name) + "?" + query.Encode(), nil
+}
+
+// VerifySignedURL checks the expires and signature parameters of a URL issued
+// by SignedURL
+func (s *LocalStorage) VerifySignedURL(container, name, expires, signature string) error {
+    unix, err := strconv.ParseInt(expires, 10, 64)
+    if err != nil || time.Now().Unix() > unix {
+        return ErrInvalidSignature
+    }
+    if !hmac.Equal([]byte(signature), []byte(s.sign(container, name, expires))) {
+        return ErrInvalidSignature
+    }
+    return nil
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, container, name string) (*ObjectInfo, error) {
+    target, err := s.path(container, name)
+    if err != nil {
+        return nil, err
+    }
+
+    stat, err := os.Stat(target)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, ErrNotFound
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to stat object: %w", err)
+    }
+    return s.objectInfo(container, name, stat), nil
+}
+
+func (s *LocalStorage) sign(container, name, expires string) string {
+    mac := hmac.New(sha256.New, s.secret)
+    mac.Write([]byte(container + "\n" + name + "\n" + expires))
+    return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *LocalStorage) objectURL(container, name string) string {
+    return s.baseURL + "/" + escapeObjectPath(container, name)
+}
+
+// objectInfo describes a stored file. The content type is not stored, so it is
+// inferred from the name's extension.
+func (s *LocalStorage) objectInfo(container, name string, stat fs.FileInfo) *ObjectInfo {
+    contentType := mime.TypeByExtension(path.Ext(name))
+    if contentType == "" {
+        contentType = "application/octet-stream"
+    }
+    return &ObjectInfo{
+        Container:   container,
+        Name:        name,
+        Size:        stat.Size(),
+        ContentType: contentType,
+        ModifiedAt:  stat.ModTime().UTC(),
+        URL:         s.objectURL(container, name),
+    }
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+    "context"
+    "errors"
+    "io"
+    "net/url"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLocalStorageRoundTrip(t *testing.T) {
+    ctx := context.Background()
+    s, err := NewLocalStorage(t.TempDir(), "http://localhost:3000/api/files/", []byte("secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    info, err := s.Put(ctx, "release-request", "alice/cover.png", strings.NewReader("image bytes"), "image/png")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.Size != int64(len("image bytes")) || info.ContentType != "image/png" {
+        t.Fatalf("unexpected object info: %+v", info)
+    }
+
+    body, got, err := s.Get(ctx, "release-request", "alice/cover.png")
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, err := io.ReadAll(body)
+    body.Close()
+    if err != nil || string(data) != "image bytes" {
+        t.Fatalf("read %q, %v", data, err)
+    }
+    if got.Name != "alice/cover.png" || got.Container != "release-request" {
+        t.Fatalf("unexpected object info: %+v", got)
+    }
+
+    stat, err := s.Stat(ctx, "release-request", "alice/cover.png")
+    if err != nil || stat.Size != info.Size {
+        t.Fatalf("Stat = %+v, %v", stat, err)
+    }
+
+    // The signed URL verifies for this object only, and not once expired
+    signed, err := s.SignedURL(ctx, "release-request", "alice/cover.png", time.Minute)
+    if err != nil {
+        t.Fatal(err)
+    }
+    u, err := url.Parse(signed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.HasPrefix(signed, "http://localhost:3000/api/files/release-request/alice/cover.png?") {
+        t.Fatalf("signed URL = %s", signed)
+    }
+    expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+    if err := s.VerifySignedURL("release-request", "alice/cover.png", expires, signature); err != nil {
+        t.Fatalf("VerifySignedURL: %v", err)
+    }
+    if err := s.VerifySignedURL("release-request", "bob/cover.png", expires, signature); !errors.Is(err, ErrInvalidSignature) {
+        t.Fatalf("signature accepted for another object: %v", err)
+    }
+    if err := s.VerifySignedURL("release-request", "alice/cover.png", "1", signature); !errors.Is(err, ErrInvalidSignature) {
+        t.Fatalf("expired signature accepted: %v", err)
+    }
+
+    if err := s.Delete(ctx, "release-request", "alice/cover.png"); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := s.Get(ctx, "release-request", "alice/cover.png"); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("Get after delete = %v, want ErrNotFound", err)
+    }
+}
+
+func TestLocalStorageRejectsEscapingNames(t *testing.T) {
+    s, err := NewLocalStorage(t.TempDir(), "http://localhost:3000/api/files", []byte("secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := s.Put(context.Background(), "kyc", "../outside.txt", strings.NewReader("x"), ""); !errors.Is(err, ErrInvalidName) {
+        t.Fatalf("Put with an escaping name = %v, want ErrInvalidName", err)
+    }
+}
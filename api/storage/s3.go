@@ -0,0 +1,336 @@
+package storage
+
+import (
+    "bytes"
+    "context"
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    s3Algorithm       = "AWS4-HMAC-SHA256"
+    s3TimeFormat      = "20060102T150405Z"
+    s3DateFormat      = "20060102"
+    s3MaxPresign      = 7 * 24 * time.Hour
+    s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// S3Storage stores objects in one bucket of an S3-compatible service (AWS S3,
+// MinIO, R2, ...). Containers become key prefixes, so "release-request" with
+// name "alice/cover.png" is stored as "release-request/alice/cover.png".
+// Requests are signed with AWS Signature Version 4.
+type S3Storage struct {
+    endpoint  *url.URL
+    region    string
+    bucket    string
+    accessKey string
+    secretKey string
+    pathStyle bool
+    client    *http.Client
+    now       func() time.Time
+}
+
+// NewS3Storage targets bucket at endpoint. pathStyle addresses the bucket as
+// endpoint/bucket instead of bucket.endpoint, which most self-hosted services
+// require.
+func NewS3Storage(endpoint, region, bucket, accessKey, secretKey string, pathStyle bool) (*S3Storage, error) {
+    u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+    if err != nil || u.Scheme == "" || u.Host == "" {
+        return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+    }
+    return &S3Storage{
+        endpoint:  u,
+        region:    region,
+        bucket:    bucket,
+        accessKey: accessKey,
+        secretKey: secretKey,
+        pathStyle: pathStyle,
+        client:    &http.Client{Timeout: 5 * time.Minute},
+        now:       time.Now,
+    }, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, container, name string, body io.Reader, contentType string) (*ObjectInfo, error) {
+    if err := validateName(container, name); err != nil {
+        return nil, err
+    }
+
+    // PutObject needs the length and payload hash up front, so the body is
+    // buffered; uploads are bounded by the API's request size limit
+    payload, err := io.ReadAll(body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read object: %w", err)
+    }
+
+    req, err := s.newRequest(ctx, http.MethodPut, container, name, payload)
+    if err != nil {
+        return nil, err
+    }
+    if contentType != "" {
+        req.Header.Set("Content-Type", contentType)
+    }
+    s.sign(req, payload)
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to upload object: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, s.responseError("upload object", resp)
+    }
+
+    return &ObjectInfo{
+        Container:   container,
+        Name:        name,
+        Size:        int64(len(payload)),
+        ContentType: contentType,
+        ModifiedAt:  time.Now().UTC(),
+        URL:         s.objectURL(container, name).String(),
+    }, nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, container, name string) (io.ReadCloser, *ObjectInfo, error) {
+    resp, err := s.do(ctx, http.MethodGet, container, name)
+    if err != nil {
+        return nil, nil, err
+    }
+    if resp.StatusCode == http.StatusNotFound {
+        resp.Body.Close()
+        return nil, nil, ErrNotFound
+    }
+    if resp.StatusCode != http.StatusOK {
+        defer resp.Body.Close()
+        return nil, nil, s.responseError("download object", resp)
+    }
+    return resp.Body, s.objectInfo(container, name, resp), nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, container, name string) error {
+    resp, err := s.do(ctx, http.MethodDelete, container, name)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+        return s.responseError("delete object", resp)
+    }
+    return nil
+}
+
+// SignedURL returns a presigned GET URL. S3 caps presigned URLs at seven days.
+func (s *S3Storage) SignedURL(ctx context.Context, container, name string, expiry time.Duration) (string, error) {
+    if err := validateName(container, name); err != nil {
+        return "", err
+    }
+    if expiry <= 0 || expiry > s3MaxPresign {
+        return "", fmt.Errorf("signed URL expiry must be between 1s and %s", s3MaxPresign)
+    }
+
+    return s.presign(s.objectURL(container, name), expiry), nil
+}
+
+// presign adds SigV4 query authentication for a GET of u to it
+func (s *S3Storage) presign(u *url.URL, expiry time.Duration) string {
+    now := s.now().UTC()
+    query := url.Values{}
+    query.Set("X-Amz-Algorithm", s3Algorithm)
+    query.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+    query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+    query.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+    query.Set("X-Amz-SignedHeaders", "host")
+    u.RawQuery = canonicalQuery(query)
+
+    canonical := strings.Join([]string{
+        http.MethodGet,
+        u.EscapedPath(),
+        u.RawQuery,
+        "host:" + u.Host + "\n",
+        "host",
+        s3UnsignedPayload,
+    }, "\n")
+    u.RawQuery += "&X-Amz-Signature=" + s.signature(now, canonical)
+    return u.String()
+}
+
+func (s *S3Storage) Stat(ctx context.Context, container, name string) (*ObjectInfo, error) {
+    resp, err := s.do(ctx, http.MethodHead, container, name)
+    if err != nil {
+        return nil, err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode == http.StatusNotFound {
+        return nil, ErrNotFound
+    }
+    if resp.StatusCode != http.StatusOK {
+        return nil, s.responseError("stat object", resp)
+    }
+    return s.objectInfo(container, name, resp), nil
+}
+
+// do sends a signed request without a body
+func (s *S3Storage) do(ctx context.Context, method, container, name string) (*http.Response, error) {
+    if err := validateName(container, name); err != nil {
+        return nil, err
+    }
+    req, err := s.newRequest(ctx, method, container, name, nil)
+    if err != nil {
+        return nil, err
+    }
+    s.sign(req, nil)
+
+    resp, err := s.client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("failed to send S3 request: %w", err)
+    }
+    return resp, nil
+}
+
+func (s *S3Storage) newRequest(ctx context.Context, method, container, name string, payload []byte) (*http.Request, error) {
+    var body io.Reader
+    if payload != nil {
+        body = bytes.NewReader(payload)
+    }
+    req, err := http.NewRequestWithContext(ctx, method, s.objectURL(container, name).String(), body)
+    if err != nil {
+        return nil, fmt.Errorf("failed to build S3 request: %w", err)
+    }
+    return req, nil
+}
+
+// objectURL addresses container/name in the bucket. The path is escaped with
+// S3's rules and set as RawPath so the request carries exactly the path that
+// was signed.
+func (s *S3Storage) objectURL(container, name string) *url.URL {
+    u := *s.endpoint
+    key := container + "/" + name
+    if s.pathStyle {
+        u.Path = u.Path + "/" + s.bucket + "/" + key
+    } else {
+        u.Host = s.bucket + "." + u.Host
+        u.Path = u.Path + "/" + key
+    }
+    u.RawPath = s3EscapePath(u.Path)
+    return &u
+}
+
+// sign adds a Signature Version 4 Authorization header to req
+func (s *S3Storage) sign(req *http.Request, payload []byte) {
+    now := s.now().UTC()
+    payloadHash := sha256.Sum256(payload)
+    req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+    req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+    signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+    headers := "host:" + req.URL.Host + "\n" +
+        "x-amz-content-sha256:" + req.Header.Get("X-Amz-Content-Sha256") + "\n" +
+        "x-amz-date:" + req.Header.Get("X-Amz-Date") + "\n"
+    if contentType := req.Header.Get("Content-Type"); contentType != "" {
+        signed = []string{"content-type", "host", "x-amz-content-sha256", "x-amz-date"}
+        headers = "content-type:" + strings.TrimSpace(contentType) + "\n" + headers
+    }
+
+    canonical := strings.Join([]string{
+        req.Method,
+        req.URL.EscapedPath(),
+        canonicalQuery(req.URL.Query()),
+        headers,
+        strings.Join(signed, ";"),
+        req.Header.Get("X-Amz-Content-Sha256"),
+    }, "\n")
+
+    req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+        s3Algorithm, s.accessKey, s.scope(now), strings.Join(signed, ";"), s.signature(now, canonical)))
+}
+
+func (s *S3Storage) scope(t time.Time) string {
+    return t.Format(s3DateFormat) + "/" + s.region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with the key derived for t's date
+func (s *S3Storage) signature(t time.Time, canonical string) string {
+    canonicalHash := sha256.Sum256([]byte(canonical))
+    stringToSign := s3Algorithm + "\n" + t.Format(s3TimeFormat) + "\n" + s.scope(t) + "\n" + hex.EncodeToString(canonicalHash[:])
+
+    key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format(s3DateFormat))
+    key = hmacSHA256(key, s.region)
+    key = hmacSHA256(key, "s3")
+    key = hmacSHA256(key, "aws4_request")
+    return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s *S3Storage) objectInfo(container, name string, resp *http.Response) *ObjectInfo {
+    info := &ObjectInfo{
+        Container:   container,
+        Name:        name,
+        Size:        resp.ContentLength,
+        ContentType: resp.Header.Get("Content-Type"),
+        URL:         s.objectURL(container, name).String(),
+    }
+    if modifiedAt, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+        info.ModifiedAt = modifiedAt
+    }
+    return info
+}
+
+func (s *S3Storage) responseError(action string, resp *http.Response) error {
+    body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+    return fmt.Errorf("failed to %s: S3 returned %s: %s", action, resp.Status, strings.TrimSpace(string(body)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+    mac := hmac.New(sha256.New, key)
+    mac.Write([]byte(data))
+    return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query parameters sorted by key, as SigV4 requires
+func canonicalQuery(query url.Values) string {
+    keys := make([]string, 0, len(query))
+    for key := range query {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    var pairs []string
+    for _, key := range keys {
+        values := append([]string(nil), query[key]...)
+        sort.Strings(values)
+        for _, value := range values {
+            pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+        }
+    }
+    return strings.Join(pairs, "&")
+}
+
+// s3EscapePath escapes each path segment, keeping the separators
+func s3EscapePath(p string) string {
+    return s3Escape(p, false)
+}
+
+// s3Escape percent-encodes everything except the unreserved characters
+// A-Z a-z 0-9 - _ . ~, and "/" unless encodeSlash is set
+func s3Escape(s string, encodeSlash bool) string {
+    var b strings.Builder
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+            b.WriteByte(c)
+        case c == '/' && !encodeSlash:
+            b.WriteByte(c)
+        default:
+            fmt.Fprintf(&b, "%%%02X", c)
+        }
+    }
+    return b.String()
+}
@@ -0,0 +1,306 @@
+// Package storage keeps uploaded files behind the Storage interface so the
+// upload flows do not depend on one provider. Azure Blob Storage, an S3
+// compatible service or a local directory can be selected from the
+// environment; the local backend needs no credentials, which lets the KYC and
+// release flows run on a development machine. Release media can instead be
+// published to IPFS, where it is addressed by content.
+package storage
+
+import (
+    "context"
+    "crypto/rand"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "io"
+    "net/url"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+)
+
+var (
+    ErrNotFound    = errors.New("object not found")
+    ErrInvalidName = errors.New("invalid object name")
+)
+
+// KYCContainer holds KYC documents. It must not be publicly readable; files in
+// it are only reachable through short-lived signed links.
+const KYCContainer = "kyc-verification-requests"
+
+// ObjectInfo describes a stored object. URL is the object's unsigned address;
+// objects in private containers can only be fetched through SignedURL. CID is
+// set by content-addressed backends only.
+type ObjectInfo struct {
+    Container   string    `json:"container"`
+    Name        string    `json:"name"`
+    Size        int64     `json:"size"`
+    ContentType string    `json:"content_type"`
+    ModifiedAt  time.Time `json:"modified_at"`
+    URL         string    `json:"url"`
+    CID         string    `json:"cid,omitempty"`
+}
+
+// Storage stores objects by container and name. Names may contain "/" to
+// group objects, e.g. "<username>/<file>". Get and Stat return ErrNotFound
+// for a missing object; deleting a missing object is not an error.
+type Storage interface {
+    Put(ctx context.Context, container, name string, body io.Reader, contentType string) (*ObjectInfo, error)
+    Get(ctx context.Context, container, name string) (io.ReadCloser, *ObjectInfo, error)
+    Delete(ctx context.Context, container, name string) error
+    SignedURL(ctx context.Context, container, name string, expiry time.Duration) (string, error)
+    Stat(ctx context.Context, container, name string) (*ObjectInfo, error)
+}
+
+// ServedStorage is a backend whose signed URLs point at the API itself. The
+// API checks such a link with VerifySignedURL and serves the object with Get.
+type ServedStorage interface {
+    Storage
+    VerifySignedURL(container, name, expires, signature string) error
+}
+
+// Config selects and configures the storage backends
+type Config struct {
+    // Backend is "azure", "s3" or "local"
+    Backend string
+    // MediaBackend stores public release media: "ipfs", or the same
+    // backend as everything else when empty
+    MediaBackend string
+
+    AzureConnectionString string
+
+    S3Endpoint        string
+    S3Region          string
+    S3Bucket          string
+    S3AccessKeyID     string
+    S3SecretAccessKey string
+    S3PathStyle       bool
+
+    LocalDir    string
+    LocalURL    string
+    LocalSecret []byte
+
+    IPFSAPIURL     string
+    IPFSGatewayURL string
+    IPFSAPIToken   string
+
+    // KYCEncryptionKeys turns on envelope encryption of KYC documents when
+    // set; KYCFilesURL is where the API serves them decrypted
+    KYCEncryptionKeys  map[string][]byte
+    KYCEncryptionKeyID string
+    KYCFilesURL        string
+}
+
+// LoadConfig reads storage configuration from the environment. STORAGE_BACKEND
+// picks the backend; when it is unset Azure is used if
+// AZURE_BLOB_CONNECTION_STRING is set and the local directory otherwise.
+func LoadConfig() (Config, error) {
+    config := Config{
+        Backend:               os.Getenv("STORAGE_BACKEND"),
+        AzureConnectionString: os.Getenv("AZURE_BLOB_CONNECTION_STRING"),
+        S3Endpoint:            os.Getenv("S3_ENDPOINT"),
+        S3Region:              os.Getenv("S3_REGION"),
+        S3Bucket:              os.Getenv("S3_BUCKET"),
+        S3AccessKeyID:         os.Getenv("S3_ACCESS_KEY_ID"),
+        S3SecretAccessKey:     os.Getenv("S3_SECRET_ACCESS_KEY"),
+        LocalDir:              os.Getenv("LOCAL_STORAGE_DIR"),
+        LocalURL:              os.Getenv("LOCAL_STORAGE_URL"),
+        LocalSecret:           []byte(os.Getenv("LOCAL_STORAGE_SECRET")),
+        MediaBackend:          os.Getenv("MEDIA_STORAGE_BACKEND"),
+        IPFSAPIURL:            os.Getenv("IPFS_API_URL"),
+        IPFSGatewayURL:        os.Getenv("IPFS_GATEWAY_URL"),
+        IPFSAPIToken:          os.Getenv("IPFS_API_TOKEN"),
+        KYCEncryptionKeyID:    os.Getenv("KYC_ENCRYPTION_KEY_ID"),
+        KYCFilesURL:           os.Getenv("KYC_FILES_URL"),
+    }
+
+    if config.Backend == "" {
+        config.Backend = "local"
+        if config.AzureConnectionString != "" {
+            config.Backend = "azure"
+        }
+    }
+
+    switch config.Backend {
+    case "azure":
+        if config.AzureConnectionString == "" {
+            return config, fmt.Errorf("AZURE_BLOB_CONNECTION_STRING is required for the azure storage backend")
+        }
+
+    case "s3":
+        if config.S3Bucket == "" || config.S3AccessKeyID == "" || config.S3SecretAccessKey == "" {
+            return config, fmt.Errorf("S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required for the s3 storage backend")
+        }
+        if config.S3Region == "" {
+            config.S3Region = "us-east-1"
+        }
+        if config.S3Endpoint == "" {
+            config.S3Endpoint = "https://s3." + config.S3Region + ".amazonaws.com"
+        }
+        if pathStyle := os.Getenv("S3_PATH_STYLE"); pathStyle != "" {
+            v, err := strconv.ParseBool(pathStyle)
+            if err != nil {
+                return config, fmt.Errorf("S3_PATH_STYLE must be true or false")
+            }
+            config.S3PathStyle = v
+        }
+
+    case "local":
+        if config.LocalDir == "" {
+            config.LocalDir = "data/uploads"
+        }
+        if config.LocalURL == "" {
+            config.LocalURL = "http://localhost:3000/api/files"
+        }
+        // Without a configured secret signed URLs stop working on restart,
+        // which is acceptable for local development
+        if len(config.LocalSecret) == 0 {
+            config.LocalSecret = make([]byte, 32)
+            if _, err := rand.Read(config.LocalSecret); err != nil {
+                return config, fmt.Errorf("failed to generate local storage secret: %w", err)
+            }
+        }
+
+    case "ipfs":
+        // KYC documents go through Backend, and anything on IPFS is public
+        return config, fmt.Errorf("STORAGE_BACKEND cannot be ipfs; set MEDIA_STORAGE_BACKEND=ipfs to publish release media")
+
+    default:
+        return config, fmt.Errorf("STORAGE_BACKEND must be azure, s3 or local")
+    }
+
+    switch config.MediaBackend {
+    case "":
+    case "ipfs":
+        if config.IPFSAPIURL == "" {
+            config.IPFSAPIURL = "http://127.0.0.1:5001"
+        }
+        if config.IPFSGatewayURL == "" {
+            config.IPFSGatewayURL = "https://ipfs.io"
+        }
+    default:
+        return config, fmt.Errorf("MEDIA_STORAGE_BACKEND must be ipfs or unset")
+    }
+
+    // KYC_ENCRYPTION_KEYS="2024-10:<base64 key>,2024-11:<base64 key>", rotated
+    // like JWT_KEYS: add a kid, point KYC_ENCRYPTION_KEY_ID at it, and keep old
+    // kids for as long as documents sealed with them are kept
+    if rawKeys := os.Getenv("KYC_ENCRYPTION_KEYS"); rawKeys != "" {
+        config.KYCEncryptionKeys = map[string][]byte{}
+        for _, entry := range strings.Split(rawKeys, ",") {
+            kid, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+            if !found || kid == "" || encoded == "" {
+                return config, fmt.Errorf("malformed KYC_ENCRYPTION_KEYS entry, expected kid:base64-key")
+            }
+            key, err := base64.StdEncoding.DecodeString(encoded)
+            if err != nil || len(key) != 32 {
+                return config, fmt.Errorf("KYC encryption key %q must be 32 bytes of base64", kid)
+            }
+            config.KYCEncryptionKeys[kid] = key
+        }
+        if config.KYCFilesURL == "" {
+            config.KYCFilesURL = "http://localhost:3000/api/kyc/files"
+        }
+    }
+
+    return config, nil
+}
+
+// New returns the backend config selects
+func New(config Config) (Storage, error) {
+    switch config.Backend {
+    case "azure":
+        return NewAzureStorage(config.AzureConnectionString)
+    case "s3":
+        return NewS3Storage(config.S3Endpoint, config.S3Region, config.S3Bucket, config.S3AccessKeyID, config.S3SecretAccessKey, config.S3PathStyle)
+    case "local":
+        return NewLocalStorage(config.LocalDir, config.LocalURL, config.LocalSecret)
+    }
+    return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+}
+
+// NewMedia returns the backend for release media, which is primary unless
+// config selects a separate media backend
+func NewMedia(config Config, primary Storage) (Storage, error) {
+    if config.MediaBackend == "ipfs" {
+        return NewIPFSStorage(config.IPFSAPIURL, config.IPFSGatewayURL, config.IPFSAPIToken)
+    }
+    return primary, nil
+}
+
+// NewKYC returns the backend for KYC documents: primary, sealed with envelope
+// encryption when config has encryption keys. It refuses a backend that
+// reports KYCContainer as publicly readable.
+func NewKYC(config Config, primary Storage) (Storage, error) {
+    if checker, ok := primary.(interface {
+        requirePrivate(ctx context.Context, container string) error
+    }); ok {
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+        defer cancel()
+        if err := checker.requirePrivate(ctx, KYCContainer); err != nil {
+            return nil, err
+        }
+    }
+
+    if len(config.KYCEncryptionKeys) == 0 {
+        return primary, nil
+    }
+    return NewEncryptedStorage(primary, config.KYCEncryptionKeys, config.KYCEncryptionKeyID, config.KYCFilesURL)
+}
+
+// validateName rejects names that could escape their container on backends
+// that map names to paths
+func validateName(container, name string) error {
+    if container == "" || strings.ContainsAny(container, "/\\") || container == "." || container == ".." {
+        return ErrInvalidName
+    }
+    if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+        return ErrInvalidName
+    }
+    for _, part := range strings.Split(name, "/") {
+        if part == "" || part == "." || part == ".." {
+            return ErrInvalidName
+        }
+    }
+    return nil
+}
+
+// escapeObjectPath escapes container and name for use in a URL path
+func escapeObjectPath(container, name string) string {
+    parts := strings.Split(name, "/")
+    for i, part := range parts {
+        parts[i] = url.PathEscape(part)
+    }
+    return url.PathEscape(container) + "/" + strings.Join(parts, "/")
+}
+
+// countingReader counts the bytes read through it, for backends whose upload
+// call does not report the stored size
+type countingReader struct {
+    r io.Reader
+    n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+    n, err := c.r.Read(p)
+    c.n += int64(n)
+    return n, err
+}
+
+// ObjectNameFromURL recovers the name of an object in container from the
+// unsigned URL its backend reported. Every backend addresses objects as
+// ".../<container>/<name>", so older records that kept only the URL can
+// still be read through Get.
+func ObjectNameFromURL(rawURL, container string) (string, bool) {
+    u, err := url.Parse(rawURL)
+    if err != nil {
+        return "", false
+    }
+    prefix := "/" + container + "/"
+    i := strings.Index(u.Path, prefix)
+    if i < 0 || i+len(prefix) == len(u.Path) {
+        return "", false
+    }
+    return u.Path[i+len(prefix):], true
+}
@@ -0,0 +1,269 @@
+package uploads
+
+import (
+    "bytes"
+    "encoding/binary"
+    "fmt"
+    "image"
+    "image/gif"
+    "image/jpeg"
+    "image/png"
+
+    "golang.org/x/image/draw"
+    "golang.org/x/image/webp"
+)
+
+const (
+    thumbnailSize = 320
+    webSize       = 1280
+    // maxPixels refuses images that would take too much memory to decode
+    maxPixels = 50_000_000
+)
+
+// decodedImage is an image with its metadata removed
+type decodedImage struct {
+    img  image.Image
+    data []byte
+}
+
+// cleanImage decodes data and returns it without embedded metadata. JPEG,
+// PNG and GIF are re-encoded, which drops EXIF, GPS, XMP and text chunks;
+// a JPEG's EXIF orientation is applied to the pixels first so the photo
+// still displays upright. WebP cannot be re-encoded with the standard
+// library, so its metadata chunks are cut out of the container instead.
+func cleanImage(data []byte, contentType string) (*decodedImage, error) {
+    var config image.Config
+    var err error
+    switch contentType {
+    case "image/jpeg":
+        config, err = jpeg.DecodeConfig(bytes.NewReader(data))
+    case "image/png":
+        config, err = png.DecodeConfig(bytes.NewReader(data))
+    case "image/gif":
+        config, err = gif.DecodeConfig(bytes.NewReader(data))
+    case "image/webp":
+        config, err = webp.DecodeConfig(bytes.NewReader(data))
+    default:
+        return nil, ErrUnsupportedType
+    }
+    if err != nil {
+        return nil, ErrInvalidImage
+    }
+    if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+        return nil, fmt.Errorf("%w: dimensions are out of range", ErrInvalidImage)
+    }
+
+    var out bytes.Buffer
+    var img image.Image
+    switch contentType {
+    case "image/jpeg":
+        if img, err = jpeg.Decode(bytes.NewReader(data)); err != nil {
+            return nil, ErrInvalidImage
+        }
+        img = orient(img, jpegOrientation(data))
+        err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 92})
+
+    case "image/png":
+        if img, err = png.Decode(bytes.NewReader(data)); err != nil {
+            return nil, ErrInvalidImage
+        }
+        err = png.Encode(&out, img)
+
+    case "image/gif":
+        animation, decodeErr := gif.DecodeAll(bytes.NewReader(data))
+        if decodeErr != nil || len(animation.Image) == 0 {
+            return nil, ErrInvalidImage
+        }
+        img = animation.Image[0]
+        err = gif.EncodeAll(&out, animation)
+
+    case "image/webp":
+        if img, err = webp.Decode(bytes.NewReader(data)); err != nil {
+            return nil, ErrInvalidImage
+        }
+        var stripped []byte
+        if stripped, err = stripWebPMetadata(data); err == nil {
+            out.Write(stripped)
+        }
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to clean image: %w", err)
+    }
+
+    return &decodedImage{img: img, data: out.Bytes()}, nil
+}
+
+// encodeVariant scales img to fit within maxSide (never enlarging it) and
+// encodes it for the web: JPEG when the image is opaque, PNG otherwise
+func encodeVariant(img image.Image, maxSide int) ([]byte, string, error) {
+    bounds := img.Bounds()
+    width, height := bounds.Dx(), bounds.Dy()
+    if width > maxSide || height > maxSide {
+        if width >= height {
+            height = max(1, height*maxSide/width)
+            width = maxSide
+        } else {
+            width = max(1, width*maxSide/height)
+            height = maxSide
+        }
+    }
+
+    dst := image.NewRGBA(image.Rect(0, 0, width, height))
+    draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+
+    var out bytes.Buffer
+    if dst.Opaque() {
+        if err := jpeg.Encode(&out, dst, &jpeg.Options{Quality: 82}); err != nil {
+            return nil, "", fmt.Errorf("failed to encode image variant: %w", err)
+        }
+        return out.Bytes(), "image/jpeg", nil
+    }
+    if err := png.Encode(&out, dst); err != nil {
+        return nil, "", fmt.Errorf("failed to encode image variant: %w", err)
+    }
+    return out.Bytes(), "image/png", nil
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG's APP1
+// segment, returning 1 (upright) when there is none
+func jpegOrientation(data []byte) int {
+    if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+        return 1
+    }
+
+    for i := 2; i+4 <= len(data); {
+        if data[i] != 0xFF {
+            return 1
+        }
+        marker := data[i+1]
+        if marker == 0xDA || marker == 0xD9 {
+            // Start of scan or end of image: no more metadata segments
+            return 1
+        }
+        length := int(binary.BigEndian.Uint16(data[i+2:]))
+        if length < 2 || i+2+length > len(data) {
+            return 1
+        }
+        segment := data[i+4 : i+2+length]
+        if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+            return exifOrientation(segment[6:])
+        }
+        i += 2 + length
+    }
+    return 1
+}
+
+// exifOrientation finds tag 0x0112 in IFD0 of a TIFF-structured EXIF block
+func exifOrientation(tiff []byte) int {
+    if len(tiff) < 8 {
+        return 1
+    }
+    var order binary.ByteOrder
+    switch string(tiff[:2]) {
+    case "II":
+        order = binary.LittleEndian
+    case "MM":
+        order = binary.BigEndian
+    default:
+        return 1
+    }
+
+    ifd := int(order.Uint32(tiff[4:]))
+    if ifd+2 > len(tiff) {
+        return 1
+    }
+    entries := int(order.Uint16(tiff[ifd:]))
+    for n := 0; n < entries; n++ {
+        entry := ifd + 2 + n*12
+        if entry+12 > len(tiff) {
+            return 1
+        }
+        if order.Uint16(tiff[entry:]) == 0x0112 {
+            if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+                return v
+            }
+            return 1
+        }
+    }
+    return 1
+}
+
+// orient redraws img so that an image stored with EXIF orientation o
+// displays upright without it
+func orient(img image.Image, o int) image.Image {
+    if o <= 1 || o > 8 {
+        return img
+    }
+
+    b := img.Bounds()
+    w, h := b.Dx(), b.Dy()
+    // Orientations 5-8 swap width and height
+    dw, dh := w, h
+    if o >= 5 {
+        dw, dh = h, w
+    }
+    dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            var dx, dy int
+            switch o {
+            case 2:
+                dx, dy = w-1-x, y
+            case 3:
+                dx, dy = w-1-x, h-1-y
+            case 4:
+                dx, dy = x, h-1-y
+            case 5:
+                dx, dy = y, x
+            case 6:
+                dx, dy = h-1-y, x
+            case 7:
+                dx, dy = h-1-y, w-1-x
+            case 8:
+                dx, dy = y, w-1-x
+            }
+            dst.Set(dx, dy, img.At(b.Min.X+x, b.Min.Y+y))
+        }
+    }
+    return dst
+}
+
+// stripWebPMetadata drops the EXIF and XMP chunks from a WebP file and clears
+// the VP8X flags that announce them
+func stripWebPMetadata(data []byte) ([]byte, error) {
+    if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+        return nil, ErrInvalidImage
+    }
+
+    out := make([]byte, 12, len(data))
+    copy(out, data[:12])
+    for i := 12; i < len(data); {
+        if i+8 > len(data) {
+            return nil, ErrInvalidImage
+        }
+        fourCC := string(data[i : i+4])
+        size := int(binary.LittleEndian.Uint32(data[i+4:]))
+        end := i + 8 + size + size%2 // chunks are padded to an even length
+        if size < 0 || end > len(data) {
+            return nil, ErrInvalidImage
+        }
+
+        switch fourCC {
+        case "EXIF", "XMP ":
+        case "VP8X":
+            chunk := append([]byte(nil), data[i:end]...)
+            if len(chunk) > 8 {
+                // Bit 3 is EXIF, bit 2 is XMP
+                chunk[8] &^= 0x08 | 0x04
+            }
+            out = append(out, chunk...)
+        default:
+            out = append(out, data[i:end]...)
+        }
+        i = end
+    }
+
+    binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+    return out, nil
+}
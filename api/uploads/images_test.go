@@ -0,0 +1,182 @@
+package uploads
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "image"
+    "image/color"
+    "image/jpeg"
+    "testing"
+)
+
+// exifTIFF is a big-endian EXIF block with orientation o and a GPS IFD
+// holding a latitude reference
+func exifTIFF(o int) []byte {
+    tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+    tiff = append(tiff, 0x00, 0x02)
+    tiff = append(tiff, 0x01, 0x12, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x00, byte(o), 0x00, 0x00)
+    tiff = append(tiff, 0x88, 0x25, 0x00, 0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x26)
+    tiff = append(tiff, 0x00, 0x00, 0x00, 0x00)
+    // GPS IFD at offset 38
+    tiff = append(tiff, 0x00, 0x01)
+    tiff = append(tiff, 0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x02, 'N', 0x00, 0x00, 0x00)
+    return append(tiff, 0x00, 0x00, 0x00, 0x00)
+}
+
+// exifJPEG returns a w×h JPEG whose APP1 segment carries exifTIFF(o)
+func exifJPEG(t *testing.T, w, h, o int) []byte {
+    t.Helper()
+    img := image.NewRGBA(image.Rect(0, 0, w, h))
+    for y := 0; y < h; y++ {
+        for x := 0; x < w; x++ {
+            img.Set(x, y, color.RGBA{R: uint8(40 * x), G: uint8(40 * y), B: 200, A: 255})
+        }
+    }
+    var encoded bytes.Buffer
+    if err := jpeg.Encode(&encoded, img, nil); err != nil {
+        t.Fatal(err)
+    }
+
+    payload := append([]byte("Exif\x00\x00"), exifTIFF(o)...)
+    app1 := []byte{0xFF, 0xE1, 0, 0}
+    binary.BigEndian.PutUint16(app1[2:], uint16(2+len(payload)))
+    app1 = append(app1, payload...)
+
+    data := append([]byte{}, encoded.Bytes()[:2]...)
+    data = append(data, app1...)
+    return append(data, encoded.Bytes()[2:]...)
+}
+
+// jpegMarkers lists the segment markers before a JPEG's image data
+func jpegMarkers(data []byte) []byte {
+    var markers []byte
+    for i := 2; i+4 <= len(data) && data[i] == 0xFF && data[i+1] != 0xDA; {
+        markers = append(markers, data[i+1])
+        i += 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+    }
+    return markers
+}
+
+func TestCleanImageStripsJPEGMetadata(t *testing.T) {
+    tests := []struct {
+        orientation   int
+        width, height int
+    }{
+        {1, 4, 2},
+        {3, 4, 2},
+        {6, 2, 4},
+        {8, 2, 4},
+    }
+    for _, tt := range tests {
+        data := exifJPEG(t, 4, 2, tt.orientation)
+        if got := jpegOrientation(data); got != tt.orientation {
+            t.Fatalf("orientation %d read as %d", tt.orientation, got)
+        }
+
+        decoded, err := cleanImage(data, "image/jpeg")
+        if err != nil {
+            t.Fatalf("orientation %d: %v", tt.orientation, err)
+        }
+        if bytes.IndexByte(jpegMarkers(decoded.data), 0xE1) >= 0 || bytes.Contains(decoded.data, []byte("Exif")) {
+            t.Fatalf("orientation %d: cleaned JPEG still has an APP1 segment", tt.orientation)
+        }
+        config, err := jpeg.DecodeConfig(bytes.NewReader(decoded.data))
+        if err != nil {
+            t.Fatal(err)
+        }
+        if config.Width != tt.width || config.Height != tt.height {
+            t.Fatalf("orientation %d: cleaned image is %dx%d, want %dx%d", tt.orientation, config.Width, config.Height, tt.width, tt.height)
+        }
+    }
+}
+
+// webpChunk encodes one RIFF chunk, padded to an even length
+func webpChunk(fourCC string, payload []byte) []byte {
+    chunk := append([]byte(fourCC), 0, 0, 0, 0)
+    binary.LittleEndian.PutUint32(chunk[4:], uint32(len(payload)))
+    chunk = append(chunk, payload...)
+    if len(payload)%2 == 1 {
+        chunk = append(chunk, 0)
+    }
+    return chunk
+}
+
+func webpFile(chunks ...[]byte) []byte {
+    data := []byte("RIFF\x00\x00\x00\x00WEBP")
+    for _, chunk := range chunks {
+        data = append(data, chunk...)
+    }
+    binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+    return data
+}
+
+func TestStripWebPMetadata(t *testing.T) {
+    // Alpha, EXIF and XMP flags set
+    vp8x := make([]byte, 10)
+    vp8x[0] = 0x10 | 0x08 | 0x04
+    lossless := []byte{0x2f, 0x00, 0x00, 0x00, 0x00}
+    data := webpFile(
+        webpChunk("VP8X", vp8x),
+        webpChunk("VP8L", lossless),
+        webpChunk("EXIF", exifTIFF(6)),
+        webpChunk("XMP ", []byte("<x:xmpmeta>GPS</x:xmpmeta>")),
+    )
+
+    stripped, err := stripWebPMetadata(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := webpFile(webpChunk("VP8X", append([]byte{0x10}, vp8x[1:]...)), webpChunk("VP8L", lossless))
+    if !bytes.Equal(stripped, want) {
+        t.Fatalf("stripped WebP = %x, want %x", stripped, want)
+    }
+}
+
+func TestMalformedImagesDoNotPanic(t *testing.T) {
+    soi := []byte{0xFF, 0xD8}
+    for _, data := range [][]byte{
+        nil,
+        soi,
+        append(soi, 0xFF, 0xE1, 0xFF, 0xFF, 'E'),
+        append(soi, 0xFF, 0xE1, 0x00, 0x01),
+        append(soi, 0xFF, 0xE1, 0x00, 0x0C, 'E', 'x', 'i', 'f', 0, 0, 'M', 'M', 0, 0x2a),
+        append(soi, 0x00, 0xE1, 0x00, 0x04),
+    } {
+        if got := jpegOrientation(data); got != 1 {
+            t.Fatalf("jpegOrientation(%x) = %d, want 1", data, got)
+        }
+    }
+
+    for _, tiff := range [][]byte{
+        []byte("MM\x00\x2a\xff\xff\xff\xff"),
+        []byte("II\x2a\x00\x08\x00\x00\x00\xff\xff"),
+        []byte("XX\x00\x2a\x00\x00\x00\x08"),
+        exifTIFF(6)[:20],
+    } {
+        if got := exifOrientation(tiff); got != 1 {
+            t.Fatalf("exifOrientation(%x) = %d, want 1", tiff, got)
+        }
+    }
+
+    oversized := webpFile(webpChunk("VP8L", []byte{0x2f}))
+    binary.LittleEndian.PutUint32(oversized[16:], 0xFFFFFFFF)
+    for _, data := range [][]byte{
+        []byte("RIFF"),
+        []byte("RIFF\x00\x00\x00\x00WEBPVP8"),
+        oversized,
+        webpFile(webpChunk("EXIF", exifTIFF(1)))[:30],
+    } {
+        if _, err := stripWebPMetadata(data); !errors.Is(err, ErrInvalidImage) {
+            t.Fatalf("stripWebPMetadata(%x) error = %v, want ErrInvalidImage", data, err)
+        }
+    }
+
+    // Every truncation of a valid JPEG fails cleanly
+    data := exifJPEG(t, 4, 2, 6)
+    for n := 0; n < len(data)-2; n++ {
+        if _, err := cleanImage(data[:n], "image/jpeg"); err == nil {
+            t.Fatalf("JPEG truncated to %d bytes was accepted", n)
+        }
+    }
+}
@@ -0,0 +1,214 @@
+// Package uploads checks and prepares user files before they reach storage.
+// Every upload is held to the limits of its purpose, typed by sniffing its
+// content rather than trusting the client, stripped of embedded metadata
+// when it is an image, and stored under a generated name so uploads can
+// neither overwrite each other nor escape their folder.
+package uploads
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "io"
+    "log"
+    "mime/multipart"
+    "net/http"
+    "path"
+    "strings"
+
+    "shellhacks/api/storage"
+)
+
+// MaxRequestSize bounds a whole multipart request; it must fit the largest
+// policy plus the other form fields
+const MaxRequestSize = 64 << 20
+
+var (
+    ErrTooLarge        = errors.New("file is too large")
+    ErrUnsupportedType = errors.New("file type is not allowed")
+    ErrInvalidImage    = errors.New("image could not be read")
+)
+
+// Policy is what an upload for one purpose may contain
+type Policy struct {
+    MaxSize int64
+    // Types are the allowed sniffed content types
+    Types []string
+    // Variants asks for a thumbnail and a web-sized copy of images
+    Variants bool
+}
+
+var (
+    // KYCDocument is an identity document: a photo or a scanned PDF
+    KYCDocument = Policy{MaxSize: 10 << 20, Types: []string{"image/jpeg", "image/png", "application/pdf"}}
+    // KYCFaceImage is a photo of the person being verified
+    KYCFaceImage = Policy{MaxSize: 10 << 20, Types: []string{"image/jpeg", "image/png"}}
+    // ReleaseMedia is the artwork or clip a release is minted with
+    ReleaseMedia = Policy{
+        MaxSize:  50 << 20,
+        Types:    []string{"image/jpeg", "image/png", "image/gif", "image/webp", "video/mp4", "video/webm"},
+        Variants: true,
+    }
+)
+
+// extensions names stored files after their sniffed type, never the client's
+var extensions = map[string]string{
+    "image/jpeg":      ".jpg",
+    "image/png":       ".png",
+    "image/gif":       ".gif",
+    "image/webp":      ".webp",
+    "application/pdf": ".pdf",
+    "video/mp4":       ".mp4",
+    "video/webm":      ".webm",
+}
+
+// Upload is a stored file and, for images under a Variants policy, its
+// resized copies
+type Upload struct {
+    ContentType string
+    Original    *storage.ObjectInfo
+    Thumbnail   *storage.ObjectInfo
+    Web         *storage.ObjectInfo
+}
+
+// Save validates file against policy and stores it in container under
+// owner's folder. Images are re-encoded without their metadata; other files
+// are stored unchanged.
+func Save(ctx context.Context, store storage.Storage, container, owner string, file *multipart.FileHeader, policy Policy) (*Upload, error) {
+    if file.Size > policy.MaxSize {
+        return nil, fmt.Errorf("%w: the limit is %d MB", ErrTooLarge, policy.MaxSize>>20)
+    }
+
+    stream, err := file.Open()
+    if err != nil {
+        return nil, fmt.Errorf("failed to open upload: %w", err)
+    }
+    defer stream.Close()
+
+    // The declared size comes from the client, so the read is capped as well
+    data, err := io.ReadAll(io.LimitReader(stream, policy.MaxSize+1))
+    if err != nil {
+        return nil, fmt.Errorf("failed to read upload: %w", err)
+    }
+    if int64(len(data)) > policy.MaxSize {
+        return nil, fmt.Errorf("%w: the limit is %d MB", ErrTooLarge, policy.MaxSize>>20)
+    }
+
+    contentType := http.DetectContentType(data)
+    if !policy.allows(contentType) {
+        return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+    }
+
+    upload := &Upload{ContentType: contentType}
+    base, err := objectBase(owner, file.Filename)
+    if err != nil {
+        return nil, err
+    }
+
+    var decoded *decodedImage
+    if strings.HasPrefix(contentType, "image/") {
+        decoded, err = cleanImage(data, contentType)
+        if err != nil {
+            return nil, err
+        }
+        data = decoded.data
+    }
+
+    upload.Original, err = store.Put(ctx, container, base+extensions[contentType], bytes.NewReader(data), contentType)
+    if err != nil {
+        return nil, err
+    }
+
+    if decoded == nil || !policy.Variants {
+        return upload, nil
+    }
+
+    for _, variant := range []struct {
+        suffix  string
+        maxSide int
+        target  **storage.ObjectInfo
+    }{
+        {"-thumb", thumbnailSize, &upload.Thumbnail},
+        {"-web", webSize, &upload.Web},
+    } {
+        resized, variantType, err := encodeVariant(decoded.img, variant.maxSide)
+        if err == nil {
+            *variant.target, err = store.Put(ctx, container, base+variant.suffix+extensions[variantType], bytes.NewReader(resized), variantType)
+        }
+        if err != nil {
+            // Nothing will reference a partial upload, so remove what was stored
+            upload.remove(ctx, store)
+            return nil, err
+        }
+    }
+
+    return upload, nil
+}
+
+// remove deletes every stored object of an upload, logging failures since
+// the caller is already handling an error
+func (u *Upload) remove(ctx context.Context, store storage.Storage) {
+    for _, info := range []*storage.ObjectInfo{u.Original, u.Thumbnail, u.Web} {
+        if info == nil {
+            continue
+        }
+        name := info.Name
+        if info.CID != "" {
+            name = info.CID
+        }
+        if err := store.Delete(ctx, info.Container, name); err != nil {
+            log.Printf("Error removing partial upload %s/%s: %v", info.Container, name, err)
+        }
+    }
+}
+
+func (p Policy) allows(contentType string) bool {
+    for _, allowed := range p.Types {
+        if allowed == contentType {
+            return true
+        }
+    }
+    return false
+}
+
+// objectBase returns "<owner>/<random id>-<clean name>" without an extension.
+// The random id keeps two uploads of the same file name apart.
+func objectBase(owner, filename string) (string, error) {
+    id := make([]byte, 12)
+    if _, err := rand.Read(id); err != nil {
+        return "", fmt.Errorf("failed to generate upload name: %w", err)
+    }
+
+    stem := path.Base(strings.ReplaceAll(filename, "\\", "/"))
+    stem = strings.TrimSuffix(stem, path.Ext(stem))
+    return sanitize(owner, "user") + "/" + hex.EncodeToString(id) + "-" + sanitize(stem, "file"), nil
+}
+
+// sanitize reduces s to lowercase letters, digits, '-' and '_', at most 48
+// characters, falling back when nothing is left
+func sanitize(s, fallback string) string {
+    var b strings.Builder
+    dash := false
+    for _, r := range strings.ToLower(s) {
+        switch {
+        case 'a' <= r && r <= 'z', '0' <= r && r <= '9', r == '_':
+            b.WriteRune(r)
+            dash = false
+        case !dash && b.Len() > 0:
+            b.WriteByte('-')
+            dash = true
+        }
+        if b.Len() >= 48 {
+            break
+        }
+    }
+
+    clean := strings.Trim(b.String(), "-_")
+    if clean == "" {
+        return fallback
+    }
+    return clean
+}
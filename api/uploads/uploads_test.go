@@ -0,0 +1,112 @@
+package uploads
+
+import (
+    "bytes"
+    "context"
+    "errors"
+    "image"
+    "image/png"
+    "mime/multipart"
+    "strings"
+    "testing"
+
+    "shellhacks/api/storage"
+)
+
+// fileHeader wraps data as an uploaded form file called filename
+func fileHeader(t *testing.T, filename string, data []byte) *multipart.FileHeader {
+    t.Helper()
+    var body bytes.Buffer
+    writer := multipart.NewWriter(&body)
+    part, err := writer.CreateFormFile("file", "upload")
+    if err != nil {
+        t.Fatal(err)
+    }
+    part.Write(data)
+    writer.Close()
+
+    form, err := multipart.NewReader(&body, writer.Boundary()).ReadForm(1 << 20)
+    if err != nil {
+        t.Fatal(err)
+    }
+    file := form.File["file"][0]
+    // The multipart reader already drops directories; Save must not rely on it
+    file.Filename = filename
+    return file
+}
+
+func TestObjectBase(t *testing.T) {
+    tests := []struct {
+        owner, filename string
+        prefix, suffix  string
+    }{
+        {"alice", "passport.png", "alice/", "-passport"},
+        {"alice", "../../x.png", "alice/", "-x"},
+        {"alice", `..\..\windows\x.png`, "alice/", "-x"},
+        {"alice", "/etc/passwd", "alice/", "-passwd"},
+        {"alice", "..", "alice/", "-file"},
+        {"../bob", "x.png", "bob/", "-x"},
+        {"", "Ünïcode Name!.PNG", "user/", "-n-code-name"},
+    }
+    for _, tt := range tests {
+        base, err := objectBase(tt.owner, tt.filename)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !strings.HasPrefix(base, tt.prefix) || !strings.HasSuffix(base, tt.suffix) {
+            t.Errorf("objectBase(%q, %q) = %q, want %q...%q", tt.owner, tt.filename, base, tt.prefix, tt.suffix)
+        }
+        if strings.Contains(base, "..") || strings.Count(base, "/") != 1 {
+            t.Errorf("objectBase(%q, %q) = %q escapes the owner's folder", tt.owner, tt.filename, base)
+        }
+    }
+
+    if got := sanitize(strings.Repeat("a", 100), "file"); len(got) > 48 {
+        t.Errorf("sanitize kept %d characters", len(got))
+    }
+}
+
+func TestSave(t *testing.T) {
+    ctx := context.Background()
+    store, err := storage.NewLocalStorage(t.TempDir(), "http://localhost:3000/api/files", []byte("secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    var photo bytes.Buffer
+    if err := png.Encode(&photo, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name     string
+        filename string
+        data     []byte
+        policy   Policy
+        err      error
+    }{
+        {"photo", "face.png", photo.Bytes(), KYCFaceImage, nil},
+        {"traversing name", "../../x.png", photo.Bytes(), KYCFaceImage, nil},
+        {"pdf named as an image", "face.png", []byte("%PDF-1.4\n%test"), KYCFaceImage, ErrUnsupportedType},
+        {"html named as an image", "art.png", []byte("<html><script>alert(1)</script></html>"), ReleaseMedia, ErrUnsupportedType},
+        {"too large", "face.png", photo.Bytes(), Policy{MaxSize: 8, Types: []string{"image/png"}}, ErrTooLarge},
+        {"corrupt image", "face.png", photo.Bytes()[:40], KYCFaceImage, ErrInvalidImage},
+    }
+    for _, tt := range tests {
+        upload, err := Save(ctx, store, "kyc", "alice", fileHeader(t, tt.filename, tt.data), tt.policy)
+        if tt.err != nil {
+            if !errors.Is(err, tt.err) {
+                t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+            }
+            continue
+        }
+        if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+            continue
+        }
+        name := upload.Original.Name
+        if upload.ContentType != "image/png" || !strings.HasPrefix(name, "alice/") || strings.Contains(name, "..") || !strings.HasSuffix(name, ".png") {
+            t.Errorf("%s: stored as %q (%s)", tt.name, name, upload.ContentType)
+        }
+    }
+}
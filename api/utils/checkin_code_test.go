@@ -0,0 +1,61 @@
+package utils
+
+import (
+    "encoding/base64"
+    "errors"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseCheckInCode(t *testing.T) {
+    secretA, secretB := []byte("event-a-secret"), []byte("event-b-secret")
+    expires := time.Now().Add(time.Hour).Unix()
+
+    code, claims, err := SignCheckInCode(secretA, CheckInClaims{EventID: 1, ExpiresAt: expires, Wallet: "0xABC"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    parsed, err := ParseCheckInCode(secretA, 1, " "+code+"\n")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if *parsed != claims || parsed.Wallet != "0xabc" || parsed.Nonce == "" {
+        t.Fatalf("parsed %+v, want %+v", parsed, claims)
+    }
+
+    // The payload is edited to another event while the MAC is kept
+    encoded, signature, _ := strings.Cut(strings.TrimPrefix(code, checkInCodePrefix), ".")
+    payload, _ := base64.RawURLEncoding.DecodeString(encoded)
+    swapped := strings.Replace(string(payload), `"e":1`, `"e":2`, 1)
+    forged := checkInCodePrefix + base64.RawURLEncoding.EncodeToString([]byte(swapped)) + "." + signature
+    mac, _ := base64.RawURLEncoding.DecodeString(signature)
+    mac[0] ^= 1
+    tampered := checkInCodePrefix + encoded + "." + base64.RawURLEncoding.EncodeToString(mac)
+
+    expired, _, err := SignCheckInCode(secretA, CheckInClaims{EventID: 1, ExpiresAt: time.Now().Add(-time.Minute).Unix()})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name    string
+        secret  []byte
+        eventID int
+        code    string
+        err     error
+    }{
+        {"other event's secret", secretB, 2, code, ErrInvalidCheckInCode},
+        {"other event id", secretA, 2, code, ErrInvalidCheckInCode},
+        {"forged payload", secretA, 2, forged, ErrInvalidCheckInCode},
+        {"tampered signature", secretA, 1, tampered, ErrInvalidCheckInCode},
+        {"no signature", secretA, 1, checkInCodePrefix + encoded, ErrInvalidCheckInCode},
+        {"garbage", secretA, 1, "not a code", ErrInvalidCheckInCode},
+        {"expired", secretA, 1, expired, ErrExpiredCheckInCode},
+    }
+    for _, tt := range tests {
+        if _, err := ParseCheckInCode(tt.secret, tt.eventID, tt.code); !errors.Is(err, tt.err) {
+            t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+        }
+    }
+}
@@ -5,10 +5,11 @@ import (
     "time"
 )
 
-func GenerateVerificationLink(userID string) (string, error) {
-    token, err := GenerateToken(userID, time.Hour*24) // Token valid for 1 day
+// GenerateVerificationLink builds the link emailed to new accounts
+func GenerateVerificationLink(tokens *TokenService, username string) (string, error) {
+    token, _, err := tokens.Issue(username, "", PurposeEmailVerification, time.Hour*24) // Token valid for 1 day
     if err != nil {
         return "", err
     }
-    return fmt.Sprintf("http://localhost:3000/api/verify?token=%s", token), nil
+    return fmt.Sprintf("http://localhost:3000/api/verify_email?token=%s", token), nil
 }
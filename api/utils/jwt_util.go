@@ -1,48 +1,221 @@
 package utils
 
 import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
     "errors"
+    "fmt"
+    "os"
+    "strings"
     "time"
 
     "github.com/golang-jwt/jwt/v4"
+    "github.com/google/uuid"
 )
 
-var secretKey = []byte("your_secret_key") // Make sure to replace with your actual secret key
+// Token purposes. Every token carries exactly one, so a token minted for one
+// flow (e.g. email verification) can never be replayed against another.
+const (
+    PurposeAccess            = "access"
+    PurposeEmailVerification = "email_verification"
+    PurposePasswordReset     = "password_reset"
+)
+
+// minKeyLength is the shortest HMAC secret accepted for HS256 signing
+const minKeyLength = 32
+
+var (
+    ErrInvalidToken = errors.New("invalid token")
+    ErrUnknownKeyID = errors.New("unknown signing key id")
+    ErrWrongPurpose = errors.New("token issued for a different purpose")
+)
 
+// Claims are the typed claims carried by every token the API issues.
+// The username lives in the registered "sub" claim and the token ID in "jti".
 type Claims struct {
-    Username string `json:"username"`
+    Role    string `json:"role,omitempty"`
+    Purpose string `json:"purpose"`
+    // SessionID ties an access token to its refresh-token family so the
+    // session can be revoked server-side before the token expires
+    SessionID string `json:"sid,omitempty"`
     jwt.RegisteredClaims
 }
 
-// GenerateToken generates a JWT token for a given username and duration
-func GenerateToken(username string, duration time.Duration) (string, error) {
+// Username returns the account the token was issued for
+func (c *Claims) Username() string {
+    return c.Subject
+}
+
+// TokenConfig holds the key material and identity used to sign tokens
+type TokenConfig struct {
+    Issuer      string
+    Audience    string
+    ActiveKeyID string
+    // Keys maps key IDs to HMAC secrets. Every key verifies; only ActiveKeyID signs.
+    Keys map[string][]byte
+}
+
+// LoadTokenConfig reads token configuration from the environment:
+//
+//     JWT_KEYS="2024-10:first-secret,2024-11:second-secret"
+//     JWT_ACTIVE_KEY_ID="2024-11"
+//     JWT_ISSUER / JWT_AUDIENCE (optional)
+//
+// Rotating keys means adding a new kid to JWT_KEYS, switching JWT_ACTIVE_KEY_ID
+// to it, and removing the old kid once its tokens have expired.
+func LoadTokenConfig() (TokenConfig, error) {
+    config := TokenConfig{
+        Issuer:      os.Getenv("JWT_ISSUER"),
+        Audience:    os.Getenv("JWT_AUDIENCE"),
+        ActiveKeyID: os.Getenv("JWT_ACTIVE_KEY_ID"),
+        Keys:        map[string][]byte{},
+    }
+    if config.Issuer == "" {
+        config.Issuer = "levelup-api"
+    }
+    if config.Audience == "" {
+        config.Audience = "levelup-app"
+    }
+
+    rawKeys := os.Getenv("JWT_KEYS")
+    if rawKeys == "" {
+        return config, fmt.Errorf("JWT_KEYS is not set")
+    }
+
+    for _, entry := range strings.Split(rawKeys, ",") {
+        kid, secret, found := strings.Cut(strings.TrimSpace(entry), ":")
+        if !found || kid == "" || secret == "" {
+            return config, fmt.Errorf("malformed JWT_KEYS entry %q, expected kid:secret", entry)
+        }
+        config.Keys[kid] = []byte(secret)
+    }
+
+    return config, nil
+}
+
+// TokenService signs and verifies every JWT the API hands out
+type TokenService struct {
+    issuer      string
+    audience    string
+    activeKeyID string
+    keys        map[string][]byte
+}
+
+// NewTokenService validates the configuration and builds a TokenService
+func NewTokenService(config TokenConfig) (*TokenService, error) {
+    if len(config.Keys) == 0 {
+        return nil, fmt.Errorf("at least one signing key is required")
+    }
+
+    if _, ok := config.Keys[config.ActiveKeyID]; !ok {
+        return nil, fmt.Errorf("active key id %q has no matching key", config.ActiveKeyID)
+    }
+
+    keys := make(map[string][]byte, len(config.Keys))
+    for kid, secret := range config.Keys {
+        if len(secret) < minKeyLength {
+            return nil, fmt.Errorf("signing key %q must be at least %d bytes", kid, minKeyLength)
+        }
+        keys[kid] = secret
+    }
+
+    return &TokenService{
+        issuer:      config.Issuer,
+        audience:    config.Audience,
+        activeKeyID: config.ActiveKeyID,
+        keys:        keys,
+    }, nil
+}
+
+// Issue signs a token for username with the active key
+func (s *TokenService) Issue(username, role, purpose string, duration time.Duration) (string, *Claims, error) {
+    return s.issue(username, role, purpose, "", duration)
+}
+
+// IssueAccess signs an access token bound to the session sessionID
+func (s *TokenService) IssueAccess(username, role, sessionID string, duration time.Duration) (string, *Claims, error) {
+    return s.issue(username, role, PurposeAccess, sessionID, duration)
+}
+
+func (s *TokenService) issue(username, role, purpose, sessionID string, duration time.Duration) (string, *Claims, error) {
+    now := time.Now()
     claims := &Claims{
-        Username: username,
+        Role:      role,
+        Purpose:   purpose,
+        SessionID: sessionID,
         RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(duration)),
+            Subject:   username,
+            Issuer:    s.issuer,
+            Audience:  jwt.ClaimStrings{s.audience},
+            ID:        uuid.NewString(),
+            IssuedAt:  jwt.NewNumericDate(now),
+            NotBefore: jwt.NewNumericDate(now),
+            ExpiresAt: jwt.NewNumericDate(now.Add(duration)),
         },
     }
+
     token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString(secretKey)
+    token.Header["kid"] = s.activeKeyID
+
+    signed, err := token.SignedString(s.keys[s.activeKeyID])
+    if err != nil {
+        return "", nil, fmt.Errorf("failed to sign token: %w", err)
+    }
+
+    return signed, claims, nil
 }
 
-// ParseToken parses a JWT token and returns the claims if valid
-func ParseToken(tokenStr string) (*Claims, error) {
+// Parse verifies tokenStr against any configured key and checks that it was
+// issued by this service, for this audience, for the expected purpose
+func (s *TokenService) Parse(tokenStr, purpose string) (*Claims, error) {
     token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, errors.New("unexpected signing method")
+        if token.Method != jwt.SigningMethodHS256 {
+            return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
         }
-        return secretKey, nil
-    })
 
+        kid, _ := token.Header["kid"].(string)
+        secret, ok := s.keys[kid]
+        if !ok {
+            return nil, ErrUnknownKeyID
+        }
+        return secret, nil
+    })
     if err != nil {
         return nil, err
     }
 
     claims, ok := token.Claims.(*Claims)
     if !ok || !token.Valid {
-        return nil, errors.New("invalid token")
+        return nil, ErrInvalidToken
+    }
+
+    if !claims.VerifyIssuer(s.issuer, true) || !claims.VerifyAudience(s.audience, true) || claims.Subject == "" {
+        return nil, ErrInvalidToken
+    }
+
+    if claims.Purpose != purpose {
+        return nil, ErrWrongPurpose
     }
 
     return claims, nil
 }
+
+// GenerateRefreshToken returns a random opaque refresh token and the hash
+// that is stored server-side; the raw token is never persisted
+func GenerateRefreshToken() (string, string, error) {
+    raw := make([]byte, 32)
+    if _, err := rand.Read(raw); err != nil {
+        return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
+    }
+
+    token := base64.RawURLEncoding.EncodeToString(raw)
+    return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the value refresh tokens are looked up by
+func HashRefreshToken(token string) string {
+    sum := sha256.Sum256([]byte(token))
+    return hex.EncodeToString(sum[:])
+}
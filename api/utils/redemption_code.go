@@ -0,0 +1,49 @@
+package utils
+
+import (
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "strings"
+)
+
+// redemptionAlphabet leaves out characters that are easy to misread aloud or
+// on a phone screen (0/O, 1/I/L, U)
+const redemptionAlphabet = "ABCDEFGHJKMNPQRSTVWXYZ23456789"
+
+// GenerateRedemptionCode returns a one-time code in the form XXXXX-XXXXX and
+// the hash that is stored server-side; like refresh tokens, the raw code is
+// never persisted
+func GenerateRedemptionCode() (string, string, error) {
+    // Bytes at or above the largest multiple of the alphabet size are
+    // discarded so every character is equally likely
+    limit := byte(256 - 256%len(redemptionAlphabet))
+    var code strings.Builder
+    buf := make([]byte, 16)
+    for written := 0; written < 10; {
+        if _, err := rand.Read(buf); err != nil {
+            return "", "", fmt.Errorf("failed to generate redemption code: %w", err)
+        }
+        for _, b := range buf {
+            if b >= limit || written == 10 {
+                continue
+            }
+            if written == 5 {
+                code.WriteByte('-')
+            }
+            code.WriteByte(redemptionAlphabet[int(b)%len(redemptionAlphabet)])
+            written++
+        }
+    }
+
+    return code.String(), HashRedemptionCode(code.String()), nil
+}
+
+// HashRedemptionCode returns the value redemption codes are looked up by.
+// Case, spaces and dashes are ignored so staff can type codes loosely.
+func HashRedemptionCode(code string) string {
+    normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+    sum := sha256.Sum256([]byte(normalized))
+    return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "math/big"
+    "os"
+    "strconv"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/accounts"
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/common/hexutil"
+    "github.com/ethereum/go-ethereum/crypto"
+)
+
+// siweNonceAlphabet is the alphanumeric set EIP-4361 allows in a nonce
+const siweNonceAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+var (
+    ErrInvalidAddress   = errors.New("invalid wallet address")
+    ErrAddressChecksum  = errors.New("wallet address checksum does not match")
+    ErrInvalidSignature = errors.New("invalid wallet signature")
+)
+
+// SIWEConfig is how the API identifies itself in Sign-In with Ethereum
+// messages. Wallets show the domain to the user and warn when it does not
+// match the site asking for the signature.
+type SIWEConfig struct {
+    Domain    string
+    URI       string
+    ChainID   int64
+    Statement string
+}
+
+// LoadSIWEConfig reads SIWE_DOMAIN and SIWE_URI from the environment, falling
+// back to a local development frontend. The chain ID follows ETH_CHAIN_ID.
+func LoadSIWEConfig() (SIWEConfig, error) {
+    config := SIWEConfig{
+        Domain:    os.Getenv("SIWE_DOMAIN"),
+        URI:       os.Getenv("SIWE_URI"),
+        ChainID:   1,
+        Statement: "Link this wallet to your Level-Up account.",
+    }
+    if config.Domain == "" {
+        config.Domain = "localhost:5173"
+    }
+    if config.URI == "" {
+        config.URI = "http://" + config.Domain
+    }
+
+    if chainID := os.Getenv("ETH_CHAIN_ID"); chainID != "" {
+        n, err := strconv.ParseInt(chainID, 10, 64)
+        if err != nil {
+            return config, fmt.Errorf("ETH_CHAIN_ID must be a decimal chain id")
+        }
+        config.ChainID = n
+    }
+
+    return config, nil
+}
+
+// SIWEMessage is an EIP-4361 Sign-In with Ethereum message
+type SIWEMessage struct {
+    Domain         string
+    Address        common.Address
+    Statement      string
+    URI            string
+    ChainID        int64
+    Nonce          string
+    IssuedAt       time.Time
+    ExpirationTime time.Time
+}
+
+// NewSIWEMessage builds the message a wallet is asked to sign to prove it
+// controls address
+func (config SIWEConfig) NewSIWEMessage(address common.Address, nonce string, ttl time.Duration) SIWEMessage {
+    issuedAt := time.Now().UTC().Truncate(time.Second)
+    return SIWEMessage{
+        Domain:         config.Domain,
+        Address:        address,
+        Statement:      config.Statement,
+        URI:            config.URI,
+        ChainID:        config.ChainID,
+        Nonce:          nonce,
+        IssuedAt:       issuedAt,
+        ExpirationTime: issuedAt.Add(ttl),
+    }
+}
+
+// String renders the message in the EIP-4361 text format. The address is
+// written in its EIP-55 checksummed form, as the spec requires.
+func (m SIWEMessage) String() string {
+    var b strings.Builder
+    fmt.Fprintf(&b, "%s wants you to sign in with your Ethereum account:\n%s\n\n", m.Domain, m.Address.Hex())
+    if m.Statement != "" {
+        fmt.Fprintf(&b, "%s\n\n", m.Statement)
+    }
+    fmt.Fprintf(&b, "URI: %s\n", m.URI)
+    fmt.Fprintf(&b, "Version: 1\n")
+    fmt.Fprintf(&b, "Chain ID: %d\n", m.ChainID)
+    fmt.Fprintf(&b, "Nonce: %s\n", m.Nonce)
+    fmt.Fprintf(&b, "Issued At: %s\n", m.IssuedAt.Format(time.RFC3339))
+    fmt.Fprintf(&b, "Expiration Time: %s", m.ExpirationTime.Format(time.RFC3339))
+    return b.String()
+}
+
+// GenerateSIWENonce returns a random 17-character alphanumeric nonce
+func GenerateSIWENonce() (string, error) {
+    var nonce strings.Builder
+    max := big.NewInt(int64(len(siweNonceAlphabet)))
+    for i := 0; i < 17; i++ {
+        n, err := rand.Int(rand.Reader, max)
+        if err != nil {
+            return "", fmt.Errorf("failed to generate nonce: %w", err)
+        }
+        nonce.WriteByte(siweNonceAlphabet[n.Int64()])
+    }
+    return nonce.String(), nil
+}
+
+// ParseWalletAddress validates a 0x-prefixed address. All-lowercase and
+// all-uppercase addresses carry no checksum and are accepted as is; a
+// mixed-case address must match its EIP-55 checksum.
+func ParseWalletAddress(address string) (common.Address, error) {
+    if !strings.HasPrefix(address, "0x") || !common.IsHexAddress(address) {
+        return common.Address{}, ErrInvalidAddress
+    }
+
+    digits := address[2:]
+    if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+        return common.HexToAddress(address), nil
+    }
+
+    mixed, err := common.NewMixedcaseAddressFromString(address)
+    if err != nil {
+        return common.Address{}, ErrInvalidAddress
+    }
+    if !mixed.ValidChecksum() {
+        return common.Address{}, ErrAddressChecksum
+    }
+    return mixed.Address(), nil
+}
+
+// RecoverPersonalSign returns the address that produced a personal_sign
+// (EIP-191) signature over message
+func RecoverPersonalSign(message, signature string) (common.Address, error) {
+    sig, err := hexutil.Decode(signature)
+    if err != nil || len(sig) != crypto.SignatureLength {
+        return common.Address{}, ErrInvalidSignature
+    }
+
+    // Wallets return the recovery id as 27/28; go-ethereum expects 0/1
+    if sig[crypto.RecoveryIDOffset] >= 27 {
+        sig[crypto.RecoveryIDOffset] -= 27
+    }
+    if sig[crypto.RecoveryIDOffset] > 1 {
+        return common.Address{}, ErrInvalidSignature
+    }
+
+    publicKey, err := crypto.SigToPub(accounts.TextHash([]byte(message)), sig)
+    if err != nil {
+        return common.Address{}, ErrInvalidSignature
+    }
+    return crypto.PubkeyToAddress(*publicKey), nil
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+    "errors"
+    "testing"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Hardhat's first development account signing personalSignMessage
+const (
+    personalSignMessage   = "Hello, Level-Up!"
+    personalSignAddress   = "0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"
+    personalSignSignature = "0xca5deb6ee2b625615cf763d8467c73b3c9f5e0e7870d34c8bf3129922c2f2082" +
+        "4054c714c254990fe21c0436921ad07e5cdfa16860e5c115c1f6784489c678aa1c"
+)
+
+func TestRecoverPersonalSign(t *testing.T) {
+    want := common.HexToAddress(personalSignAddress)
+
+    // Wallets send v as 27/28, some libraries as 0/1
+    sig := hexutil.MustDecode(personalSignSignature)
+    sig[64] -= 27
+    for _, signature := range []string{personalSignSignature, hexutil.Encode(sig)} {
+        got, err := RecoverPersonalSign(personalSignMessage, signature)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if got != want {
+            t.Fatalf("recovered %s, want %s", got.Hex(), want.Hex())
+        }
+    }
+
+    // A tampered message recovers some other key
+    got, err := RecoverPersonalSign(personalSignMessage+" ", personalSignSignature)
+    if err == nil && got == want {
+        t.Fatal("a tampered message recovered the signer")
+    }
+
+    sig[64] = 29
+    for _, signature := range []string{hexutil.Encode(sig), personalSignSignature[:130], "0xzz", ""} {
+        if _, err := RecoverPersonalSign(personalSignMessage, signature); !errors.Is(err, ErrInvalidSignature) {
+            t.Fatalf("RecoverPersonalSign(%q) error = %v, want ErrInvalidSignature", signature, err)
+        }
+    }
+}
+
+func TestParseWalletAddress(t *testing.T) {
+    want := common.HexToAddress(personalSignAddress)
+    tests := []struct {
+        address string
+        err     error
+    }{
+        {personalSignAddress, nil},
+        {"0xf39fd6e51aad88f6f4ce6ab8827279cfffb92266", nil},
+        {"0xF39FD6E51AAD88F6F4CE6AB8827279CFFFB92266", nil},
+        {"0xF39Fd6e51aad88F6F4ce6aB8827279cffFb92266", ErrAddressChecksum},
+        {"0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92267", ErrAddressChecksum},
+        {"f39fd6e51aad88f6f4ce6ab8827279cfffb92266", ErrInvalidAddress},
+        {"0xf39fd6e51aad88f6f4ce6ab8827279cfffb922", ErrInvalidAddress},
+        {"0xg39fd6e51aad88f6f4ce6ab8827279cfffb92266", ErrInvalidAddress},
+    }
+    for _, tt := range tests {
+        got, err := ParseWalletAddress(tt.address)
+        if !errors.Is(err, tt.err) {
+            t.Errorf("ParseWalletAddress(%q) error = %v, want %v", tt.address, err, tt.err)
+            continue
+        }
+        if tt.err == nil && got != want {
+            t.Errorf("ParseWalletAddress(%q) = %s", tt.address, got.Hex())
+        }
+    }
+}
@@ -0,0 +1,17 @@
+package utils
+
+// TokenMetadata is ERC-721 metadata in the shape OpenSea and most wallets read
+type TokenMetadata struct {
+    Name        string           `json:"name"`
+    Description string           `json:"description"`
+    Image       string           `json:"image"`
+    ExternalURL string           `json:"external_url,omitempty"`
+    Attributes  []TokenAttribute `json:"attributes"`
+}
+
+// TokenAttribute is a single trait shown alongside a token
+type TokenAttribute struct {
+    TraitType   string      `json:"trait_type"`
+    Value       interface{} `json:"value"`
+    DisplayType string      `json:"display_type,omitempty"`
+}
@@ -0,0 +1,184 @@
+package workers
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math/big"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/nftdatabase"
+)
+
+const (
+    levelUpBatchSize   = 20
+    levelUpLease       = 2 * time.Minute
+    levelUpMaxAttempts = 8
+)
+
+// LevelUpQueue is the level_up_queue bookkeeping the level-up worker relies
+// on; *nftdatabase.NFTDatabase implements it
+type LevelUpQueue interface {
+    ClaimLevelUps(limit int, lease time.Duration) ([]nftdatabase.LevelUpRequest, error)
+    RecordLevelUpSubmission(requestID int, txHash string, rawTx []byte) error
+    ScheduleLevelUpCheck(requestID int, delay time.Duration) error
+    RetryLevelUp(requestID int, levelErr error, delay time.Duration, resetTx bool, maxAttempts int) error
+    CompleteLevelUp(request nftdatabase.LevelUpRequest, blockNumber *uint64) error
+}
+
+// LevelUpWorker applies the level-ups the engagement rules queue. Tokens of
+// the configured LevelUpNFT contract are raised on-chain with
+// incrementTokenLevel, one level per transaction, and only move in the
+// database once that transaction is confirmed. Everything else, or everything
+// when no leveler is configured, is recorded off-chain straight away.
+type LevelUpWorker struct {
+    queue         LevelUpQueue
+    leveler       chain.Leveler
+    confirmations uint64
+}
+
+// NewLevelUpWorker creates a level-up worker. leveler may be nil, in which
+// case every level-up is recorded off-chain.
+func NewLevelUpWorker(queue LevelUpQueue, leveler chain.Leveler, confirmations uint64) *LevelUpWorker {
+    return &LevelUpWorker{
+        queue:         queue,
+        leveler:       leveler,
+        confirmations: confirmations,
+    }
+}
+
+// Run processes batches every interval until ctx is cancelled
+func (w *LevelUpWorker) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if _, err := w.ProcessBatch(ctx); err != nil {
+                log.Printf("Error processing level-ups: %v", err)
+            }
+        }
+    }
+}
+
+// ProcessBatch claims due level-ups and moves each one forward a single step
+func (w *LevelUpWorker) ProcessBatch(ctx context.Context) (int, error) {
+    requests, err := w.queue.ClaimLevelUps(levelUpBatchSize, levelUpLease)
+    if err != nil {
+        return 0, err
+    }
+
+    for _, request := range requests {
+        switch {
+        case !w.onChain(request):
+            w.complete(request, nil)
+        case request.TxHash == nil:
+            w.submit(ctx, request)
+        default:
+            w.confirm(ctx, request)
+        }
+    }
+
+    return len(requests), nil
+}
+
+// onChain reports whether a level-up is applied through the LevelUpNFT contract
+func (w *LevelUpWorker) onChain(request nftdatabase.LevelUpRequest) bool {
+    return w.leveler != nil && strings.EqualFold(request.ContractAddress, w.leveler.ContractAddress().Hex())
+}
+
+// submit builds the incrementTokenLevel transaction and hands it to the
+// shared submission path. A token already at the target level on-chain is
+// completed without one, so a lost or reset transaction never raises the
+// level twice.
+func (w *LevelUpWorker) submit(ctx context.Context, request nftdatabase.LevelUpRequest) {
+    tokenID, ok := new(big.Int).SetString(request.TokenID, 10)
+    if !ok {
+        w.retry(request, fmt.Errorf("token id %q is not a number", request.TokenID), false)
+        return
+    }
+
+    level, err := w.leveler.TokenLevel(ctx, tokenID)
+    if err != nil {
+        w.retry(request, err, false)
+        return
+    }
+    if level >= uint64(request.ToLevel) {
+        head, err := w.leveler.BlockNumber(ctx)
+        if err != nil {
+            w.retry(request, err, false)
+            return
+        }
+        w.complete(request, &head)
+        return
+    }
+
+    tx, err := w.leveler.BuildIncrement(ctx, tokenID)
+    if err != nil {
+        w.retry(request, err, false)
+        return
+    }
+
+    job := w.job(request)
+    job.record = func(txHash string, rawTx []byte) error {
+        return w.queue.RecordLevelUpSubmission(request.RequestID, txHash, rawTx)
+    }
+    job.submit(ctx, tx)
+}
+
+// confirm checks a submitted transaction and completes the level-up once it
+// has enough confirmations. A dropped or reverted transaction is rebuilt,
+// which is safe since submit reads the on-chain level first.
+func (w *LevelUpWorker) confirm(ctx context.Context, request nftdatabase.LevelUpRequest) {
+    receipt, err := w.leveler.Receipt(ctx, common.HexToHash(*request.TxHash))
+    if err != nil {
+        w.retry(request, err, false)
+        return
+    }
+
+    if w.job(request).confirm(ctx, receipt) {
+        w.complete(request, &receipt.BlockNumber)
+    }
+}
+
+// job places a level-up on the shared transaction path
+func (w *LevelUpWorker) job(request nftdatabase.LevelUpRequest) txJob {
+    return txJob{
+        name:          fmt.Sprintf("level-up %d", request.RequestID),
+        txName:        "incrementTokenLevel transaction",
+        sender:        w.leveler,
+        confirmations: w.confirmations,
+        txHash:        request.TxHash,
+        rawTx:         request.RawTx,
+        pendingFor:    request.PendingFor,
+        scheduleCheck: func() { w.scheduleCheck(request) },
+        retry:         func(err error, resetTx bool) { w.retry(request, err, resetTx) },
+    }
+}
+
+func (w *LevelUpWorker) complete(request nftdatabase.LevelUpRequest, blockNumber *uint64) {
+    if err := w.queue.CompleteLevelUp(request, blockNumber); err != nil {
+        log.Printf("Error completing level-up %d: %v", request.RequestID, err)
+        return
+    }
+    log.Printf("Token %s:%s reached level %d (%s)", request.ContractAddress, request.TokenID, request.ToLevel, request.Source)
+}
+
+func (w *LevelUpWorker) scheduleCheck(request nftdatabase.LevelUpRequest) {
+    if err := w.queue.ScheduleLevelUpCheck(request.RequestID, mintPollInterval); err != nil {
+        log.Printf("Error scheduling level-up %d check: %v", request.RequestID, err)
+    }
+}
+
+func (w *LevelUpWorker) retry(request nftdatabase.LevelUpRequest, levelErr error, resetTx bool) {
+    log.Printf("Level-up %d attempt %d failed: %v", request.RequestID, request.Attempts+1, levelErr)
+    if err := w.queue.RetryLevelUp(request.RequestID, levelErr, mintBackoff(request.Attempts), resetTx, levelUpMaxAttempts); err != nil {
+        log.Printf("Error scheduling level-up %d retry: %v", request.RequestID, err)
+    }
+}
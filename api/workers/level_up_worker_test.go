@@ -0,0 +1,234 @@
+package workers
+
+import (
+    "context"
+    "encoding/hex"
+    "errors"
+    "math/big"
+    "testing"
+    "time"
+
+    "github.com/ethereum/go-ethereum/crypto"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// mockLevelUpCode is runtime code standing in for LevelUpNFT: the level of
+// token n lives in storage slot n, getTokenLevel reads it and
+// incrementTokenLevel adds one
+func mockLevelUpCode() string {
+    get := hex.EncodeToString(crypto.Keccak256([]byte("getTokenLevel(uint256)"))[:4])
+    inc := hex.EncodeToString(crypto.Keccak256([]byte("incrementTokenLevel(uint256)"))[:4])
+    return "60003560e01c80" + "63" + get + "14601d57" + "63" + inc + "14602a57" + "600080fd" +
+        "5b600435546000526020" + "6000f3" +
+        "5b6004358054600101905500"
+}
+
+// fakeLevelUpQueue keeps level-ups in memory the way level_up_queue does
+type fakeLevelUpQueue struct {
+    requests  map[int]*nftdatabase.LevelUpRequest
+    completed map[int]*uint64
+}
+
+func newFakeLevelUpQueue(requests ...nftdatabase.LevelUpRequest) *fakeLevelUpQueue {
+    q := &fakeLevelUpQueue{requests: map[int]*nftdatabase.LevelUpRequest{}, completed: map[int]*uint64{}}
+    for i := range requests {
+        request := requests[i]
+        q.requests[request.RequestID] = &request
+    }
+    return q
+}
+
+func (q *fakeLevelUpQueue) ClaimLevelUps(limit int, lease time.Duration) ([]nftdatabase.LevelUpRequest, error) {
+    var due []nftdatabase.LevelUpRequest
+    for _, request := range q.requests {
+        if request.Status == nftdatabase.LevelUpQueued || request.Status == nftdatabase.LevelUpSubmitted {
+            due = append(due, *request)
+        }
+    }
+    return due, nil
+}
+
+func (q *fakeLevelUpQueue) RecordLevelUpSubmission(requestID int, txHash string, rawTx []byte) error {
+    request := q.requests[requestID]
+    request.Status = nftdatabase.LevelUpSubmitted
+    request.TxHash = &txHash
+    request.RawTx = rawTx
+    request.PendingFor = 0
+    return nil
+}
+
+func (q *fakeLevelUpQueue) ScheduleLevelUpCheck(requestID int, delay time.Duration) error {
+    return nil
+}
+
+func (q *fakeLevelUpQueue) RetryLevelUp(requestID int, levelErr error, delay time.Duration, resetTx bool, maxAttempts int) error {
+    request := q.requests[requestID]
+    request.Attempts++
+    if request.Attempts >= maxAttempts {
+        request.Status = nftdatabase.LevelUpFailed
+    }
+    if resetTx {
+        request.TxHash = nil
+        request.RawTx = nil
+        request.PendingFor = 0
+        if request.Status != nftdatabase.LevelUpFailed {
+            request.Status = nftdatabase.LevelUpQueued
+        }
+    }
+    return nil
+}
+
+func (q *fakeLevelUpQueue) CompleteLevelUp(request nftdatabase.LevelUpRequest, blockNumber *uint64) error {
+    q.requests[request.RequestID].Status = nftdatabase.LevelUpConfirmed
+    q.completed[request.RequestID] = blockNumber
+    return nil
+}
+
+// unrecordedLevelUpQueue fails the next fails submissions
+type unrecordedLevelUpQueue struct {
+    *fakeLevelUpQueue
+    fails int
+}
+
+func (q *unrecordedLevelUpQueue) RecordLevelUpSubmission(requestID int, txHash string, rawTx []byte) error {
+    if q.fails > 0 {
+        q.fails--
+        return errors.New("connection refused")
+    }
+    return q.fakeLevelUpQueue.RecordLevelUpSubmission(requestID, txHash, rawTx)
+}
+
+func newTestLeveler(t *testing.T, c *testChain, backend chain.Backend, signer *chain.Signer) *chain.LevelUpNFT {
+    t.Helper()
+    leveler, err := chain.NewLevelUpNFT(backend, c.deploy(t, mockLevelUpCode()), signer)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return leveler
+}
+
+func TestMintAndLevelUpWorkersShareNonces(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+
+    minter, err := chain.NewFreshMint(c.client, c.deploy(t, mockFreshMintCode), c.signer)
+    if err != nil {
+        t.Fatal(err)
+    }
+    leveler := newTestLeveler(t, c, c.client, c.signer)
+
+    mints := newFakeMintQueue(nftdatabase.QueuedMint{QueueID: 1, ReleaseName: "Demo", OwnerAddress: "alice", Status: nftdatabase.MintQueued})
+    mintWorker := NewMintWorker(fakeOwners{"alice": "0x00000000000000000000000000000000000a11ce"}, mints, minter, fixedTokenURI("https://example.com/token.json"), 1)
+    levelUps := newFakeLevelUpQueue(nftdatabase.LevelUpRequest{
+        RequestID: 1, ContractAddress: leveler.ContractAddress().Hex(), TokenID: "7", FromLevel: 0, ToLevel: 1,
+        Status: nftdatabase.LevelUpQueued,
+    })
+    levelUpWorker := NewLevelUpWorker(levelUps, leveler, 1)
+
+    // Both transactions are built before either is mined
+    if _, err := mintWorker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := levelUpWorker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    c.backend.Commit()
+
+    if _, err := mintWorker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := levelUpWorker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if mints.mints[1].Status != nftdatabase.MintConfirmed {
+        t.Fatalf("mint was not confirmed: %+v", mints.mints[1])
+    }
+    if levelUps.requests[1].Status != nftdatabase.LevelUpConfirmed || levelUps.completed[1] == nil {
+        t.Fatalf("level-up was not confirmed: %+v", levelUps.requests[1])
+    }
+}
+
+func TestLevelUpWorkerResetsDroppedTransaction(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+
+    backend := &forgetfulBackend{Client: c.client}
+    signer, err := chain.NewSigner(backend, c.key, c.chainID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    leveler := newTestLeveler(t, c, backend, signer)
+    levelUps := newFakeLevelUpQueue(nftdatabase.LevelUpRequest{
+        RequestID: 1, ContractAddress: leveler.ContractAddress().Hex(), TokenID: "7", FromLevel: 0, ToLevel: 1,
+        Status: nftdatabase.LevelUpQueued,
+    })
+    worker := NewLevelUpWorker(levelUps, leveler, 1)
+
+    backend.drops = 1
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    request := levelUps.requests[1]
+    request.PendingFor = txDropTimeout
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if request.TxHash != nil || request.Status != nftdatabase.LevelUpQueued || request.Attempts != 1 {
+        t.Fatalf("dropped level-up was not reset: %+v", request)
+    }
+
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    c.backend.Commit()
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if request.Status != nftdatabase.LevelUpConfirmed {
+        t.Fatalf("level-up was not confirmed: %+v", request)
+    }
+
+    // The level went up exactly once
+    level, err := leveler.TokenLevel(ctx, big.NewInt(7))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if level != 1 {
+        t.Fatalf("level = %d, want 1", level)
+    }
+}
+
+func TestLevelUpWorkerReleasesUnrecordedNonce(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+    leveler := newTestLeveler(t, c, c.client, c.signer)
+    levelUps := &unrecordedLevelUpQueue{
+        fakeLevelUpQueue: newFakeLevelUpQueue(nftdatabase.LevelUpRequest{
+            RequestID: 1, ContractAddress: leveler.ContractAddress().Hex(), TokenID: "7", FromLevel: 0, ToLevel: 1,
+            Status: nftdatabase.LevelUpQueued,
+        }),
+        fails: 1,
+    }
+    worker := NewLevelUpWorker(levelUps, leveler, 1)
+
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    request := levelUps.requests[1]
+    if request.TxHash != nil {
+        t.Fatalf("unrecorded level-up was submitted: %+v", request)
+    }
+
+    // The rebuilt transaction takes the same nonce and is mined
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    c.backend.Commit()
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if request.Status != nftdatabase.LevelUpConfirmed {
+        t.Fatalf("level-up was not confirmed: %+v", request)
+    }
+}
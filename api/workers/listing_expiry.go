@@ -0,0 +1,43 @@
+package workers
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "shellhacks/api/database/nftdatabase"
+)
+
+// RunListingExpiry marks listings past their expiry as expired and releases
+// unpaid purchase reservations every interval until ctx is cancelled. Reads
+// already hide expired listings, so that half only keeps the stored status
+// honest.
+func RunListingExpiry(ctx context.Context, nftDB *nftdatabase.NFTDatabase, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            expired, err := nftDB.ExpireListings()
+            if err != nil {
+                log.Printf("Error expiring listings: %v", err)
+                continue
+            }
+            if expired > 0 {
+                log.Printf("Expired %d marketplace listings", expired)
+            }
+
+            released, err := nftDB.ReleaseLapsedReservations()
+            if err != nil {
+                log.Printf("Error releasing lapsed reservations: %v", err)
+                continue
+            }
+            if released > 0 {
+                log.Printf("Released %d lapsed listing reservations", released)
+            }
+        }
+    }
+}
@@ -0,0 +1,60 @@
+package workers
+
+import (
+    "context"
+    "log"
+    "time"
+
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// mintOutboxBatchSize caps how many approvals a single relay pass delivers
+const mintOutboxBatchSize = 50
+
+// RelayMintOutbox delivers approved releases from the account database's
+// mint_outbox into the NFT database's queued_mints. Delivery is safe to
+// repeat: QueueMint ignores releases that are already queued.
+func RelayMintOutbox(accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase) (int, error) {
+    entries, err := accountDB.GetUndeliveredMintOutbox(mintOutboxBatchSize)
+    if err != nil {
+        return 0, err
+    }
+
+    delivered := 0
+    for _, entry := range entries {
+        if err := nftDB.QueueMint(entry); err != nil {
+            log.Printf("Error queuing mint for release %d: %v", entry.ReleaseID, err)
+            if markErr := accountDB.MarkMintOutboxFailed(entry.OutboxID, err); markErr != nil {
+                log.Printf("Error recording mint outbox failure: %v", markErr)
+            }
+            continue
+        }
+
+        // If this fails the entry is delivered again next pass, which QueueMint ignores
+        if err := accountDB.MarkMintOutboxDelivered(entry.OutboxID); err != nil {
+            log.Printf("Error marking mint outbox entry %d delivered: %v", entry.OutboxID, err)
+            continue
+        }
+        delivered++
+    }
+
+    return delivered, nil
+}
+
+// RunMintOutboxRelay relays the mint outbox every interval until ctx is cancelled
+func RunMintOutboxRelay(ctx context.Context, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if _, err := RelayMintOutbox(accountDB, nftDB); err != nil {
+                log.Printf("Error relaying mint outbox: %v", err)
+            }
+        }
+    }
+}
@@ -0,0 +1,226 @@
+package workers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/nftdatabase"
+)
+
+const (
+    mintBatchSize    = 10
+    mintLease        = 2 * time.Minute
+    mintPollInterval = 15 * time.Second
+    mintBaseBackoff  = 30 * time.Second
+    mintMaxBackoff   = time.Hour
+    mintMaxAttempts  = 8
+)
+
+// TokenURIBuilder produces the tokenURI passed to FreshMint.mintNFT
+type TokenURIBuilder interface {
+    TokenURI(ctx context.Context, mint nftdatabase.QueuedMint) (string, error)
+}
+
+// APIMetadataURIs points each token at the API's metadata for its mint. The
+// token ID is only known once the mint is mined, so the URI names the queued
+// mint and the API resolves it to the token, serving the same live metadata
+// as /api/metadata/:contract/:tokenId.
+type APIMetadataURIs struct {
+    BaseURL string
+}
+
+func (b APIMetadataURIs) TokenURI(ctx context.Context, mint nftdatabase.QueuedMint) (string, error) {
+    return fmt.Sprintf("%s/api/metadata/mints/%d", strings.TrimSuffix(b.BaseURL, "/"), mint.QueueID), nil
+}
+
+// MintQueue is the queued_mints bookkeeping the mint worker relies on;
+// *nftdatabase.NFTDatabase implements it
+type MintQueue interface {
+    ClaimQueuedMints(limit int, lease time.Duration) ([]nftdatabase.QueuedMint, error)
+    RecordMintSubmission(queueID int, recipient, tokenURI, txHash string, rawTx []byte) error
+    ScheduleMintCheck(queueID int, delay time.Duration) error
+    RetryMint(queueID int, mintErr error, delay time.Duration, resetTx bool, maxAttempts int) error
+    CompleteMint(mint nftdatabase.QueuedMint, contractAddress, tokenID string, blockNumber uint64) error
+}
+
+// MintOwners looks up the verified wallets tokens are minted to;
+// *accountdatabase.AccountDatabase implements it
+type MintOwners interface {
+    GetPrimaryWallet(username string) (string, error)
+}
+
+// MintWorker drains queued_mints into FreshMint on-chain and records
+// confirmed mints in fresh_mints
+type MintWorker struct {
+    owners        MintOwners
+    queue         MintQueue
+    minter        chain.Minter
+    tokenURIs     TokenURIBuilder
+    confirmations uint64
+}
+
+// NewMintWorker creates a mint worker that waits for confirmations blocks before treating a mint as final
+func NewMintWorker(owners MintOwners, queue MintQueue, minter chain.Minter, tokenURIs TokenURIBuilder, confirmations uint64) *MintWorker {
+    return &MintWorker{
+        owners:        owners,
+        queue:         queue,
+        minter:        minter,
+        tokenURIs:     tokenURIs,
+        confirmations: confirmations,
+    }
+}
+
+// Run processes batches every interval until ctx is cancelled
+func (w *MintWorker) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            if _, err := w.ProcessBatch(ctx); err != nil {
+                log.Printf("Error processing queued mints: %v", err)
+            }
+        }
+    }
+}
+
+// ProcessBatch claims due mints and moves each one forward a single step
+func (w *MintWorker) ProcessBatch(ctx context.Context) (int, error) {
+    mints, err := w.queue.ClaimQueuedMints(mintBatchSize, mintLease)
+    if err != nil {
+        return 0, err
+    }
+
+    for _, mint := range mints {
+        if mint.TxHash == nil {
+            w.submit(ctx, mint)
+        } else {
+            w.confirm(ctx, mint)
+        }
+    }
+
+    return len(mints), nil
+}
+
+// submit builds the mint transaction and hands it to the shared submission path
+func (w *MintWorker) submit(ctx context.Context, mint nftdatabase.QueuedMint) {
+    recipient, err := w.recipient(mint)
+    if err != nil {
+        w.retry(mint, err, false)
+        return
+    }
+
+    tokenURI, err := w.tokenURIs.TokenURI(ctx, mint)
+    if err != nil {
+        w.retry(mint, err, false)
+        return
+    }
+
+    tx, err := w.minter.BuildMint(ctx, recipient, tokenURI)
+    if err != nil {
+        w.retry(mint, err, false)
+        return
+    }
+
+    job := w.job(mint)
+    job.record = func(txHash string, rawTx []byte) error {
+        return w.queue.RecordMintSubmission(mint.QueueID, recipient.Hex(), tokenURI, txHash, rawTx)
+    }
+    job.submit(ctx, tx)
+}
+
+// confirm checks a submitted transaction and completes the mint once it has enough confirmations
+func (w *MintWorker) confirm(ctx context.Context, mint nftdatabase.QueuedMint) {
+    receipt, err := w.minter.MintReceipt(ctx, common.HexToHash(*mint.TxHash))
+    if err != nil {
+        w.retry(mint, err, false)
+        return
+    }
+
+    var status *chain.TxReceipt
+    if receipt != nil {
+        status = &receipt.TxReceipt
+    }
+    if !w.job(mint).confirm(ctx, status) {
+        return
+    }
+
+    if receipt.TokenID == nil {
+        w.retry(mint, fmt.Errorf("mint transaction %s has no Transfer event", *mint.TxHash), false)
+        return
+    }
+
+    if err := w.queue.CompleteMint(mint, w.minter.ContractAddress().Hex(), receipt.TokenID.String(), receipt.BlockNumber); err != nil {
+        log.Printf("Error completing mint %d: %v", mint.QueueID, err)
+        return
+    }
+
+    log.Printf("Minted token %s for release %q in %s", receipt.TokenID, mint.ReleaseName, *mint.TxHash)
+}
+
+// job places a mint on the shared transaction path
+func (w *MintWorker) job(mint nftdatabase.QueuedMint) txJob {
+    return txJob{
+        name:          fmt.Sprintf("mint %d", mint.QueueID),
+        txName:        "mint transaction",
+        sender:        w.minter,
+        confirmations: w.confirmations,
+        txHash:        mint.TxHash,
+        rawTx:         mint.RawTx,
+        pendingFor:    mint.PendingFor,
+        scheduleCheck: func() { w.scheduleCheck(mint) },
+        retry:         func(err error, resetTx bool) { w.retry(mint, err, resetTx) },
+    }
+}
+
+// recipient resolves the wallet that receives the token. Older rows may hold
+// an address directly; newer ones hold the owning account's username.
+func (w *MintWorker) recipient(mint nftdatabase.QueuedMint) (common.Address, error) {
+    if common.IsHexAddress(mint.OwnerAddress) {
+        return common.HexToAddress(mint.OwnerAddress), nil
+    }
+
+    wallet, err := w.owners.GetPrimaryWallet(mint.OwnerAddress)
+    if err != nil {
+        return common.Address{}, err
+    }
+    if !common.IsHexAddress(wallet) {
+        return common.Address{}, errors.New("owner's primary wallet is not a valid address")
+    }
+
+    return common.HexToAddress(wallet), nil
+}
+
+func (w *MintWorker) scheduleCheck(mint nftdatabase.QueuedMint) {
+    if err := w.queue.ScheduleMintCheck(mint.QueueID, mintPollInterval); err != nil {
+        log.Printf("Error scheduling mint %d check: %v", mint.QueueID, err)
+    }
+}
+
+func (w *MintWorker) retry(mint nftdatabase.QueuedMint, mintErr error, resetTx bool) {
+    log.Printf("Mint %d attempt %d failed: %v", mint.QueueID, mint.Attempts+1, mintErr)
+    if err := w.queue.RetryMint(mint.QueueID, mintErr, mintBackoff(mint.Attempts), resetTx, mintMaxAttempts); err != nil {
+        log.Printf("Error scheduling mint %d retry: %v", mint.QueueID, err)
+    }
+}
+
+// mintBackoff doubles the delay per attempt, capped at mintMaxBackoff
+func mintBackoff(attempts int) time.Duration {
+    delay := mintBaseBackoff
+    for i := 0; i < attempts && delay < mintMaxBackoff; i++ {
+        delay *= 2
+    }
+    if delay > mintMaxBackoff {
+        delay = mintMaxBackoff
+    }
+    return delay
+}
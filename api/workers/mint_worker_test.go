@@ -0,0 +1,344 @@
+package workers
+
+import (
+    "context"
+    "crypto/ecdsa"
+    "encoding/hex"
+    "errors"
+    "math/big"
+    "testing"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "github.com/ethereum/go-ethereum/crypto"
+    "github.com/ethereum/go-ethereum/ethclient/simulated"
+    "github.com/ethereum/go-ethereum/params"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// mockFreshMintCode is runtime code standing in for FreshMint.mintNFT: it
+// increments a counter in slot 0, emits Transfer(0, recipient, id) and returns id
+const mockFreshMintCode = "60005460010180600055806004356000" +
+    "7f" + "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef" +
+    "60006000a460005260206000f3"
+
+// testChain is a simulated chain with one funded key
+type testChain struct {
+    backend *simulated.Backend
+    client  simulated.Client
+    key     *ecdsa.PrivateKey
+    chainID *big.Int
+    signer  *chain.Signer
+}
+
+func newTestChain(t *testing.T) *testChain {
+    t.Helper()
+    key, err := crypto.GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    funds := new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+    backend := simulated.NewBackend(types.GenesisAlloc{crypto.PubkeyToAddress(key.PublicKey): {Balance: funds}})
+    t.Cleanup(func() { backend.Close() })
+
+    client := backend.Client()
+    chainID, err := client.ChainID(context.Background())
+    if err != nil {
+        t.Fatal(err)
+    }
+    signer, err := chain.NewSigner(client, key, chainID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &testChain{backend: backend, client: client, key: key, chainID: chainID, signer: signer}
+}
+
+// deploy creates a contract running runtimeHex and mines it
+func (c *testChain) deploy(t *testing.T, runtimeHex string) common.Address {
+    t.Helper()
+    runtime, err := hex.DecodeString(runtimeHex)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Init code that copies the runtime code after it into memory and returns it
+    initCode := append([]byte{0x60, byte(len(runtime)), 0x80, 0x60, 0x0b, 0x60, 0x00, 0x39, 0x60, 0x00, 0xf3}, runtime...)
+
+    ctx := context.Background()
+    opts, err := c.signer.TransactOpts(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    gasPrice, err := c.client.SuggestGasPrice(ctx)
+    if err != nil {
+        t.Fatal(err)
+    }
+    tx, err := opts.Signer(opts.From, types.NewContractCreation(opts.Nonce.Uint64(), big.NewInt(0), 1_000_000, gasPrice, initCode))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := c.signer.Send(ctx, tx); err != nil {
+        t.Fatal(err)
+    }
+    c.backend.Commit()
+
+    receipt, err := c.client.TransactionReceipt(ctx, tx.Hash())
+    if err != nil || receipt.Status != types.ReceiptStatusSuccessful {
+        t.Fatalf("deploy failed: %v", err)
+    }
+    return receipt.ContractAddress
+}
+
+// fakeMintQueue keeps queued mints in memory the way queued_mints does
+type fakeMintQueue struct {
+    mints     map[int]*nftdatabase.QueuedMint
+    completed map[int]string
+}
+
+func newFakeMintQueue(mints ...nftdatabase.QueuedMint) *fakeMintQueue {
+    q := &fakeMintQueue{mints: map[int]*nftdatabase.QueuedMint{}, completed: map[int]string{}}
+    for i := range mints {
+        mint := mints[i]
+        q.mints[mint.QueueID] = &mint
+    }
+    return q
+}
+
+func (q *fakeMintQueue) ClaimQueuedMints(limit int, lease time.Duration) ([]nftdatabase.QueuedMint, error) {
+    var due []nftdatabase.QueuedMint
+    for _, mint := range q.mints {
+        if mint.Status == nftdatabase.MintQueued || mint.Status == nftdatabase.MintSubmitted {
+            due = append(due, *mint)
+        }
+    }
+    return due, nil
+}
+
+func (q *fakeMintQueue) RecordMintSubmission(queueID int, recipient, tokenURI, txHash string, rawTx []byte) error {
+    mint := q.mints[queueID]
+    mint.Status = nftdatabase.MintSubmitted
+    mint.RecipientAddress = &recipient
+    mint.TokenURI = &tokenURI
+    mint.TxHash = &txHash
+    mint.RawTx = rawTx
+    mint.PendingFor = 0
+    return nil
+}
+
+func (q *fakeMintQueue) ScheduleMintCheck(queueID int, delay time.Duration) error {
+    return nil
+}
+
+func (q *fakeMintQueue) RetryMint(queueID int, mintErr error, delay time.Duration, resetTx bool, maxAttempts int) error {
+    mint := q.mints[queueID]
+    mint.Attempts++
+    if mint.Attempts >= maxAttempts {
+        mint.Status = nftdatabase.MintFailed
+    }
+    if resetTx {
+        mint.TxHash = nil
+        mint.RawTx = nil
+        mint.PendingFor = 0
+        if mint.Status != nftdatabase.MintFailed {
+            mint.Status = nftdatabase.MintQueued
+        }
+    }
+    return nil
+}
+
+func (q *fakeMintQueue) CompleteMint(mint nftdatabase.QueuedMint, contractAddress, tokenID string, blockNumber uint64) error {
+    q.mints[mint.QueueID].Status = nftdatabase.MintConfirmed
+    q.completed[mint.QueueID] = tokenID
+    return nil
+}
+
+// unrecordedMintQueue fails the next fails submissions, like a database that
+// is briefly unreachable
+type unrecordedMintQueue struct {
+    *fakeMintQueue
+    fails int
+}
+
+func (q *unrecordedMintQueue) RecordMintSubmission(queueID int, recipient, tokenURI, txHash string, rawTx []byte) error {
+    if q.fails > 0 {
+        q.fails--
+        return errors.New("connection refused")
+    }
+    return q.fakeMintQueue.RecordMintSubmission(queueID, recipient, tokenURI, txHash, rawTx)
+}
+
+type fakeOwners map[string]string
+
+func (o fakeOwners) GetPrimaryWallet(username string) (string, error) {
+    wallet, ok := o[username]
+    if !ok {
+        return "", accountdatabase.ErrNoVerifiedWallet
+    }
+    return wallet, nil
+}
+
+type fixedTokenURI string
+
+func (u fixedTokenURI) TokenURI(ctx context.Context, mint nftdatabase.QueuedMint) (string, error) {
+    return string(u), nil
+}
+
+// forgetfulBackend accepts the next drops transactions without passing them
+// on, like a node that loses them from its mempool
+type forgetfulBackend struct {
+    simulated.Client
+    drops int
+}
+
+func (b *forgetfulBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+    if b.drops > 0 {
+        b.drops--
+        return nil
+    }
+    return b.Client.SendTransaction(ctx, tx)
+}
+
+func newTestMintWorker(t *testing.T, c *testChain, backend chain.Backend, queue MintQueue) *MintWorker {
+    t.Helper()
+    signer, err := chain.NewSigner(backend, c.key, c.chainID)
+    if err != nil {
+        t.Fatal(err)
+    }
+    minter, err := chain.NewFreshMint(backend, c.deploy(t, mockFreshMintCode), signer)
+    if err != nil {
+        t.Fatal(err)
+    }
+    owners := fakeOwners{"alice": "0x00000000000000000000000000000000000a11ce"}
+    return NewMintWorker(owners, queue, minter, fixedTokenURI("https://example.com/token.json"), 1)
+}
+
+func TestMintWorkerSubmitsAndConfirms(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+    queue := newFakeMintQueue(nftdatabase.QueuedMint{QueueID: 1, ReleaseName: "Demo", OwnerAddress: "alice", Status: nftdatabase.MintQueued})
+    worker := newTestMintWorker(t, c, c.client, queue)
+
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    mint := queue.mints[1]
+    if mint.Status != nftdatabase.MintSubmitted || mint.TxHash == nil {
+        t.Fatalf("mint was not submitted: %+v", mint)
+    }
+    if *mint.RecipientAddress != common.HexToAddress("0xa11ce").Hex() {
+        t.Fatalf("recipient = %s", *mint.RecipientAddress)
+    }
+
+    // Not mined yet: the check is rescheduled without using up an attempt
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if mint.Status != nftdatabase.MintSubmitted || mint.Attempts != 0 {
+        t.Fatalf("pending mint changed: %+v", mint)
+    }
+
+    c.backend.Commit()
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if mint.Status != nftdatabase.MintConfirmed || queue.completed[1] != "1" {
+        t.Fatalf("mint was not completed: %+v, token %q", mint, queue.completed[1])
+    }
+    if mint.Attempts != 0 {
+        t.Fatalf("attempts = %d, want 0", mint.Attempts)
+    }
+}
+
+func TestMintWorkerResetsDroppedTransaction(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+    queue := newFakeMintQueue(nftdatabase.QueuedMint{QueueID: 1, ReleaseName: "Demo", OwnerAddress: "alice", Status: nftdatabase.MintQueued})
+    backend := &forgetfulBackend{Client: c.client, drops: 1}
+    worker := newTestMintWorker(t, c, backend, queue)
+
+    // The node forgets the transaction and it stays unmined past the timeout
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    queue.mints[1].PendingFor = txDropTimeout
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    mint := queue.mints[1]
+    if mint.TxHash != nil || mint.Status != nftdatabase.MintQueued || mint.Attempts != 1 {
+        t.Fatalf("dropped mint was not reset: %+v", mint)
+    }
+
+    // The mint is rebuilt with the released nonce and goes through
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if mint.TxHash == nil {
+        t.Fatal("mint was not resubmitted")
+    }
+    c.backend.Commit()
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if mint.Status != nftdatabase.MintConfirmed || queue.completed[1] != "1" {
+        t.Fatalf("mint was not completed: %+v", mint)
+    }
+}
+
+func TestMintWorkerFailsStuckTransaction(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+    queue := newFakeMintQueue(nftdatabase.QueuedMint{QueueID: 1, ReleaseName: "Demo", OwnerAddress: "alice", Status: nftdatabase.MintQueued})
+    worker := newTestMintWorker(t, c, c.client, queue)
+
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    // Still known to the node but never mined: every check past the timeout counts
+    queue.mints[1].PendingFor = txDropTimeout
+    for i := 0; i < mintMaxAttempts; i++ {
+        if _, err := worker.ProcessBatch(ctx); err != nil {
+            t.Fatal(err)
+        }
+    }
+    mint := queue.mints[1]
+    if mint.Status != nftdatabase.MintFailed || mint.Attempts != mintMaxAttempts {
+        t.Fatalf("stuck mint did not fail: %+v", mint)
+    }
+    if mint.TxHash == nil {
+        t.Fatal("stuck transaction hash was cleared while it can still be mined")
+    }
+}
+
+func TestMintWorkerReleasesUnrecordedNonce(t *testing.T) {
+    ctx := context.Background()
+    c := newTestChain(t)
+    queue := &unrecordedMintQueue{
+        fakeMintQueue: newFakeMintQueue(nftdatabase.QueuedMint{QueueID: 1, ReleaseName: "Demo", OwnerAddress: "alice", Status: nftdatabase.MintQueued}),
+        fails:         1,
+    }
+    worker := newTestMintWorker(t, c, c.client, queue)
+
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    mint := queue.mints[1]
+    if mint.TxHash != nil {
+        t.Fatalf("unrecorded mint was submitted: %+v", mint)
+    }
+
+    // The rebuilt mint takes the same nonce, so nothing is left waiting on a gap
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    c.backend.Commit()
+    if _, err := worker.ProcessBatch(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if mint.Status != nftdatabase.MintConfirmed || queue.completed[1] != "1" {
+        t.Fatalf("mint was not completed: %+v", mint)
+    }
+}
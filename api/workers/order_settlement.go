@@ -0,0 +1,196 @@
+package workers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "math/big"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// orderSettlementBatchSize caps how many paid orders a single pass verifies
+const orderSettlementBatchSize = 25
+
+// errAwaitingTransfer is the ErrPaymentPending of a verified payment whose
+// token transfer is not on chain yet
+var errAwaitingTransfer = fmt.Errorf("%w: waiting for the seller's token transfer", chain.ErrPaymentPending)
+
+// SettleOrder verifies a pending order's payment and the token's transfer to
+// the buyer, and settles it. A verified sale completes the order and marks the
+// listing sold; a payment or transfer that can never verify, or that is still
+// not on chain once its timeout has run, fails the order and relists the
+// token. Either way both sides are written to transaction_history. Sales that
+// are still confirming, or still waiting for the seller's transfer, leave the
+// order pending and return chain.ErrPaymentPending.
+func SettleOrder(ctx context.Context, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts, order *nftdatabase.Order) (*nftdatabase.Order, error) {
+    if order.Status == nftdatabase.OrderPending {
+        if order.TxHash == nil {
+            return order, chain.ErrPaymentPending
+        }
+
+        receipt, err := verifyOrderPayment(ctx, payments, order)
+        var timeout time.Duration
+        var reason string
+        switch {
+        case errors.Is(err, chain.ErrPaymentInvalid):
+            if order, err = nftDB.FailOrder(order.OrderID, err.Error()); err != nil {
+                return nil, err
+            }
+        case errors.Is(err, errAwaitingTransfer):
+            timeout, reason = timeouts.Transfer, "the token was not transferred to the buyer within "+timeouts.Transfer.String()
+        case errors.Is(err, chain.ErrPaymentUnmined):
+            timeout, reason = timeouts.Payment, "the payment transaction was not mined within "+timeouts.Payment.String()
+        case err != nil:
+            return order, err
+        default:
+            if order, err = nftDB.CompleteOrder(order.OrderID, receipt.BlockNumber); err != nil {
+                return nil, err
+            }
+        }
+
+        if reason != "" {
+            failed, failErr := nftDB.FailStalledOrder(order.OrderID, timeout, reason)
+            if failErr != nil {
+                return nil, failErr
+            }
+            if failed == nil {
+                return order, err
+            }
+            order = failed
+        }
+    }
+
+    // Recording is idempotent, so settled orders are safe to pass through again
+    if err := recordSettlement(accountDB, order); err != nil {
+        return order, err
+    }
+
+    return order, nil
+}
+
+// verifyOrderPayment checks the payment and then the token transfer, returning
+// the receipt of whichever was mined last
+func verifyOrderPayment(ctx context.Context, payments chain.PaymentVerifier, order *nftdatabase.Order) (*chain.PaymentReceipt, error) {
+    if order.Currency != chain.NativeCurrency {
+        return nil, fmt.Errorf("%w: %s payments are not supported", chain.ErrPaymentInvalid, order.Currency)
+    }
+    if !common.IsHexAddress(order.BuyerAddress) || !common.IsHexAddress(order.SellerAddress) {
+        return nil, fmt.Errorf("%w: order has an invalid wallet address", chain.ErrPaymentInvalid)
+    }
+
+    amount, err := chain.EtherToWei(order.Price)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", chain.ErrPaymentInvalid, err)
+    }
+
+    tokenID, ok := new(big.Int).SetString(order.TokenID, 10)
+    if !ok || !common.IsHexAddress(order.ContractAddress) {
+        return nil, fmt.Errorf("%w: order has an invalid token", chain.ErrPaymentInvalid)
+    }
+
+    // Transactions mined before the reservation belong to some earlier deal
+    payment, err := payments.VerifyPayment(ctx, chain.Payment{
+        TxHash:    common.HexToHash(*order.TxHash),
+        From:      common.HexToAddress(order.BuyerAddress),
+        To:        common.HexToAddress(order.SellerAddress),
+        Amount:    amount,
+        NotBefore: order.CreatedAt,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    // The transfer is looked for in the payment transaction first, then in
+    // the separate transfer transaction attached to the order
+    transfer := chain.TokenTransfer{
+        TxHash:    payment.TxHash,
+        Contract:  common.HexToAddress(order.ContractAddress),
+        From:      common.HexToAddress(order.SellerAddress),
+        To:        common.HexToAddress(order.BuyerAddress),
+        TokenID:   tokenID,
+        NotBefore: order.CreatedAt,
+    }
+    transferred, err := payments.VerifyTransfer(ctx, transfer)
+    if errors.Is(err, chain.ErrTransferNotFound) {
+        if order.TransferTxHash == nil {
+            return nil, errAwaitingTransfer
+        }
+        transfer.TxHash = common.HexToHash(*order.TransferTxHash)
+        transferred, err = payments.VerifyTransfer(ctx, transfer)
+        if errors.Is(err, chain.ErrPaymentUnmined) {
+            return nil, errAwaitingTransfer
+        }
+    }
+    if errors.Is(err, chain.ErrTransferNotFound) {
+        return nil, fmt.Errorf("%w: %v", chain.ErrPaymentInvalid, err)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if transferred.BlockNumber > payment.BlockNumber {
+        return transferred, nil
+    }
+    return payment, nil
+}
+
+func recordSettlement(accountDB *accountdatabase.AccountDatabase, order *nftdatabase.Order) error {
+    settlement := accountdatabase.TradeSettlement{
+        OrderID:         order.OrderID,
+        BuyerUsername:   order.BuyerUsername,
+        SellerUsername:  order.SellerUsername,
+        ContractAddress: order.ContractAddress,
+        TokenID:         order.TokenID,
+        Price:           order.Price,
+        Currency:        order.Currency,
+    }
+    if order.TxHash != nil {
+        settlement.TxHash = *order.TxHash
+    }
+
+    switch order.Status {
+    case nftdatabase.OrderCompleted:
+        settlement.Status = accountdatabase.TransactionConfirmed
+        settlement.Notes = fmt.Sprintf("Marketplace order %d for %s", order.OrderID, order.ReleaseName)
+    case nftdatabase.OrderFailed:
+        settlement.Status = accountdatabase.TransactionFailed
+        if order.FailureReason != nil {
+            settlement.Notes = *order.FailureReason
+        }
+    default:
+        return nil
+    }
+
+    return accountDB.RecordTradeSettlement(settlement)
+}
+
+// RunOrderSettlement re-verifies paid orders every interval until ctx is
+// cancelled, so orders settle, or time out, even if the buyer never checks back
+func RunOrderSettlement(ctx context.Context, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            orders, err := nftDB.GetPaidPendingOrders(orderSettlementBatchSize)
+            if err != nil {
+                log.Printf("Error fetching pending orders: %v", err)
+                continue
+            }
+            for i := range orders {
+                if _, err := SettleOrder(ctx, accountDB, nftDB, payments, timeouts, &orders[i]); err != nil && !errors.Is(err, chain.ErrPaymentPending) {
+                    log.Printf("Error settling order %d: %v", orders[i].OrderID, err)
+                }
+            }
+        }
+    }
+}
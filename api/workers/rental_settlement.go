@@ -0,0 +1,180 @@
+package workers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/accountdatabase"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// rentalBatchSize caps how many rentals a single pass settles or records
+const rentalBatchSize = 25
+
+// SettleRental verifies a pending rental's payment and settles it. A verified
+// payment starts the rental; a payment that can never verify, or that is still
+// not mined once timeouts.Payment has run, fails the agreement and puts the
+// offer back on the market. Payments that are still confirming leave the
+// agreement pending and return chain.ErrPaymentPending.
+func SettleRental(ctx context.Context, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts, agreement *nftdatabase.RentalAgreement) (*nftdatabase.RentalAgreement, error) {
+    if agreement.Status == nftdatabase.RentalPending {
+        if agreement.TxHash == nil {
+            return agreement, chain.ErrPaymentPending
+        }
+
+        receipt, err := verifyRentalPayment(ctx, payments, agreement)
+        switch {
+        case errors.Is(err, chain.ErrPaymentInvalid):
+            if agreement, err = nftDB.FailRental(agreement.AgreementID, err.Error()); err != nil {
+                return nil, err
+            }
+        case errors.Is(err, chain.ErrPaymentUnmined):
+            failed, failErr := nftDB.FailStalledRental(agreement.AgreementID, timeouts.Payment, "the payment transaction was not mined within "+timeouts.Payment.String())
+            if failErr != nil {
+                return nil, failErr
+            }
+            if failed == nil {
+                return agreement, err
+            }
+            agreement = failed
+        case err != nil:
+            return agreement, err
+        default:
+            if agreement, err = nftDB.ActivateRental(agreement.AgreementID, receipt.BlockNumber); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    if err := recordRental(accountDB, nftDB, agreement); err != nil {
+        return agreement, err
+    }
+
+    return agreement, nil
+}
+
+func verifyRentalPayment(ctx context.Context, payments chain.PaymentVerifier, agreement *nftdatabase.RentalAgreement) (*chain.PaymentReceipt, error) {
+    if agreement.Currency != chain.NativeCurrency {
+        return nil, fmt.Errorf("%w: %s payments are not supported", chain.ErrPaymentInvalid, agreement.Currency)
+    }
+    if !common.IsHexAddress(agreement.RenterAddress) || !common.IsHexAddress(agreement.OwnerAddress) {
+        return nil, fmt.Errorf("%w: rental has an invalid wallet address", chain.ErrPaymentInvalid)
+    }
+
+    // Rent and collateral are paid to the owner in a single transfer
+    amount, err := chain.EtherToWei(agreement.AmountDue)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", chain.ErrPaymentInvalid, err)
+    }
+
+    return payments.VerifyPayment(ctx, chain.Payment{
+        TxHash:    common.HexToHash(*agreement.TxHash),
+        From:      common.HexToAddress(agreement.RenterAddress),
+        To:        common.HexToAddress(agreement.OwnerAddress),
+        Amount:    amount,
+        NotBefore: agreement.CreatedAt,
+    })
+}
+
+// recordRental writes whichever of an agreement's ledger entries are due and
+// not yet written: the rent payment once the payment settles, and the
+// collateral refund once the rental ends. Recording is idempotent, so a crash
+// between writing and marking only repeats no-op writes.
+func recordRental(accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, agreement *nftdatabase.RentalAgreement) error {
+    settlement := accountdatabase.RentalSettlement{
+        RentalID:        agreement.AgreementID,
+        OwnerUsername:   agreement.OwnerUsername,
+        RenterUsername:  agreement.RenterUsername,
+        ContractAddress: agreement.ContractAddress,
+        TokenID:         agreement.TokenID,
+        Rent:            agreement.TotalRent,
+        Collateral:      agreement.Collateral,
+        Currency:        agreement.Currency,
+    }
+    if agreement.TxHash != nil {
+        settlement.TxHash = *agreement.TxHash
+    }
+
+    var payment, collateral bool
+    switch agreement.Status {
+    case nftdatabase.RentalActive, nftdatabase.RentalEnded:
+        payment = !agreement.PaymentRecorded
+        collateral = agreement.Status == nftdatabase.RentalEnded && !agreement.CollateralRecorded
+        settlement.Status = accountdatabase.TransactionConfirmed
+        settlement.Notes = fmt.Sprintf("Rental %d: %d days of token %s", agreement.AgreementID, agreement.Days, agreement.TokenID)
+    case nftdatabase.RentalFailed:
+        payment = !agreement.PaymentRecorded
+        settlement.Status = accountdatabase.TransactionFailed
+        if agreement.FailureReason != nil {
+            settlement.Notes = *agreement.FailureReason
+        }
+    }
+    if !payment && !collateral {
+        return nil
+    }
+
+    if payment {
+        if err := accountDB.RecordRentalPayment(settlement); err != nil {
+            return err
+        }
+    }
+    if collateral {
+        settlement.Notes = fmt.Sprintf("Collateral refund for rental %d", agreement.AgreementID)
+        if err := accountDB.RecordCollateralRefund(settlement); err != nil {
+            return err
+        }
+    }
+
+    return nftDB.MarkRentalRecorded(agreement.AgreementID, payment, collateral)
+}
+
+// RunRentalJobs expires lapsed rentals every interval until ctx is cancelled:
+// unpaid agreements past their payment deadline expire and rentals past their
+// end date end. It then settles paid rentals, when payments is configured,
+// and writes any ledger entries that are still outstanding.
+func RunRentalJobs(ctx context.Context, accountDB *accountdatabase.AccountDatabase, nftDB *nftdatabase.NFTDatabase, payments chain.PaymentVerifier, timeouts chain.PaymentTimeouts, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+            expired, ended, err := nftDB.ExpireRentals()
+            if err != nil {
+                log.Printf("Error expiring rentals: %v", err)
+            } else if expired > 0 || ended > 0 {
+                log.Printf("Expired %d unpaid rentals and ended %d rentals", expired, ended)
+            }
+
+            if payments != nil {
+                agreements, err := nftDB.GetPaidPendingRentals(rentalBatchSize)
+                if err != nil {
+                    log.Printf("Error fetching pending rentals: %v", err)
+                }
+                for i := range agreements {
+                    if _, err := SettleRental(ctx, accountDB, nftDB, payments, timeouts, &agreements[i]); err != nil && !errors.Is(err, chain.ErrPaymentPending) {
+                        log.Printf("Error settling rental %d: %v", agreements[i].AgreementID, err)
+                    }
+                }
+            }
+
+            agreements, err := nftDB.GetUnrecordedRentals(rentalBatchSize)
+            if err != nil {
+                log.Printf("Error fetching unrecorded rentals: %v", err)
+                continue
+            }
+            for i := range agreements {
+                if err := recordRental(accountDB, nftDB, &agreements[i]); err != nil {
+                    log.Printf("Error recording rental %d: %v", agreements[i].AgreementID, err)
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,236 @@
+package workers
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "strings"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/nftdatabase"
+)
+
+// stakingIndexBatchSize caps how many blocks a single log query spans
+const stakingIndexBatchSize = 2000
+
+// StakingStore is where the indexer keeps events and its progress;
+// *nftdatabase.NFTDatabase implements it
+type StakingStore interface {
+    GetChainCheckpoint(name string) (*nftdatabase.ChainCheckpoint, error)
+    SaveStakingEvents(events []nftdatabase.StakingEventRecord, checkpoint nftdatabase.ChainCheckpoint) error
+    LatestStakingEventBlock(stakerContract string, beforeBlock uint64) (*nftdatabase.ChainCheckpoint, error)
+    RewindStakingEvents(name, stakerContract string, fromBlock uint64, checkpoint *nftdatabase.ChainCheckpoint) ([]nftdatabase.TokenRef, error)
+}
+
+// StakingIndexer follows an NFTStaker contract and stores its events. It only
+// indexes blocks with at least confirmations confirmations, and checks the
+// checkpoint block's hash before every batch so a reorg below that depth is
+// rolled back rather than silently kept.
+type StakingIndexer struct {
+    nftDB         StakingStore
+    source        chain.StakingEventSource
+    startBlock    uint64
+    confirmations uint64
+    tokenContract *common.Address
+}
+
+// NewStakingIndexer creates an indexer that starts at startBlock, normally the
+// NFTStaker deployment block
+func NewStakingIndexer(nftDB StakingStore, source chain.StakingEventSource, startBlock, confirmations uint64) *StakingIndexer {
+    return &StakingIndexer{
+        nftDB:         nftDB,
+        source:        source,
+        startBlock:    startBlock,
+        confirmations: confirmations,
+    }
+}
+
+// checkpointName keys this indexer's progress in chain_checkpoints
+func (ix *StakingIndexer) checkpointName() string {
+    return "nftstaker:" + strings.ToLower(ix.source.StakerAddress().Hex())
+}
+
+// Run syncs every interval until ctx is cancelled
+func (ix *StakingIndexer) Run(ctx context.Context, interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        if err := ix.Sync(ctx); err != nil {
+            log.Printf("Error indexing staking events: %v", err)
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Sync indexes batches until it reaches the confirmed head
+func (ix *StakingIndexer) Sync(ctx context.Context) error {
+    for ctx.Err() == nil {
+        caughtUp, err := ix.step(ctx)
+        if err != nil {
+            return err
+        }
+        if caughtUp {
+            return nil
+        }
+    }
+    return ctx.Err()
+}
+
+// step handles one reorg check or one batch of blocks
+func (ix *StakingIndexer) step(ctx context.Context) (bool, error) {
+    if ix.tokenContract == nil {
+        tokenContract, err := ix.source.TokenContract(ctx)
+        if err != nil {
+            return false, err
+        }
+        ix.tokenContract = &tokenContract
+    }
+
+    checkpoint, err := ix.nftDB.GetChainCheckpoint(ix.checkpointName())
+    if err != nil {
+        return false, err
+    }
+
+    next := ix.startBlock
+    if checkpoint != nil {
+        hash, _, err := ix.source.BlockHeader(ctx, checkpoint.BlockNumber)
+        if err != nil {
+            return false, err
+        }
+        if hash.Hex() != checkpoint.BlockHash {
+            return false, ix.rewind(ctx, checkpoint.BlockNumber)
+        }
+        next = checkpoint.BlockNumber + 1
+    }
+
+    head, err := ix.source.BlockNumber(ctx)
+    if err != nil {
+        return false, err
+    }
+    if head+1 < ix.confirmations {
+        return true, nil
+    }
+    confirmed := head
+    if ix.confirmations > 0 {
+        confirmed = head + 1 - ix.confirmations
+    }
+    if next > confirmed {
+        return true, nil
+    }
+
+    to := next + stakingIndexBatchSize - 1
+    if to > confirmed {
+        to = confirmed
+    }
+
+    events, err := ix.source.StakingEvents(ctx, next, to)
+    if err != nil {
+        return false, err
+    }
+
+    // Every event must come from the canonical block we are about to
+    // checkpoint past; anything else means a reorg raced the log query
+    headers := map[uint64]time.Time{}
+    records := make([]nftdatabase.StakingEventRecord, 0, len(events))
+    for _, event := range events {
+        blockTime, ok := headers[event.BlockNumber]
+        if !ok {
+            hash, timestamp, err := ix.source.BlockHeader(ctx, event.BlockNumber)
+            if err != nil {
+                return false, err
+            }
+            if hash != event.BlockHash {
+                return false, fmt.Errorf("block %d changed while indexing, retrying", event.BlockNumber)
+            }
+            blockTime = time.Unix(int64(timestamp), 0).UTC()
+            headers[event.BlockNumber] = blockTime
+        }
+
+        record := nftdatabase.StakingEventRecord{
+            StakerContract: ix.source.StakerAddress().Hex(),
+            TokenContract:  ix.tokenContract.Hex(),
+            TokenID:        event.TokenID.String(),
+            EventType:      event.Kind,
+            StakerAddress:  event.Staker.Hex(),
+            BlockNumber:    event.BlockNumber,
+            BlockHash:      event.BlockHash.Hex(),
+            BlockTime:      blockTime,
+            TxHash:         event.TxHash.Hex(),
+            LogIndex:       event.LogIndex,
+        }
+        if event.Kind == chain.EventLevelUp {
+            level := int64(event.NewLevel)
+            record.NewLevel = &level
+        }
+        records = append(records, record)
+    }
+
+    toHash, _, err := ix.source.BlockHeader(ctx, to)
+    if err != nil {
+        return false, err
+    }
+    if err := ix.nftDB.SaveStakingEvents(records, nftdatabase.ChainCheckpoint{
+        Name:        ix.checkpointName(),
+        BlockNumber: to,
+        BlockHash:   toHash.Hex(),
+    }); err != nil {
+        return false, err
+    }
+
+    if len(records) > 0 {
+        log.Printf("Indexed %d staking events in blocks %d-%d", len(records), next, to)
+    }
+    return to == confirmed, nil
+}
+
+// rewind moves the checkpoint back from a block that is no longer canonical to
+// the newest stored event block that still is, and drops the events above it.
+// A canonical block's ancestors are canonical too, so everything the reorg
+// could have changed is re-indexed however deep it went.
+func (ix *StakingIndexer) rewind(ctx context.Context, orphaned uint64) error {
+    stakerContract := ix.source.StakerAddress().Hex()
+
+    var checkpoint *nftdatabase.ChainCheckpoint
+    for before := orphaned; ; {
+        block, err := ix.nftDB.LatestStakingEventBlock(stakerContract, before)
+        if err != nil {
+            return err
+        }
+        if block == nil || block.BlockNumber < ix.startBlock {
+            break
+        }
+        hash, _, err := ix.source.BlockHeader(ctx, block.BlockNumber)
+        if err != nil {
+            return err
+        }
+        if hash.Hex() == block.BlockHash {
+            checkpoint = &nftdatabase.ChainCheckpoint{Name: ix.checkpointName(), BlockNumber: block.BlockNumber, BlockHash: block.BlockHash}
+            break
+        }
+        before = block.BlockNumber
+    }
+
+    from := ix.startBlock
+    if checkpoint != nil {
+        from = checkpoint.BlockNumber + 1
+    }
+
+    log.Printf("Staking indexer: block %d was reorganized, re-indexing from block %d", orphaned, from)
+    tokens, err := ix.nftDB.RewindStakingEvents(ix.checkpointName(), stakerContract, from, checkpoint)
+    if err != nil {
+        return err
+    }
+
+    if len(tokens) > 0 {
+        log.Printf("Staking indexer: rolled back events for %d tokens", len(tokens))
+    }
+    return nil
+}
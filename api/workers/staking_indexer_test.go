@@ -0,0 +1,274 @@
+package workers
+
+import (
+    "context"
+    "math/big"
+    "testing"
+
+    "github.com/ethereum/go-ethereum/common"
+    "shellhacks/api/chain"
+    "shellhacks/api/database/nftdatabase"
+)
+
+var (
+    testStakerAddress = common.HexToAddress("0x5a4e")
+    testTokenContract = common.HexToAddress("0x70ce")
+)
+
+// fakeBlock is one block of a fakeStakingChain
+type fakeBlock struct {
+    hash   common.Hash
+    events []chain.StakingEvent
+}
+
+// fakeStakingChain is a StakingEventSource whose blocks can be replaced to
+// simulate a reorg
+type fakeStakingChain struct {
+    blocks []fakeBlock
+}
+
+// newFakeStakingChain builds a chain of n empty blocks on the given fork
+func newFakeStakingChain(n int, fork byte) *fakeStakingChain {
+    c := &fakeStakingChain{}
+    for i := 0; i < n; i++ {
+        c.blocks = append(c.blocks, fakeBlock{hash: fakeBlockHash(uint64(i), fork)})
+    }
+    return c
+}
+
+func fakeBlockHash(number uint64, fork byte) common.Hash {
+    var hash common.Hash
+    hash[0] = fork
+    new(big.Int).SetUint64(number).FillBytes(hash[24:])
+    return hash
+}
+
+// stake adds a staking event for tokenID to block number
+func (c *fakeStakingChain) stake(number uint64, tokenID int64) {
+    block := &c.blocks[number]
+    block.events = append(block.events, chain.StakingEvent{
+        Kind:        chain.EventStaked,
+        Staker:      common.HexToAddress("0xa11ce"),
+        TokenID:     big.NewInt(tokenID),
+        BlockNumber: number,
+        BlockHash:   block.hash,
+        TxHash:      common.BigToHash(big.NewInt(tokenID)),
+        LogIndex:    uint(len(block.events)),
+    })
+}
+
+// reorg replaces every block from number up with empty blocks on a new fork
+func (c *fakeStakingChain) reorg(number uint64, fork byte) {
+    for i := number; i < uint64(len(c.blocks)); i++ {
+        c.blocks[i] = fakeBlock{hash: fakeBlockHash(i, fork)}
+    }
+}
+
+func (c *fakeStakingChain) StakerAddress() common.Address {
+    return testStakerAddress
+}
+
+func (c *fakeStakingChain) TokenContract(ctx context.Context) (common.Address, error) {
+    return testTokenContract, nil
+}
+
+func (c *fakeStakingChain) BlockNumber(ctx context.Context) (uint64, error) {
+    return uint64(len(c.blocks) - 1), nil
+}
+
+func (c *fakeStakingChain) BlockHeader(ctx context.Context, number uint64) (common.Hash, uint64, error) {
+    return c.blocks[number].hash, 1_700_000_000 + number*12, nil
+}
+
+func (c *fakeStakingChain) StakingEvents(ctx context.Context, from, to uint64) ([]chain.StakingEvent, error) {
+    var events []chain.StakingEvent
+    for i := from; i <= to; i++ {
+        events = append(events, c.blocks[i].events...)
+    }
+    return events, nil
+}
+
+// fakeStakingStore keeps indexed events in memory the way staking_events does
+type fakeStakingStore struct {
+    checkpoints map[string]nftdatabase.ChainCheckpoint
+    events      []nftdatabase.StakingEventRecord
+}
+
+func newFakeStakingStore() *fakeStakingStore {
+    return &fakeStakingStore{checkpoints: map[string]nftdatabase.ChainCheckpoint{}}
+}
+
+func (s *fakeStakingStore) GetChainCheckpoint(name string) (*nftdatabase.ChainCheckpoint, error) {
+    checkpoint, ok := s.checkpoints[name]
+    if !ok {
+        return nil, nil
+    }
+    return &checkpoint, nil
+}
+
+func (s *fakeStakingStore) SaveStakingEvents(events []nftdatabase.StakingEventRecord, checkpoint nftdatabase.ChainCheckpoint) error {
+    s.events = append(s.events, events...)
+    s.checkpoints[checkpoint.Name] = checkpoint
+    return nil
+}
+
+func (s *fakeStakingStore) LatestStakingEventBlock(stakerContract string, beforeBlock uint64) (*nftdatabase.ChainCheckpoint, error) {
+    var latest *nftdatabase.ChainCheckpoint
+    for _, event := range s.events {
+        if event.StakerContract != stakerContract || event.BlockNumber >= beforeBlock {
+            continue
+        }
+        if latest == nil || event.BlockNumber > latest.BlockNumber {
+            latest = &nftdatabase.ChainCheckpoint{BlockNumber: event.BlockNumber, BlockHash: event.BlockHash}
+        }
+    }
+    return latest, nil
+}
+
+func (s *fakeStakingStore) RewindStakingEvents(name, stakerContract string, fromBlock uint64, checkpoint *nftdatabase.ChainCheckpoint) ([]nftdatabase.TokenRef, error) {
+    var kept []nftdatabase.StakingEventRecord
+    var tokens []nftdatabase.TokenRef
+    for _, event := range s.events {
+        if event.StakerContract == stakerContract && event.BlockNumber >= fromBlock {
+            tokens = append(tokens, nftdatabase.TokenRef{ContractAddress: event.TokenContract, TokenID: event.TokenID})
+            continue
+        }
+        kept = append(kept, event)
+    }
+    s.events = kept
+
+    if checkpoint == nil {
+        delete(s.checkpoints, name)
+    } else {
+        s.checkpoints[name] = *checkpoint
+    }
+    return tokens, nil
+}
+
+// tokenIDs lists the stored events' token IDs in order
+func (s *fakeStakingStore) tokenIDs() []string {
+    ids := make([]string, len(s.events))
+    for i, event := range s.events {
+        ids[i] = event.TokenID
+    }
+    return ids
+}
+
+func TestStakingIndexerIndexesConfirmedBlocks(t *testing.T) {
+    ctx := context.Background()
+    source := newFakeStakingChain(10, 1)
+    source.stake(3, 1)
+    source.stake(8, 2)
+    store := newFakeStakingStore()
+    indexer := NewStakingIndexer(store, source, 0, 3)
+
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    // Head is 9, so only blocks up to 7 have three confirmations
+    checkpoint := store.checkpoints[indexer.checkpointName()]
+    if checkpoint.BlockNumber != 7 || checkpoint.BlockHash != source.blocks[7].hash.Hex() {
+        t.Fatalf("checkpoint = %+v, want block 7", checkpoint)
+    }
+    if ids := store.tokenIDs(); len(ids) != 1 || ids[0] != "1" {
+        t.Fatalf("indexed tokens = %v, want [1]", ids)
+    }
+    if store.events[0].TokenContract != testTokenContract.Hex() || store.events[0].BlockHash != source.blocks[3].hash.Hex() {
+        t.Fatalf("unexpected event record: %+v", store.events[0])
+    }
+}
+
+func TestStakingIndexerRewindsReorganizedCheckpoint(t *testing.T) {
+    ctx := context.Background()
+    source := newFakeStakingChain(100, 1)
+    source.stake(10, 1)
+    source.stake(90, 2)
+    store := newFakeStakingStore()
+    indexer := NewStakingIndexer(store, source, 0, 1)
+
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if ids := store.tokenIDs(); len(ids) != 2 {
+        t.Fatalf("indexed tokens = %v, want both", ids)
+    }
+
+    // The checkpointed block and the one holding token 2 are replaced, and
+    // the new fork stakes token 3 instead
+    source.reorg(80, 2)
+    source.stake(85, 3)
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    ids := store.tokenIDs()
+    if len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+        t.Fatalf("indexed tokens after reorg = %v, want [1 3]", ids)
+    }
+    for _, event := range store.events {
+        if event.BlockHash != source.blocks[event.BlockNumber].hash.Hex() {
+            t.Fatalf("event from orphaned block kept: %+v", event)
+        }
+    }
+    checkpoint := store.checkpoints[indexer.checkpointName()]
+    if checkpoint.BlockNumber != 99 || checkpoint.BlockHash != source.blocks[99].hash.Hex() {
+        t.Fatalf("checkpoint = %+v, want the new block 99", checkpoint)
+    }
+}
+
+func TestStakingIndexerRewindsPastStartBlock(t *testing.T) {
+    ctx := context.Background()
+    source := newFakeStakingChain(20, 1)
+    source.stake(5, 1)
+    store := newFakeStakingStore()
+    indexer := NewStakingIndexer(store, source, 2, 0)
+
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    // A reorg reaching back to the start block restarts indexing from scratch
+    source.reorg(2, 2)
+    source.stake(4, 2)
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    if ids := store.tokenIDs(); len(ids) != 1 || ids[0] != "2" {
+        t.Fatalf("indexed tokens after reorg = %v, want [2]", ids)
+    }
+    checkpoint := store.checkpoints[indexer.checkpointName()]
+    if checkpoint.BlockHash != source.blocks[19].hash.Hex() {
+        t.Fatalf("checkpoint = %+v, want the new block 19", checkpoint)
+    }
+}
+
+func TestStakingIndexerRewindsDeepReorg(t *testing.T) {
+    ctx := context.Background()
+    source := newFakeStakingChain(5000, 1)
+    source.stake(20, 1)
+    source.stake(100, 2)
+    store := newFakeStakingStore()
+    indexer := NewStakingIndexer(store, source, 0, 0)
+
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    // The fork point is thousands of blocks below the checkpoint, under the
+    // newest stored event, and the new fork stakes a token in the gap
+    source.reorg(50, 2)
+    source.stake(60, 3)
+    if err := indexer.Sync(ctx); err != nil {
+        t.Fatal(err)
+    }
+
+    if ids := store.tokenIDs(); len(ids) != 2 || ids[0] != "1" || ids[1] != "3" {
+        t.Fatalf("indexed tokens after reorg = %v, want [1 3]", ids)
+    }
+    checkpoint := store.checkpoints[indexer.checkpointName()]
+    if checkpoint.BlockHash != source.blocks[4999].hash.Hex() {
+        t.Fatalf("checkpoint = %+v, want the new block 4999", checkpoint)
+    }
+}
@@ -0,0 +1,125 @@
+package workers
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "time"
+
+    "github.com/ethereum/go-ethereum/common"
+    "github.com/ethereum/go-ethereum/core/types"
+    "shellhacks/api/chain"
+)
+
+// txDropTimeout is how long a transaction may go without a receipt before
+// the worker checks whether it was dropped
+const txDropTimeout = 10 * time.Minute
+
+// txSender is the part of chain.Minter and chain.Leveler that carries a
+// signed transaction from built to mined
+type txSender interface {
+    Release(nonce uint64)
+    Send(ctx context.Context, tx *types.Transaction) error
+    Dropped(ctx context.Context, tx *types.Transaction) (bool, error)
+    BlockNumber(ctx context.Context) (uint64, error)
+}
+
+// txJob is one queued item on the path the mint and level-up workers share:
+// its transaction is built, stored, sent, then checked until it has enough
+// confirmations. Failures go to retry, with resetTx set when the stored
+// transaction can never be mined and a new one has to be built.
+type txJob struct {
+    name          string // names the item in log lines, e.g. "mint 4"
+    txName        string // names its transactions in errors, e.g. "mint transaction"
+    sender        txSender
+    confirmations uint64
+    txHash        *string
+    rawTx         []byte
+    pendingFor    time.Duration
+    record        func(txHash string, rawTx []byte) error
+    scheduleCheck func()
+    retry         func(err error, resetTx bool)
+}
+
+// submit stores and broadcasts a freshly built transaction. It is stored
+// before sending so a crash never leads to a second one; a transaction that
+// cannot be stored is never sent, so its nonce is handed back.
+func (j txJob) submit(ctx context.Context, tx *types.Transaction) {
+    rawTx, err := tx.MarshalBinary()
+    if err != nil {
+        j.sender.Release(tx.Nonce())
+        j.retry(fmt.Errorf("failed to encode transaction: %w", err), false)
+        return
+    }
+
+    if err := j.record(tx.Hash().Hex(), rawTx); err != nil {
+        j.sender.Release(tx.Nonce())
+        log.Printf("Error recording %s submission: %v", j.name, err)
+        return
+    }
+
+    if err := j.sender.Send(ctx, tx); err != nil {
+        // The stored transaction is rebroadcast when it is next checked
+        j.retry(err, false)
+        return
+    }
+
+    j.scheduleCheck()
+}
+
+// confirm moves the stored transaction on given its receipt, nil while it is
+// pending. It reports true once the transaction succeeded and has enough
+// confirmations; every other outcome is handled here.
+func (j txJob) confirm(ctx context.Context, receipt *chain.TxReceipt) bool {
+    txHash := common.HexToHash(*j.txHash)
+
+    if receipt == nil {
+        var tx types.Transaction
+        if err := tx.UnmarshalBinary(j.rawTx); err != nil {
+            j.retry(fmt.Errorf("stored %s %s is unreadable: %w", j.txName, txHash.Hex(), err), false)
+            return false
+        }
+
+        if j.pendingFor >= txDropTimeout {
+            dropped, err := j.sender.Dropped(ctx, &tx)
+            if err != nil {
+                j.retry(err, false)
+                return false
+            }
+            if dropped {
+                j.retry(fmt.Errorf("%s %s was dropped", j.txName, txHash.Hex()), true)
+                return false
+            }
+        }
+
+        // Still pending, or dropped from this node's mempool only; rebroadcasting the same signed transaction is safe
+        if err := j.sender.Send(ctx, &tx); err != nil {
+            log.Printf("Error rebroadcasting %s: %v", j.name, err)
+        }
+        if j.pendingFor >= txDropTimeout {
+            // Count a transaction that stays stuck, so it ends up failed for
+            // manual follow-up instead of being checked forever
+            j.retry(fmt.Errorf("%s %s still pending after %s", j.txName, txHash.Hex(), j.pendingFor.Round(time.Second)), false)
+            return false
+        }
+        j.scheduleCheck()
+        return false
+    }
+
+    if !receipt.Success {
+        j.retry(fmt.Errorf("%s %s reverted", j.txName, txHash.Hex()), true)
+        return false
+    }
+
+    head, err := j.sender.BlockNumber(ctx)
+    if err != nil {
+        j.retry(err, false)
+        return false
+    }
+    if head < receipt.BlockNumber || head-receipt.BlockNumber+1 < j.confirmations {
+        j.scheduleCheck()
+        return false
+    }
+
+    return true
+}
@@ -3,6 +3,7 @@ import { TamaguiProvider } from 'tamagui';
 import { BrowserRouter as Router, Routes, Route } from 'react-router-dom';
 import tamaguiConfig from './tamagui.config';
 import './assets/fonts/fonts.css';
+import { logout } from './auth';
 // Importing pages
 import HomePage from './pages/Home/home';
 import Login from './pages/Profile/login';
@@ -19,6 +20,7 @@ import ReleaseForm from './pages/Profile/releaseform';
 import ReviewReleaseRequests from './pages/Profile/reviewreleaserequest';
 import KYC from './pages/Profile/kyc';
 import KYCReview from './pages/Profile/kycreview';
+import Transactions from './pages/Profile/transactions';
 import { Stack } from 'tamagui';
 
 // Import Particle Background
@@ -27,9 +29,9 @@ import ParticlesBackground from './ParticlesBackground';
 const App: React.FC = () => {
   const [isAuthenticated, setIsAuthenticated] = useState<boolean>(!!localStorage.getItem('authToken'));
 
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    await logout();
     setIsAuthenticated(false);
-    localStorage.removeItem('authToken');
     window.location.href = 'http://localhost:5173/pages/Profile/login';
   };
 
@@ -60,6 +62,7 @@ const App: React.FC = () => {
               <Route path="/pages/Profile/logout" element={<Logout />} />
               <Route path="/kyc" element={<KYC/>}/>
               <Route path="/review_kyc" element={<KYCReview/>}/>
+              <Route path="/transactions" element={<Transactions/>}/>
             </Routes>
           </Stack>
         </div>
@@ -0,0 +1,67 @@
+import axios, { AxiosError, InternalAxiosRequestConfig } from 'axios';
+
+const API_URL = 'http://localhost:3000';
+
+type RetriableRequest = InternalAxiosRequestConfig & { _retried?: boolean };
+
+export const storeSession = (token: string, refreshToken: string) => {
+  localStorage.setItem('authToken', token);
+  localStorage.setItem('refreshToken', refreshToken);
+};
+
+export const clearSession = () => {
+  localStorage.removeItem('authToken');
+  localStorage.removeItem('refreshToken');
+};
+
+// Revoke the session server-side before dropping the tokens locally
+export const logout = async (allDevices = false) => {
+  const token = localStorage.getItem('authToken');
+  if (token) {
+    try {
+      await axios.post(`${API_URL}/api/${allDevices ? 'logout_all' : 'logout'}`, {}, {
+        headers: { Authorization: `Bearer ${token}` },
+      });
+    } catch {
+      // The session may already be expired or revoked; clear it locally regardless
+    }
+  }
+  clearSession();
+};
+
+let refreshing: Promise<string | null> | null = null;
+
+const refreshAccessToken = async (): Promise<string | null> => {
+  const refreshToken = localStorage.getItem('refreshToken');
+  if (!refreshToken) {
+    return null;
+  }
+
+  try {
+    const response = await axios.post(`${API_URL}/api/token/refresh`, { refresh_token: refreshToken });
+    storeSession(response.data.token, response.data.refresh_token);
+    return response.data.token;
+  } catch {
+    clearSession();
+    return null;
+  }
+};
+
+// Retry requests that fail with 401 once, after rotating the refresh token.
+// Concurrent failures share a single refresh so the token is only rotated once.
+axios.interceptors.response.use(undefined, async (error: AxiosError) => {
+  const request = error.config as RetriableRequest | undefined;
+  if (!request || request._retried || error.response?.status !== 401 || request.url?.endsWith('/api/token/refresh')) {
+    return Promise.reject(error);
+  }
+
+  refreshing = refreshing ?? refreshAccessToken().finally(() => { refreshing = null; });
+  const token = await refreshing;
+  if (!token) {
+    return Promise.reject(error);
+  }
+
+  request._retried = true;
+  request.headers.Authorization = `Bearer ${token}`;
+  return axios(request);
+});
@@ -10,8 +10,9 @@ interface CreateNewListingProps {
 const CreateNewListing: React.FC<CreateNewListingProps> = ({ onAddListing }) => {
   const [showCreateListingModal, setShowCreateListingModal] = useState(false);
   const [newListing, setNewListing] = useState({
-    nftId: "",
-    sellerAddress: "",
+    contractAddress: "",
+    tokenId: "",
+    releaseName: "",
     price: "",
   });
 
@@ -21,10 +22,12 @@ const CreateNewListing: React.FC<CreateNewListingProps> = ({ onAddListing }) =>
         method: "POST",
         headers: {
           "Content-Type": "application/json",
+          Authorization: `Bearer ${localStorage.getItem("authToken")}`,
         },
         body: JSON.stringify({
-          nftId: newListing.nftId,
-          sellerAddress: newListing.sellerAddress,
+          contract_address: newListing.contractAddress,
+          token_id: newListing.tokenId,
+          release_name: newListing.releaseName,
           price: parseFloat(newListing.price),
         }),
       });
@@ -32,7 +35,7 @@ const CreateNewListing: React.FC<CreateNewListingProps> = ({ onAddListing }) =>
       if (response.ok) {
         alert("Listing created successfully!");
         setShowCreateListingModal(false);
-        setNewListing({ nftId: "", sellerAddress: "", price: "" }); // Reset form
+        setNewListing({ contractAddress: "", tokenId: "", releaseName: "", price: "" }); // Reset form
 
         // Call onAddListing to refresh the marketplace listings in the parent component
         if (onAddListing) {
@@ -85,16 +88,23 @@ const CreateNewListing: React.FC<CreateNewListingProps> = ({ onAddListing }) =>
               Create New Listing
             </Text>
             <Input
-              placeholder="NFT ID"
-              value={newListing.nftId}
-              onChangeText={(text) => setNewListing({ ...newListing, nftId: text })}
+              placeholder="Contract Address"
+              value={newListing.contractAddress}
+              onChangeText={(text) => setNewListing({ ...newListing, contractAddress: text })}
               borderColor="#6A1B9A"
               marginBottom="$4"
             />
             <Input
-              placeholder="Seller Address"
-              value={newListing.sellerAddress}
-              onChangeText={(text) => setNewListing({ ...newListing, sellerAddress: text })}
+              placeholder="Token ID"
+              value={newListing.tokenId}
+              onChangeText={(text) => setNewListing({ ...newListing, tokenId: text })}
+              borderColor="#6A1B9A"
+              marginBottom="$4"
+            />
+            <Input
+              placeholder="Release Name"
+              value={newListing.releaseName}
+              onChangeText={(text) => setNewListing({ ...newListing, releaseName: text })}
               borderColor="#6A1B9A"
               marginBottom="$4"
             />
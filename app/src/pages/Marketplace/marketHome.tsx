@@ -15,6 +15,7 @@ type MarketListingType = {
   price: number;
   listed_at: string;
   image_url: string;
+  level: number;
 };
 
 const MarketHome: React.FC = () => {
@@ -32,8 +33,7 @@ const MarketHome: React.FC = () => {
       if (!response.ok) throw new Error("Failed to fetch listings");
 
       const data = await response.json();
-      console.log(data)
-      setMarketListings(data);
+      setMarketListings(data.listings);
     } catch (error) {
       console.error("Error fetching market listings:", error);
     }
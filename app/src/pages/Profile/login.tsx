@@ -2,6 +2,7 @@ import React, { useState } from 'react';
 import axios from 'axios';
 import { useNavigate } from 'react-router-dom';
 import { YStack, Input, Text, Button, Card } from 'tamagui';
+import { storeSession } from '../../auth';
 
 interface LoginProps {
   setIsAuthenticated: (auth: boolean) => void;
@@ -21,8 +22,8 @@ const Login: React.FC<LoginProps> = ({ setIsAuthenticated }) => {
       });
 
       if (response.status === 200) {
-        // Store the token in local storage
-        localStorage.setItem('authToken', response.data.token);
+        // Store the access and refresh tokens in local storage
+        storeSession(response.data.token, response.data.refresh_token);
         setIsAuthenticated(true);
         navigate('/');
       }
@@ -1,14 +1,16 @@
 import React, { useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
+import { logout } from '../../auth';
 
 const Logout: React.FC = () => {
   const navigate = useNavigate();
 
   useEffect(() => {
-    // Clear the token and redirect to login
-    localStorage.removeItem('authToken');
-    navigate('/pages/Profile/login');
-    window.location.href = 'http://localhost:5173/pages/Profile/login';
+    // Revoke the session, clear the tokens and redirect to login
+    logout().then(() => {
+      navigate('/pages/Profile/login');
+      window.location.href = 'http://localhost:5173/pages/Profile/login';
+    });
   }, [navigate]);
 
   return null;
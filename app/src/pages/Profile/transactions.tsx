@@ -0,0 +1,101 @@
+import React, { useEffect, useState } from 'react';
+import axios from 'axios';
+import { Text, Button, YStack, XStack, Card } from 'tamagui';
+
+interface LedgerItem {
+  kind: 'token' | 'currency';
+  contract_address?: string;
+  token_id?: string;
+  quantity?: number;
+  currency?: string;
+  amount?: string;
+}
+
+interface Transaction {
+  transaction_id: string;
+  transaction_type: string;
+  items_sent: LedgerItem[];
+  items_received: LedgerItem[];
+  notes: string;
+  status: string;
+  tx_hash: string | null;
+  created_at: string;
+}
+
+const PAGE_SIZE = 20;
+
+const describeItem = (item: LedgerItem) =>
+  item.kind === 'currency'
+    ? `${item.amount} ${item.currency}`
+    : `${item.quantity ?? 1} x token #${item.token_id}`;
+
+const Transactions: React.FC = () => {
+  const [transactions, setTransactions] = useState<Transaction[]>([]);
+  const [total, setTotal] = useState(0);
+  const [offset, setOffset] = useState(0);
+  const [error, setError] = useState<string | null>(null);
+
+  useEffect(() => {
+    const fetchTransactions = async () => {
+      try {
+        const token = localStorage.getItem('authToken');
+        const response = await axios.get('http://localhost:3000/api/account/transactions', {
+          headers: {
+            Authorization: `Bearer ${token}`,
+          },
+          params: { limit: PAGE_SIZE, offset },
+        });
+        setTransactions(response.data.transactions || []);
+        setTotal(response.data.total || 0);
+      } catch (err) {
+        console.error('Failed to fetch transactions', err);
+        setError('Failed to fetch transactions.');
+      }
+    };
+
+    fetchTransactions();
+  }, [offset]);
+
+  return (
+    <YStack alignItems="center" justifyContent="center" padding="$4">
+      <Text fontSize="$7" color="#6A1B9A" fontWeight="bold" marginBottom="$4">
+        Transaction History
+      </Text>
+
+      {error && <Text color="red">{error}</Text>}
+      {!error && transactions.length === 0 && <Text color="#6A1B9A">No transactions yet.</Text>}
+
+      <YStack gap="$3" width="100%" maxWidth="900px">
+        {transactions.map((transaction) => (
+          <Card key={transaction.transaction_id} padding="$4" backgroundColor="#F8EAF6" borderRadius="$4">
+            <XStack justifyContent="space-between">
+              <Text fontWeight="bold" color="#6A1B9A">
+                {transaction.transaction_type}
+              </Text>
+              <Text color="#6A1B9A">{transaction.status}</Text>
+            </XStack>
+            <Text>Sent: {transaction.items_sent.map(describeItem).join(', ') || '-'}</Text>
+            <Text>Received: {transaction.items_received.map(describeItem).join(', ') || '-'}</Text>
+            {transaction.notes && <Text>{transaction.notes}</Text>}
+            {transaction.tx_hash && <Text fontSize="$2">Tx: {transaction.tx_hash}</Text>}
+            <Text fontSize="$2">{new Date(transaction.created_at).toLocaleString()}</Text>
+          </Card>
+        ))}
+      </YStack>
+
+      <XStack gap="$4" marginTop="$4" alignItems="center">
+        <Button disabled={offset === 0} onPress={() => setOffset(Math.max(0, offset - PAGE_SIZE))}>
+          Previous
+        </Button>
+        <Text>
+          {total === 0 ? 0 : offset + 1}-{Math.min(offset + PAGE_SIZE, total)} of {total}
+        </Text>
+        <Button disabled={offset + PAGE_SIZE >= total} onPress={() => setOffset(offset + PAGE_SIZE)}>
+          Next
+        </Button>
+      </XStack>
+    </YStack>
+  );
+};
+
+export default Transactions;